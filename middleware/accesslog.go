@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Redaction modes for phone numbers in access logs
+const (
+	RedactHash  = "hash"
+	RedactLast4 = "last4"
+)
+
+var (
+	// accessLog writes REST access entries, kept apart from the call event log
+	accessLog = log.New(os.Stdout, "", 0)
+
+	// secretParams are always fully masked
+	secretParams = []string{"token", "signature", "secret", "password", "auth", "key"}
+
+	// phoneParams carry phone numbers and are hashed or truncated
+	phoneParams = []string{"from", "to", "caller", "called", "phone", "number", "forwardedfrom"}
+
+	// hashKey keys phone fingerprints so they cannot be reversed by hashing
+	// every possible number
+	hashKey = sync.OnceValue(loadHashKey)
+)
+
+// accessLogConfig holds redaction settings for the access logger
+type accessLogConfig struct {
+	phoneMode   string
+	extraSecret []string
+}
+
+// loadAccessLogConfig reads redaction settings from the environment
+func loadAccessLogConfig() accessLogConfig {
+	mode := strings.ToLower(getEnv("ACCESS_LOG_PHONE_REDACTION", RedactHash))
+	if mode != RedactHash && mode != RedactLast4 {
+		log.Printf("Unknown ACCESS_LOG_PHONE_REDACTION %q, falling back to %s\n", mode, RedactHash)
+		mode = RedactHash
+	}
+	var extra []string
+	for _, k := range getEnvList("ACCESS_LOG_REDACT_PARAMS") {
+		extra = append(extra, strings.ToLower(k))
+	}
+	return accessLogConfig{phoneMode: mode, extraSecret: extra}
+}
+
+// accessLogger returns a middleware that writes one JSON line per HTTP request
+func accessLogger() gin.HandlerFunc {
+	cfg := loadAccessLogConfig()
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		entry := map[string]interface{}{
+			"log":        "access",
+			"time":       start.UTC().Format(time.RFC3339Nano),
+			"method":     c.Request.Method,
+			"path":       cfg.redactPath(c.Request.URL.Path),
+			"status":     c.Writer.Status(),
+			"latency_ms": time.Since(start).Milliseconds(),
+			"client_ip":  c.ClientIP(),
+			"bytes_out":  c.Writer.Size(),
+		}
+		if q := c.Request.URL.Query(); len(q) > 0 {
+			entry["query"] = cfg.redactValues(q)
+		}
+		// Only log form values the handler already parsed; never consume the body here
+		if c.Request.PostForm != nil && len(c.Request.PostForm) > 0 {
+			entry["form"] = cfg.redactValues(c.Request.PostForm)
+		}
+		if c.GetHeader("Authorization") != "" {
+			entry["auth"] = "present"
+		}
+		if c.GetHeader("X-Twilio-Signature") != "" {
+			entry["twilio_signature"] = "present"
+		}
+		if len(c.Errors) > 0 {
+			entry["errors"] = c.Errors.String()
+		}
+
+		data, err := json.Marshal(entry)
+		if err != nil {
+			log.Println("Error marshaling access log entry:", err)
+			return
+		}
+		accessLog.Println(string(data))
+	}
+}
+
+// redactValues returns a copy of the values with secrets and phone parameters redacted
+func (cfg accessLogConfig) redactValues(values url.Values) map[string]string {
+	out := make(map[string]string, len(values))
+	for k, v := range values {
+		value := strings.Join(v, ",")
+		lower := strings.ToLower(k)
+		switch {
+		case cfg.isSecret(lower):
+			out[k] = "[REDACTED]"
+		case isPhoneParam(lower):
+			out[k] = cfg.redactPhone(value)
+		default:
+			out[k] = value
+		}
+	}
+	return out
+}
+
+// redactPath masks the path segments that are E.164 phone numbers, such as
+// /admin/dnc/+14155550100; IDs and timestamps are left alone
+func (cfg accessLogConfig) redactPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, "+") {
+			continue
+		}
+		if parsed, err := parseNumber(segment); err == nil && parsed.E164 == segment {
+			segments[i] = cfg.redactPhone(segment)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// redactPhone hashes a phone number or keeps only its last four digits
+func (cfg accessLogConfig) redactPhone(phone string) string {
+	if phone == "" {
+		return ""
+	}
+	if cfg.phoneMode == RedactLast4 {
+		if len(phone) <= 4 {
+			return "***"
+		}
+		return "***" + phone[len(phone)-4:]
+	}
+	return hashValue(phone)
+}
+
+// isSecret reports whether a lowercased parameter name holds a secret
+func (cfg accessLogConfig) isSecret(name string) bool {
+	return matchesAny(name, secretParams) || matchesAny(name, cfg.extraSecret)
+}
+
+// isPhoneParam reports whether a lowercased parameter name carries a phone number
+func isPhoneParam(name string) bool {
+	for _, p := range phoneParams {
+		if name == p {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAny reports whether name contains any of the given fragments
+func matchesAny(name string, fragments []string) bool {
+	for _, f := range fragments {
+		if strings.Contains(name, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// hashValue returns a short, stable HMAC-SHA256 fingerprint of a value
+func hashValue(value string) string {
+	mac := hmac.New(sha256.New, hashKey())
+	mac.Write([]byte(value))
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// loadHashKey reads HASH_KEY, falling back to a random key generated once
+// and kept in DATA_DIR so fingerprints stay stable across restarts. Instances
+// sharing logs or storage should set the same HASH_KEY
+func loadHashKey() []byte {
+	if key := os.Getenv("HASH_KEY"); key != "" {
+		return []byte(key)
+	}
+	path := dataPath("hash.key")
+	if key, err := os.ReadFile(path); err == nil && len(key) > 0 {
+		return key
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		log.Fatal("Error generating a hash key: ", err)
+	}
+	key := []byte(hex.EncodeToString(raw))
+	if err := os.WriteFile(path, key, 0o600); err != nil {
+		log.Println("Error saving the generated hash key:", err)
+	}
+	log.Println("HASH_KEY is not set; using a key generated in", path)
+	return key
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requireAdmin rejects requests without the ADMIN_TOKEN bearer token; the
+// admin API is disabled entirely when no token is configured
+func requireAdmin() gin.HandlerFunc {
+	token := getEnv("ADMIN_TOKEN", "")
+	return func(c *gin.Context) {
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "admin API disabled: ADMIN_TOKEN not set"})
+			return
+		}
+		provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.Set(auditActorKey, "admin")
+		c.Next()
+	}
+}
+
+// parseTimeParam reads an RFC 3339 timestamp or YYYY-MM-DD date query parameter
+func parseTimeParam(c *gin.Context, name string) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// callFilterFromQuery builds a call filter from the tenant, agent, caller,
+// disposition, from, to, since and canary parameters
+func callFilterFromQuery(c *gin.Context) (CallFilter, error) {
+	from, err := parseTimeParam(c, "from")
+	if err != nil {
+		return CallFilter{}, err
+	}
+	if since := c.Query("since"); since != "" {
+		window, err := parseSince(since)
+		if err != nil {
+			return CallFilter{}, err
+		}
+		from = time.Now().Add(-window)
+	}
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		return CallFilter{}, err
+	}
+	return CallFilter{
+		Tenant:      c.Query("tenant"),
+		Agent:       c.Query("agent"),
+		Caller:      c.Query("caller"),
+		Disposition: c.Query("disposition"),
+		From:        from,
+		To:          to,
+		Canary:      c.Query("canary") == "true",
+	}, nil
+}
+
+// parseSince reads a lookback window such as 36h or 7d
+func parseSince(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid since %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
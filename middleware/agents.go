@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultAgentID names the built-in agent defined by the VOICE and SYSTEM_MESSAGE constants
+const DefaultAgentID = "default"
+
+// Agent defines the persona shared by voice calls and text conversations
+type Agent struct {
+	ID           string  `json:"id"`
+	Name         string  `json:"name"`
+	Instructions string  `json:"instructions"`
+	Voice        string  `json:"voice"`
+	Temperature  float64 `json:"temperature"`
+	TextModel    string  `json:"text_model"`
+
+	// LocalizedInstructions replace Instructions for callers in a given
+	// language, keyed by full tag ("es-MX") or base language ("es")
+	LocalizedInstructions map[string]string `json:"localized_instructions,omitempty"`
+
+	// Taxonomy lists the intent and disposition codes calls are tagged with
+	Taxonomy *IntentTaxonomy `json:"taxonomy,omitempty"`
+
+	// Escalation overrides the default escalation signals and actions
+	Escalation *EscalationPolicy `json:"escalation,omitempty"`
+
+	// Policy controls how the agent recovers from repeated failed turns
+	Policy *ConversationPolicy `json:"conversation_policy,omitempty"`
+
+	// DTMFMenu is the keypad menu used on noisy lines or as a fallback
+	DTMFMenu *DTMFMenu `json:"dtmf_menu,omitempty"`
+
+	// QA controls which calls are sampled for human review
+	QA *QASampling `json:"qa,omitempty"`
+
+	// Rubric is the checklist completed calls are scored against automatically
+	Rubric []RubricCriterion `json:"rubric,omitempty"`
+
+	// Assets are recorded clips played instead of synthesized prompts
+	Assets *AgentAssets `json:"assets,omitempty"`
+
+	// Vocabulary lists domain terms (product names, SKUs, place names) the
+	// transcription and the model should recognize
+	Vocabulary []string `json:"vocabulary,omitempty"`
+
+	// Pronunciations map terms to how they should be spoken
+	Pronunciations map[string]string `json:"pronunciations,omitempty"`
+
+	// VoiceVerification checks the caller's voice and gates tools on a match
+	VoiceVerification *VoiceVerification `json:"voice_verification,omitempty"`
+
+	// Capture lists structured details the agent collects and confirms by
+	// reading them back
+	Capture []CaptureField `json:"capture,omitempty"`
+
+	// Assist makes the agent a co-pilot: it drafts replies as text for a
+	// human agent, streamed to /calls/:id/copilot, instead of speaking
+	Assist bool `json:"assist,omitempty"`
+
+	// Budget downgrades new calls to a cheaper model while the agent's
+	// recent calls cost too much or answer too slowly
+	Budget *AgentBudget `json:"budget,omitempty"`
+
+	// Whisper puts callers in a conference with a human agent; the model
+	// only listens, whispering translations or suggestions to the human
+	Whisper *WhisperConfig `json:"whisper,omitempty"`
+}
+
+// AgentRegistry looks up agent definitions by ID
+type AgentRegistry struct {
+	sync.RWMutex
+	agents map[string]*Agent
+
+	// managed holds agents declared through the admin API exactly as
+	// declared, before defaults; they are saved to DATA_DIR
+	path    string
+	managed map[string]Agent
+	inFile  map[string]bool
+}
+
+// loadAgents reads agents from AGENTS_FILE, then the agents declared through
+// the admin API, and always provides the default agent
+func loadAgents() *AgentRegistry {
+	var list []*Agent
+	if _, err := loadJSONFile("AGENTS_FILE", &list); err != nil {
+		log.Println("Error loading AGENTS_FILE:", err)
+	}
+	r := &AgentRegistry{
+		agents:  make(map[string]*Agent),
+		path:    dataPath("agents.json"),
+		managed: make(map[string]Agent),
+		inFile:  make(map[string]bool),
+	}
+	for _, a := range list {
+		if a.ID == "" {
+			log.Println("Skipping agent without id")
+			continue
+		}
+		applyAgentDefaults(a)
+		r.agents[a.ID] = a
+		r.inFile[a.ID] = true
+	}
+	var saved []Agent
+	if err := readJSONFile(r.path, &saved); err != nil {
+		log.Println("Error loading saved agents:", err)
+	}
+	for _, spec := range saved {
+		if spec.ID == "" || r.inFile[spec.ID] {
+			continue
+		}
+		r.managed[spec.ID] = spec
+		effective := spec
+		r.agents[spec.ID] = applyAgentDefaults(&effective)
+	}
+	if _, ok := r.agents[DefaultAgentID]; !ok {
+		r.agents[DefaultAgentID] = applyAgentDefaults(&Agent{ID: DefaultAgentID, Name: "Default"})
+	}
+	log.Printf("Loaded %d agent(s)\n", len(r.agents))
+	return r
+}
+
+// applyAgentDefaults fills unset fields from the built-in agent
+func applyAgentDefaults(a *Agent) *Agent {
+	if a.Instructions == "" {
+		a.Instructions = SYSTEM_MESSAGE
+	}
+	if a.Voice == "" {
+		a.Voice = VOICE
+	}
+	if a.Temperature == 0 {
+		a.Temperature = 0.8
+	}
+	if a.TextModel == "" {
+		a.TextModel = getEnv("TEXT_MODEL", "gpt-4o-mini")
+	}
+	return a
+}
+
+// instructionsFor returns the agent's instructions for a language tag
+func (a *Agent) instructionsFor(language string) string {
+	if text, ok := a.LocalizedInstructions[language]; ok {
+		return text
+	}
+	base, _, _ := strings.Cut(language, "-")
+	if text, ok := a.LocalizedInstructions[base]; ok {
+		return text
+	}
+	return a.Instructions
+}
+
+// get returns the agent with the given ID, falling back to the default agent
+func (r *AgentRegistry) get(id string) *Agent {
+	r.RLock()
+	defer r.RUnlock()
+	if a, ok := r.agents[id]; ok {
+		return a
+	}
+	return r.agents[DefaultAgentID]
+}
+
+// exists reports whether an agent is defined, without the default fallback
+func (r *AgentRegistry) exists(id string) bool {
+	r.RLock()
+	defer r.RUnlock()
+	_, ok := r.agents[id]
+	return ok
+}
+
+// spec returns an agent as declared: managed agents before defaults, others
+// as loaded
+func (r *AgentRegistry) spec(id string) (Agent, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	if spec, ok := r.managed[id]; ok {
+		return spec, true
+	}
+	if a, ok := r.agents[id]; ok {
+		return *a, true
+	}
+	return Agent{}, false
+}
+
+// specs returns every agent as declared, sorted by ID
+func (r *AgentRegistry) specs() []Agent {
+	r.RLock()
+	ids := make([]string, 0, len(r.agents))
+	for id := range r.agents {
+		ids = append(ids, id)
+	}
+	r.RUnlock()
+	sort.Strings(ids)
+	list := make([]Agent, 0, len(ids))
+	for _, id := range ids {
+		if spec, ok := r.spec(id); ok {
+			list = append(list, spec)
+		}
+	}
+	return list
+}
+
+// plan reports what putting the spec would do
+func (r *AgentRegistry) plan(spec Agent) (string, error) {
+	r.RLock()
+	defer r.RUnlock()
+	return r.planLocked(spec)
+}
+
+// planLocked is plan with the registry locked
+func (r *AgentRegistry) planLocked(spec Agent) (string, error) {
+	if r.inFile[spec.ID] {
+		return "", fmt.Errorf("agent %s is defined in AGENTS_FILE", spec.ID)
+	}
+	current, ok := r.managed[spec.ID]
+	return changeAction(ok, current, spec), nil
+}
+
+// put creates or replaces a managed agent; calls in progress keep the
+// definition they started with
+func (r *AgentRegistry) put(spec Agent) (string, error) {
+	r.Lock()
+	action, err := r.planLocked(spec)
+	if err != nil || action == ChangeUnchanged {
+		r.Unlock()
+		return action, err
+	}
+	effective := spec
+	r.managed[spec.ID] = spec
+	r.agents[spec.ID] = applyAgentDefaults(&effective)
+	r.Unlock()
+	return action, r.save()
+}
+
+// remove deletes a managed agent; the default agent reverts to the built-in one
+func (r *AgentRegistry) remove(id string) (bool, error) {
+	r.Lock()
+	_, ok := r.managed[id]
+	delete(r.managed, id)
+	if ok {
+		delete(r.agents, id)
+		if id == DefaultAgentID {
+			r.agents[id] = applyAgentDefaults(&Agent{ID: DefaultAgentID, Name: "Default"})
+		}
+	}
+	r.Unlock()
+	if !ok {
+		return false, nil
+	}
+	return true, r.save()
+}
+
+// managedIDs returns the IDs of agents declared through the admin API
+func (r *AgentRegistry) managedIDs() []string {
+	r.RLock()
+	defer r.RUnlock()
+	ids := make([]string, 0, len(r.managed))
+	for id := range r.managed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// save writes the managed agents to DATA_DIR
+func (r *AgentRegistry) save() error {
+	r.RLock()
+	list := make([]Agent, 0, len(r.managed))
+	for _, spec := range r.managed {
+		list = append(list, spec)
+	}
+	r.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return writeJSONFile(r.path, list)
+}
+
+// agentFor returns the agent configured for a tenant
+func agentFor(tenant *Tenant) *Agent {
+	if tenant == nil {
+		return agents.get(DefaultAgentID)
+	}
+	return agents.get(tenant.AgentID)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Alert kinds raised by the anomaly detector
+const (
+	AlertErrorRate    = "error_rate_spike"
+	AlertDialFailures = "openai_dial_failures"
+	AlertCallDuration = "abnormal_call_duration"
+	AlertCostPerCall  = "cost_per_call_spike"
+)
+
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// Alert is a single threshold breach sent to the configured webhooks.
+// Subject names what breached it, such as a tenant, agent or rollout; the
+// call is only context, so one bad stretch does not alert once per call
+type Alert struct {
+	Kind     string    `json:"kind"`
+	Severity string    `json:"severity"`
+	Message  string    `json:"message"`
+	CallSid  string    `json:"call_sid,omitempty"`
+	Subject  string    `json:"subject,omitempty"`
+	Value    float64   `json:"value"`
+	Limit    float64   `json:"threshold"`
+	Time     time.Time `json:"time"`
+}
+
+// AlertConfig holds thresholds and destinations for anomaly alerts
+type AlertConfig struct {
+	Window          time.Duration
+	Cooldown        time.Duration
+	MinSamples      int
+	ErrorRate       float64
+	DialFailures    int
+	MaxCallDuration time.Duration
+	MaxCallCost     float64
+	CostSpikeFactor float64
+	SlackURLs       []string
+	WebhookURLs     []string
+	PagerDutyKey    string
+}
+
+// Alerter tracks call outcomes in a sliding window and dispatches alerts
+type Alerter struct {
+	sync.Mutex
+	cfg        AlertConfig
+	calls      []time.Time
+	failures   []time.Time
+	dialErrors []time.Time
+	costs      []float64
+	lastSent   map[string]time.Time
+}
+
+// loadAlertConfig reads alert thresholds from the environment
+func loadAlertConfig() AlertConfig {
+	return AlertConfig{
+		Window:          getEnvDuration("ALERT_WINDOW", 5*time.Minute),
+		Cooldown:        getEnvDuration("ALERT_COOLDOWN", 15*time.Minute),
+		MinSamples:      getEnvInt("ALERT_MIN_SAMPLES", 5),
+		ErrorRate:       getEnvFloat("ALERT_ERROR_RATE", 0.2),
+		DialFailures:    getEnvInt("ALERT_DIAL_FAILURES", 3),
+		MaxCallDuration: getEnvDuration("ALERT_MAX_CALL_DURATION", time.Hour),
+		MaxCallCost:     getEnvFloat("ALERT_MAX_CALL_COST", 5.0),
+		CostSpikeFactor: getEnvFloat("ALERT_COST_SPIKE_FACTOR", 3.0),
+		SlackURLs:       getEnvList("ALERT_SLACK_WEBHOOK_URLS"),
+		WebhookURLs:     getEnvList("ALERT_WEBHOOK_URLS"),
+		PagerDutyKey:    getEnv("ALERT_PAGERDUTY_ROUTING_KEY", ""),
+	}
+}
+
+// newAlerter creates an alerter from the given configuration
+func newAlerter(cfg AlertConfig) *Alerter {
+	return &Alerter{
+		cfg:      cfg,
+		lastSent: make(map[string]time.Time),
+	}
+}
+
+// recordDialFailure counts a failed connection attempt to OpenAI
+func (a *Alerter) recordDialFailure(err error) {
+	a.Lock()
+	now := time.Now()
+	a.dialErrors = pruneWindow(append(a.dialErrors, now), now, a.cfg.Window)
+	a.calls = pruneWindow(append(a.calls, now), now, a.cfg.Window)
+	a.failures = pruneWindow(append(a.failures, now), now, a.cfg.Window)
+	dialCount := len(a.dialErrors)
+	a.Unlock()
+
+	if a.cfg.DialFailures > 0 && dialCount >= a.cfg.DialFailures {
+		a.raise(Alert{
+			Kind:     AlertDialFailures,
+			Severity: "critical",
+			Message:  fmt.Sprintf("%d OpenAI dial failures in the last %s (latest: %v)", dialCount, a.cfg.Window, err),
+			Value:    float64(dialCount),
+			Limit:    float64(a.cfg.DialFailures),
+		})
+	}
+	a.checkErrorRate()
+}
+
+// recordCallEnd evaluates a finished call against duration, cost and error-rate thresholds
+func (a *Alerter) recordCallEnd(callSid, tenant string, duration time.Duration, cost float64, failed bool) {
+	a.Lock()
+	now := time.Now()
+	a.calls = pruneWindow(append(a.calls, now), now, a.cfg.Window)
+	if failed {
+		a.failures = pruneWindow(append(a.failures, now), now, a.cfg.Window)
+	}
+	avgCost := average(a.costs)
+	samples := len(a.costs)
+	a.costs = append(a.costs, cost)
+	if len(a.costs) > 100 {
+		a.costs = a.costs[len(a.costs)-100:]
+	}
+	a.Unlock()
+
+	if a.cfg.MaxCallDuration > 0 && duration > a.cfg.MaxCallDuration {
+		a.raise(Alert{
+			Kind:     AlertCallDuration,
+			Severity: "warning",
+			Message:  fmt.Sprintf("Call %s lasted %s", callSid, duration.Round(time.Second)),
+			CallSid:  callSid,
+			Subject:  tenant,
+			Value:    duration.Seconds(),
+			Limit:    a.cfg.MaxCallDuration.Seconds(),
+		})
+	}
+
+	var message string
+	var limit float64
+	switch {
+	case a.cfg.MaxCallCost > 0 && cost > a.cfg.MaxCallCost:
+		limit = a.cfg.MaxCallCost
+		message = fmt.Sprintf("Call %s cost $%.4f, over the $%.4f limit (recent average $%.4f)", callSid, cost, limit, avgCost)
+	case samples >= a.cfg.MinSamples && avgCost > 0 && a.cfg.CostSpikeFactor > 0 && cost > avgCost*a.cfg.CostSpikeFactor:
+		limit = avgCost * a.cfg.CostSpikeFactor
+		message = fmt.Sprintf("Call %s cost $%.4f, over %.1fx the recent average of $%.4f", callSid, cost, a.cfg.CostSpikeFactor, avgCost)
+	}
+	if message != "" {
+		a.raise(Alert{
+			Kind:     AlertCostPerCall,
+			Severity: "warning",
+			Message:  message,
+			CallSid:  callSid,
+			Subject:  tenant,
+			Value:    cost,
+			Limit:    limit,
+		})
+	}
+	a.checkErrorRate()
+}
+
+// checkErrorRate raises an alert when the failure ratio in the window crosses the threshold
+func (a *Alerter) checkErrorRate() {
+	a.Lock()
+	now := time.Now()
+	a.calls = pruneWindow(a.calls, now, a.cfg.Window)
+	a.failures = pruneWindow(a.failures, now, a.cfg.Window)
+	total, failed := len(a.calls), len(a.failures)
+	a.Unlock()
+
+	if total < a.cfg.MinSamples || a.cfg.ErrorRate <= 0 {
+		return
+	}
+	rate := float64(failed) / float64(total)
+	if rate >= a.cfg.ErrorRate {
+		a.raise(Alert{
+			Kind:     AlertErrorRate,
+			Severity: "critical",
+			Message:  fmt.Sprintf("%d of %d calls failed in the last %s", failed, total, a.cfg.Window),
+			Value:    rate,
+			Limit:    a.cfg.ErrorRate,
+		})
+	}
+}
+
+// raise sends an alert unless the same kind fired for the same subject
+// within the cooldown
+func (a *Alerter) raise(alert Alert) {
+	alert.Time = time.Now().UTC()
+
+	key := alert.key()
+	a.Lock()
+	if last, ok := a.lastSent[key]; ok && time.Since(last) < a.cfg.Cooldown {
+		a.Unlock()
+		return
+	}
+	a.lastSent[key] = time.Now()
+	for k, last := range a.lastSent {
+		if time.Since(last) >= a.cfg.Cooldown {
+			delete(a.lastSent, k)
+		}
+	}
+	a.Unlock()
+
+	log.Printf("ALERT [%s] %s\n", alert.Kind, alert.Message)
+	go a.dispatch(alert)
+}
+
+// key identifies an alert's kind and subject for the cooldown and deduplication
+func (alert Alert) key() string {
+	if alert.Subject == "" {
+		return alert.Kind
+	}
+	return alert.Kind + ":" + alert.Subject
+}
+
+// dispatch delivers an alert to every configured destination
+func (a *Alerter) dispatch(alert Alert) {
+	for _, url := range a.cfg.SlackURLs {
+		a.post(url, map[string]interface{}{
+			"text": fmt.Sprintf(":rotating_light: *%s* (%s)\n%s", alert.Kind, alert.Severity, alert.Message),
+		})
+	}
+	for _, url := range a.cfg.WebhookURLs {
+		a.post(url, alert)
+	}
+	if a.cfg.PagerDutyKey != "" {
+		a.post(pagerDutyEventsURL, map[string]interface{}{
+			"routing_key":  a.cfg.PagerDutyKey,
+			"event_action": "trigger",
+			"dedup_key":    alert.key(),
+			"payload": map[string]interface{}{
+				"summary":        alert.Message,
+				"source":         "voice-assistant-middleware",
+				"severity":       alert.Severity,
+				"custom_details": alert,
+			},
+		})
+	}
+}
+
+// post sends an alert body to a webhook URL, logging failures
+func (a *Alerter) post(url string, body interface{}) {
+	if err := postJSON(url, body, nil); err != nil {
+		log.Println("Error sending alert webhook:", err)
+	}
+}
+
+// pruneWindow drops timestamps older than the window
+func pruneWindow(times []time.Time, now time.Time, window time.Duration) []time.Time {
+	cutoff := now.Add(-window)
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+// average returns the mean of the values, or zero for an empty slice
+func average(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
@@ -0,0 +1,569 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// Kinds of audio asset
+const (
+	AssetGreeting   = "greeting"
+	AssetHold       = "hold"
+	AssetDisclosure = "disclosure"
+)
+
+// maxAssetBytes caps an uploaded source file
+const maxAssetBytes = 20 << 20
+
+// errUnsupportedWAV sends WAV encodings decodeWAV does not handle to ffmpeg
+var errUnsupportedWAV = errors.New("unsupported WAV encoding")
+
+// assetNamePattern keeps asset names safe to use in paths and URLs
+var assetNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// validAssetKind reports whether kind is one of the asset kinds
+func validAssetKind(kind string) bool {
+	return kind == AssetGreeting || kind == AssetHold || kind == AssetDisclosure
+}
+
+// AgentAssets names the audio assets an agent plays instead of synthesized speech
+type AgentAssets struct {
+	// Greeting replaces the spoken greeting before the stream connects
+	Greeting string `json:"greeting,omitempty"`
+	// Hold plays while a caller waits in the admission queue
+	Hold string `json:"hold,omitempty"`
+	// Disclosure plays to the caller as soon as the stream starts
+	Disclosure string `json:"disclosure,omitempty"`
+}
+
+// AssetVersion is one uploaded revision of an asset, stored as 8 kHz A-law
+type AssetVersion struct {
+	Version      int       `json:"version"`
+	UploadedAt   time.Time `json:"uploaded_at"`
+	SourceFormat string    `json:"source_format"`
+	SourceBytes  int       `json:"source_bytes"`
+	DurationMs   int64     `json:"duration_ms"`
+	SHA256       string    `json:"sha256"`
+
+	// Text and Voice record the prompt of a synthesized version
+	Text  string `json:"text,omitempty"`
+	Voice string `json:"voice,omitempty"`
+}
+
+// Asset is a named audio clip with its version history
+type Asset struct {
+	Name     string         `json:"name"`
+	Kind     string         `json:"kind"`
+	Current  int            `json:"current"`
+	Versions []AssetVersion `json:"versions"`
+}
+
+// AssetStore keeps audio assets under DATA_DIR/assets
+type AssetStore struct {
+	sync.RWMutex
+	path   string
+	assets map[string]*Asset
+}
+
+// newAssetStore loads the asset index
+func newAssetStore() *AssetStore {
+	s := &AssetStore{path: dataPath("assets", "index.json"), assets: make(map[string]*Asset)}
+	var list []*Asset
+	if err := readJSONFile(s.path, &list); err != nil {
+		log.Println("Error loading asset index:", err)
+	}
+	for _, asset := range list {
+		s.assets[asset.Name] = asset
+	}
+	return s
+}
+
+// audioPath is where a version's transcoded audio is kept
+func (s *AssetStore) audioPath(name string, version int) string {
+	return dataPath("assets", name, "v"+strconv.Itoa(version)+".alaw")
+}
+
+// list returns the assets sorted by name
+func (s *AssetStore) list() []Asset {
+	s.RLock()
+	defer s.RUnlock()
+	list := make([]Asset, 0, len(s.assets))
+	for _, asset := range s.assets {
+		list = append(list, *asset)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// save writes the index; the caller holds the lock
+func (s *AssetStore) save() error {
+	list := make([]*Asset, 0, len(s.assets))
+	for _, asset := range s.assets {
+		list = append(list, asset)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return writeJSONFile(s.path, list)
+}
+
+// get returns a copy of an asset
+func (s *AssetStore) get(name string) (Asset, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	asset, ok := s.assets[name]
+	if !ok {
+		return Asset{}, false
+	}
+	return *asset, true
+}
+
+// add transcodes an upload and stores it as the asset's new current version;
+// origin carries any details of where the audio came from
+func (s *AssetStore) add(name, kind, contentType string, source []byte, origin AssetVersion) (Asset, error) {
+	audio, format, err := transcodeToAlaw(source, contentType)
+	if err != nil {
+		return Asset{}, err
+	}
+	sum := sha256.Sum256(audio)
+
+	s.Lock()
+	defer s.Unlock()
+	asset, ok := s.assets[name]
+	if !ok {
+		asset = &Asset{Name: name, Kind: kind}
+	} else if kind != "" {
+		asset.Kind = kind
+	}
+	version := origin
+	version.Version = len(asset.Versions) + 1
+	version.UploadedAt = time.Now().UTC()
+	version.SourceFormat = format
+	version.SourceBytes = len(source)
+	version.DurationMs = int64(len(audio) / bytesPerMs)
+	version.SHA256 = hex.EncodeToString(sum[:])
+	if err := os.WriteFile(s.audioPath(name, version.Version), audio, 0o600); err != nil {
+		return Asset{}, err
+	}
+	asset.Versions = append(asset.Versions, version)
+	asset.Current = version.Version
+	s.assets[name] = asset
+	return *asset, s.save()
+}
+
+// setCurrent points an asset at an earlier or later version
+func (s *AssetStore) setCurrent(name string, version int) (Asset, error) {
+	s.Lock()
+	defer s.Unlock()
+	asset, ok := s.assets[name]
+	if !ok {
+		return Asset{}, fmt.Errorf("asset %q not found", name)
+	}
+	if version < 1 || version > len(asset.Versions) {
+		return Asset{}, fmt.Errorf("asset %q has no version %d", name, version)
+	}
+	asset.Current = version
+	return *asset, s.save()
+}
+
+// remove deletes an asset and all of its versions
+func (s *AssetStore) remove(name string) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.assets[name]; !ok {
+		return false, nil
+	}
+	delete(s.assets, name)
+	os.RemoveAll(dataDir("assets", name))
+	return true, s.save()
+}
+
+// audio returns a version of an asset as A-law; version 0 is the current one
+func (s *AssetStore) audio(name string, version int) ([]byte, int, error) {
+	asset, ok := s.get(name)
+	if !ok {
+		return nil, 0, fmt.Errorf("asset %q not found", name)
+	}
+	if version == 0 {
+		version = asset.Current
+	}
+	if version < 1 || version > len(asset.Versions) {
+		return nil, 0, fmt.Errorf("asset %q has no version %d", name, version)
+	}
+	data, err := os.ReadFile(s.audioPath(name, version))
+	return data, version, err
+}
+
+// url returns the link Twilio fetches an asset's current version from. The
+// link carries the audio's hash as well as the version, since an asset that
+// is deleted and uploaded again starts over at version 1
+func (s *AssetStore) url(host, name string) string {
+	asset, ok := s.get(name)
+	if !ok {
+		return ""
+	}
+	base := strings.TrimRight(getEnv("PUBLIC_BASE_URL", ""), "/")
+	if base == "" {
+		base = "https://" + host
+	}
+	return fmt.Sprintf("%s/assets/%s/%s.wav", base, name, asset.Versions[asset.Current-1].file())
+}
+
+// file names a version's audio in asset links, such as v3-1a2b3c4d5e6f
+func (v AssetVersion) file() string {
+	return fmt.Sprintf("v%d-%.12s", v.Version, v.SHA256)
+}
+
+// playVerb renders a <Play> for an asset, or "" when it does not exist
+func (s *AssetStore) playVerb(host, name string) string {
+	if name == "" {
+		return ""
+	}
+	link := s.url(host, name)
+	if link == "" {
+		log.Printf("Audio asset %q is not uploaded; falling back to speech\n", name)
+		return ""
+	}
+	return "<Play>" + html.EscapeString(link) + "</Play>"
+}
+
+// agentAsset renders the <Play> for one of an agent's assets by kind
+func agentAsset(c *gin.Context, agent *Agent, kind string) string {
+	if agent.Assets == nil {
+		return ""
+	}
+	name := map[string]string{
+		AssetGreeting:   agent.Assets.Greeting,
+		AssetHold:       agent.Assets.Hold,
+		AssetDisclosure: agent.Assets.Disclosure,
+	}[kind]
+	return assets.playVerb(c.Request.Host, name)
+}
+
+// transcodeToAlaw converts an upload to 8 kHz mono A-law. WAV files are
+// decoded here; anything else, such as MP3, goes through ffmpeg
+func transcodeToAlaw(source []byte, contentType string) ([]byte, string, error) {
+	switch {
+	case contentType == "audio/x-alaw-basic" || contentType == "audio/alaw":
+		return source, "alaw", nil
+	case bytes.HasPrefix(source, []byte("RIFF")) && len(source) > 12 && string(source[8:12]) == "WAVE":
+		pcm, rate, err := decodeWAV(source)
+		if err == nil {
+			return encodeAlaw(resample(pcm, rate, bytesPerSecond)), "wav", nil
+		}
+		if !errors.Is(err, errUnsupportedWAV) {
+			return nil, "", err
+		}
+	}
+	audio, err := ffmpegToAlaw(source)
+	return audio, "ffmpeg", err
+}
+
+// decodeWAV reads a PCM, float or G.711 WAV file and mixes it down to mono
+func decodeWAV(data []byte) ([]int16, int, error) {
+	var format, channels, bits uint16
+	var rate uint32
+	var samples []byte
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := data[pos+8:]
+		if size > len(body) {
+			size = len(body)
+		}
+		body = body[:size]
+		switch id {
+		case "fmt ":
+			if len(body) < 16 {
+				return nil, 0, fmt.Errorf("short WAV format chunk")
+			}
+			format = binary.LittleEndian.Uint16(body[0:2])
+			channels = binary.LittleEndian.Uint16(body[2:4])
+			rate = binary.LittleEndian.Uint32(body[4:8])
+			bits = binary.LittleEndian.Uint16(body[14:16])
+			// WAVE_FORMAT_EXTENSIBLE carries the real format in its sub-format GUID
+			if format == 0xfffe && len(body) >= 26 {
+				format = binary.LittleEndian.Uint16(body[24:26])
+			}
+		case "data":
+			samples = body
+		}
+		pos += 8 + size + size%2
+	}
+	if channels == 0 || rate == 0 || samples == nil {
+		return nil, 0, fmt.Errorf("WAV file has no audio")
+	}
+
+	var decode func([]byte) float64
+	width := int(bits) / 8
+	switch {
+	case format == 1 && bits == 8:
+		decode = func(b []byte) float64 { return (float64(b[0]) - 128) / 128 }
+	case format == 1 && bits == 16:
+		decode = func(b []byte) float64 { return float64(int16(binary.LittleEndian.Uint16(b))) / 32768 }
+	case format == 1 && bits == 24:
+		decode = func(b []byte) float64 {
+			return float64(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24)>>8) / 8388608
+		}
+	case format == 3 && bits == 32:
+		decode = func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }
+	case format == 6 && bits == 8:
+		decode = func(b []byte) float64 { return float64(alawToLinear(b[0])) / 32768 }
+	case format == 7 && bits == 8:
+		decode = func(b []byte) float64 { return float64(ulawToLinear(b[0])) / 32768 }
+	default:
+		return nil, 0, fmt.Errorf("%w: format %d with %d bits", errUnsupportedWAV, format, bits)
+	}
+
+	frame := width * int(channels)
+	pcm := make([]int16, len(samples)/frame)
+	for i := range pcm {
+		var sum float64
+		for ch := 0; ch < int(channels); ch++ {
+			offset := i*frame + ch*width
+			sum += decode(samples[offset : offset+width])
+		}
+		pcm[i] = clampSample(sum / float64(channels) * 32767)
+	}
+	return pcm, int(rate), nil
+}
+
+// clampSample converts a scaled sample to 16 bits without wrapping
+func clampSample(v float64) int16 {
+	switch {
+	case v > 32767:
+		return 32767
+	case v < -32768:
+		return -32768
+	}
+	return int16(math.Round(v))
+}
+
+// resample converts PCM between sample rates, averaging over each output
+// period when downsampling so high frequencies do not alias
+func resample(pcm []int16, from, to int) []int16 {
+	if from == to || len(pcm) == 0 {
+		return pcm
+	}
+	ratio := float64(from) / float64(to)
+	out := make([]int16, int(float64(len(pcm))/ratio))
+	for i := range out {
+		start := float64(i) * ratio
+		if ratio <= 1 {
+			// Upsampling: interpolate between neighbours
+			j := int(start)
+			frac := start - float64(j)
+			next := pcm[j]
+			if j+1 < len(pcm) {
+				next = pcm[j+1]
+			}
+			out[i] = clampSample(float64(pcm[j])*(1-frac) + float64(next)*frac)
+			continue
+		}
+		first, last := int(start), int(start+ratio)
+		if last > len(pcm) {
+			last = len(pcm)
+		}
+		var sum float64
+		for _, v := range pcm[first:last] {
+			sum += float64(v)
+		}
+		out[i] = clampSample(sum / float64(last-first))
+	}
+	return out
+}
+
+// encodeAlaw encodes PCM as A-law
+func encodeAlaw(pcm []int16) []byte {
+	out := make([]byte, len(pcm))
+	for i, v := range pcm {
+		out[i] = linearToAlaw(v)
+	}
+	return out
+}
+
+// ffmpegToAlaw transcodes any format ffmpeg understands
+func ffmpegToAlaw(source []byte) ([]byte, error) {
+	ffmpeg := getEnv("FFMPEG_PATH", "ffmpeg")
+	if _, err := exec.LookPath(ffmpeg); err != nil {
+		return nil, fmt.Errorf("only WAV and A-law uploads are supported without ffmpeg: %w", err)
+	}
+	var out, stderr bytes.Buffer
+	cmd := exec.Command(ffmpeg, "-hide_banner", "-loglevel", "error", "-i", "pipe:0", "-ac", "1", "-ar", strconv.Itoa(bytesPerSecond), "-f", "alaw", "pipe:1")
+	cmd.Stdin = bytes.NewReader(source)
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	if out.Len() == 0 {
+		return nil, fmt.Errorf("ffmpeg produced no audio")
+	}
+	return out.Bytes(), nil
+}
+
+// playAsset streams an asset's current version to the caller ahead of the
+// assistant's audio
+func (s *Session) playAsset(name string) error {
+	audio, _, err := assets.audio(name, 0)
+	if err != nil {
+		return err
+	}
+	// One second per message keeps frames small without flooding the socket
+	for start := 0; start < len(audio); start += bytesPerSecond {
+		end := min(start+bytesPerSecond, len(audio))
+		data, err := json.Marshal(map[string]interface{}{
+			"event":     "media",
+			"streamSid": s.streamSid,
+			"media":     map[string]string{"payload": base64.StdEncoding.EncodeToString(audio[start:end])},
+		})
+		if err != nil {
+			return err
+		}
+		if err := s.writeClient(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeClient writes a raw message to the Twilio connection
+func (s *Session) writeClient(data []byte) error {
+	s.clientMu.Lock()
+	defer s.clientMu.Unlock()
+	s.sent(data)
+	return s.clientConn.WriteMessage(websocket.TextMessage, data)
+}
+
+// handleListAssets serves GET /admin/assets
+func handleListAssets(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"assets": assets.list()})
+}
+
+// handleGetAsset serves GET /admin/assets/:name
+func handleGetAsset(c *gin.Context) {
+	asset, ok := assets.get(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "asset not found"})
+		return
+	}
+	c.JSON(http.StatusOK, asset)
+}
+
+// handleUploadAsset serves POST /admin/assets/:name with the audio file as
+// the request body; each upload becomes a new version
+func handleUploadAsset(c *gin.Context) {
+	name := c.Param("name")
+	if !assetNamePattern.MatchString(name) || name == "tts" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "asset names are lowercase letters, digits, - and _"})
+		return
+	}
+	kind := c.Query("kind")
+	if _, exists := assets.get(name); !exists && kind == "" {
+		kind = AssetGreeting
+	}
+	if kind != "" && !validAssetKind(kind) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be greeting, hold or disclosure"})
+		return
+	}
+	source, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxAssetBytes))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+	if len(source) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "empty upload"})
+		return
+	}
+	asset, err := assets.add(name, kind, c.ContentType(), source, AssetVersion{})
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, asset)
+}
+
+// handleSetAssetVersion serves PUT /admin/assets/:name/current to roll an
+// asset back or forward
+func handleSetAssetVersion(c *gin.Context) {
+	var req struct {
+		Version int `json:"version" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	asset, err := assets.setCurrent(c.Param("name"), req.Version)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, asset)
+}
+
+// handleDeleteAsset serves DELETE /admin/assets/:name
+func handleDeleteAsset(c *gin.Context) {
+	ok, err := assets.remove(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "asset not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+// handleAssetAudio serves /assets/:name/:file, a version as WAV. Twilio
+// fetches these for <Play>, so they are public; the file name pins the
+// audio's hash, so what a link serves never changes and can be cached
+func handleAssetAudio(c *gin.Context) {
+	name, file := c.Param("name"), strings.TrimSuffix(c.Param("file"), ".wav")
+	asset, ok := assets.get(name)
+	if !ok || !strings.HasSuffix(c.Param("file"), ".wav") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "asset not found"})
+		return
+	}
+	version := 0
+	for _, v := range asset.Versions {
+		if v.file() == file {
+			version = v.Version
+		}
+	}
+	if version == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "asset not found"})
+		return
+	}
+	audio, _, err := assets.audio(name, version)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "asset not found"})
+		return
+	}
+	pcm := make([]int16, len(audio))
+	for i, b := range audio {
+		pcm[i] = alawToLinear(b)
+	}
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Data(http.StatusOK, "audio/wav", encodeWAV(pcm))
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordingURL returns the public link to a call's audio, if PUBLIC_BASE_URL is set
+func recordingURL(callSid string) string {
+	base := getEnv("PUBLIC_BASE_URL", "")
+	if base == "" {
+		return ""
+	}
+	return strings.TrimRight(base, "/") + "/calls/" + callSid + "/audio"
+}
+
+// readTrack reads [from, to) bytes of a recording track, padding missing audio with silence
+func readTrack(path string, from, to int64) ([]byte, error) {
+	buf := bytes.Repeat([]byte{alawSilence}, int(to-from))
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.ReadAt(buf, from); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// sliceRecording decodes a byte range of the chosen track, or both tracks mixed, to PCM
+func sliceRecording(info *RecordingInfo, track string, from, to int64) ([]int16, error) {
+	var paths []string
+	switch track {
+	case TrackCaller:
+		paths = []string{info.CallerFile}
+	case TrackAssistant:
+		paths = []string{info.AssistantFile}
+	case "", "both":
+		paths = []string{info.CallerFile, info.AssistantFile}
+	default:
+		return nil, fmt.Errorf("unknown track %q", track)
+	}
+	mixed := make([]int32, to-from)
+	for _, path := range paths {
+		audio, err := readTrack(path, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for i, b := range audio {
+			mixed[i] += int32(alawToLinear(b))
+		}
+	}
+	pcm := make([]int16, len(mixed))
+	for i, v := range mixed {
+		switch {
+		case v > 32767:
+			v = 32767
+		case v < -32768:
+			v = -32768
+		}
+		pcm[i] = int16(v)
+	}
+	return pcm, nil
+}
+
+// encodeWAV wraps 8 kHz mono PCM in a WAV container
+func encodeWAV(pcm []int16) []byte {
+	var b bytes.Buffer
+	size := uint32(len(pcm) * 2)
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, 36+size)
+	b.WriteString("WAVEfmt ")
+	binary.Write(&b, binary.LittleEndian, uint32(16))
+	binary.Write(&b, binary.LittleEndian, uint16(1)) // PCM
+	binary.Write(&b, binary.LittleEndian, uint16(1)) // mono
+	binary.Write(&b, binary.LittleEndian, uint32(bytesPerSecond))
+	binary.Write(&b, binary.LittleEndian, uint32(bytesPerSecond*2))
+	binary.Write(&b, binary.LittleEndian, uint16(2))
+	binary.Write(&b, binary.LittleEndian, uint16(16))
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, size)
+	binary.Write(&b, binary.LittleEndian, pcm)
+	return b.Bytes()
+}
+
+// encodeMP3 transcodes a WAV file with ffmpeg
+func encodeMP3(wav []byte) ([]byte, error) {
+	ffmpeg := getEnv("FFMPEG_PATH", "ffmpeg")
+	if _, err := exec.LookPath(ffmpeg); err != nil {
+		return nil, fmt.Errorf("mp3 output requires ffmpeg: %w", err)
+	}
+	var out, stderr bytes.Buffer
+	cmd := exec.Command(ffmpeg, "-hide_banner", "-loglevel", "error", "-f", "wav", "-i", "pipe:0", "-f", "mp3", "pipe:1")
+	cmd.Stdin = bytes.NewReader(wav)
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out.Bytes(), nil
+}
+
+// audioRange resolves the from/to (seconds) or turn query parameters to a byte range
+func audioRange(c *gin.Context, record CallRecord) (int64, int64, error) {
+	if value := c.Query("turn"); value != "" {
+		index, err := strconv.Atoi(value)
+		if err != nil || index < 0 || index >= len(record.Turns) {
+			return 0, 0, fmt.Errorf("invalid turn %q", value)
+		}
+		turn := record.Turns[index]
+		if turn.AudioStart < 0 || turn.AudioEnd <= turn.AudioStart {
+			return 0, 0, fmt.Errorf("turn %d has no recorded audio", index)
+		}
+		return turn.AudioStart, turn.AudioEnd, nil
+	}
+
+	end := int64(record.DurationSec * bytesPerSecond)
+	if fi, err := os.Stat(record.Recording.CallerFile); err == nil && fi.Size() > end {
+		end = fi.Size()
+	}
+	from, to := int64(0), end
+	if value := c.Query("from"); value != "" {
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil || seconds < 0 {
+			return 0, 0, fmt.Errorf("invalid from %q", value)
+		}
+		from = int64(seconds * bytesPerSecond)
+	}
+	if value := c.Query("to"); value != "" {
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil || seconds < 0 {
+			return 0, 0, fmt.Errorf("invalid to %q", value)
+		}
+		to = int64(seconds * bytesPerSecond)
+	}
+	if to > end {
+		to = end
+	}
+	if from >= to {
+		return 0, 0, fmt.Errorf("empty time range")
+	}
+	return from, to, nil
+}
+
+// handleCallAudio serves GET /calls/:id/audio as a WAV or MP3 slice of the recording
+func handleCallAudio(c *gin.Context) {
+	record, ok := callStore.get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "call not found"})
+		return
+	}
+	if record.Recording == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "call was not recorded"})
+		return
+	}
+	from, to, err := audioRange(c, record)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pcm, err := sliceRecording(record.Recording, c.Query("track"), from, to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	wav := encodeWAV(pcm)
+	switch c.DefaultQuery("format", "wav") {
+	case "wav":
+		c.Data(http.StatusOK, "audio/wav", wav)
+	case "mp3":
+		mp3, err := encodeMP3(wav)
+		if err != nil {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "audio/mpeg", mp3)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be wav or mp3"})
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"math"
+	"sync"
+)
+
+// Audio quality analysis constants; frames are 20 ms of 8 kHz audio
+const (
+	qualityFrameBytes = 160
+	qualityClipLevel  = 32000
+	qualityGapSlackMs = 40
+)
+
+// LegQuality holds the audio-quality indicators for one side of the call
+type LegQuality struct {
+	Frames        int     `json:"frames"`
+	ClippingRatio float64 `json:"clipping_ratio"`
+	SilenceRatio  float64 `json:"silence_ratio"`
+	SNRdB         float64 `json:"snr_db"`
+	FrameGaps     int     `json:"frame_gaps"`
+	GapMs         int64   `json:"gap_ms"`
+	Score         int     `json:"score"`
+}
+
+// CallQuality is the per-call audio quality summary stored in the CDR
+type CallQuality struct {
+	Caller    LegQuality `json:"caller"`
+	Assistant LegQuality `json:"assistant"`
+
+	// Score is the worse of the two legs, 0-100
+	Score int `json:"score"`
+}
+
+// qualityMeter accumulates frame statistics for one leg
+type qualityMeter struct {
+	sync.Mutex
+	samples int
+	clipped int
+	frames  int
+	silent  int
+
+	// levels is a histogram of frame levels in whole dBFS, index = -dBFS
+	levels [97]int
+
+	nextTimestampMs int64
+	gaps            int
+	gapMs           int64
+}
+
+// alawToLinear decodes one G.711 A-law byte to a 16-bit sample
+func alawToLinear(a byte) int16 {
+	a ^= 0x55
+	t := int16(a&0x0f) << 4
+	seg := (a & 0x70) >> 4
+	switch seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= seg - 1
+	}
+	if a&0x80 != 0 {
+		return t
+	}
+	return -t
+}
+
+// linearToAlaw encodes a 16-bit sample as one G.711 A-law byte
+func linearToAlaw(sample int16) byte {
+	pcm := int(sample) >> 3
+	mask := byte(0xd5)
+	if pcm < 0 {
+		mask = 0x55
+		pcm = -pcm - 1
+	}
+	seg := 0
+	for end := 0x1f; seg < 8 && pcm > end; end = end<<1 | 1 {
+		seg++
+	}
+	if seg >= 8 {
+		return 0x7f ^ mask
+	}
+	aval := byte(seg << 4)
+	if seg < 2 {
+		aval |= byte(pcm>>1) & 0x0f
+	} else {
+		aval |= byte(pcm>>seg) & 0x0f
+	}
+	return aval ^ mask
+}
+
+// ulawToLinear decodes one G.711 mu-law byte to a 16-bit sample
+func ulawToLinear(u byte) int16 {
+	u = ^u
+	t := (int16(u&0x0f) << 3) + 0x84
+	t <<= (u & 0x70) >> 4
+	if u&0x80 != 0 {
+		return 0x84 - t
+	}
+	return t - 0x84
+}
+
+// addTimed records caller audio and checks its stream timestamp for lost frames
+func (m *qualityMeter) addTimed(timestampMs int64, audio []byte) {
+	m.Lock()
+	if m.nextTimestampMs > 0 && timestampMs-m.nextTimestampMs > qualityGapSlackMs {
+		m.gaps++
+		m.gapMs += timestampMs - m.nextTimestampMs
+	}
+	m.nextTimestampMs = timestampMs + int64(len(audio)/bytesPerMs)
+	m.Unlock()
+	m.add(audio)
+}
+
+// add records audio split into 20 ms frames
+func (m *qualityMeter) add(audio []byte) {
+	silenceDBFS := getEnvFloat("QUALITY_SILENCE_DBFS", -45)
+	m.Lock()
+	defer m.Unlock()
+	for start := 0; start < len(audio); start += qualityFrameBytes {
+		end := start + qualityFrameBytes
+		if end > len(audio) {
+			end = len(audio)
+		}
+		var energy float64
+		for _, b := range audio[start:end] {
+			sample := float64(alawToLinear(b))
+			if math.Abs(sample) >= qualityClipLevel {
+				m.clipped++
+			}
+			energy += sample * sample
+		}
+		m.samples += end - start
+		m.frames++
+
+		rms := math.Sqrt(energy / float64(end-start))
+		level := -96.0
+		if rms > 0 {
+			level = math.Max(-96, 20*math.Log10(rms/32768))
+		}
+		if level < silenceDBFS {
+			m.silent++
+		}
+		m.levels[int(-level)]++
+	}
+}
+
+// levelPercentile returns the frame level at percentile p in dBFS
+func (m *qualityMeter) levelPercentile(p float64) float64 {
+	target := int(math.Ceil(float64(m.frames) * p))
+	seen := 0
+	// Walk from the quietest bin up
+	for i := len(m.levels) - 1; i >= 0; i-- {
+		seen += m.levels[i]
+		if seen >= target && seen > 0 {
+			return -float64(i)
+		}
+	}
+	return 0
+}
+
+// summary computes the leg indicators and its 0-100 score
+func (m *qualityMeter) summary() LegQuality {
+	m.Lock()
+	defer m.Unlock()
+	q := LegQuality{Frames: m.frames, FrameGaps: m.gaps, GapMs: m.gapMs}
+	if m.frames == 0 {
+		return q
+	}
+	q.ClippingRatio = float64(m.clipped) / float64(m.samples)
+	q.SilenceRatio = float64(m.silent) / float64(m.frames)
+	// Quiet frames approximate the noise floor and loud frames the speech level
+	q.SNRdB = m.levelPercentile(0.9) - m.levelPercentile(0.1)
+
+	score := 100.0
+	score -= math.Min(40, q.ClippingRatio*4000)
+	if q.SNRdB < 25 {
+		score -= math.Min(40, (25-q.SNRdB)*2)
+	}
+	durationMs := float64(m.samples / bytesPerMs)
+	if durationMs > 0 {
+		score -= math.Min(30, float64(m.gapMs)/durationMs*200)
+	}
+	if q.SilenceRatio > 0.95 {
+		score -= 20
+	}
+	q.Score = int(math.Max(0, math.Round(score)))
+	return q
+}
+
+// audioQuality summarizes both legs of the session
+func (s *Session) audioQuality() *CallQuality {
+	q := &CallQuality{Caller: s.callerQuality.summary(), Assistant: s.assistantQuality.summary()}
+	if q.Caller.Frames == 0 && q.Assistant.Frames == 0 {
+		return nil
+	}
+	q.Score = q.Caller.Score
+	if q.Assistant.Frames > 0 && (q.Caller.Frames == 0 || q.Assistant.Score < q.Score) {
+		q.Score = q.Assistant.Score
+	}
+	return q
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Audited kinds of access to call data
+const (
+	AuditTurns      = "turns.read"
+	AuditRecording  = "recording.read"
+	AuditTranscript = "transcript.read"
+	AuditCopilot    = "copilot.stream"
+	AuditTrace      = "trace.read"
+	AuditWhisper    = "whisper.read"
+	AuditWhisperSet = "whisper.update"
+	AuditSearch     = "transcript.search"
+	AuditExport     = "export.deliver"
+	AuditDownload   = "export.download"
+)
+
+// Context keys where handlers leave the calls a request touched when they
+// are not named in the path, the export it served, and the actor its
+// credential authenticated
+const (
+	auditCallsKey  = "audit_calls"
+	auditExportKey = "audit_export"
+	auditActorKey  = "audit_actor"
+)
+
+// AuditEntry records one access to recordings or transcripts
+type AuditEntry struct {
+	At         time.Time `json:"at"`
+	Action     string    `json:"action"`
+	Actor      string    `json:"actor"`
+	Claimed    string    `json:"claimed_actor,omitempty"`
+	Credential string    `json:"credential"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	Method     string    `json:"method,omitempty"`
+	Path       string    `json:"path,omitempty"`
+	Status     int       `json:"status,omitempty"`
+	CallSids   []string  `json:"call_sids,omitempty"`
+	ExportID   string    `json:"export_id,omitempty"`
+}
+
+// AuditLog appends entries to DATA_DIR/audit.jsonl; the file is only ever
+// appended to so it can be shipped to write-once storage
+type AuditLog struct {
+	sync.Mutex
+	path string
+}
+
+// newAuditLog opens the audit log
+func newAuditLog() *AuditLog {
+	return &AuditLog{path: dataPath("audit.jsonl")}
+}
+
+// record appends an entry and mirrors it to the process log
+func (a *AuditLog) record(entry AuditEntry) {
+	if entry.At.IsZero() {
+		entry.At = time.Now().UTC()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Println("Error marshaling audit entry:", err)
+		return
+	}
+	accessLog.Println(`{"log":"audit","entry":` + string(data) + `}`)
+
+	a.Lock()
+	defer a.Unlock()
+	f, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		log.Println("Error opening audit log:", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		log.Println("Error writing audit log:", err)
+	}
+}
+
+// entries returns the entries that pass keep, oldest first
+func (a *AuditLog) entries(keep func(AuditEntry) bool) ([]AuditEntry, error) {
+	a.Lock()
+	defer a.Unlock()
+	f, err := os.Open(a.path)
+	if os.IsNotExist(err) {
+		return []AuditEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries := []AuditEntry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if keep(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// auditActor names who made a request from the credential that was
+// checked: "admin" for the admin token, "signed-link" for a valid signed
+// link and "anonymous" for requests that authenticated neither
+func auditActor(c *gin.Context) string {
+	if actor := c.GetString(auditActorKey); actor != "" {
+		return actor
+	}
+	return "anonymous"
+}
+
+// auditClaimedActor returns the X-Actor header, which callers set to the
+// operator or service acting; nothing verifies it, so it is kept apart
+// from the actor
+func auditClaimedActor(c *gin.Context) string {
+	actor := strings.TrimSpace(c.GetHeader("X-Actor"))
+	if len(actor) > 100 {
+		actor = actor[:100]
+	}
+	return actor
+}
+
+// auditCredential identifies the token used without revealing it
+func auditCredential(c *gin.Context) string {
+	if c.Query("signature") != "" {
+		return "signed-link"
+	}
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if token == "" {
+		return "none"
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "admin-token:" + hex.EncodeToString(sum[:4])
+}
+
+// auditAccess records each request to a call data endpoint once the handler
+// has run, including refused and failed ones
+func auditAccess(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		entry := AuditEntry{
+			Action:     action,
+			Actor:      auditActor(c),
+			Claimed:    auditClaimedActor(c),
+			Credential: auditCredential(c),
+			IP:         c.ClientIP(),
+			UserAgent:  c.Request.UserAgent(),
+			Method:     c.Request.Method,
+			Path:       c.Request.URL.Path,
+			Status:     c.Writer.Status(),
+		}
+		if calls, ok := c.Get(auditCallsKey); ok {
+			entry.CallSids, _ = calls.([]string)
+		} else if id := c.Param("id"); id != "" {
+			entry.CallSids = []string{id}
+		}
+		entry.ExportID = c.GetString(auditExportKey)
+		auditLog.record(entry)
+	}
+}
+
+// handleCallAccessReport serves GET /calls/:id/access, every recorded access
+// to the call's recording and transcript, including exports containing it
+func handleCallAccessReport(c *gin.Context) {
+	callSid := c.Param("id")
+	if _, ok := callStore.get(callSid); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "call not found"})
+		return
+	}
+	entries, err := auditLog.entries(func(entry AuditEntry) bool {
+		return containsString(entry.CallSids, callSid)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"call_sid": callSid, "accesses": entries})
+}
+
+// handleAuditLog serves GET /admin/audit, filtered by actor, action and the
+// from and to times
+func handleAuditLog(c *gin.Context) {
+	from, err := parseTimeParam(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from: " + err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to: " + err.Error()})
+		return
+	}
+	actor, action := c.Query("actor"), c.Query("action")
+	entries, err := auditLog.entries(func(entry AuditEntry) bool {
+		return (actor == "" || entry.Actor == actor) &&
+			(action == "" || entry.Action == action) &&
+			(from.IsZero() || !entry.At.Before(from)) &&
+			(to.IsZero() || entry.At.Before(to))
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
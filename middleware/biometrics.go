@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VoiceMatch is a speaker-verification provider's verdict on the caller
+type VoiceMatch struct {
+	Provider string  `json:"provider"`
+	Score    float64 `json:"score"`
+	Identity string  `json:"identity,omitempty"`
+	Verified bool    `json:"verified"`
+	AudioMs  int64   `json:"audio_ms"`
+	// Final is set by providers that have reached a decision and need no more audio
+	Final bool `json:"final,omitempty"`
+}
+
+// VoiceprintSession identifies the call and the identity the caller claims
+type VoiceprintSession struct {
+	CallSid string
+	Tenant  string
+	Caller  string
+}
+
+// VoiceprintProvider scores caller audio against enrolled voiceprints.
+// Stream receives 8 kHz A-law audio in order and returns the running match
+type VoiceprintProvider interface {
+	Stream(session VoiceprintSession, audio []byte) (VoiceMatch, error)
+	End(session VoiceprintSession)
+}
+
+// VoiceVerification makes an agent verify callers by voice
+type VoiceVerification struct {
+	// Threshold is the score a match needs; defaults to VOICEPRINT_THRESHOLD
+	Threshold float64 `json:"threshold,omitempty"`
+
+	// Tools are refused until the caller's voice matches
+	Tools []string `json:"tools,omitempty"`
+}
+
+var (
+	voiceprintMu        sync.RWMutex
+	voiceprintProviders = map[string]VoiceprintProvider{}
+)
+
+// registerVoiceprintProvider makes a provider selectable with VOICEPRINT_PROVIDER
+func registerVoiceprintProvider(name string, p VoiceprintProvider) {
+	voiceprintMu.Lock()
+	defer voiceprintMu.Unlock()
+	voiceprintProviders[name] = p
+}
+
+// voiceprintProvider returns the configured provider, or nil when voice
+// verification is off
+func voiceprintProvider() (string, VoiceprintProvider) {
+	name := getEnv("VOICEPRINT_PROVIDER", "")
+	if name == "" {
+		return "", nil
+	}
+	voiceprintMu.RLock()
+	defer voiceprintMu.RUnlock()
+	return name, voiceprintProviders[name]
+}
+
+func init() {
+	registerVoiceprintProvider("http", httpVoiceprint{})
+}
+
+// httpVoiceprint posts audio chunks to VOICEPRINT_URL/<call sid> and reads
+// back the match as JSON; the call's stream is closed with a DELETE
+type httpVoiceprint struct{}
+
+// request builds a request to the provider for a call
+func (httpVoiceprint) request(method, callSid string, body []byte) (*http.Request, error) {
+	endpoint := getEnv("VOICEPRINT_URL", "")
+	if endpoint == "" {
+		return nil, fmt.Errorf("VOICEPRINT_URL is not set")
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(endpoint, "/")+"/"+url.PathEscape(callSid), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if token := getEnv("VOICEPRINT_TOKEN", ""); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+func (p httpVoiceprint) Stream(session VoiceprintSession, audio []byte) (VoiceMatch, error) {
+	var match VoiceMatch
+	req, err := p.request(http.MethodPost, session.CallSid, audio)
+	if err != nil {
+		return match, err
+	}
+	req.Header.Set("Content-Type", "audio/x-alaw-basic")
+	req.Header.Set("X-Tenant", session.Tenant)
+	req.Header.Set("X-Caller", session.Caller)
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		return match, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return match, newStatusError("voiceprint", resp)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&match)
+	return match, err
+}
+
+func (p httpVoiceprint) End(session VoiceprintSession) {
+	req, err := p.request(http.MethodDelete, session.CallSid, nil)
+	if err != nil {
+		return
+	}
+	if resp, err := outboundClient.Do(req); err == nil {
+		resp.Body.Close()
+	}
+}
+
+// voiceprintState streams a session's caller audio to the provider
+type voiceprintState struct {
+	sync.Mutex
+	name      string
+	provider  VoiceprintProvider
+	session   VoiceprintSession
+	threshold float64
+	audio     chan []byte
+	closed    bool
+	match     *VoiceMatch
+	announced bool
+}
+
+// startVoiceprint begins verification when a provider is configured and the
+// agent asks for it
+func (s *Session) startVoiceprint() {
+	if s.agent.VoiceVerification == nil || s.from == "" {
+		return
+	}
+	name, provider := voiceprintProvider()
+	if provider == nil {
+		if name != "" {
+			log.Printf("Unknown VOICEPRINT_PROVIDER %q; voice verification disabled\n", name)
+		}
+		return
+	}
+	threshold := s.agent.VoiceVerification.Threshold
+	if threshold <= 0 {
+		threshold = getEnvFloat("VOICEPRINT_THRESHOLD", 0.8)
+	}
+	v := &voiceprintState{
+		name:      name,
+		provider:  provider,
+		session:   VoiceprintSession{CallSid: s.callSid, Tenant: s.tenant.ID, Caller: s.from},
+		threshold: threshold,
+		audio:     make(chan []byte, 64),
+	}
+	s.Lock()
+	s.voiceprint = v
+	s.Unlock()
+	s.spawn(func() { s.runVoiceprint(v) })
+}
+
+// feedVoiceprint queues caller audio for the provider without blocking the
+// media loop; audio is dropped if the provider falls behind
+func (s *Session) feedVoiceprint(audio []byte) {
+	s.Lock()
+	v := s.voiceprint
+	s.Unlock()
+	if v == nil {
+		return
+	}
+	v.Lock()
+	defer v.Unlock()
+	if v.closed {
+		return
+	}
+	select {
+	case v.audio <- audio:
+	default:
+	}
+}
+
+// stopVoiceprint ends streaming when the call ends
+func (s *Session) stopVoiceprint() {
+	s.Lock()
+	v := s.voiceprint
+	s.Unlock()
+	if v == nil {
+		return
+	}
+	v.Lock()
+	if !v.closed {
+		v.closed = true
+		close(v.audio)
+	}
+	v.Unlock()
+}
+
+// runVoiceprint batches caller audio into chunks for the provider until it
+// reaches a verdict, the caller has spoken long enough, or the call ends
+func (s *Session) runVoiceprint(v *voiceprintState) {
+	defer v.provider.End(v.session)
+	chunkBytes := int(getEnvDuration("VOICEPRINT_CHUNK", 2*time.Second).Milliseconds()) * bytesPerMs
+	maxBytes := int(getEnvDuration("VOICEPRINT_MAX_AUDIO", 30*time.Second).Milliseconds()) * bytesPerMs
+	var chunk []byte
+	sent := 0
+	for audio := range v.audio {
+		chunk = append(chunk, audio...)
+		if len(chunk) < chunkBytes {
+			continue
+		}
+		// Voiceprints are biometric data; nothing leaves without storage consent
+		if !s.hasConsent(ConsentDataStorage) {
+			chunk = chunk[:0]
+			continue
+		}
+		match, err := v.provider.Stream(v.session, chunk)
+		sent += len(chunk)
+		chunk = chunk[:0]
+		if err != nil {
+			log.Printf("Error streaming audio of call %s to voiceprint provider %s: %v\n", v.session.CallSid, v.name, err)
+			continue
+		}
+		match.Provider = v.name
+		match.AudioMs = int64(sent / bytesPerMs)
+		match.Verified = match.Score >= v.threshold
+		s.setVoiceMatch(v, match)
+		if match.Verified || match.Final || sent >= maxBytes {
+			break
+		}
+	}
+	// Stop queueing audio once there is a verdict
+	v.Lock()
+	if !v.closed {
+		v.closed = true
+		close(v.audio)
+	}
+	v.Unlock()
+}
+
+// setVoiceMatch attaches the provider's latest verdict to the session and
+// tells the model once the caller is verified
+func (s *Session) setVoiceMatch(v *voiceprintState, match VoiceMatch) {
+	v.Lock()
+	v.match = &match
+	announce := match.Verified && !v.announced
+	if announce {
+		v.announced = true
+	}
+	v.Unlock()
+	if !announce {
+		return
+	}
+	log.Printf("Caller on %s verified by voice as %q (score %.2f)\n", v.session.CallSid, match.Identity, match.Score)
+	text := "The caller's voice has been verified"
+	if match.Identity != "" {
+		text += " as " + match.Identity
+	}
+	s.sendOpenAI(map[string]interface{}{
+		"type": "conversation.item.create",
+		"item": map[string]interface{}{
+			"type":    "message",
+			"role":    "system",
+			"content": []map[string]interface{}{{"type": "input_text", "text": text + ". Tools that need a verified caller are now available."}},
+		},
+	})
+}
+
+// voiceMatch returns the session's current verdict, if any
+func (s *Session) voiceMatch() *VoiceMatch {
+	s.Lock()
+	v := s.voiceprint
+	s.Unlock()
+	if v == nil {
+		return nil
+	}
+	v.Lock()
+	defer v.Unlock()
+	if v.match == nil {
+		return nil
+	}
+	match := *v.match
+	return &match
+}
+
+// voiceMatchRequired reports whether a tool must wait for a verified voice
+func (s *Session) voiceMatchRequired(tool string) bool {
+	if s.agent.VoiceVerification == nil || !containsString(s.agent.VoiceVerification.Tools, tool) {
+		return false
+	}
+	match := s.voiceMatch()
+	return match == nil || !match.Verified
+}
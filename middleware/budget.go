@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AlertBudgetExceeded is raised when an agent goes over its cost or latency budget
+const AlertBudgetExceeded = "agent_budget_exceeded"
+
+// defaultDowngradeModel is the cheaper, faster realtime model over-budget agents fall back to
+const defaultDowngradeModel = "gpt-4o-mini-realtime-preview"
+
+// AgentBudget caps an agent's cost or response latency over a rolling
+// window; while the agent is over budget its new calls use a cheaper,
+// faster model. Only calls on the primary model count toward the budget,
+// so the agent returns to it once they age out of the window
+type AgentBudget struct {
+	// MaxAvgCost is the average USD cost per call, MaxWindowCost the total
+	// spend across the window and MaxAvgLatencyMs the average time to the
+	// assistant's first audio; zero leaves a limit unchecked
+	MaxAvgCost      float64 `json:"max_avg_cost_usd,omitempty"`
+	MaxWindowCost   float64 `json:"max_window_cost_usd,omitempty"`
+	MaxAvgLatencyMs int64   `json:"max_avg_latency_ms,omitempty"`
+
+	// WindowMinutes defaults to 60; MinCalls is how many calls the averages
+	// need before they are checked, 5 by default
+	WindowMinutes int `json:"window_minutes,omitempty"`
+	MinCalls      int `json:"min_calls,omitempty"`
+
+	// Model is the realtime model used while over budget
+	Model string `json:"model,omitempty"`
+
+	// ExemptClasses are priority classes whose calls keep the primary model
+	ExemptClasses []string `json:"exempt_classes,omitempty"`
+}
+
+// BudgetStatus is an agent's spend and latency against its budget
+type BudgetStatus struct {
+	Agent           string      `json:"agent"`
+	Budget          AgentBudget `json:"budget"`
+	Calls           int         `json:"calls"`
+	WindowCost      float64     `json:"window_cost_usd"`
+	AvgCost         float64     `json:"avg_cost_usd"`
+	AvgLatencyMs    float64     `json:"avg_latency_ms"`
+	OverBudget      bool        `json:"over_budget"`
+	Reason          string      `json:"reason,omitempty"`
+	Since           *time.Time  `json:"since,omitempty"`
+	DowngradedCalls int         `json:"downgraded_calls"`
+}
+
+// budgetSample is one completed primary-model call
+type budgetSample struct {
+	at        time.Time
+	cost      float64
+	latencyMs int64
+	responses int
+}
+
+// BudgetTracker keeps each budgeted agent's recent calls and whether it is
+// over budget
+type BudgetTracker struct {
+	sync.Mutex
+	samples    map[string][]budgetSample
+	overSince  map[string]time.Time
+	downgraded map[string]int
+}
+
+// newBudgetTracker seeds the windows with the last day of stored calls
+func newBudgetTracker() *BudgetTracker {
+	b := &BudgetTracker{
+		samples:    make(map[string][]budgetSample),
+		overSince:  make(map[string]time.Time),
+		downgraded: make(map[string]int),
+	}
+	records := callStore.list(CallFilter{From: time.Now().Add(-24 * time.Hour)})
+	for i := len(records) - 1; i >= 0; i-- {
+		if agents.exists(records[i].Agent) {
+			b.add(agents.get(records[i].Agent), records[i])
+		}
+	}
+	return b
+}
+
+// observe adds a completed primary-model call to its agent's window
+func (b *BudgetTracker) observe(agent *Agent, record CallRecord) {
+	if reason := b.add(agent, record); reason != "" {
+		b.alert(agent, reason)
+	}
+}
+
+// add records a call's sample and returns the reason if the agent just went
+// over budget
+func (b *BudgetTracker) add(agent *Agent, record CallRecord) string {
+	if agent.Budget == nil || record.Downgrade != "" {
+		return ""
+	}
+	sample := budgetSample{at: record.EndedAt, cost: record.Cost}
+	for _, turn := range record.Turns {
+		if turn.Speaker == SpeakerAssistant && turn.LatencyMs > 0 {
+			sample.latencyMs += turn.LatencyMs
+			sample.responses++
+		}
+	}
+	b.Lock()
+	defer b.Unlock()
+	b.samples[agent.ID] = append(b.samples[agent.ID], sample)
+	if status, crossed := b.evaluateLocked(agent.ID, *agent.Budget); crossed {
+		return status.Reason
+	}
+	return ""
+}
+
+// alert reports an agent going over budget
+func (b *BudgetTracker) alert(agent *Agent, reason string) {
+	log.Printf("Agent %s is over budget, downgrading new calls: %s\n", agent.ID, reason)
+	alerts.raise(Alert{
+		Kind:     AlertBudgetExceeded,
+		Severity: "warning",
+		Message:  fmt.Sprintf("Agent %s is over budget (%s); new calls use %s", agent.ID, reason, agent.Budget.model()),
+		Subject:  agent.ID,
+	})
+}
+
+// evaluateLocked drops samples older than the window and checks the limits,
+// reporting whether the agent just went over budget; the caller holds the lock
+func (b *BudgetTracker) evaluateLocked(agentID string, budget AgentBudget) (BudgetStatus, bool) {
+	cutoff := time.Now().Add(-budget.window())
+	samples := b.samples[agentID]
+	for len(samples) > 0 && samples[0].at.Before(cutoff) {
+		samples = samples[1:]
+	}
+	b.samples[agentID] = samples
+
+	status := BudgetStatus{Agent: agentID, Budget: budget, Calls: len(samples), DowngradedCalls: b.downgraded[agentID]}
+	var latency int64
+	responses := 0
+	for _, sample := range samples {
+		status.WindowCost += sample.cost
+		latency += sample.latencyMs
+		responses += sample.responses
+	}
+	if status.Calls > 0 {
+		status.AvgCost = status.WindowCost / float64(status.Calls)
+	}
+	if responses > 0 {
+		status.AvgLatencyMs = float64(latency) / float64(responses)
+	}
+	minCalls := budget.MinCalls
+	if minCalls <= 0 {
+		minCalls = 5
+	}
+	switch {
+	case budget.MaxWindowCost > 0 && status.WindowCost > budget.MaxWindowCost:
+		status.Reason = fmt.Sprintf("spent $%.2f against $%.2f", status.WindowCost, budget.MaxWindowCost)
+	case status.Calls < minCalls:
+	case budget.MaxAvgCost > 0 && status.AvgCost > budget.MaxAvgCost:
+		status.Reason = fmt.Sprintf("average cost $%.3f per call against $%.3f", status.AvgCost, budget.MaxAvgCost)
+	case budget.MaxAvgLatencyMs > 0 && status.AvgLatencyMs > float64(budget.MaxAvgLatencyMs):
+		status.Reason = fmt.Sprintf("average latency %.0fms against %dms", status.AvgLatencyMs, budget.MaxAvgLatencyMs)
+	}
+	status.OverBudget = status.Reason != ""
+
+	if !status.OverBudget {
+		delete(b.overSince, agentID)
+		return status, false
+	}
+	_, wasOver := b.overSince[agentID]
+	if !wasOver {
+		b.overSince[agentID] = time.Now().UTC()
+	}
+	since := b.overSince[agentID]
+	status.Since = &since
+	return status, !wasOver
+}
+
+// modelFor returns the model a new call to the agent should use instead of
+// the primary one, and why, or "" when the agent is within budget or the
+// call's priority class is exempt
+func (b *BudgetTracker) modelFor(agent *Agent, class string) (string, string) {
+	if agent.Budget == nil || containsString(agent.Budget.ExemptClasses, class) {
+		return "", ""
+	}
+	b.Lock()
+	status, crossed := b.evaluateLocked(agent.ID, *agent.Budget)
+	if status.OverBudget {
+		b.downgraded[agent.ID]++
+	}
+	b.Unlock()
+	if crossed {
+		b.alert(agent, status.Reason)
+	}
+	if !status.OverBudget {
+		return "", ""
+	}
+	return agent.Budget.model(), status.Reason
+}
+
+// list returns the status of every agent with a budget
+func (b *BudgetTracker) list() []BudgetStatus {
+	agents.RLock()
+	budgeted := make(map[string]AgentBudget)
+	for id, agent := range agents.agents {
+		if agent.Budget != nil {
+			budgeted[id] = *agent.Budget
+		}
+	}
+	agents.RUnlock()
+	b.Lock()
+	defer b.Unlock()
+	list := make([]BudgetStatus, 0, len(budgeted))
+	for id, budget := range budgeted {
+		status, _ := b.evaluateLocked(id, budget)
+		list = append(list, status)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Agent < list[j].Agent })
+	return list
+}
+
+// window returns the budget's rolling window
+func (budget AgentBudget) window() time.Duration {
+	if budget.WindowMinutes <= 0 {
+		return time.Hour
+	}
+	return time.Duration(budget.WindowMinutes) * time.Minute
+}
+
+// model returns the model used while over budget
+func (budget AgentBudget) model() string {
+	if budget.Model == "" {
+		return defaultDowngradeModel
+	}
+	return budget.Model
+}
+
+// withRealtimeModel returns a Realtime API URL asking for another model
+func withRealtimeModel(endpoint, model string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || model == "" {
+		return endpoint
+	}
+	query := u.Query()
+	query.Set("model", model)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// realtimeModel returns the model a Realtime API URL asks for
+func realtimeModel(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+	return u.Query().Get("model")
+}
+
+// loadDowngradePricing reads per-million-token prices of the downgrade model
+func loadDowngradePricing() Pricing {
+	return Pricing{
+		TextInput:   getEnvFloat("DOWNGRADE_PRICE_TEXT_INPUT", 0.6),
+		AudioInput:  getEnvFloat("DOWNGRADE_PRICE_AUDIO_INPUT", 10),
+		CachedInput: getEnvFloat("DOWNGRADE_PRICE_CACHED_INPUT", 0.3),
+		TextOutput:  getEnvFloat("DOWNGRADE_PRICE_TEXT_OUTPUT", 2.4),
+		AudioOutput: getEnvFloat("DOWNGRADE_PRICE_AUDIO_OUTPUT", 20),
+	}
+}
+
+// pricing returns the token prices of the session's model
+func (s *Session) pricing() Pricing {
+	if s.downgrade != "" {
+		return downgradePricing
+	}
+	return pricing
+}
+
+// handleBudgetStatus serves GET /admin/budgets
+func handleBudgetStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"budgets": budgets.list()})
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CallFilter selects stored call records
+type CallFilter struct {
+	Tenant      string
+	Agent       string
+	Caller      string
+	Disposition string
+	From        time.Time
+	To          time.Time
+
+	// Canary includes synthetic canary calls, which are left out otherwise
+	Canary bool
+}
+
+// CallStore persists call records as one JSON file per call under DATA_DIR/calls
+type CallStore struct {
+	sync.RWMutex
+	dir     string
+	records map[string]*CallRecord
+	index   *TranscriptIndex
+}
+
+// newCallStore loads existing call records from disk
+func newCallStore() *CallStore {
+	st := &CallStore{
+		dir:     dataDir("calls"),
+		records: make(map[string]*CallRecord),
+		index:   newTranscriptIndex(),
+	}
+	files, err := filepath.Glob(filepath.Join(st.dir, "*.json"))
+	if err != nil {
+		log.Println("Error listing call records:", err)
+	}
+	for _, file := range files {
+		var record CallRecord
+		if err := readJSONFile(file, &record); err != nil {
+			log.Printf("Error loading call record %s: %v\n", file, err)
+			continue
+		}
+		st.records[record.CallSid] = &record
+		st.index.add(&record)
+	}
+	log.Printf("Loaded %d call record(s)\n", len(st.records))
+	return st
+}
+
+// save stores or replaces a call record
+func (st *CallStore) save(record CallRecord) {
+	if record.CallSid == "" || strings.ContainsAny(record.CallSid, `/\`) {
+		log.Println("Refusing to store call record with invalid id:", record.CallSid)
+		return
+	}
+	st.Lock()
+	st.records[record.CallSid] = &record
+	st.Unlock()
+	st.index.add(&record)
+	if err := writeJSONFile(filepath.Join(st.dir, record.CallSid+".json"), record); err != nil {
+		log.Printf("Error saving call record %s: %v\n", record.CallSid, err)
+	}
+}
+
+// update applies fn to a stored record and saves it
+func (st *CallStore) update(callSid string, fn func(*CallRecord) error) error {
+	record, ok := st.get(callSid)
+	if !ok {
+		return fmt.Errorf("call not found")
+	}
+	if err := fn(&record); err != nil {
+		return err
+	}
+	st.save(record)
+	return nil
+}
+
+// get returns a copy of a call record
+func (st *CallStore) get(callSid string) (CallRecord, bool) {
+	st.RLock()
+	defer st.RUnlock()
+	record, ok := st.records[callSid]
+	if !ok {
+		return CallRecord{}, false
+	}
+	return *record, true
+}
+
+// await returns a call's record, waiting up to timeout for the server to
+// finish tearing the call down, which includes model calls for
+// classification and scoring, and save it
+func (st *CallStore) await(callSid string, timeout time.Duration) (CallRecord, bool) {
+	deadline := time.Now().Add(timeout)
+	for {
+		if record, ok := st.get(callSid); ok {
+			return record, true
+		}
+		if time.Now().After(deadline) {
+			return CallRecord{}, false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// list returns copies of matching records, newest first
+func (st *CallStore) list(filter CallFilter) []CallRecord {
+	st.RLock()
+	var out []CallRecord
+	for _, record := range st.records {
+		if filter.matches(record) {
+			out = append(out, *record)
+		}
+	}
+	st.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].StartedAt.After(out[j].StartedAt) })
+	return out
+}
+
+// matches reports whether a record passes the filter
+func (f CallFilter) matches(r *CallRecord) bool {
+	if r.Canary && !f.Canary {
+		return false
+	}
+	if f.Tenant != "" && r.Tenant != f.Tenant {
+		return false
+	}
+	if f.Agent != "" && r.Agent != f.Agent {
+		return false
+	}
+	if f.Caller != "" && r.From != f.Caller {
+		return false
+	}
+	if f.Disposition != "" && r.Disposition != f.Disposition {
+		return false
+	}
+	if !f.From.IsZero() && r.StartedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !r.StartedAt.Before(f.To) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AlertCanaryFailed is raised when a synthetic canary call fails its assertions
+const AlertCanaryFailed = "canary_failed"
+
+// CanaryScript is a simulated call plus the outcome it must produce
+type CanaryScript struct {
+	SimScript
+
+	// Expect lists phrases the assistant transcript must contain
+	Expect []string `json:"expect"`
+
+	// MaxFirstAudioMs fails the canary if the assistant takes longer to answer
+	MaxFirstAudioMs int `json:"max_first_audio_ms"`
+}
+
+// CanaryRun is the outcome of one canary call
+type CanaryRun struct {
+	CallSid   string    `json:"call_sid"`
+	StartedAt time.Time `json:"started_at"`
+	Passed    bool      `json:"passed"`
+	Failures  []string  `json:"failures,omitempty"`
+	Result    SimResult `json:"result"`
+}
+
+// Canary periodically places a scripted synthetic call and checks its outcome
+type Canary struct {
+	sync.Mutex
+	script  *CanaryScript
+	url     string
+	history []CanaryRun
+	running bool
+}
+
+// newCanary loads CANARY_SCRIPT_FILE and starts the schedule when CANARY_INTERVAL is set
+func newCanary() *Canary {
+	c := &Canary{url: getEnv("CANARY_URL", "ws://localhost:"+getEnv("PORT", "5050")+"/media-stream")}
+	var script CanaryScript
+	ok, err := loadJSONFile("CANARY_SCRIPT_FILE", &script)
+	if err != nil {
+		log.Println("Error loading CANARY_SCRIPT_FILE:", err)
+	}
+	if !ok || err != nil {
+		return c
+	}
+	if script.From == "" {
+		script.From = "+15005550006"
+	}
+	c.script = &script
+	if interval := getEnvDuration("CANARY_INTERVAL", 0); interval > 0 {
+		go func() {
+			for range time.Tick(interval) {
+				c.run()
+			}
+		}()
+		log.Println("Canary calls scheduled every", interval)
+	}
+	return c
+}
+
+// run places one canary call and alerts if it fails
+func (c *Canary) run() (CanaryRun, error) {
+	c.Lock()
+	if c.script == nil {
+		c.Unlock()
+		return CanaryRun{}, fmt.Errorf("no canary script configured")
+	}
+	if c.running {
+		c.Unlock()
+		return CanaryRun{}, fmt.Errorf("a canary call is already running")
+	}
+	c.running = true
+	script := *c.script
+	c.Unlock()
+
+	run := CanaryRun{CallSid: newID("canary"), StartedAt: time.Now().UTC()}
+	result, err := simulateCall(c.url, run.CallSid, script.SimScript, map[string]string{"Canary": "true"})
+	run.Result = result
+	if err != nil {
+		run.Failures = append(run.Failures, err.Error())
+	} else {
+		run.Failures = append(run.Failures, checkCanary(script, result)...)
+	}
+	run.Passed = len(run.Failures) == 0
+
+	c.Lock()
+	c.running = false
+	c.history = append(c.history, run)
+	if len(c.history) > 50 {
+		c.history = c.history[len(c.history)-50:]
+	}
+	c.Unlock()
+
+	if run.Passed {
+		log.Printf("Canary call %s passed (first audio after %s)\n", run.CallSid, result.FirstAudio.Round(time.Millisecond))
+	} else {
+		alerts.raise(Alert{
+			Kind:     AlertCanaryFailed,
+			Severity: "critical",
+			Message:  fmt.Sprintf("Canary call %s failed: %s", run.CallSid, strings.Join(run.Failures, "; ")),
+			CallSid:  run.CallSid,
+		})
+	}
+	return run, nil
+}
+
+// checkCanary asserts the expected flow against the simulated call and its CDR
+func checkCanary(script CanaryScript, result SimResult) []string {
+	var failures []string
+	if result.AssistantBytes == 0 {
+		failures = append(failures, "assistant sent no audio")
+	}
+	if script.MaxFirstAudioMs > 0 && result.FirstAudio > time.Duration(script.MaxFirstAudioMs)*time.Millisecond {
+		failures = append(failures, fmt.Sprintf("first audio after %s", result.FirstAudio.Round(time.Millisecond)))
+	}
+	record, ok := callStore.await(result.CallSid, getEnvDuration("CANARY_RECORD_TIMEOUT", 30*time.Second))
+	if !ok {
+		return append(failures, "no call record was stored")
+	}
+	if record.Status != CallCompleted {
+		failures = append(failures, "call status "+record.Status)
+	}
+	var said strings.Builder
+	for _, entry := range record.Transcript {
+		if entry.Speaker == SpeakerAssistant {
+			said.WriteString(strings.ToLower(entry.Text) + "\n")
+		}
+	}
+	for _, phrase := range script.Expect {
+		if !strings.Contains(said.String(), strings.ToLower(phrase)) {
+			failures = append(failures, fmt.Sprintf("assistant never said %q", phrase))
+		}
+	}
+	return failures
+}
+
+// handleCanaryStatus serves GET /admin/canary
+func handleCanaryStatus(c *gin.Context) {
+	canary.Lock()
+	defer canary.Unlock()
+	c.JSON(http.StatusOK, gin.H{"configured": canary.script != nil, "running": canary.running, "runs": canary.history})
+}
+
+// handleCanaryRun serves POST /admin/canary/run
+func handleCanaryRun(c *gin.Context) {
+	run, err := canary.run()
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, run)
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Kinds of structured field an agent can capture
+const (
+	CaptureDigits   = "digits"
+	CapturePhone    = "phone"
+	CapturePostcode = "postcode"
+	CaptureOrderID  = "order_id"
+	CaptureAddress  = "address"
+	CaptureEmail    = "email"
+)
+
+// CaptureField is a piece of structured data the agent collects from the
+// caller, validated locally and confirmed by reading it back
+type CaptureField struct {
+	Name        string `json:"name"`
+	Kind        string `json:"kind"`
+	Description string `json:"description,omitempty"`
+
+	// Pattern overrides the kind's format check, as a regular expression
+	// matched against the normalized value
+	Pattern string `json:"pattern,omitempty"`
+
+	// Length fixes the number of digits of a digits field
+	Length int `json:"length,omitempty"`
+}
+
+// CapturedValue is a field value awaiting or past confirmation
+type CapturedValue struct {
+	Value     string `json:"value"`
+	Confirmed bool   `json:"confirmed"`
+	Attempts  int    `json:"attempts"`
+}
+
+// postcodePatterns validate postcodes by country after normalization
+var postcodePatterns = map[string]*regexp.Regexp{
+	"US": regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+	"GB": regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? \d[A-Z]{2}$`),
+	"IE": regexp.MustCompile(`^[A-Z]\d[\dW] [A-Z\d]{4}$`),
+	"CA": regexp.MustCompile(`^[A-Z]\d[A-Z] \d[A-Z]\d$`),
+	"NL": regexp.MustCompile(`^\d{4} [A-Z]{2}$`),
+	"PT": regexp.MustCompile(`^\d{4}-\d{3}$`),
+	"BR": regexp.MustCompile(`^\d{5}-\d{3}$`),
+	"DE": regexp.MustCompile(`^\d{5}$`),
+	"FR": regexp.MustCompile(`^\d{5}$`),
+	"ES": regexp.MustCompile(`^\d{5}$`),
+	"IT": regexp.MustCompile(`^\d{5}$`),
+	"MX": regexp.MustCompile(`^\d{5}$`),
+	"AU": regexp.MustCompile(`^\d{4}$`),
+}
+
+// spokenDigits maps number words a transcript may contain to digits
+var spokenDigits = map[string]string{
+	"zero": "0", "oh": "0", "nought": "0", "one": "1", "two": "2", "three": "3", "four": "4",
+	"five": "5", "six": "6", "seven": "7", "eight": "8", "nine": "9",
+}
+
+// spokenToDigits rewrites spelled-out digits ("four one five", "double
+// seven") as digits, leaving other words alone
+func spokenToDigits(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return unicode.IsSpace(r) || r == ',' || r == '.'
+	})
+	var out []string
+	repeat := 1
+	for _, word := range words {
+		switch word {
+		case "double":
+			repeat = 2
+			continue
+		case "triple":
+			repeat = 3
+			continue
+		}
+		if digit, ok := spokenDigits[word]; ok {
+			out = append(out, strings.Repeat(digit, repeat))
+		} else {
+			out = append(out, strings.Repeat(word, repeat))
+		}
+		repeat = 1
+	}
+	return strings.Join(out, " ")
+}
+
+// normalize validates a raw value for the field and returns its canonical
+// form, and a note when validation corrected what the caller said
+func (f CaptureField) normalize(raw, country string) (string, string, error) {
+	value := spokenToDigits(raw)
+	note := ""
+	switch f.Kind {
+	case CapturePhone:
+		parsed, err := validateDestination(value)
+		if err != nil {
+			return "", "", fmt.Errorf("that is not a valid phone number")
+		}
+		value = parsed.E164
+	case CaptureAddress:
+		if addressProvider() == "" {
+			value = strings.TrimSpace(raw)
+			break
+		}
+		result, err := validateAddress(raw, country)
+		if err != nil {
+			// An unreachable provider should not stop the caller; the
+			// read-back still confirms the address
+			log.Printf("Error validating address: %v\n", err)
+			value = strings.TrimSpace(raw)
+			break
+		}
+		if !result.Valid {
+			problem := "the address could not be verified"
+			if len(result.Problems) > 0 {
+				problem = "the address could not be verified: " + strings.Join(result.Problems, ", ")
+			}
+			return "", "", fmt.Errorf("%s", problem)
+		}
+		value = result.Formatted
+		if result.Corrected {
+			note = "The address was standardized; make sure the caller agrees with the corrected version."
+		}
+	case CaptureEmail:
+		result := validateEmail(raw)
+		if result.Suggestion != "" {
+			return "", "", fmt.Errorf("%s; ask whether the caller meant %s", result.Problem, result.Suggestion)
+		}
+		if !result.Valid {
+			return "", "", fmt.Errorf("%s", result.Problem)
+		}
+		value = result.Address
+	case CapturePostcode:
+		value = strings.ToUpper(strings.Join(strings.Fields(value), ""))
+		// Most formats put the space before the final three characters
+		if country == "GB" || country == "IE" || country == "CA" {
+			if len(value) > 3 {
+				value = value[:len(value)-3] + " " + value[len(value)-3:]
+			}
+		} else if country == "NL" && len(value) == 6 {
+			value = value[:4] + " " + value[4:]
+		}
+		if pattern, ok := postcodePatterns[country]; ok && f.Pattern == "" && !pattern.MatchString(value) {
+			return "", "", fmt.Errorf("that is not a valid %s postcode", country)
+		}
+	case CaptureDigits:
+		value = strings.Map(func(r rune) rune {
+			if unicode.IsDigit(r) {
+				return r
+			}
+			if unicode.IsSpace(r) || r == '-' {
+				return -1
+			}
+			return 'x'
+		}, value)
+		if strings.Contains(value, "x") || value == "" {
+			return "", "", fmt.Errorf("only digits are expected")
+		}
+		if f.Length > 0 && len(value) != f.Length {
+			return "", "", fmt.Errorf("expected %d digits but got %d", f.Length, len(value))
+		}
+	default:
+		// Identifiers are case-insensitive and spoken with spaces or dashes
+		value = strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(value))
+	}
+	if f.Pattern != "" {
+		pattern, err := regexp.Compile(f.Pattern)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid pattern for field %s: %v", f.Name, err)
+		}
+		if !pattern.MatchString(value) {
+			return "", "", fmt.Errorf("that does not look like a valid %s", strings.ReplaceAll(f.Name, "_", " "))
+		}
+	}
+	return value, note, nil
+}
+
+// readBack spells a value out in short groups so it is read one character
+// at a time, e.g. "4 1 5, 5 5 5, 0 1 0 0"
+func readBack(kind, value string) string {
+	var groups []string
+	switch kind {
+	case CapturePhone:
+		parsed, err := parseNumber(value)
+		if err == nil && parsed.CallingCode == "1" && len(parsed.National) == 10 {
+			groups = []string{parsed.National[:3], parsed.National[3:6], parsed.National[6:]}
+		} else {
+			groups = chunk(strings.TrimPrefix(value, "+"), 3)
+		}
+	case CapturePostcode:
+		groups = strings.Fields(value)
+	case CaptureAddress:
+		// Addresses are read as written; only the numbers are spelled out
+		return value
+	case CaptureEmail:
+		at := strings.LastIndex(value, "@")
+		spelled := strings.NewReplacer(".", "dot", "_", "underscore", "-", "dash", "+", "plus").
+			Replace(strings.Join(strings.Split(value[:at], ""), " "))
+		return spelled + ", at, " + strings.ReplaceAll(value[at+1:], ".", " dot ")
+	default:
+		groups = chunk(value, 3)
+	}
+	for i, group := range groups {
+		groups[i] = strings.Join(strings.Split(group, ""), " ")
+	}
+	return strings.Join(groups, ", ")
+}
+
+// chunk splits s into groups of n characters
+func chunk(s string, n int) []string {
+	var groups []string
+	for len(s) > n {
+		groups = append(groups, s[:n])
+		s = s[n:]
+	}
+	return append(groups, s)
+}
+
+// captureField returns the agent's definition of a field
+func (s *Session) captureField(name string) (CaptureField, bool) {
+	for _, field := range s.agent.Capture {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return CaptureField{}, false
+}
+
+// capturedValue returns a field's value once the caller has confirmed it;
+// tools use this instead of anything taken from the transcript
+func (s *Session) capturedValue(name string) (string, bool) {
+	s.Lock()
+	defer s.Unlock()
+	captured, ok := s.captured[name]
+	if !ok || !captured.Confirmed {
+		return "", false
+	}
+	return captured.Value, true
+}
+
+// captureInstructions tells the model how to collect the agent's fields
+func (s *Session) captureInstructions() string {
+	if len(s.agent.Capture) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("You may need to collect these details from the caller:")
+	for _, field := range s.agent.Capture {
+		b.WriteString("\n- " + field.Name + " (" + strings.ReplaceAll(field.Kind, "_", " ") + ")")
+		if field.Description != "" {
+			b.WriteString(": " + field.Description)
+		}
+	}
+	b.WriteString("\nAsk for one detail at a time. Pass exactly what the caller said to capture_field, without correcting or guessing characters. " +
+		"If it is rejected, explain the problem and ask again. Otherwise read the value back exactly as given in read_back, one character at a time, " +
+		"ask the caller to confirm, and report their answer with confirm_field. Never repeat or use a detail that has not been confirmed.")
+	return b.String()
+}
+
+func init() {
+	registerTool(&Tool{
+		Name:        "capture_field",
+		Description: "Validate a detail the caller gave, such as a phone number, order ID or postcode, before reading it back for confirmation.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"field": map[string]interface{}{"type": "string", "description": "Name of the detail being collected"},
+				"value": map[string]interface{}{"type": "string", "description": "Exactly what the caller said"},
+			},
+			"required": []string{"field", "value"},
+		},
+		Available: func(s *Session) bool { return len(s.agent.Capture) > 0 },
+		Handler: func(s *Session, args json.RawMessage) (interface{}, error) {
+			var params struct {
+				Field string `json:"field"`
+				Value string `json:"value"`
+			}
+			if err := json.Unmarshal(args, &params); err != nil {
+				return nil, err
+			}
+			field, ok := s.captureField(params.Field)
+			if !ok {
+				return nil, fmt.Errorf("unknown field %q", params.Field)
+			}
+			s.Lock()
+			captured := s.captured[field.Name]
+			captured.Attempts++
+			s.captured[field.Name] = captured
+			s.Unlock()
+
+			value, note, err := field.normalize(params.Value, countryForNumber(s.from))
+			if err != nil {
+				return map[string]interface{}{"status": "invalid", "error": err.Error(), "attempts": captured.Attempts}, nil
+			}
+			s.Lock()
+			s.captured[field.Name] = CapturedValue{Value: value, Attempts: captured.Attempts}
+			s.Unlock()
+			result := map[string]interface{}{
+				"status":    "needs_confirmation",
+				"read_back": readBack(field.Kind, value),
+				"next_step": "Read this back to the caller and ask whether it is correct, then call confirm_field.",
+			}
+			if note != "" {
+				result["note"] = note
+			}
+			return result, nil
+		},
+	})
+	registerTool(&Tool{
+		Name:        "confirm_field",
+		Description: "Record whether the caller confirmed the read-back of a captured detail.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"field":     map[string]interface{}{"type": "string", "description": "Name of the detail that was read back"},
+				"confirmed": map[string]interface{}{"type": "boolean", "description": "True if the caller said the read-back was correct"},
+			},
+			"required": []string{"field", "confirmed"},
+		},
+		Available: func(s *Session) bool { return len(s.agent.Capture) > 0 },
+		Handler: func(s *Session, args json.RawMessage) (interface{}, error) {
+			var params struct {
+				Field     string `json:"field"`
+				Confirmed bool   `json:"confirmed"`
+			}
+			if err := json.Unmarshal(args, &params); err != nil {
+				return nil, err
+			}
+			s.Lock()
+			defer s.Unlock()
+			captured, ok := s.captured[params.Field]
+			if !ok || captured.Value == "" {
+				return nil, fmt.Errorf("capture %s with capture_field first", params.Field)
+			}
+			if !params.Confirmed {
+				s.captured[params.Field] = CapturedValue{Attempts: captured.Attempts}
+				return map[string]string{"status": "rejected", "next_step": "Ask the caller for it again, slowly."}, nil
+			}
+			captured.Confirmed = true
+			s.captured[params.Field] = captured
+			return map[string]string{"status": "confirmed"}, nil
+		},
+	})
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Cassette message directions on the OpenAI link
+const (
+	CassetteClient = "client"
+	CassetteServer = "server"
+)
+
+// Cassette is the full OpenAI event stream of one call, recorded for replay
+type Cassette struct {
+	CallSid    string          `json:"call_sid"`
+	Tenant     string          `json:"tenant"`
+	From       string          `json:"from"`
+	To         string          `json:"to"`
+	RecordedAt time.Time       `json:"recorded_at"`
+	Events     []CassetteEvent `json:"events"`
+}
+
+// CassetteEvent is one message on the OpenAI link. Server events carry the
+// position in the client stream they followed, so replay releases them at
+// the same point in the call regardless of wall-clock timing
+type CassetteEvent struct {
+	Dir      string `json:"dir"`
+	OffsetMs int64  `json:"offset_ms"`
+
+	// AfterEvents is the number of non-audio client events sent before a server event
+	AfterEvents int `json:"after_events,omitempty"`
+
+	// AfterAudioMs is how much caller audio had been appended before a server event
+	AfterAudioMs int64 `json:"after_audio_ms,omitempty"`
+
+	Event json.RawMessage `json:"event"`
+}
+
+// cassetteRecorder captures a session's OpenAI traffic
+type cassetteRecorder struct {
+	sync.Mutex
+	started  time.Time
+	position cassettePosition
+	events   []CassetteEvent
+}
+
+// cassettePosition tracks how far the client stream has progressed
+type cassettePosition struct {
+	events  int
+	audioMs int64
+}
+
+// advance moves the position past one client message
+func (p *cassettePosition) advance(message []byte) (eventType string) {
+	var event struct {
+		Type  string `json:"type"`
+		Audio string `json:"audio"`
+	}
+	json.Unmarshal(message, &event)
+	if event.Type == "input_audio_buffer.append" {
+		audio, _ := base64.StdEncoding.DecodeString(event.Audio)
+		p.audioMs += int64(len(audio) / bytesPerMs)
+	} else {
+		p.events++
+	}
+	return event.Type
+}
+
+// newCassetteRecorder starts a recording when RECORD_CASSETTES is enabled
+func newCassetteRecorder() *cassetteRecorder {
+	if !recordCassettes {
+		return nil
+	}
+	return &cassetteRecorder{started: time.Now()}
+}
+
+// client records a message sent to OpenAI
+func (r *cassetteRecorder) client(message []byte) {
+	if r == nil {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.position.advance(message)
+	r.events = append(r.events, CassetteEvent{
+		Dir:      CassetteClient,
+		OffsetMs: time.Since(r.started).Milliseconds(),
+		Event:    append(json.RawMessage(nil), message...),
+	})
+}
+
+// server records a message received from OpenAI
+func (r *cassetteRecorder) server(message []byte) {
+	if r == nil {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.events = append(r.events, CassetteEvent{
+		Dir:          CassetteServer,
+		OffsetMs:     time.Since(r.started).Milliseconds(),
+		AfterEvents:  r.position.events,
+		AfterAudioMs: r.position.audioMs,
+		Event:        append(json.RawMessage(nil), message...),
+	})
+}
+
+// saveCassette writes the session's recording to DATA_DIR/cassettes
+func (s *Session) saveCassette() {
+	if s.cassette == nil || s.callSid == "" {
+		return
+	}
+	s.cassette.Lock()
+	cassette := Cassette{
+		CallSid:    s.callSid,
+		Tenant:     s.tenant.ID,
+		From:       s.from,
+		To:         s.to,
+		RecordedAt: s.startedAt.UTC(),
+		Events:     s.cassette.events,
+	}
+	s.cassette.Unlock()
+	if err := writeJSONFile(dataPath("cassettes", s.callSid+".json"), cassette); err != nil {
+		log.Printf("Error saving cassette for call %s: %v\n", s.callSid, err)
+	}
+}
+
+// callerAudio reassembles the caller audio appended during the recorded call
+func (c *Cassette) callerAudio() []byte {
+	var audio []byte
+	for _, e := range c.Events {
+		if e.Dir != CassetteClient {
+			continue
+		}
+		var event struct {
+			Type  string `json:"type"`
+			Audio string `json:"audio"`
+		}
+		if json.Unmarshal(e.Event, &event) != nil || event.Type != "input_audio_buffer.append" {
+			continue
+		}
+		chunk, _ := base64.StdEncoding.DecodeString(event.Audio)
+		audio = append(audio, chunk...)
+	}
+	return audio
+}
+
+// CassetteReplay serves a cassette in place of the OpenAI Realtime API and
+// notes where the live client stream departs from the recorded one
+type CassetteReplay struct {
+	sync.Mutex
+	cassette    *Cassette
+	divergences []string
+}
+
+// newCassetteReplay prepares a cassette for replay
+func newCassetteReplay(cassette *Cassette) *CassetteReplay {
+	return &CassetteReplay{cassette: cassette}
+}
+
+// diverged records a difference between the live and recorded client streams
+func (r *CassetteReplay) diverged(format string, args ...interface{}) {
+	r.Lock()
+	r.divergences = append(r.divergences, fmt.Sprintf(format, args...))
+	r.Unlock()
+}
+
+// Divergences returns the differences seen so far
+func (r *CassetteReplay) Divergences() []string {
+	r.Lock()
+	defer r.Unlock()
+	return append([]string(nil), r.divergences...)
+}
+
+// ServeHTTP replays the server side of the cassette to one connection
+func (r *CassetteReplay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	conn, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		log.Println("Cassette replay upgrade error:", err)
+		return
+	}
+	defer conn.Close()
+
+	// The recorded non-audio client events, in order, for comparison
+	var expected []string
+	var server []CassetteEvent
+	for _, e := range r.cassette.Events {
+		if e.Dir == CassetteServer {
+			server = append(server, e)
+			continue
+		}
+		var p cassettePosition
+		if t := p.advance(e.Event); p.events > 0 {
+			expected = append(expected, t)
+		}
+	}
+
+	var mu sync.Mutex
+	progressed := sync.NewCond(&mu)
+	var position cassettePosition
+	closed := false
+	go func() {
+		defer func() {
+			mu.Lock()
+			closed = true
+			progressed.Broadcast()
+			mu.Unlock()
+		}()
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			before := position.events
+			eventType := position.advance(message)
+			if position.events > before {
+				if before >= len(expected) {
+					r.diverged("unexpected client event %d: %s", before+1, eventType)
+				} else if expected[before] != eventType {
+					r.diverged("client event %d: expected %s, got %s", before+1, expected[before], eventType)
+				}
+			}
+			progressed.Broadcast()
+			mu.Unlock()
+		}
+	}()
+
+	for i, e := range server {
+		mu.Lock()
+		for !closed && (position.events < e.AfterEvents || position.audioMs < e.AfterAudioMs) {
+			progressed.Wait()
+		}
+		if position.events < e.AfterEvents || position.audioMs < e.AfterAudioMs {
+			stalled := position
+			mu.Unlock()
+			r.diverged("replay stalled before server event %d of %d: waiting for %d client events and %d ms of audio, got %d and %d ms",
+				i+1, len(server), e.AfterEvents, e.AfterAudioMs, stalled.events, stalled.audioMs)
+			return
+		}
+		mu.Unlock()
+		if err := conn.WriteMessage(websocket.TextMessage, e.Event); err != nil {
+			return
+		}
+	}
+
+	// Hold the connection open until the client hangs up
+	mu.Lock()
+	for !closed {
+		progressed.Wait()
+	}
+	if position.events < len(expected) {
+		r.diverged("client sent %d events, the recording has %d", position.events, len(expected))
+	}
+	mu.Unlock()
+}
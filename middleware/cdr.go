@@ -0,0 +1,180 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// Call statuses recorded in the CDR
+const (
+	CallCompleted = "completed"
+	CallFailed    = "failed"
+	CallVoicemail = "voicemail"
+	// CallInterrupted calls were in progress when the instance stopped;
+	// the record is the last state the instance saw
+	CallInterrupted = "interrupted"
+)
+
+// CallRecord is the call detail record produced when a call ends
+type CallRecord struct {
+	CallSid      string    `json:"call_sid"`
+	StreamSid    string    `json:"stream_sid"`
+	Tenant       string    `json:"tenant"`
+	Agent        string    `json:"agent"`
+	From         string    `json:"from"`
+	To           string    `json:"to"`
+	Status       string    `json:"status"`
+	StartedAt    time.Time `json:"started_at"`
+	EndedAt      time.Time `json:"ended_at"`
+	DurationSec  float64   `json:"duration_sec"`
+	Cost         float64   `json:"cost_usd"`
+	Usage        Usage     `json:"usage"`
+	RecordingURL string    `json:"recording_url,omitempty"`
+	Intent       string    `json:"intent,omitempty"`
+	Disposition  string    `json:"disposition,omitempty"`
+	Contained    bool      `json:"contained"`
+	Summary      string    `json:"summary,omitempty"`
+	Escalations  []string  `json:"escalations,omitempty"`
+	Priority     string    `json:"priority,omitempty"`
+	Transferred  bool      `json:"transferred"`
+	Strategies   []string  `json:"policy_strategies,omitempty"`
+	DTMFDigits   []string  `json:"dtmf_digits,omitempty"`
+
+	Recording *RecordingInfo             `json:"recording,omitempty"`
+	Consent   map[string]ConsentDecision `json:"consent,omitempty"`
+	Flags     map[string]bool            `json:"flags,omitempty"`
+
+	AudioQuality *CallQuality  `json:"audio_quality,omitempty"`
+	Review       *QAReview     `json:"qa_review,omitempty"`
+	Rubric       *RubricResult `json:"qa_rubric,omitempty"`
+	Canary       bool          `json:"canary,omitempty"`
+	Outbound     bool          `json:"outbound,omitempty"`
+	Migrations   []string      `json:"migrations,omitempty"`
+	Killed       bool          `json:"killed,omitempty"`
+	MemoryLimit  string        `json:"memory_limit,omitempty"`
+	Degraded     []string      `json:"degraded,omitempty"`
+	Class        string        `json:"priority_class,omitempty"`
+	Voiceprint   *VoiceMatch   `json:"voiceprint,omitempty"`
+	Rollout      string        `json:"rollout,omitempty"`
+	Model        string        `json:"model,omitempty"`
+
+	// Downgrade says why the call ran on a cheaper model than its agent's
+	Downgrade string `json:"model_downgrade,omitempty"`
+
+	// Whisper is the conference bridge of a whisper call
+	Whisper *WhisperSummary `json:"whisper,omitempty"`
+
+	// CSAT is the caller's 1-5 satisfaction score from a post-call survey
+	CSAT *float64 `json:"csat,omitempty"`
+
+	// Captured holds the details the caller confirmed on read-back
+	Captured map[string]string `json:"captured,omitempty"`
+
+	// Dataset flags the call in or out of dataset exports; nil leaves it to
+	// the export's selection
+	Dataset *bool `json:"dataset,omitempty"`
+
+	Transcript []TranscriptEntry `json:"transcript,omitempty"`
+	Turns      []Turn            `json:"turns,omitempty"`
+	ToolCalls  []ToolCallRecord  `json:"tool_calls,omitempty"`
+}
+
+// callRecord builds the CDR for the session; the caller must hold the lock
+func (s *Session) callRecord() CallRecord {
+	record := CallRecord{
+		CallSid:   s.callSid,
+		StreamSid: s.streamSid,
+		Tenant:    s.tenant.ID,
+		Agent:     s.agent.ID,
+		From:      s.from,
+		To:        s.to,
+		Status:    CallCompleted,
+		StartedAt: s.startedAt.UTC(),
+		EndedAt:   time.Now().UTC(),
+		Cost:      s.usage.cost(s.pricing()),
+		Usage:     s.usage,
+
+		Escalations: append([]string(nil), s.escalations...),
+		Priority:    s.priority,
+		Transferred: s.transferred,
+		Strategies:  append([]string(nil), s.policy.strategies...),
+		DTMFDigits:  append([]string(nil), s.dtmf.selections...),
+
+		AudioQuality: s.audioQuality(),
+		Canary:       s.canary,
+		Outbound:     s.outbound,
+		Migrations:   append([]string(nil), s.migrations...),
+		Class:        s.priorityClass,
+		Killed:       s.killed,
+		MemoryLimit:  s.memoryLimit,
+		Rollout:      s.rollout,
+		Model:        s.model,
+		Downgrade:    s.downgrade,
+		Whisper:      s.whisper.summary(),
+
+		Transcript: append([]TranscriptEntry(nil), s.transcript...),
+		Turns:      append([]Turn(nil), s.turnLog.turns...),
+		ToolCalls:  append([]ToolCallRecord(nil), s.toolCalls...),
+	}
+	if record.CallSid == "" {
+		record.CallSid = s.streamSid
+	}
+	if s.voiceprint != nil {
+		s.voiceprint.Lock()
+		record.Voiceprint = s.voiceprint.match
+		s.voiceprint.Unlock()
+	}
+	if len(s.flags) > 0 {
+		record.Flags = make(map[string]bool, len(s.flags))
+		for name, on := range s.flags {
+			record.Flags[name] = on
+		}
+	}
+	if len(s.consent) > 0 {
+		record.Consent = make(map[string]ConsentDecision, len(s.consent))
+		for kind, decision := range s.consent {
+			record.Consent[kind] = decision
+		}
+	}
+	for name, captured := range s.captured {
+		if !captured.Confirmed {
+			continue
+		}
+		if record.Captured == nil {
+			record.Captured = make(map[string]string)
+		}
+		record.Captured[name] = captured.Value
+	}
+	record.DurationSec = record.EndedAt.Sub(record.StartedAt).Seconds()
+	switch {
+	case s.failed:
+		record.Status = CallFailed
+	case strings.HasPrefix(s.answeredBy, "machine"):
+		record.Status = CallVoicemail
+	}
+	return record
+}
+
+// duration returns the call length as a time.Duration
+func (r CallRecord) duration() time.Duration {
+	return r.EndedAt.Sub(r.StartedAt)
+}
+
+// withoutContent strips what the caller said and what was said to them,
+// keeping the call metadata, for callers who did not consent to storage
+func withoutContent(record *CallRecord) {
+	record.Transcript = nil
+	record.Summary = ""
+	record.Captured = nil
+	if record.Rubric != nil {
+		for i := range record.Rubric.Criteria {
+			record.Rubric.Criteria[i].Evidence = ""
+		}
+	}
+	for i := range record.Turns {
+		record.Turns[i].Transcript = ""
+	}
+	for i := range record.ToolCalls {
+		record.ToolCalls[i].Arguments = nil
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+// TestWithoutContentClearsCaptured checks a record kept without storage
+// consent carries none of the details the caller dictated
+func TestWithoutContentClearsCaptured(t *testing.T) {
+	record := CallRecord{
+		CallSid: "CAconsent",
+		Captured: map[string]string{
+			"email":   "caller@example.com",
+			"address": "1 Main St, Springfield IL 62701",
+			"phone":   "+14155550100",
+		},
+		Transcript: []TranscriptEntry{{Speaker: SpeakerCaller, Text: "my email is caller@example.com"}},
+	}
+	withoutContent(&record)
+	if len(record.Captured) != 0 {
+		t.Fatalf("captured fields kept without consent: %v", record.Captured)
+	}
+	if len(record.Transcript) != 0 {
+		t.Fatal("transcript kept without consent")
+	}
+}
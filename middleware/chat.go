@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const openAIChatURL = "https://api.openai.com/v1/chat/completions"
+
+// chatMessage is one entry of a text conversation
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// chatCompletion asks an OpenAI text model for the next message in the
+// tenant's region; jsonMode constrains the reply to a JSON object
+func chatCompletion(tenant *Tenant, model string, messages []chatMessage, temperature float64, jsonMode bool) (string, error) {
+	region, err := residency.regionFor(tenant)
+	if err != nil {
+		return "", err
+	}
+	request := map[string]interface{}{
+		"model":       model,
+		"messages":    messages,
+		"temperature": temperature,
+	}
+	if jsonMode {
+		request["response_format"] = map[string]string{"type": "json_object"}
+	}
+	var response struct {
+		Choices []struct {
+			Message chatMessage `json:"message"`
+		} `json:"choices"`
+	}
+	headers := map[string]string{"Authorization": "Bearer " + region.apiKey()}
+	started := time.Now()
+	err = doJSON(http.MethodPost, region.chatURL(), request, headers, &response)
+	providerMetrics.record(ProviderOpenAIChat, time.Since(started), err)
+	if err != nil {
+		return "", err
+	}
+	if len(response.Choices) == 0 || response.Choices[0].Message.Content == "" {
+		return "", fmt.Errorf("empty completion")
+	}
+	return response.Choices[0].Message.Content, nil
+}
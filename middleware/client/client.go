@@ -0,0 +1,141 @@
+// Package client calls the voice assistant middleware's admin, call data and
+// reporting API. The request and response types and one method per
+// operation are generated from the server's routes into api.go; run
+// go generate in the middleware directory after changing an endpoint.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client calls one middleware deployment
+type Client struct {
+	// BaseURL is the deployment's root, e.g. https://voice.example.com
+	BaseURL string
+
+	// Token is the deployment's ADMIN_TOKEN
+	Token string
+
+	// Actor is sent as X-Actor and kept in the deployment's audit log as the
+	// claimed actor, next to the actor the token authenticates
+	Actor string
+
+	HTTPClient *http.Client
+}
+
+// New returns a client for the deployment at baseURL
+func New(baseURL, token string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Error is a non-2xx answer from the API
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("middleware API: %d %s", e.Status, e.Message)
+}
+
+// send performs a request and returns the response when it succeeded
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if c.Actor != "" {
+		req.Header.Set("X-Actor", c.Actor)
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if json.Unmarshal(data, &apiErr) != nil || apiErr.Error == "" {
+			apiErr.Error = strings.TrimSpace(string(data))
+		}
+		return nil, &Error{Status: resp.StatusCode, Message: apiErr.Error}
+	}
+	return resp, nil
+}
+
+// do sends a JSON request body, if any, and decodes the JSON response into out
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body, contentType = bytes.NewReader(data), "application/json"
+	}
+	resp, err := c.send(ctx, method, path, query, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// upload sends a raw body and decodes the JSON response into out
+func (c *Client) upload(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string, out interface{}) error {
+	resp, err := c.send(ctx, method, path, query, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// stream returns a response body for the caller to read as it arrives and
+// close, for server-sent event streams
+func (c *Client) stream(ctx context.Context, method, path string, query url.Values) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, method, path, query, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// raw returns a response body as is, for recordings, transcripts and archives
+func (c *Client) raw(ctx context.Context, method, path string, query url.Values) ([]byte, error) {
+	resp, err := c.send(ctx, method, path, query, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
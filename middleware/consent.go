@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Consent kinds a tenant can require before enabling a feature
+const (
+	ConsentRecording   = "recording"
+	ConsentSMS         = "sms"
+	ConsentDataStorage = "data_storage"
+)
+
+// consentDescriptions are read to the model when asking for consent
+var consentDescriptions = map[string]string{
+	ConsentRecording:   "recording this call",
+	ConsentSMS:         "sending them text message follow-ups",
+	ConsentDataStorage: "storing the call transcript and their details",
+}
+
+// ConsentConfig lists the consents a tenant requires from callers
+type ConsentConfig struct {
+	Require []string `json:"require"`
+	Prompt  string   `json:"prompt,omitempty"`
+}
+
+// ConsentDecision is a caller's recorded answer for one kind of consent
+type ConsentDecision struct {
+	Granted bool      `json:"granted"`
+	At      time.Time `json:"at"`
+
+	// Snippet is the caller audio captured when the answer was given, and
+	// RecordingOffset its byte position in the call recording when one exists
+	Snippet         string `json:"snippet,omitempty"`
+	RecordingOffset int64  `json:"recording_offset,omitempty"`
+}
+
+// consentRequired reports whether the tenant gates a feature on caller consent
+func (s *Session) consentRequired(kind string) bool {
+	if s.tenant == nil || s.tenant.Consent == nil {
+		return false
+	}
+	for _, k := range s.tenant.Consent.Require {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// hasConsent reports whether a gated feature may be used on this call
+func (s *Session) hasConsent(kind string) bool {
+	if !s.consentRequired(kind) {
+		return true
+	}
+	s.Lock()
+	defer s.Unlock()
+	decision, ok := s.consent[kind]
+	return ok && decision.Granted
+}
+
+// consentInstructions asks the model to collect any consents still pending
+func (s *Session) consentInstructions() string {
+	if s.tenant == nil || s.tenant.Consent == nil {
+		return ""
+	}
+	var pending []string
+	for _, kind := range s.tenant.Consent.Require {
+		if _, decided := s.consent[kind]; !decided {
+			pending = append(pending, consentDescriptions[kind])
+		}
+	}
+	if len(pending) == 0 {
+		return ""
+	}
+	if s.tenant.Consent.Prompt != "" {
+		return s.tenant.Consent.Prompt
+	}
+	return "Right after greeting the caller, and before anything else, ask whether they consent to " +
+		strings.Join(pending, ", ") + ". Record their answers with the record_consent tool. " +
+		"If they decline, respect that and keep helping them."
+}
+
+// captureCallerAudio keeps a short rolling buffer of caller audio for consent
+// evidence and feeds the recorder when recording is active
+func (s *Session) captureCallerAudio(timestampMs int64, audio []byte) {
+	s.Lock()
+	recorder := s.recorder
+	if s.migratedTo != "" {
+		// The resumed stream records from here on
+		recorder = nil
+	}
+	if s.tenant != nil && s.tenant.Consent != nil {
+		limit := getEnvInt("CONSENT_SNIPPET_SECONDS", 10) * bytesPerSecond
+		s.audioRing = append(s.audioRing, audio...)
+		if len(s.audioRing) > limit {
+			s.audioRing = s.audioRing[len(s.audioRing)-limit:]
+		}
+	}
+	s.Unlock()
+	if recorder != nil {
+		recorder.writeCaller(timestampMs, audio)
+	}
+}
+
+// startRecordingIfAllowed starts the recorder once the tenant and caller allow it
+func (s *Session) startRecordingIfAllowed() {
+	if s.tenant == nil || !s.tenant.RecordCalls || !s.hasConsent(ConsentRecording) {
+		return
+	}
+	if s.degradation >= DegradeMedia {
+		log.Println("Not recording call under load:", s.callSid)
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.recorder != nil || s.callSid == "" {
+		return
+	}
+	recorder, err := newRecorder(s.callSid, s.startedAt, s.recordingBytes)
+	if err != nil {
+		log.Println("Error starting call recording:", err)
+		return
+	}
+	s.recorder = recorder
+	log.Println("Recording started for call", s.callSid)
+}
+
+// saveConsentSnippet writes the buffered caller audio as evidence of a consent answer
+func (s *Session) saveConsentSnippet(at time.Time) string {
+	s.Lock()
+	audio := append([]byte(nil), s.audioRing...)
+	callSid := s.callSid
+	s.Unlock()
+	if len(audio) == 0 || callSid == "" {
+		return ""
+	}
+	path := filepath.Join(dataDir("consent"), fmt.Sprintf("%s-%d.alaw", callSid, at.UnixMilli()))
+	if err := os.WriteFile(path, audio, 0o600); err != nil {
+		log.Println("Error saving consent snippet:", err)
+		return ""
+	}
+	return path
+}
+
+func init() {
+	registerTool(&Tool{
+		Name:        "record_consent",
+		Description: "Record the caller's explicit yes/no answers to the consent questions. Only include answers the caller actually gave.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				ConsentRecording:   map[string]interface{}{"type": "boolean", "description": "Caller agrees to the call being recorded"},
+				ConsentSMS:         map[string]interface{}{"type": "boolean", "description": "Caller agrees to receive SMS follow-ups"},
+				ConsentDataStorage: map[string]interface{}{"type": "boolean", "description": "Caller agrees to their data being stored"},
+			},
+		},
+		Available: func(s *Session) bool {
+			return s.tenant != nil && s.tenant.Consent != nil && len(s.tenant.Consent.Require) > 0
+		},
+		Handler: func(s *Session, args json.RawMessage) (interface{}, error) {
+			var answers map[string]bool
+			if err := json.Unmarshal(args, &answers); err != nil {
+				return nil, err
+			}
+			now := time.Now().UTC()
+			snippet := s.saveConsentSnippet(now)
+
+			s.Lock()
+			var offset int64
+			if s.recorder != nil {
+				offset = s.recorder.position()
+			}
+			recorded := []string{}
+			for kind, granted := range answers {
+				if _, known := consentDescriptions[kind]; !known {
+					continue
+				}
+				s.consent[kind] = ConsentDecision{Granted: granted, At: now, Snippet: snippet, RecordingOffset: offset}
+				recorded = append(recorded, kind)
+			}
+			s.Unlock()
+
+			log.Printf("Consent recorded on call %s: %v\n", s.callSid, answers)
+			s.startRecordingIfAllowed()
+			// Drop the consent prompt and expose tools that were waiting on consent
+			s.sendSessionUpdate()
+			return map[string]interface{}{"status": "recorded", "consents": recorded}, nil
+		},
+	})
+}
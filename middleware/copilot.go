@@ -0,0 +1,167 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Co-pilot event types
+const (
+	// CopilotTranscript is a finished utterance by the caller or assistant
+	CopilotTranscript = "transcript"
+	// CopilotTextDelta and CopilotTextDone carry the text of the response
+	// the model is producing, before and as it is spoken
+	CopilotTextDelta = "text.delta"
+	CopilotTextDone  = "text.done"
+	// CopilotToolResult is a tool call with its output or error
+	CopilotToolResult = "tool.result"
+	// CopilotEnded is the last event of a stream
+	CopilotEnded = "call.ended"
+)
+
+// copilotBuffer is how many events a slow co-pilot may fall behind before
+// events are dropped for it
+const copilotBuffer = 256
+
+// CopilotEvent is one update streamed to an agent-assist co-pilot
+type CopilotEvent struct {
+	Type    string          `json:"type"`
+	At      time.Time       `json:"at"`
+	Speaker string          `json:"speaker,omitempty"`
+	ItemID  string          `json:"item_id,omitempty"`
+	Text    string          `json:"text,omitempty"`
+	Tool    *ToolCallRecord `json:"tool,omitempty"`
+}
+
+// copilotFeed fans a session's co-pilot events out to the connected UIs
+type copilotFeed struct {
+	sync.Mutex
+	subscribers map[chan CopilotEvent]bool
+	closed      bool
+}
+
+// subscribe registers a co-pilot; it fails once the call has ended
+func (f *copilotFeed) subscribe() (chan CopilotEvent, bool) {
+	f.Lock()
+	defer f.Unlock()
+	if f.closed {
+		return nil, false
+	}
+	if f.subscribers == nil {
+		f.subscribers = make(map[chan CopilotEvent]bool)
+	}
+	ch := make(chan CopilotEvent, copilotBuffer)
+	f.subscribers[ch] = true
+	return ch, true
+}
+
+// unsubscribe removes a co-pilot that disconnected
+func (f *copilotFeed) unsubscribe(ch chan CopilotEvent) {
+	f.Lock()
+	defer f.Unlock()
+	if f.subscribers[ch] {
+		delete(f.subscribers, ch)
+		close(ch)
+	}
+}
+
+// publish sends an event to every co-pilot without waiting on slow ones
+func (f *copilotFeed) publish(event CopilotEvent) {
+	f.Lock()
+	defer f.Unlock()
+	if len(f.subscribers) == 0 {
+		return
+	}
+	event.At = time.Now().UTC()
+	for ch := range f.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// close ends every co-pilot stream when the call ends
+func (f *copilotFeed) close() {
+	f.Lock()
+	defer f.Unlock()
+	f.closed = true
+	for ch := range f.subscribers {
+		select {
+		case ch <- CopilotEvent{Type: CopilotEnded, At: time.Now().UTC()}:
+		default:
+		}
+		close(ch)
+	}
+	f.subscribers = nil
+}
+
+// modalities returns what the model responds with: agents in assist or
+// whisper mode write for a human agent instead of speaking to the caller
+func (s *Session) modalities() []string {
+	_, agent, _ := s.identity()
+	s.Lock()
+	whisper := s.whisper != nil
+	s.Unlock()
+	if agent.Assist || whisper {
+		return []string{"text"}
+	}
+	return []string{"text", "audio"}
+}
+
+// handleCopilotStream serves GET /calls/:id/copilot, a server-sent event
+// stream of a live call's transcript, the response text the model is
+// producing and its tool results, for human agents assisting or supervising
+func handleCopilotStream(c *gin.Context) {
+	s := fleet.findSession(c.Param("id"))
+	if s == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no live session for that call on this instance"})
+		return
+	}
+	ch, ok := s.copilot.subscribe()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "call has ended"})
+		return
+	}
+	defer s.copilot.unsubscribe(ch)
+
+	// A co-pilot joining mid-call first gets the conversation so far
+	s.Lock()
+	backlog := make([]CopilotEvent, 0, len(s.transcript)+len(s.toolCalls))
+	for _, entry := range s.transcript {
+		backlog = append(backlog, CopilotEvent{Type: CopilotTranscript, At: entry.At, Speaker: entry.Speaker, Text: entry.Text})
+	}
+	for i := range s.toolCalls {
+		tool := s.toolCalls[i]
+		backlog = append(backlog, CopilotEvent{Type: CopilotToolResult, At: tool.At, Tool: &tool})
+	}
+	s.Unlock()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	for _, event := range backlog {
+		c.SSEvent(event.Type, event)
+	}
+	c.Writer.Flush()
+	heartbeat := time.NewTicker(getEnvDuration("COPILOT_HEARTBEAT", 15*time.Second))
+	defer heartbeat.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, open := <-ch:
+			if !open {
+				return false
+			}
+			c.SSEvent(event.Type, event)
+			return event.Type != CopilotEnded
+		case <-heartbeat.C:
+			io.WriteString(w, ": keepalive\n\n")
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
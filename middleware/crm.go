@@ -0,0 +1,439 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Supported CRM providers
+const (
+	CRMHubSpot    = "hubspot"
+	CRMSalesforce = "salesforce"
+)
+
+const (
+	hubSpotAPIURL        = "https://api.hubapi.com"
+	hubSpotTokenURL      = "https://api.hubapi.com/oauth/v1/token"
+	salesforceTokenURL   = "https://login.salesforce.com/services/oauth2/token"
+	salesforceAPIVersion = "v59.0"
+
+	// hubSpotCallToContact is HubSpot's association type ID for call -> contact
+	hubSpotCallToContact = 194
+)
+
+// CRMConfig holds a tenant's CRM provider and OAuth credentials
+type CRMConfig struct {
+	Provider     string `json:"provider"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+	AccessToken  string `json:"access_token,omitempty"`
+	TokenURL     string `json:"token_url,omitempty"`
+	InstanceURL  string `json:"instance_url,omitempty"`
+}
+
+// oauthToken is a cached access token for one tenant
+type oauthToken struct {
+	accessToken string
+	instanceURL string
+	expiresAt   time.Time
+}
+
+// CRMWriter logs finished calls into each tenant's CRM
+type CRMWriter struct {
+	sync.Mutex
+	tokens map[string]oauthToken
+}
+
+// newCRMWriter creates a writer with an empty token cache
+func newCRMWriter() *CRMWriter {
+	return &CRMWriter{tokens: make(map[string]oauthToken)}
+}
+
+// logCall writes the call to the tenant's CRM in the background
+func (w *CRMWriter) logCall(tenant *Tenant, record CallRecord) {
+	if tenant == nil || tenant.CRM == nil || record.From == "" {
+		return
+	}
+	go func() {
+		var err error
+		switch tenant.CRM.Provider {
+		case CRMHubSpot:
+			err = w.logHubSpot(tenant, record)
+		case CRMSalesforce:
+			err = w.logSalesforce(tenant, record)
+		default:
+			err = fmt.Errorf("unknown CRM provider %q", tenant.CRM.Provider)
+		}
+		if err != nil {
+			log.Printf("Error writing call %s to %s CRM for tenant %s: %v\n", record.CallSid, tenant.CRM.Provider, tenant.ID, err)
+			return
+		}
+		log.Printf("Logged call %s to %s CRM for tenant %s\n", record.CallSid, tenant.CRM.Provider, tenant.ID)
+	}()
+}
+
+// token returns a valid access token, refreshing it via OAuth when needed
+func (w *CRMWriter) token(tenant *Tenant) (oauthToken, error) {
+	cfg := tenant.CRM
+	w.Lock()
+	cached, ok := w.tokens[tenant.ID]
+	w.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached, nil
+	}
+	if cfg.RefreshToken == "" {
+		if cfg.AccessToken == "" {
+			return oauthToken{}, fmt.Errorf("no OAuth credentials configured")
+		}
+		return oauthToken{accessToken: cfg.AccessToken, instanceURL: cfg.InstanceURL}, nil
+	}
+
+	tokenURL := cfg.TokenURL
+	if tokenURL == "" {
+		tokenURL = hubSpotTokenURL
+		if cfg.Provider == CRMSalesforce {
+			tokenURL = salesforceTokenURL
+		}
+	}
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {cfg.ClientID},
+		"client_secret": {cfg.ClientSecret},
+		"refresh_token": {cfg.RefreshToken},
+	}
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		InstanceURL string `json:"instance_url"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := postForm(tokenURL, form, &resp); err != nil {
+		return oauthToken{}, fmt.Errorf("refreshing OAuth token: %w", err)
+	}
+
+	// Salesforce does not return expires_in; assume a conservative lifetime
+	lifetime := time.Duration(resp.ExpiresIn) * time.Second
+	if lifetime <= 0 {
+		lifetime = 30 * time.Minute
+	}
+	token := oauthToken{
+		accessToken: resp.AccessToken,
+		instanceURL: resp.InstanceURL,
+		expiresAt:   time.Now().Add(lifetime - time.Minute),
+	}
+	if token.instanceURL == "" {
+		token.instanceURL = cfg.InstanceURL
+	}
+	w.Lock()
+	w.tokens[tenant.ID] = token
+	w.Unlock()
+	return token, nil
+}
+
+// logHubSpot upserts the contact by phone and logs a call engagement
+func (w *CRMWriter) logHubSpot(tenant *Tenant, record CallRecord) error {
+	token, err := w.token(tenant)
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{"Authorization": "Bearer " + token.accessToken}
+
+	var search struct {
+		Results []struct {
+			ID         string            `json:"id"`
+			Properties map[string]string `json:"properties"`
+		} `json:"results"`
+	}
+	query := map[string]interface{}{
+		"filterGroups": []interface{}{map[string]interface{}{
+			"filters": []interface{}{map[string]interface{}{
+				"propertyName": "phone", "operator": "EQ", "value": record.From,
+			}},
+		}},
+		"properties": hubSpotFields.names(),
+		"limit":      1,
+	}
+	if err := doJSON("POST", hubSpotAPIURL+"/crm/v3/objects/contacts/search", query, headers, &search); err != nil {
+		return fmt.Errorf("searching contact: %w", err)
+	}
+
+	details, review := record.contactDetails(hubSpotFields)
+	contactID := ""
+	if len(search.Results) > 0 {
+		contactID = search.Results[0].ID
+		var conflicts []string
+		details, conflicts = mergeDetails(details, search.Results[0].Properties)
+		review = append(review, conflicts...)
+		if len(details) > 0 {
+			update := map[string]interface{}{"properties": details}
+			if err := doJSON("PATCH", hubSpotAPIURL+"/crm/v3/objects/contacts/"+contactID, update, headers, nil); err != nil {
+				return fmt.Errorf("updating contact: %w", err)
+			}
+		}
+	} else {
+		var created struct {
+			ID string `json:"id"`
+		}
+		details["phone"] = record.From
+		contact := map[string]interface{}{"properties": details}
+		if err := doJSON("POST", hubSpotAPIURL+"/crm/v3/objects/contacts", contact, headers, &created); err != nil {
+			return fmt.Errorf("creating contact: %w", err)
+		}
+		contactID = created.ID
+	}
+
+	from, to, direction := record.From, record.To, "INBOUND"
+	if record.Outbound {
+		from, to, direction = record.To, record.From, "OUTBOUND"
+	}
+	properties := map[string]interface{}{
+		"hs_timestamp":        record.StartedAt.Format(time.RFC3339),
+		"hs_call_title":       "AI voice assistant call",
+		"hs_call_body":        callActivitySummary(record) + reviewNote(review),
+		"hs_call_duration":    fmt.Sprintf("%d", record.duration().Milliseconds()),
+		"hs_call_from_number": from,
+		"hs_call_to_number":   to,
+		"hs_call_status":      "COMPLETED",
+		"hs_call_direction":   direction,
+	}
+	if record.Status == CallFailed {
+		properties["hs_call_status"] = "FAILED"
+	}
+	call := map[string]interface{}{
+		"properties": properties,
+		"associations": []interface{}{map[string]interface{}{
+			"to": map[string]string{"id": contactID},
+			"types": []interface{}{map[string]interface{}{
+				"associationCategory": "HUBSPOT_DEFINED",
+				"associationTypeId":   hubSpotCallToContact,
+			}},
+		}},
+	}
+	if err := doJSON("POST", hubSpotAPIURL+"/crm/v3/objects/calls", call, headers, nil); err != nil {
+		return fmt.Errorf("creating call activity: %w", err)
+	}
+	return nil
+}
+
+// soqlEscape escapes a value for a quoted SOQL string literal, backslashes
+// included so a caller-supplied backslash cannot unescape the closing quote
+func soqlEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`).Replace(value)
+}
+
+// logSalesforce upserts the contact by phone and logs a completed call task
+func (w *CRMWriter) logSalesforce(tenant *Tenant, record CallRecord) error {
+	token, err := w.token(tenant)
+	if err != nil {
+		return err
+	}
+	if token.instanceURL == "" {
+		return fmt.Errorf("no Salesforce instance URL")
+	}
+	base := strings.TrimRight(token.instanceURL, "/") + "/services/data/" + salesforceAPIVersion
+	headers := map[string]string{"Authorization": "Bearer " + token.accessToken}
+
+	soql := fmt.Sprintf("SELECT Id, %s FROM Contact WHERE Phone = '%s' LIMIT 1", strings.Join(salesforceFields.names(), ", "), soqlEscape(record.From))
+	var result struct {
+		Records []map[string]interface{} `json:"records"`
+	}
+	if err := doJSON("GET", base+"/query?q="+url.QueryEscape(soql), nil, headers, &result); err != nil {
+		return fmt.Errorf("querying contact: %w", err)
+	}
+
+	details, review := record.contactDetails(salesforceFields)
+	contactID := ""
+	if len(result.Records) > 0 {
+		existing := map[string]string{}
+		for name, value := range result.Records[0] {
+			existing[name], _ = value.(string)
+		}
+		contactID = existing["Id"]
+		var conflicts []string
+		details, conflicts = mergeDetails(details, existing)
+		review = append(review, conflicts...)
+		if len(details) > 0 {
+			if err := doJSON("PATCH", base+"/sobjects/Contact/"+contactID, details, headers, nil); err != nil {
+				return fmt.Errorf("updating contact: %w", err)
+			}
+		}
+	} else {
+		var created struct {
+			ID string `json:"id"`
+		}
+		contact := details
+		contact["LastName"] = "Caller " + record.From
+		contact["Phone"] = record.From
+		if err := doJSON("POST", base+"/sobjects/Contact", contact, headers, &created); err != nil {
+			return fmt.Errorf("creating contact: %w", err)
+		}
+		contactID = created.ID
+	}
+
+	callType := "Inbound"
+	if record.Outbound {
+		callType = "Outbound"
+	}
+	task := map[string]interface{}{
+		"WhoId":                 contactID,
+		"Subject":               "AI voice assistant call",
+		"Description":           callActivitySummary(record) + reviewNote(review),
+		"TaskSubtype":           "Call",
+		"Status":                "Completed",
+		"CallType":              callType,
+		"CallDurationInSeconds": int(record.DurationSec),
+		"ActivityDate":          record.StartedAt.Format("2006-01-02"),
+	}
+	if err := doJSON("POST", base+"/sobjects/Task", task, headers, nil); err != nil {
+		return fmt.Errorf("creating call task: %w", err)
+	}
+	return nil
+}
+
+// crmFields names the contact fields a CRM keeps captured details in
+type crmFields struct {
+	Email    string
+	Street   string
+	City     string
+	Region   string
+	Postcode string
+	Country  string
+}
+
+var (
+	hubSpotFields    = crmFields{Email: "email", Street: "address", City: "city", Region: "state", Postcode: "zip", Country: "country"}
+	salesforceFields = crmFields{Email: "Email", Street: "MailingStreet", City: "MailingCity", Region: "MailingState", Postcode: "MailingPostalCode", Country: "MailingCountry"}
+)
+
+// names lists the fields, to read a matched contact's current values
+func (f crmFields) names() []string {
+	return []string{f.Email, f.Street, f.City, f.Region, f.Postcode, f.Country}
+}
+
+// contactDetails returns the confirmed details the call captured, by CRM
+// field, and describes for review the ones that fit no field: an address
+// is only written when it splits into its parts
+func (r CallRecord) contactDetails(fields crmFields) (map[string]string, []string) {
+	details := map[string]string{}
+	var review []string
+	if email, ok := r.capturedOfKind(CaptureEmail); ok {
+		details[fields.Email] = email
+	}
+	if address, ok := r.capturedOfKind(CaptureAddress); ok {
+		parts, ok := splitAddress(address)
+		if !ok {
+			review = append(review, "address given on the call: "+address)
+		}
+		for name, value := range map[string]string{fields.Street: parts.Street, fields.City: parts.City, fields.Region: parts.Region, fields.Postcode: parts.Postcode, fields.Country: parts.Country} {
+			if value != "" {
+				details[name] = value
+			}
+		}
+	}
+	return details, review
+}
+
+// mergeDetails keeps the details for fields the matched contact has empty.
+// The contact was matched by caller ID alone, which can be spoofed, so
+// values that would replace what the CRM holds are described for review
+// instead of written
+func mergeDetails(details, existing map[string]string) (map[string]string, []string) {
+	fill := map[string]string{}
+	var conflicts []string
+	for _, name := range sortedKeys(details) {
+		current := strings.TrimSpace(existing[name])
+		switch {
+		case current == "":
+			fill[name] = details[name]
+		case !strings.EqualFold(current, details[name]):
+			conflicts = append(conflicts, fmt.Sprintf("%s given on the call: %s (contact has %s)", name, details[name], current))
+		}
+	}
+	return fill, conflicts
+}
+
+// reviewNote appends the details left for someone to review to the activity text
+func reviewNote(review []string) string {
+	if len(review) == 0 {
+		return ""
+	}
+	return "\nNot applied to the contact, please review:\n- " + strings.Join(review, "\n- ")
+}
+
+// AddressParts is a captured address split into the fields CRMs keep
+type AddressParts struct {
+	Street   string
+	City     string
+	Region   string
+	Postcode string
+	Country  string
+}
+
+var (
+	// usRegionPostcode matches a "CA 94043" segment, as Google formats it
+	usRegionPostcode = regexp.MustCompile(`^([A-Z]{2})\s+(\d{5}(?:-\d{4})?)$`)
+	// usLastLine matches a "Mountain View CA 94043-1351" segment, as Smarty formats it
+	usLastLine = regexp.MustCompile(`^(.+?)\s+([A-Z]{2})\s+(\d{5}(?:-\d{4})?)$`)
+)
+
+// splitAddress splits a US address in the formats the validation providers
+// return into its parts; other addresses are not split
+func splitAddress(address string) (AddressParts, bool) {
+	var segments []string
+	for _, segment := range strings.Split(address, ",") {
+		if segment = strings.TrimSpace(segment); segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	var parts AddressParts
+	if n := len(segments); n > 0 {
+		switch strings.ToUpper(segments[n-1]) {
+		case "USA", "US", "UNITED STATES":
+			parts.Country = "US"
+			segments = segments[:n-1]
+		}
+	}
+	n := len(segments)
+	if n >= 3 {
+		if m := usRegionPostcode.FindStringSubmatch(segments[n-1]); m != nil {
+			parts.Street, parts.City, parts.Region, parts.Postcode = strings.Join(segments[:n-2], ", "), segments[n-2], m[1], m[2]
+			return parts, true
+		}
+	}
+	if n >= 2 {
+		if m := usLastLine.FindStringSubmatch(segments[n-1]); m != nil {
+			parts.Street, parts.City, parts.Region, parts.Postcode = strings.Join(segments[:n-1], ", "), m[1], m[2], m[3]
+			return parts, true
+		}
+	}
+	return AddressParts{}, false
+}
+
+// capturedOfKind returns the first confirmed detail of a kind the call's
+// agent captured; only values validated and read back reach the CRM
+func (r CallRecord) capturedOfKind(kind string) (string, bool) {
+	for _, field := range agents.get(r.Agent).Capture {
+		if value, ok := r.Captured[field.Name]; ok && field.Kind == kind {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// callActivitySummary composes the activity text written to the CRM
+func callActivitySummary(record CallRecord) string {
+	summary := fmt.Sprintf("Call %s with the AI voice assistant (%s, %s).",
+		record.CallSid, record.Status, record.duration().Round(time.Second))
+	if record.Summary != "" {
+		summary += "\n" + record.Summary
+	}
+	if record.RecordingURL != "" {
+		summary += "\nRecording: " + record.RecordingURL
+	}
+	return summary
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// emailPattern finds email addresses to redact from dataset text
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// DatasetMessage is one chat message in the fine-tuning format
+type DatasetMessage struct {
+	Role       string            `json:"role"`
+	Content    string            `json:"content,omitempty"`
+	ToolCalls  []DatasetToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string            `json:"tool_call_id,omitempty"`
+}
+
+// DatasetToolCall is an assistant's function call in the fine-tuning format
+type DatasetToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// DatasetAudio points a message at its span of the call recording
+type DatasetAudio struct {
+	Message int     `json:"message"`
+	Track   string  `json:"track"`
+	Start   float64 `json:"start"`
+	End     float64 `json:"end"`
+}
+
+// DatasetMetadata describes where an example came from; fine-tuning ignores it
+type DatasetMetadata struct {
+	CallSid     string         `json:"call_sid"`
+	Tenant      string         `json:"tenant"`
+	Agent       string         `json:"agent"`
+	Disposition string         `json:"disposition,omitempty"`
+	Contained   bool           `json:"contained"`
+	Recording   string         `json:"recording,omitempty"`
+	Audio       []DatasetAudio `json:"audio,omitempty"`
+}
+
+// DatasetExample is one call as a line of a JSONL dataset
+type DatasetExample struct {
+	Messages []DatasetMessage         `json:"messages"`
+	Tools    []map[string]interface{} `json:"tools,omitempty"`
+	Metadata DatasetMetadata          `json:"metadata"`
+}
+
+// datasetPhonePattern finds phone numbers written with separators, as in
+// "415-555-0100", "(415) 555 0100" or "4 1 5 5 5 5 0 1 0 0"
+var datasetPhonePattern = regexp.MustCompile(`\+?\(?\d(?:[\s.\-()]{0,2}\d){6,14}`)
+
+// spokenNumberPattern finds runs of seven or more spoken digits, as in
+// "four one five, five five five, oh one double oh"
+var spokenNumberPattern = regexp.MustCompile(`(?i)\b(?:(?:` + strings.Join(append(sortedKeys(spokenDigits), `\d`), "|") + `)\b[\s,.\-]*|(?:double|triple)\s+){7,}`)
+
+// piiRedactor masks phone numbers, email addresses, the caller's name and
+// captured details, whether written in normalized form, formatted, spaced
+// out or spoken
+type piiRedactor struct {
+	known []piiValue
+}
+
+// piiValue is one known personal detail and the patterns that find it
+type piiValue struct {
+	value    string
+	label    string
+	patterns []*regexp.Regexp
+}
+
+// newPIIRedactor prepares redaction of the call's known personal details:
+// its numbers, the captured values as confirmed and as the caller gave
+// them, and the name the caller gave
+func newPIIRedactor(record CallRecord) piiRedactor {
+	var r piiRedactor
+	for _, known := range []string{record.From, record.To} {
+		r.add(known, "[PHONE]")
+		if parsed, err := parseNumber(known); err == nil {
+			r.add(parsed.National, "[PHONE]")
+		}
+	}
+	for name, value := range record.Captured {
+		r.add(value, "["+strings.ToUpper(name)+"]")
+	}
+	for _, call := range record.ToolCalls {
+		var args struct {
+			Field string `json:"field"`
+			Value string `json:"value"`
+			Name  string `json:"name"`
+		}
+		if json.Unmarshal(call.Arguments, &args) != nil {
+			continue
+		}
+		switch call.Name {
+		case "capture_field":
+			r.add(args.Value, "["+strings.ToUpper(args.Field)+"]")
+		case "remember_caller_name":
+			r.add(args.Name, "[NAME]")
+		}
+	}
+	if memory, ok := memories.get(record.Tenant, record.From); ok {
+		r.add(memory.Name, "[NAME]")
+	}
+	// Longer values first so they win over values they contain
+	sort.SliceStable(r.known, func(i, j int) bool { return len(r.known[i].value) > len(r.known[j].value) })
+	return r
+}
+
+// add registers a known detail: its text matched case-insensitively with
+// any spacing and, when it holds digits, those digits with separators or
+// spoken
+func (r *piiRedactor) add(value, label string) {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 {
+		return
+	}
+	words := strings.Fields(value)
+	for i, word := range words {
+		words[i] = regexp.QuoteMeta(word)
+	}
+	// Word boundaries keep a short name from matching inside other words
+	text := strings.Join(words, `[\s,]+`)
+	if isWordChar(value[0]) {
+		text = `\b` + text
+	}
+	if isWordChar(value[len(value)-1]) {
+		text += `\b`
+	}
+	known := piiValue{value: value, label: label}
+	known.patterns = append(known.patterns, regexp.MustCompile(`(?i)`+text))
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, spokenToDigits(value))
+	if len(digits) >= 4 {
+		written := make([]string, len(digits))
+		spoken := make([]string, len(digits))
+		for i, digit := range digits {
+			written[i] = string(digit)
+			spoken[i] = `(?:` + string(digit) + `|` + strings.Join(digitWords(string(digit)), "|") + `)`
+		}
+		known.patterns = append(known.patterns,
+			regexp.MustCompile(`\+?\(?`+strings.Join(written, `[\s.\-()]*`)),
+			regexp.MustCompile(`(?i)\b`+strings.Join(spoken, `[\s,.\-]*`)+`\b`),
+		)
+	}
+	r.known = append(r.known, known)
+}
+
+// isWordChar reports whether a byte counts as a word character for \b
+func isWordChar(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// digitWords returns the spoken forms of a digit
+func digitWords(digit string) []string {
+	var words []string
+	for _, word := range sortedKeys(spokenDigits) {
+		if spokenDigits[word] == digit {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// redact returns text with personal details replaced by placeholders
+func (r piiRedactor) redact(text string) string {
+	for _, known := range r.known {
+		for _, pattern := range known.patterns {
+			text = pattern.ReplaceAllLiteralString(text, known.label)
+		}
+	}
+	text = emailPattern.ReplaceAllString(text, "[EMAIL]")
+	text = spokenNumberPattern.ReplaceAllStringFunc(text, func(match string) string {
+		// Keep the separator the run swallowed after its last digit
+		return "[PHONE]" + match[len(strings.TrimRight(match, " \t\n,.-")):]
+	})
+	return datasetPhonePattern.ReplaceAllString(text, "[PHONE]")
+}
+
+// redactJSON redacts the strings in a JSON document, keeping it valid
+func (r piiRedactor) redactJSON(data json.RawMessage) string {
+	var value interface{}
+	if len(data) == 0 || json.Unmarshal(data, &value) != nil {
+		return "{}"
+	}
+	redacted, _ := json.Marshal(r.redactValue(value))
+	return string(redacted)
+}
+
+// redactValue walks a decoded JSON value redacting its strings
+func (r piiRedactor) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return r.redact(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = r.redactValue(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = r.redactValue(v[k])
+		}
+	}
+	return value
+}
+
+// datasetEvent is a turn or tool call placed on the call timeline
+type datasetEvent struct {
+	at   time.Time
+	turn *Turn
+	tool *ToolCallRecord
+}
+
+// datasetExample converts a call into chat messages with its tool calls in
+// order, redacting personal details
+func datasetExample(record CallRecord, withRecording bool) DatasetExample {
+	redactor := newPIIRedactor(record)
+	agent := agents.get(record.Agent)
+	example := DatasetExample{
+		Messages: []DatasetMessage{{Role: "system", Content: agent.Instructions}},
+		Metadata: DatasetMetadata{
+			CallSid:     record.CallSid,
+			Tenant:      record.Tenant,
+			Agent:       record.Agent,
+			Disposition: record.Disposition,
+			Contained:   record.Contained,
+		},
+	}
+	if withRecording && record.Recording != nil {
+		example.Metadata.Recording = "recordings/" + record.CallSid + ".wav"
+	}
+
+	var events []datasetEvent
+	for i := range record.Turns {
+		if record.Turns[i].Transcript != "" {
+			events = append(events, datasetEvent{at: record.Turns[i].StartedAt, turn: &record.Turns[i]})
+		}
+	}
+	// Calls without turn data fall back to the plain transcript
+	if len(events) == 0 {
+		for _, entry := range record.Transcript {
+			events = append(events, datasetEvent{at: entry.At, turn: &Turn{Speaker: entry.Speaker, Transcript: entry.Text, AudioStart: -1}})
+		}
+	}
+	for i := range record.ToolCalls {
+		events = append(events, datasetEvent{at: record.ToolCalls[i].At, tool: &record.ToolCalls[i]})
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].at.Before(events[j].at) })
+
+	toolNames := map[string]bool{}
+	for i, event := range events {
+		if event.tool != nil {
+			call := DatasetToolCall{ID: event.tool.CallID, Type: "function"}
+			if call.ID == "" {
+				call.ID = "call_" + record.CallSid + "_" + strconv.Itoa(i)
+			}
+			call.Function.Name = event.tool.Name
+			call.Function.Arguments = redactor.redactJSON(event.tool.Arguments)
+			output := event.tool.Output
+			if event.tool.Error != "" {
+				output, _ = json.Marshal(map[string]string{"error": event.tool.Error})
+			}
+			example.Messages = append(example.Messages,
+				DatasetMessage{Role: "assistant", ToolCalls: []DatasetToolCall{call}},
+				DatasetMessage{Role: "tool", ToolCallID: call.ID, Content: redactor.redactJSON(output)},
+			)
+			toolNames[event.tool.Name] = true
+			continue
+		}
+		turn := event.turn
+		role, track := "user", "caller"
+		if turn.Speaker == SpeakerAssistant {
+			role, track = "assistant", "assistant"
+		}
+		example.Messages = append(example.Messages, DatasetMessage{Role: role, Content: redactor.redact(turn.Transcript)})
+		if example.Metadata.Recording != "" && turn.AudioStart >= 0 && turn.AudioEnd > turn.AudioStart {
+			example.Metadata.Audio = append(example.Metadata.Audio, DatasetAudio{
+				Message: len(example.Messages) - 1,
+				Track:   track,
+				Start:   float64(turn.AudioStart) / bytesPerSecond,
+				End:     float64(turn.AudioEnd) / bytesPerSecond,
+			})
+		}
+	}
+
+	for _, name := range sortedBoolKeys(toolNames) {
+		tool, ok := lookupTool(name)
+		if !ok {
+			continue
+		}
+		example.Tools = append(example.Tools, map[string]interface{}{
+			"type": "function",
+			"function": map[string]interface{}{
+				"name":        tool.Name,
+				"description": tool.Description,
+				"parameters":  tool.Parameters,
+			},
+		})
+	}
+	return example
+}
+
+// sortedBoolKeys returns a set's members in order
+func sortedBoolKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// inDataset reports whether a call belongs in a dataset export; calls are
+// only used for training once flagged in
+func inDataset(record CallRecord) bool {
+	return record.Dataset != nil && *record.Dataset
+}
+
+// writeDataset adds dataset.jsonl with one example per selected call
+func writeDataset(archive archiveWriter, records []CallRecord, req ExportRequest) error {
+	var lines strings.Builder
+	for _, record := range records {
+		if !inDataset(record) || (len(record.Turns) == 0 && len(record.Transcript) == 0) {
+			continue
+		}
+		line, err := json.Marshal(datasetExample(record, containsString(req.Include, ExportRecordings)))
+		if err != nil {
+			return err
+		}
+		lines.Write(line)
+		lines.WriteByte('\n')
+	}
+	return archive.add("dataset.jsonl", []byte(lines.String()))
+}
+
+// handleSetDatasetInclusion serves PUT /calls/:id/dataset, flagging a call
+// in or out of dataset exports; a null include clears the flag
+func handleSetDatasetInclusion(c *gin.Context) {
+	var body struct {
+		Include *bool `json:"include"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err := callStore.update(c.Param("id"), func(record *CallRecord) error {
+		record.Dataset = body.Include
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"call_sid": c.Param("id"), "include": body.Include})
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"html"
+	"log"
+	"net/http"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Degradation levels, each including the ones below it
+const (
+	DegradeNone = iota
+	// DegradeMedia stops recording and caller transcription on new calls
+	DegradeMedia
+	// DegradeAnalysis skips post-call classification and rubric scoring
+	DegradeAnalysis
+	// DegradeShed turns away new calls below the shed priority
+	DegradeShed
+)
+
+// degradeLevelNames label the levels in logs, metrics and CDRs
+var degradeLevelNames = []string{"none", "media", "analysis", "shed"}
+
+// DegradeStep is one change of degradation level
+type DegradeStep struct {
+	At         time.Time `json:"at"`
+	From       string    `json:"from"`
+	To         string    `json:"to"`
+	CPUPercent float64   `json:"cpu_percent"`
+	MemoryMB   float64   `json:"memory_mb"`
+}
+
+// Degrader raises the degradation level one step per sample while CPU or
+// memory is over its threshold, and lowers it one step after several
+// samples comfortably below both
+type Degrader struct {
+	sync.Mutex
+	cpuThreshold  float64
+	memThreshold  float64
+	shedPriority  int
+	shedMessage   string
+	level         int
+	calmSamples   int
+	cpuPercent    float64
+	memoryMB      float64
+	steps         []DegradeStep
+	levelSince    time.Time
+	timeAtLevel   []time.Duration
+	degradedCalls int
+	shedCalls     int
+	skippedJobs   int
+
+	lastCPU    time.Duration
+	lastSample time.Time
+}
+
+// newDegrader starts sampling process load when a threshold is configured
+func newDegrader() *Degrader {
+	d := &Degrader{
+		cpuThreshold: getEnvFloat("DEGRADE_CPU_PERCENT", 0),
+		memThreshold: getEnvFloat("DEGRADE_MEMORY_MB", 0),
+		shedPriority: getEnvInt("DEGRADE_SHED_PRIORITY", 0),
+		shedMessage:  getEnv("DEGRADE_SHED_MESSAGE", "All of our assistants are busy right now. Please call again in a few minutes."),
+		levelSince:   time.Now(),
+		timeAtLevel:  make([]time.Duration, len(degradeLevelNames)),
+	}
+	if d.cpuThreshold <= 0 && d.memThreshold <= 0 {
+		return d
+	}
+	d.lastCPU, d.lastSample = processCPUTime(), time.Now()
+	go func() {
+		for range time.Tick(getEnvDuration("DEGRADE_SAMPLE_INTERVAL", 5*time.Second)) {
+			d.sample()
+		}
+	}()
+	log.Printf("Adaptive degradation enabled (cpu %.0f%%, memory %.0f MB)\n", d.cpuThreshold, d.memThreshold)
+	return d
+}
+
+// processCPUTime returns the user and system CPU time the process has used
+func processCPUTime() time.Duration {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
+
+// sample measures load and moves the level by at most one step
+func (d *Degrader) sample() {
+	now := time.Now()
+	cpu := processCPUTime()
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	d.Lock()
+	defer d.Unlock()
+	// Percent of all cores, so a fully busy 4-core host reads 100
+	elapsed := now.Sub(d.lastSample)
+	if elapsed > 0 {
+		d.cpuPercent = 100 * float64(cpu-d.lastCPU) / float64(elapsed) / float64(runtime.NumCPU())
+	}
+	d.lastCPU, d.lastSample = cpu, now
+	// The live heap rather than Sys, which holds at its peak and would never
+	// let the level recover
+	d.memoryMB = float64(mem.HeapAlloc) / (1 << 20)
+
+	over := (d.cpuThreshold > 0 && d.cpuPercent >= d.cpuThreshold) ||
+		(d.memThreshold > 0 && d.memoryMB >= d.memThreshold)
+	// Recover only with some headroom so the level does not flap
+	calm := (d.cpuThreshold <= 0 || d.cpuPercent < 0.8*d.cpuThreshold) &&
+		(d.memThreshold <= 0 || d.memoryMB < 0.8*d.memThreshold)
+	switch {
+	case over && d.level < DegradeShed:
+		d.calmSamples = 0
+		d.setLevel(d.level + 1)
+	case calm && d.level > DegradeNone:
+		d.calmSamples++
+		if d.calmSamples >= 3 {
+			d.calmSamples = 0
+			d.setLevel(d.level - 1)
+		}
+	case !calm:
+		d.calmSamples = 0
+	}
+}
+
+// setLevel records and logs a level change; the caller holds the lock
+func (d *Degrader) setLevel(level int) {
+	step := DegradeStep{
+		At:         time.Now().UTC(),
+		From:       degradeLevelNames[d.level],
+		To:         degradeLevelNames[level],
+		CPUPercent: d.cpuPercent,
+		MemoryMB:   d.memoryMB,
+	}
+	d.timeAtLevel[d.level] += time.Since(d.levelSince)
+	d.levelSince = time.Now()
+	d.level = level
+	d.steps = append(d.steps, step)
+	if len(d.steps) > 100 {
+		d.steps = d.steps[len(d.steps)-100:]
+	}
+	log.Printf("Degradation level %s -> %s (cpu %.0f%%, memory %.0f MB)\n", step.From, step.To, step.CPUPercent, step.MemoryMB)
+}
+
+// current returns the degradation level
+func (d *Degrader) current() int {
+	d.Lock()
+	defer d.Unlock()
+	return d.level
+}
+
+// admitCall counts a new call of the given priority rank and reports
+// whether it may go ahead
+func (d *Degrader) admitCall(rank int) bool {
+	d.Lock()
+	defer d.Unlock()
+	if d.level >= DegradeShed && rank < d.shedPriority {
+		d.shedCalls++
+		return false
+	}
+	if d.level > DegradeNone {
+		d.degradedCalls++
+	}
+	return true
+}
+
+// skipAnalysis reports whether post-call model jobs should be skipped
+func (d *Degrader) skipAnalysis() bool {
+	d.Lock()
+	defer d.Unlock()
+	if d.level < DegradeAnalysis {
+		return false
+	}
+	d.skippedJobs++
+	return true
+}
+
+// degradedSteps names the degradations applied to a call at the given level
+func degradedSteps(level int) []string {
+	if level <= DegradeNone {
+		return nil
+	}
+	return append([]string(nil), degradeLevelNames[1:level+1]...)
+}
+
+// handleDegradationStatus serves GET /admin/degradation
+func handleDegradationStatus(c *gin.Context) {
+	degrader.Lock()
+	defer degrader.Unlock()
+	seconds := make(map[string]float64, len(degradeLevelNames))
+	for level, name := range degradeLevelNames {
+		spent := degrader.timeAtLevel[level]
+		if level == degrader.level {
+			spent += time.Since(degrader.levelSince)
+		}
+		seconds[name] = spent.Seconds()
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"level":          degradeLevelNames[degrader.level],
+		"cpu_percent":    degrader.cpuPercent,
+		"memory_mb":      degrader.memoryMB,
+		"thresholds":     gin.H{"cpu_percent": degrader.cpuThreshold, "memory_mb": degrader.memThreshold, "shed_priority": degrader.shedPriority},
+		"seconds":        seconds,
+		"degraded_calls": degrader.degradedCalls,
+		"shed_calls":     degrader.shedCalls,
+		"skipped_jobs":   degrader.skippedJobs,
+		"steps":          degrader.steps,
+	})
+}
+
+// shedTwiML politely turns away a call shed under load
+func (d *Degrader) shedTwiML(locale Locale) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<Response>
+    <Say` + locale.sayAttributes() + `>` + html.EscapeString(d.shedMessage) + `</Say>
+    <Hangup/>
+</Response>`
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Registry check outcomes
+const (
+	RegistryClear   = "clear"
+	RegistryListed  = "listed"
+	RegistryError   = "error"
+	RegistrySkipped = "skipped"
+)
+
+// Campaign contact statuses
+const (
+	ContactCalled  = "called"
+	ContactBlocked = "blocked"
+	ContactFailed  = "failed"
+)
+
+// DNCEntry is a number that must not be called
+type DNCEntry struct {
+	Number  string    `json:"number"`
+	Reason  string    `json:"reason,omitempty"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// DNCCheck is the outcome of checking one number before dialing it
+type DNCCheck struct {
+	Number    string    `json:"number"`
+	CheckedAt time.Time `json:"checked_at"`
+	Internal  bool      `json:"internal_listed"`
+	Registry  string    `json:"registry"`
+	Allowed   bool      `json:"allowed"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// DNCRegistry holds the internal do-not-call list and checks numbers against
+// it and an optional external registry; API changes are saved to DATA_DIR
+type DNCRegistry struct {
+	sync.RWMutex
+	path    string
+	entries map[string]DNCEntry
+	// managed entries were added through the API and are saved; inFile
+	// keeps the DNC_FILE entries, restored on every start and when an API
+	// entry for the same number is removed
+	managed map[string]bool
+	inFile  map[string]DNCEntry
+
+	registryURL   string
+	registryToken string
+	// failOpen lets calls through when the external registry cannot be reached
+	failOpen bool
+}
+
+// loadDNCRegistry reads DNC_FILE, then numbers saved through the admin API
+func loadDNCRegistry() *DNCRegistry {
+	r := &DNCRegistry{
+		path:          dataPath("dnc.json"),
+		entries:       make(map[string]DNCEntry),
+		managed:       make(map[string]bool),
+		inFile:        make(map[string]DNCEntry),
+		registryURL:   getEnv("DNC_REGISTRY_URL", ""),
+		registryToken: getEnv("DNC_REGISTRY_TOKEN", ""),
+		failOpen:      getEnvBool("DNC_FAIL_OPEN", false),
+	}
+	var list []DNCEntry
+	if _, err := loadJSONFile("DNC_FILE", &list); err != nil {
+		log.Println("Error loading DNC_FILE:", err)
+	}
+	var saved []DNCEntry
+	if err := readJSONFile(r.path, &saved); err != nil {
+		log.Println("Error loading saved do-not-call list:", err)
+	}
+	for _, entry := range list {
+		if key := dncKey(entry.Number); key != "" {
+			r.entries[key] = entry
+			r.inFile[key] = entry
+		}
+	}
+	for _, entry := range saved {
+		if key := dncKey(entry.Number); key != "" {
+			r.entries[key] = entry
+			r.managed[key] = true
+		}
+	}
+	return r
+}
+
+// dncKey reduces a number to the digits of its E.164 form so formatting
+// does not matter
+func dncKey(number string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, normalizeNumber(number))
+}
+
+// list returns the internal list sorted by number
+func (r *DNCRegistry) list() []DNCEntry {
+	r.RLock()
+	defer r.RUnlock()
+	list := make([]DNCEntry, 0, len(r.entries))
+	for _, entry := range r.entries {
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Number < list[j].Number })
+	return list
+}
+
+// add puts a number on the internal list and saves it
+func (r *DNCRegistry) add(entry DNCEntry) error {
+	key := dncKey(entry.Number)
+	r.Lock()
+	r.entries[key] = entry
+	r.managed[key] = true
+	r.Unlock()
+	return r.save()
+}
+
+// errDNCInFile is returned when removing a number DNC_FILE would bring back
+var errDNCInFile = errors.New("number is listed in DNC_FILE; remove it from the file")
+
+// remove takes a number added through the API off the internal list and
+// saves it, falling back to the DNC_FILE entry for the number if there is
+// one; numbers only in DNC_FILE cannot be removed, since the next start
+// would restore them
+func (r *DNCRegistry) remove(number string) (bool, error) {
+	key := dncKey(number)
+	r.Lock()
+	_, ok := r.entries[key]
+	if !r.managed[key] {
+		r.Unlock()
+		if ok {
+			return true, errDNCInFile
+		}
+		return false, nil
+	}
+	delete(r.managed, key)
+	if entry, inFile := r.inFile[key]; inFile {
+		r.entries[key] = entry
+	} else {
+		delete(r.entries, key)
+	}
+	r.Unlock()
+	return true, r.save()
+}
+
+// save writes the numbers added through the API
+func (r *DNCRegistry) save() error {
+	r.RLock()
+	list := make([]DNCEntry, 0, len(r.managed))
+	for key := range r.managed {
+		list = append(list, r.entries[key])
+	}
+	r.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Number < list[j].Number })
+	return writeJSONFile(r.path, list)
+}
+
+// check decides whether a number may be called. Restricted destinations and
+// internal entries are always blocked; a registry that cannot be reached
+// blocks the call unless DNC_FAIL_OPEN is set
+func (r *DNCRegistry) check(number string) DNCCheck {
+	result := DNCCheck{Number: number, CheckedAt: time.Now().UTC(), Registry: RegistrySkipped}
+	if rule, ok := restrictedNumbers.match(number); ok {
+		result.Reason = rule.Category + " number"
+		return result
+	}
+	r.RLock()
+	entry, listed := r.entries[dncKey(number)]
+	r.RUnlock()
+	if listed {
+		result.Internal = true
+		result.Reason = "on the internal do-not-call list"
+		if entry.Reason != "" {
+			result.Reason += ": " + entry.Reason
+		}
+	}
+	if r.registryURL != "" {
+		var reply struct {
+			Listed bool `json:"listed"`
+		}
+		headers := map[string]string{}
+		if r.registryToken != "" {
+			headers["Authorization"] = "Bearer " + r.registryToken
+		}
+		endpoint := r.registryURL + "?number=" + url.QueryEscape(number)
+		if err := doJSON(http.MethodGet, endpoint, nil, headers, &reply); err != nil {
+			log.Printf("Error checking %s against the do-not-call registry: %v\n", number, err)
+			result.Registry = RegistryError
+			if !r.failOpen && result.Reason == "" {
+				result.Reason = "do-not-call registry unavailable"
+			}
+		} else if reply.Listed {
+			result.Registry = RegistryListed
+			if result.Reason == "" {
+				result.Reason = "on the do-not-call registry"
+			}
+		} else {
+			result.Registry = RegistryClear
+		}
+	}
+	result.Allowed = result.Reason == ""
+	return result
+}
+
+// CampaignContact is one number dialed, or refused, for an outbound campaign
+type CampaignContact struct {
+	ID       string   `json:"id,omitempty"`
+	Campaign string   `json:"campaign"`
+	Tenant   string   `json:"tenant,omitempty"`
+	Number   string   `json:"number"`
+	Status   string   `json:"status"`
+	CallSid  string   `json:"call_sid,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Check    DNCCheck `json:"dnc_check"`
+}
+
+// campaignMu serializes updates to the campaign contact logs
+var campaignMu sync.Mutex
+
+// campaignPath is where a campaign's contacts are kept
+func campaignPath(campaign string) string {
+	return dataPath("campaigns", campaign+".json")
+}
+
+// recordContacts appends contacts to their campaign's log
+func recordContacts(campaign string, contacts []CampaignContact) error {
+	campaignMu.Lock()
+	defer campaignMu.Unlock()
+	var existing []CampaignContact
+	if err := readJSONFile(campaignPath(campaign), &existing); err != nil {
+		return err
+	}
+	return writeJSONFile(campaignPath(campaign), append(existing, contacts...))
+}
+
+// OutboundRequest asks for a batch of campaign contacts to be called
+type OutboundRequest struct {
+	Campaign string `json:"campaign" binding:"required"`
+	Tenant   string `json:"tenant"`
+	From     string `json:"from" binding:"required"`
+	Contacts []struct {
+		ID     string `json:"id"`
+		Number string `json:"number"`
+	} `json:"contacts" binding:"required"`
+}
+
+// dialContact checks a contact against the do-not-call lists and places the
+// call when allowed
+func dialContact(req OutboundRequest, id, number string) CampaignContact {
+	contact := CampaignContact{ID: id, Campaign: req.Campaign, Tenant: req.Tenant, Number: number}
+	parsed, err := validateDestination(number)
+	if err != nil {
+		contact.Status = ContactFailed
+		contact.Error = err.Error()
+		return contact
+	}
+	number = parsed.E164
+	contact.Number = number
+	contact.Check = dncRegistry.check(number)
+	if !contact.Check.Allowed {
+		contact.Status = ContactBlocked
+		log.Printf("Blocked outbound call to %s for campaign %s: %s\n", number, req.Campaign, contact.Check.Reason)
+		return contact
+	}
+	webhookURL := strings.TrimRight(getEnv("PUBLIC_BASE_URL", ""), "/") + "/incoming-call"
+	if req.Tenant != "" {
+		webhookURL += "?tenant=" + url.QueryEscape(req.Tenant)
+	}
+	callSid, err := placeCall(req.From, number, webhookURL)
+	if err != nil {
+		contact.Status = ContactFailed
+		contact.Error = err.Error()
+		log.Printf("Error placing outbound call to %s for campaign %s: %v\n", number, req.Campaign, err)
+		return contact
+	}
+	contact.Status = ContactCalled
+	contact.CallSid = callSid
+	return contact
+}
+
+// handleOutboundCalls serves POST /admin/outbound
+func handleOutboundCalls(c *gin.Context) {
+	var req OutboundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.ContainsAny(req.Campaign, `/\.`) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid campaign name"})
+		return
+	}
+	if getEnv("PUBLIC_BASE_URL", "") == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "outbound calls need PUBLIC_BASE_URL"})
+		return
+	}
+	contacts := make([]CampaignContact, 0, len(req.Contacts))
+	for _, contact := range req.Contacts {
+		contacts = append(contacts, dialContact(req, contact.ID, contact.Number))
+	}
+	if err := recordContacts(req.Campaign, contacts); err != nil {
+		log.Printf("Error recording contacts for campaign %s: %v\n", req.Campaign, err)
+	}
+	c.JSON(http.StatusOK, gin.H{"campaign": req.Campaign, "contacts": contacts})
+}
+
+// handleCampaignContacts serves GET /admin/campaigns/:id
+func handleCampaignContacts(c *gin.Context) {
+	campaign := c.Param("id")
+	if strings.ContainsAny(campaign, `/\.`) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid campaign name"})
+		return
+	}
+	campaignMu.Lock()
+	var contacts []CampaignContact
+	err := readJSONFile(campaignPath(campaign), &contacts)
+	campaignMu.Unlock()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if contacts == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "campaign not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"campaign": campaign, "contacts": contacts})
+}
+
+// handleListDNC serves GET /admin/dnc
+func handleListDNC(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"numbers": dncRegistry.list()})
+}
+
+// handleCheckDNC serves GET /admin/dnc/:number, checking without dialing
+func handleCheckDNC(c *gin.Context) {
+	parsed, err := validateDestination(c.Param("number"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, dncRegistry.check(parsed.E164))
+}
+
+// handlePutDNC serves PUT /admin/dnc/:number
+func handlePutDNC(c *gin.Context) {
+	var entry DNCEntry
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&entry); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	entry.Number = normalizeNumber(c.Param("number"))
+	if dncKey(entry.Number) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid number %q", entry.Number)})
+		return
+	}
+	entry.AddedAt = time.Now().UTC()
+	if err := dncRegistry.add(entry); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// handleDeleteDNC serves DELETE /admin/dnc/:number
+func handleDeleteDNC(c *gin.Context) {
+	ok, err := dncRegistry.remove(c.Param("number"))
+	if errors.Is(err, errDNCInFile) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "number not on the list"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// StrategyDTMFMenu switches a struggling call to the agent's keypad menu
+const StrategyDTMFMenu = "dtmf_menu"
+
+// DTMF menu option actions
+const (
+	DTMFActionTool     = "tool"
+	DTMFActionTransfer = "transfer"
+	DTMFActionSay      = "say"
+	DTMFActionResume   = "resume"
+)
+
+// DTMFMenu is a declarative keypad menu an agent can start in or fall back to
+type DTMFMenu struct {
+	Start         bool                  `json:"start"`
+	Prompt        string                `json:"prompt"`
+	InvalidPrompt string                `json:"invalid_prompt"`
+	Options       map[string]DTMFOption `json:"options"`
+}
+
+// DTMFOption maps a key press to an action
+type DTMFOption struct {
+	Action    string                 `json:"action"`
+	Tool      string                 `json:"tool,omitempty"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+	Number    string                 `json:"number,omitempty"`
+	Message   string                 `json:"message,omitempty"`
+}
+
+// dtmfState tracks keypad mode for one call
+type dtmfState struct {
+	active     bool
+	selections []string
+}
+
+// hasDTMFMenu reports whether the session's agent defines a keypad menu
+func (s *Session) hasDTMFMenu() bool {
+	return s.agent.DTMFMenu != nil && len(s.agent.DTMFMenu.Options) > 0
+}
+
+// dtmfActive reports whether caller audio should bypass the model
+func (s *Session) dtmfActive() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.dtmf.active
+}
+
+// enterDTMFMode stops forwarding caller audio and reads the menu prompt
+func (s *Session) enterDTMFMode() {
+	if !s.hasDTMFMenu() {
+		log.Println("dtmf_menu requested but the agent has no DTMF menu")
+		return
+	}
+	s.Lock()
+	s.dtmf.active = true
+	s.Unlock()
+	s.sendOpenAI(map[string]interface{}{"type": "input_audio_buffer.clear"})
+	log.Printf("Stream %s entered DTMF menu mode\n", s.streamSid)
+	s.speak(s.agent.DTMFMenu.Prompt)
+}
+
+// exitDTMFMode hands the call back to the voice conversation
+func (s *Session) exitDTMFMode() {
+	s.Lock()
+	s.dtmf.active = false
+	s.Unlock()
+	log.Printf("Stream %s left DTMF menu mode\n", s.streamSid)
+	s.injectSystemMessage("The caller has returned from the keypad menu. Ask how you can help.", true)
+}
+
+// handleDTMF runs the menu option for a key press
+func (s *Session) handleDTMF(digit string) {
+	if !s.dtmfActive() {
+		log.Printf("Ignoring DTMF %q outside menu mode\n", digit)
+		return
+	}
+	menu := s.agent.DTMFMenu
+	s.Lock()
+	s.dtmf.selections = append(s.dtmf.selections, digit)
+	s.Unlock()
+
+	if digit == "*" {
+		s.speak(menu.Prompt)
+		return
+	}
+	option, ok := menu.Options[digit]
+	if !ok {
+		invalid := menu.InvalidPrompt
+		if invalid == "" {
+			invalid = "Sorry, that is not a valid option."
+		}
+		s.speak(invalid + " " + menu.Prompt)
+		return
+	}
+
+	switch option.Action {
+	case DTMFActionSay:
+		s.speak(option.Message + " " + menu.Prompt)
+	case DTMFActionResume:
+		s.exitDTMFMode()
+	case DTMFActionTransfer:
+		if option.Message != "" {
+			s.speak(option.Message)
+		}
+		s.spawn(func() {
+			time.Sleep(getEnvDuration("POLICY_TRANSFER_DELAY", 4*time.Second))
+			if err := s.transfer(option.Number); err != nil {
+				log.Println("Error transferring call from DTMF menu:", err)
+				s.speak("Sorry, we could not transfer your call. " + menu.Prompt)
+				return
+			}
+		})
+	case DTMFActionTool:
+		s.runMenuTool(option)
+	default:
+		log.Println("Unknown DTMF action:", option.Action)
+		s.speak(menu.Prompt)
+	}
+}
+
+// runMenuTool invokes a registered tool for a menu selection and reads back the result
+func (s *Session) runMenuTool(option DTMFOption) {
+	tool, ok := lookupTool(option.Tool)
+	if !ok || (tool.Available != nil && !tool.Available(s)) {
+		log.Println("DTMF menu references unavailable tool:", option.Tool)
+		s.speak("Sorry, that option is not available right now. " + s.agent.DTMFMenu.Prompt)
+		return
+	}
+	args, _ := json.Marshal(option.Arguments)
+	result, err := tool.Handler(s, args)
+	if err != nil {
+		log.Printf("DTMF tool %s failed: %v\n", option.Tool, err)
+		s.speak("Sorry, something went wrong. " + s.agent.DTMFMenu.Prompt)
+		return
+	}
+	data, _ := json.Marshal(result)
+	s.respond(fmt.Sprintf("Briefly tell the caller the outcome of %s, using this result: %s. Then say: %s",
+		option.Tool, data, s.agent.DTMFMenu.Prompt))
+}
+
+// speak makes the model read text verbatim without adding to it
+func (s *Session) speak(text string) {
+	s.respond("Say exactly the following, and nothing else: " + text)
+}
+
+// respond requests a single model response guided by one-off instructions
+func (s *Session) respond(instructions string) {
+	s.sendOpenAI(map[string]interface{}{
+		"type": "response.create",
+		"response": map[string]interface{}{
+			"modalities":   []string{"text", "audio"},
+			"instructions": instructions,
+		},
+	})
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Escalation actions an agent can be configured with
+const (
+	ActionAlert         = "alert"
+	ActionOfferTransfer = "offer_transfer"
+	ActionPrioritize    = "prioritize"
+)
+
+// Escalation signals
+const (
+	SignalHumanRequested    = "human_requested"
+	SignalMisunderstanding  = "repeated_misunderstanding"
+	SignalNegativeSentiment = "negative_sentiment"
+)
+
+// EventEscalation is sent to webhook subscribers when a call escalates
+const EventEscalation = "escalation.requested"
+
+// PriorityHigh marks calls a supervisor should look at first
+const PriorityHigh = "high"
+
+var (
+	defaultHumanPhrases = []string{
+		"speak to a human", "talk to a human", "real person", "speak to someone", "talk to someone",
+		"representative", "operator", "customer service", "your manager", "a supervisor",
+		"hablar con una persona", "hablar con alguien", "un agente", "un operador",
+	}
+	misunderstandingPhrases = []string{
+		"didn't catch", "did not catch", "didn't understand", "did not understand", "could you repeat",
+		"can you repeat", "say that again", "sorry, what", "no le he entendido", "no te he entendido",
+		"puede repetir", "puedes repetir",
+	}
+)
+
+// EscalationPolicy configures which signals escalate a call and what happens next
+type EscalationPolicy struct {
+	Actions               []string `json:"actions"`
+	Phrases               []string `json:"phrases"`
+	MisunderstandingLimit int      `json:"misunderstanding_limit"`
+	NegativeTurns         int      `json:"negative_turns"`
+	TransferNumber        string   `json:"transfer_number"`
+}
+
+// escalationState tracks signals for one call
+type escalationState struct {
+	misunderstandings int
+	negativeStreak    int
+	fired             map[string]bool
+}
+
+// Escalation is an entry on the supervisor dashboard
+type Escalation struct {
+	ID           string    `json:"id"`
+	CallSid      string    `json:"call_sid"`
+	Tenant       string    `json:"tenant"`
+	Agent        string    `json:"agent"`
+	From         string    `json:"from"`
+	Signal       string    `json:"signal"`
+	Detail       string    `json:"detail"`
+	Priority     string    `json:"priority,omitempty"`
+	At           time.Time `json:"at"`
+	Acknowledged bool      `json:"acknowledged"`
+}
+
+// EscalationBoard keeps recent escalations for supervisors
+type EscalationBoard struct {
+	sync.Mutex
+	items []*Escalation
+	limit int
+}
+
+// newEscalationBoard creates a board holding the most recent escalations
+func newEscalationBoard() *EscalationBoard {
+	return &EscalationBoard{limit: getEnvInt("ESCALATION_BOARD_SIZE", 200)}
+}
+
+// escalationPolicy returns the agent's policy, or the environment defaults
+func (a *Agent) escalationPolicy() EscalationPolicy {
+	policy := EscalationPolicy{}
+	if a.Escalation != nil {
+		policy = *a.Escalation
+	}
+	if len(policy.Actions) == 0 {
+		policy.Actions = getEnvList("ESCALATION_ACTIONS")
+		if len(policy.Actions) == 0 {
+			policy.Actions = []string{ActionAlert}
+		}
+	}
+	if len(policy.Phrases) == 0 {
+		policy.Phrases = defaultHumanPhrases
+	}
+	if policy.MisunderstandingLimit == 0 {
+		policy.MisunderstandingLimit = getEnvInt("ESCALATION_MISUNDERSTANDINGS", 3)
+	}
+	if policy.NegativeTurns == 0 {
+		policy.NegativeTurns = getEnvInt("ESCALATION_NEGATIVE_TURNS", 3)
+	}
+	if policy.TransferNumber == "" {
+		policy.TransferNumber = getEnv("TRANSFER_NUMBER", "")
+	}
+	return policy
+}
+
+// isMisunderstanding reports whether an assistant utterance asks the caller to repeat
+func isMisunderstanding(text string) bool {
+	return containsAny(strings.ToLower(text), misunderstandingPhrases)
+}
+
+// containsAny reports whether text contains any of the phrases
+func containsAny(text string, phrases []string) bool {
+	for _, p := range phrases {
+		if strings.Contains(text, strings.ToLower(p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkEscalation inspects a new utterance for escalation signals
+func (s *Session) checkEscalation(speaker, text string) {
+	policy := s.agent.escalationPolicy()
+
+	s.Lock()
+	state := &s.escalation
+	var signal, detail string
+	switch speaker {
+	case SpeakerCaller:
+		if containsAny(strings.ToLower(text), policy.Phrases) {
+			signal, detail = SignalHumanRequested, fmt.Sprintf("Caller said: %q", text)
+		}
+		if sentimentScore(text) < 0 {
+			state.negativeStreak++
+		} else {
+			state.negativeStreak = 0
+		}
+		if signal == "" && policy.NegativeTurns > 0 && state.negativeStreak >= policy.NegativeTurns {
+			signal, detail = SignalNegativeSentiment, fmt.Sprintf("%d negative turns in a row", state.negativeStreak)
+		}
+	case SpeakerAssistant:
+		if isMisunderstanding(text) {
+			state.misunderstandings++
+		} else {
+			state.misunderstandings = 0
+		}
+		if policy.MisunderstandingLimit > 0 && state.misunderstandings >= policy.MisunderstandingLimit {
+			signal, detail = SignalMisunderstanding, fmt.Sprintf("%d misunderstandings in a row", state.misunderstandings)
+		}
+	}
+	if signal == "" || state.fired[signal] {
+		s.Unlock()
+		return
+	}
+	if state.fired == nil {
+		state.fired = make(map[string]bool)
+	}
+	state.fired[signal] = true
+	s.escalations = append(s.escalations, signal)
+	s.Unlock()
+
+	log.Printf("Escalation on stream %s: %s (%s)\n", s.streamSid, signal, detail)
+	s.escalate(policy, signal, detail)
+}
+
+// escalate runs the configured actions for a signal
+func (s *Session) escalate(policy EscalationPolicy, signal, detail string) {
+	priority := ""
+	for _, action := range policy.Actions {
+		if action == ActionPrioritize {
+			priority = PriorityHigh
+			s.Lock()
+			s.priority = PriorityHigh
+			s.Unlock()
+		}
+	}
+
+	s.Lock()
+	entry := &Escalation{
+		ID:       newEventID(),
+		CallSid:  s.callSid,
+		Tenant:   s.tenant.ID,
+		Agent:    s.agent.ID,
+		From:     s.from,
+		Signal:   signal,
+		Detail:   detail,
+		Priority: priority,
+		At:       time.Now().UTC(),
+	}
+	s.Unlock()
+
+	for _, action := range policy.Actions {
+		switch action {
+		case ActionAlert:
+			escalationBoard.add(entry)
+			trigger := TriggerEscalation
+			if signal == SignalNegativeSentiment {
+				trigger = TriggerNegativeSentiment
+			}
+			notifier.notify(CallNotification{Trigger: trigger, CallSid: entry.CallSid, From: entry.From, Detail: detail})
+			webhooks.send(EventEscalation, entry)
+		case ActionOfferTransfer:
+			if policy.TransferNumber == "" {
+				log.Println("offer_transfer escalation configured without a transfer number")
+				continue
+			}
+			s.injectSystemMessage("The caller may need a human. Politely offer to transfer them to a colleague, "+
+				"and if they agree, call the transfer_call tool.", true)
+		case ActionPrioritize:
+			// handled above so the dashboard entry carries the priority
+		default:
+			log.Println("Unknown escalation action:", action)
+		}
+	}
+}
+
+// injectSystemMessage adds a system message to the conversation, optionally
+// asking for a response when the model is not already speaking
+func (s *Session) injectSystemMessage(text string, respond bool) {
+	s.sendOpenAI(map[string]interface{}{
+		"type": "conversation.item.create",
+		"item": map[string]interface{}{
+			"type":    "message",
+			"role":    "system",
+			"content": []map[string]string{{"type": "input_text", "text": text}},
+		},
+	})
+	s.Lock()
+	idle := !s.isResponding
+	s.Unlock()
+	if respond && idle {
+		s.sendOpenAI(map[string]interface{}{"type": "response.create"})
+	}
+}
+
+// add records an escalation, dropping the oldest past the limit
+func (b *EscalationBoard) add(e *Escalation) {
+	b.Lock()
+	defer b.Unlock()
+	b.items = append(b.items, e)
+	if len(b.items) > b.limit {
+		b.items = b.items[len(b.items)-b.limit:]
+	}
+}
+
+// list returns escalations with high priority and unacknowledged entries first
+func (b *EscalationBoard) list(includeAcknowledged bool) []Escalation {
+	b.Lock()
+	defer b.Unlock()
+	var high, normal []Escalation
+	for i := len(b.items) - 1; i >= 0; i-- {
+		e := *b.items[i]
+		if e.Acknowledged && !includeAcknowledged {
+			continue
+		}
+		if e.Priority == PriorityHigh && !e.Acknowledged {
+			high = append(high, e)
+		} else {
+			normal = append(normal, e)
+		}
+	}
+	return append(high, normal...)
+}
+
+// acknowledge marks an escalation as handled
+func (b *EscalationBoard) acknowledge(id string) bool {
+	b.Lock()
+	defer b.Unlock()
+	for _, e := range b.items {
+		if e.ID == id {
+			e.Acknowledged = true
+			return true
+		}
+	}
+	return false
+}
+
+// handleListEscalations serves GET /admin/escalations
+func handleListEscalations(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"escalations": escalationBoard.list(c.Query("all") == "true")})
+}
+
+// handleAcknowledgeEscalation serves POST /admin/escalations/:id/ack
+func handleAcknowledgeEscalation(c *gin.Context) {
+	if !escalationBoard.acknowledge(c.Param("id")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "escalation not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "acknowledged"})
+}
+
+func init() {
+	registerTool(&Tool{
+		Name:        "transfer_call",
+		Description: "Transfer the caller to a human colleague. Only use this after the caller agrees to be transferred.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"reason": map[string]interface{}{"type": "string", "description": "Why the caller needs a human"},
+			},
+		},
+		Available: func(s *Session) bool {
+			return s.agent.escalationPolicy().TransferNumber != ""
+		},
+		Handler: func(s *Session, args json.RawMessage) (interface{}, error) {
+			number := s.agent.escalationPolicy().TransferNumber
+			if err := s.transfer(number); err != nil {
+				return nil, err
+			}
+			return map[string]string{"status": "transferring"}, nil
+		},
+	})
+}
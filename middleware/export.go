@@ -0,0 +1,239 @@
+package main
+
+import (
+	"crypto/hmac"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Transcript export formats
+const (
+	FormatText = "text"
+	FormatSRT  = "srt"
+	FormatVTT  = "vtt"
+	FormatJSON = "json"
+)
+
+// exportContentTypes maps export formats to their media types
+var exportContentTypes = map[string]string{
+	FormatText: "text/plain; charset=utf-8",
+	FormatSRT:  "application/x-subrip; charset=utf-8",
+	FormatVTT:  "text/vtt; charset=utf-8",
+}
+
+// diarizationLabels are the speaker IDs used in diarized exports
+var diarizationLabels = map[string]string{
+	SpeakerCaller:    "SPEAKER_00",
+	SpeakerAssistant: "SPEAKER_01",
+}
+
+// TranscriptSegment is one utterance on the recording timeline
+type TranscriptSegment struct {
+	Start   float64 `json:"start"`
+	End     float64 `json:"end"`
+	Speaker string  `json:"speaker"`
+	Label   string  `json:"label"`
+	Text    string  `json:"text"`
+}
+
+// DiarizedTranscript is the diarized JSON export
+type DiarizedTranscript struct {
+	CallSid  string              `json:"call_sid"`
+	Duration float64             `json:"duration"`
+	Speakers []string            `json:"speakers"`
+	Segments []TranscriptSegment `json:"segments"`
+}
+
+// transcriptSegments places each utterance on the recording timeline, using
+// turn audio offsets when the call was recorded and wall-clock times otherwise
+func transcriptSegments(record CallRecord) []TranscriptSegment {
+	var segments []TranscriptSegment
+	for _, turn := range record.Turns {
+		if turn.Transcript == "" {
+			continue
+		}
+		seg := TranscriptSegment{Speaker: diarizationLabels[turn.Speaker], Label: turn.Speaker, Text: turn.Transcript}
+		if turn.AudioStart >= 0 && turn.AudioEnd > turn.AudioStart {
+			seg.Start = float64(turn.AudioStart) / bytesPerSecond
+			seg.End = float64(turn.AudioEnd) / bytesPerSecond
+		} else {
+			seg.Start = turn.StartedAt.Sub(record.StartedAt).Seconds()
+			seg.End = seg.Start
+			if !turn.EndedAt.IsZero() {
+				seg.End = turn.EndedAt.Sub(record.StartedAt).Seconds()
+			}
+		}
+		segments = append(segments, seg)
+	}
+	if len(segments) > 0 || len(record.Transcript) == 0 {
+		return segments
+	}
+
+	// Calls without turn data only have the time each utterance was transcribed
+	for i, entry := range record.Transcript {
+		seg := TranscriptSegment{
+			Start:   entry.At.Sub(record.StartedAt).Seconds(),
+			Speaker: diarizationLabels[entry.Speaker],
+			Label:   entry.Speaker,
+			Text:    entry.Text,
+		}
+		seg.End = record.DurationSec
+		if i+1 < len(record.Transcript) {
+			seg.End = record.Transcript[i+1].At.Sub(record.StartedAt).Seconds()
+		}
+		segments = append(segments, seg)
+	}
+	return segments
+}
+
+// subtitleTimestamp formats seconds as HH:MM:SS<sep>mmm
+func subtitleTimestamp(seconds float64, sep string) string {
+	if seconds < 0 {
+		seconds = 0
+	}
+	d := time.Duration(seconds * float64(time.Second))
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60, sep, d.Milliseconds()%1000)
+}
+
+// renderSRT writes segments as SubRip subtitles
+func renderSRT(segments []TranscriptSegment) string {
+	var b strings.Builder
+	for i, seg := range segments {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s: %s\n\n", i+1,
+			subtitleTimestamp(seg.Start, ","), subtitleTimestamp(seg.End, ","), seg.Label, srtText(seg.Text))
+	}
+	return b.String()
+}
+
+// renderVTT writes segments as WebVTT with voice spans for each speaker
+func renderVTT(segments []TranscriptSegment) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+	for _, seg := range segments {
+		fmt.Fprintf(&b, "%s --> %s\n<v %s>%s\n\n",
+			subtitleTimestamp(seg.Start, "."), subtitleTimestamp(seg.End, "."), seg.Label, vttText(seg.Text))
+	}
+	return b.String()
+}
+
+// cueText joins a transcript onto one line, since a blank line ends a cue
+func cueText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// srtText keeps caller speech from forming an SRT timing line
+func srtText(text string) string {
+	return strings.ReplaceAll(cueText(text), "-->", "->")
+}
+
+// vttText escapes the characters WebVTT reads as markup or timing
+func vttText(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(cueText(text))
+}
+
+// exportFormat picks the format from the format parameter, then the Accept header
+func exportFormat(c *gin.Context) string {
+	if format := c.Query("format"); format != "" {
+		return format
+	}
+	accept := c.GetHeader("Accept")
+	switch {
+	case strings.Contains(accept, "text/vtt"):
+		return FormatVTT
+	case strings.Contains(accept, "application/x-subrip"):
+		return FormatSRT
+	case strings.Contains(accept, "application/json"):
+		return FormatJSON
+	}
+	return FormatText
+}
+
+// liveRecord returns the record so far of a call live on this instance, so
+// links sent mid-call, such as escalation notifications, already work
+func liveRecord(callSid string) (CallRecord, bool) {
+	s := fleet.findSession(callSid)
+	if s == nil {
+		return CallRecord{}, false
+	}
+	s.Lock()
+	record := s.callRecord()
+	s.Unlock()
+	if !s.hasConsent(ConsentDataStorage) {
+		withoutContent(&record)
+	}
+	return record, true
+}
+
+// transcriptLink returns a time-limited signed link to a call's transcript
+// for people without the admin token, such as notification recipients, or
+// "" when there is no public URL or signing key
+func transcriptLink(callSid string) string {
+	base := strings.TrimRight(getEnv("PUBLIC_BASE_URL", ""), "/")
+	if base == "" || len(exportSigningKey()) == 0 {
+		return ""
+	}
+	expires := time.Now().Add(getEnvDuration("TRANSCRIPT_LINK_TTL", 24*time.Hour)).Unix()
+	return fmt.Sprintf("%s/transcripts/%s?expires=%d&signature=%s", base, callSid, expires, exportSignature("transcript:"+callSid, expires))
+}
+
+// handleSignedTranscript serves GET /transcripts/:id, a call's transcript
+// through the signed link notifications carry
+func handleSignedTranscript(c *gin.Context) {
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires || len(exportSigningKey()) == 0 ||
+		!hmac.Equal([]byte(c.Query("signature")), []byte(exportSignature("transcript:"+c.Param("id"), expires))) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid or expired link"})
+		return
+	}
+	c.Set(auditActorKey, "signed-link")
+	handleCallTranscript(c)
+}
+
+// handleCallTranscript serves GET /calls/:id/transcript as text, SRT, WebVTT or diarized JSON
+func handleCallTranscript(c *gin.Context) {
+	record, ok := callStore.get(c.Param("id"))
+	if !ok {
+		record, ok = liveRecord(c.Param("id"))
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "call not found"})
+		return
+	}
+	format := exportFormat(c)
+	segments := transcriptSegments(record)
+
+	var body string
+	switch format {
+	case FormatText:
+		body = transcriptText(record.Transcript)
+	case FormatSRT:
+		body = renderSRT(segments)
+	case FormatVTT:
+		body = renderVTT(segments)
+	case FormatJSON:
+		if segments == nil {
+			segments = []TranscriptSegment{}
+		}
+		c.JSON(http.StatusOK, DiarizedTranscript{
+			CallSid:  record.CallSid,
+			Duration: record.DurationSec,
+			Speakers: []string{diarizationLabels[SpeakerCaller], diarizationLabels[SpeakerAssistant]},
+			Segments: segments,
+		})
+		return
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be text, srt, vtt or json"})
+		return
+	}
+	extension := format
+	if format == FormatText {
+		extension = "txt"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s.%s"`, record.CallSid, extension))
+	c.Data(http.StatusOK, exportContentTypes[format], []byte(body))
+}
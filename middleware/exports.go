@@ -0,0 +1,549 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/hmac"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Export job statuses
+const (
+	ExportQueued    = "queued"
+	ExportRunning   = "running"
+	ExportCompleted = "completed"
+	ExportFailed    = "failed"
+	ExportExpired   = "expired"
+)
+
+// What an export can include
+const (
+	ExportCDRs        = "cdrs"
+	ExportTranscripts = "transcripts"
+	ExportRecordings  = "recordings"
+	ExportDataset     = "dataset"
+)
+
+// Export delivery targets
+const (
+	DeliverDownload = "download"
+	DeliverS3       = "s3"
+)
+
+// Archive formats
+const (
+	ArchiveZip   = "zip"
+	ArchiveTarGz = "tar.gz"
+)
+
+// ExportRequest is the body of POST /admin/exports
+type ExportRequest struct {
+	Tenant      string    `json:"tenant"`
+	Agent       string    `json:"agent"`
+	Caller      string    `json:"caller"`
+	Disposition string    `json:"disposition"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Include     []string  `json:"include"`
+	Format      string    `json:"format"`
+	Destination string    `json:"destination"`
+}
+
+// ExportJob tracks one asynchronous export
+type ExportJob struct {
+	ID          string        `json:"id"`
+	Status      string        `json:"status"`
+	Request     ExportRequest `json:"request"`
+	CreatedAt   time.Time     `json:"created_at"`
+	CompletedAt time.Time     `json:"completed_at,omitempty"`
+	Calls       int           `json:"calls"`
+	Size        int64         `json:"size_bytes"`
+	Location    string        `json:"location,omitempty"`
+	Error       string        `json:"error,omitempty"`
+
+	DownloadURL string `json:"download_url,omitempty"`
+
+	// RequestedBy is the actor who created the job and CallSids the calls it
+	// delivered, for the audit log
+	RequestedBy string   `json:"requested_by,omitempty"`
+	CallSids    []string `json:"call_sids,omitempty"`
+}
+
+// ExportJobs runs export jobs one at a time and persists their status
+type ExportJobs struct {
+	sync.Mutex
+	dir   string
+	jobs  map[string]*ExportJob
+	queue chan string
+}
+
+// newExportJobs loads job history and resumes unfinished jobs
+func newExportJobs() *ExportJobs {
+	e := &ExportJobs{
+		dir:   dataDir("exports"),
+		jobs:  make(map[string]*ExportJob),
+		queue: make(chan string, 100),
+	}
+	var list []*ExportJob
+	if err := readJSONFile(filepath.Join(e.dir, "jobs.json"), &list); err != nil {
+		log.Println("Error loading export jobs:", err)
+	}
+	var pending []string
+	for _, job := range list {
+		e.jobs[job.ID] = job
+		if job.Status == ExportQueued || job.Status == ExportRunning {
+			job.Status = ExportQueued
+			pending = append(pending, job.ID)
+		}
+	}
+	go e.worker()
+	// Jobs left over from the last run may not all fit in the queue, so they
+	// are fed to it in the background rather than holding up startup
+	go func() {
+		for _, id := range pending {
+			e.queue <- id
+		}
+	}()
+	return e
+}
+
+// create validates a request and queues a job for it
+func (e *ExportJobs) create(req ExportRequest, actor string) (ExportJob, error) {
+	if len(req.Include) == 0 {
+		req.Include = []string{ExportCDRs, ExportTranscripts}
+	}
+	for _, item := range req.Include {
+		if item != ExportCDRs && item != ExportTranscripts && item != ExportRecordings && item != ExportDataset {
+			return ExportJob{}, fmt.Errorf("unknown include %q", item)
+		}
+	}
+	if req.Format == "" {
+		req.Format = ArchiveZip
+	}
+	if req.Format != ArchiveZip && req.Format != ArchiveTarGz {
+		return ExportJob{}, fmt.Errorf("format must be zip or tar.gz")
+	}
+	if req.Destination == "" {
+		req.Destination = DeliverDownload
+	}
+	switch req.Destination {
+	case DeliverDownload:
+	case DeliverS3:
+		if _, ok := exportBucket(req.Tenant); !ok {
+			return ExportJob{}, fmt.Errorf("S3 export bucket is not configured")
+		}
+	default:
+		return ExportJob{}, fmt.Errorf("destination must be download or s3")
+	}
+
+	job := &ExportJob{ID: newID("exp"), Status: ExportQueued, Request: req, CreatedAt: time.Now().UTC(), RequestedBy: actor}
+	e.Lock()
+	e.jobs[job.ID] = job
+	e.saveLocked()
+	snapshot := *job
+	e.Unlock()
+
+	select {
+	case e.queue <- job.ID:
+	default:
+		e.finish(job.ID, fmt.Errorf("export queue is full"))
+		return ExportJob{}, fmt.Errorf("export queue is full, try again later")
+	}
+	return snapshot, nil
+}
+
+// get returns a copy of a job
+func (e *ExportJobs) get(id string) (ExportJob, bool) {
+	e.Lock()
+	defer e.Unlock()
+	job, ok := e.jobs[id]
+	if !ok {
+		return ExportJob{}, false
+	}
+	return *job, true
+}
+
+// list returns all jobs, newest first
+func (e *ExportJobs) list() []ExportJob {
+	e.Lock()
+	list := make([]ExportJob, 0, len(e.jobs))
+	for _, job := range e.jobs {
+		list = append(list, *job)
+	}
+	e.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// saveLocked writes the job list; the caller must hold the lock
+func (e *ExportJobs) saveLocked() {
+	list := make([]*ExportJob, 0, len(e.jobs))
+	for _, job := range e.jobs {
+		list = append(list, job)
+	}
+	if err := writeJSONFile(filepath.Join(e.dir, "jobs.json"), list); err != nil {
+		log.Println("Error saving export jobs:", err)
+	}
+}
+
+// archivePath is where a job's bundle is written locally
+func (e *ExportJobs) archivePath(job ExportJob) string {
+	return filepath.Join(e.dir, job.ID+"."+job.Request.Format)
+}
+
+// worker runs queued jobs and expires old archives
+func (e *ExportJobs) worker() {
+	for id := range e.queue {
+		e.Lock()
+		job, ok := e.jobs[id]
+		if ok {
+			job.Status = ExportRunning
+			e.saveLocked()
+		}
+		e.Unlock()
+		if !ok {
+			continue
+		}
+		log.Println("Running export job", id)
+		e.finish(id, e.run(*job))
+		e.expire()
+	}
+}
+
+// finish records a job's outcome
+func (e *ExportJobs) finish(id string, err error) {
+	e.Lock()
+	defer e.Unlock()
+	job, ok := e.jobs[id]
+	if !ok {
+		return
+	}
+	job.CompletedAt = time.Now().UTC()
+	if err != nil {
+		job.Status = ExportFailed
+		job.Error = err.Error()
+		log.Printf("Export job %s failed: %v\n", id, err)
+	} else {
+		job.Status = ExportCompleted
+		log.Printf("Export job %s completed with %d call(s)\n", id, job.Calls)
+	}
+	e.saveLocked()
+}
+
+// run builds the archive for a job and delivers it
+func (e *ExportJobs) run(job ExportJob) error {
+	req := job.Request
+	records := callStore.list(CallFilter{
+		Tenant:      req.Tenant,
+		Agent:       req.Agent,
+		Caller:      req.Caller,
+		Disposition: req.Disposition,
+		From:        req.From,
+		To:          req.To,
+	})
+	if req.Destination == DeliverS3 && req.Tenant == "" {
+		// The shared bucket may be in another region than pinned tenants' data
+		pinned := pinnedTenants()
+		kept := records[:0]
+		for _, record := range records {
+			if !pinned[record.Tenant] {
+				kept = append(kept, record)
+			}
+		}
+		if skipped := len(records) - len(kept); skipped > 0 {
+			log.Printf("Export job %s leaves out %d call(s) of region-pinned tenants\n", job.ID, skipped)
+		}
+		records = kept
+	}
+
+	path := e.archivePath(job)
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	archive := newArchiveWriter(f, req.Format)
+	err = writeExport(archive, records, req.Include)
+	if err == nil && containsString(req.Include, ExportDataset) {
+		err = writeDataset(archive, records, req)
+	}
+	if err != nil {
+		archive.Close()
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := archive.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	info, err := f.Stat()
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	location := ""
+	if req.Destination == DeliverS3 {
+		cfg, _ := exportBucket(req.Tenant)
+		contentType := "application/zip"
+		if req.Format == ArchiveTarGz {
+			contentType = "application/gzip"
+		}
+		location, err = cfg.putObject("exports/"+filepath.Base(path), path, contentType)
+		if err != nil {
+			return err
+		}
+		os.Remove(path)
+	}
+
+	callSids := make([]string, len(records))
+	for i, record := range records {
+		callSids[i] = record.CallSid
+	}
+	e.Lock()
+	if stored, ok := e.jobs[job.ID]; ok {
+		stored.Calls = len(records)
+		stored.Size = info.Size()
+		stored.Location = location
+		stored.CallSids = callSids
+	}
+	e.Unlock()
+	if req.Destination == DeliverS3 && len(records) > 0 {
+		auditLog.record(AuditEntry{Action: AuditExport, Actor: job.RequestedBy, Credential: "export-job", Path: location, CallSids: callSids, ExportID: job.ID})
+	}
+	return nil
+}
+
+// exportBucket returns the bucket an export is delivered to: the region's
+// bucket for tenants pinned to one, otherwise S3_EXPORT_BUCKET
+func exportBucket(tenantID string) (S3Config, bool) {
+	if tenantID == "" {
+		return loadS3Config()
+	}
+	tenant := tenants.get(tenantID)
+	if tenant.Region == "" {
+		return loadS3Config()
+	}
+	region := residency.region(tenant.Region)
+	if region == nil {
+		return S3Config{}, false
+	}
+	return region.storage()
+}
+
+// expire deletes downloadable archives past EXPORT_RETENTION
+func (e *ExportJobs) expire() {
+	cutoff := time.Now().Add(-getEnvDuration("EXPORT_RETENTION", 7*24*time.Hour))
+	e.Lock()
+	defer e.Unlock()
+	changed := false
+	for _, job := range e.jobs {
+		if job.Status != ExportCompleted || job.Request.Destination != DeliverDownload || job.CompletedAt.After(cutoff) {
+			continue
+		}
+		os.Remove(e.archivePath(*job))
+		job.Status = ExportExpired
+		changed = true
+	}
+	if changed {
+		e.saveLocked()
+	}
+}
+
+// writeExport adds the requested data for each call to the archive
+func writeExport(archive archiveWriter, records []CallRecord, include []string) error {
+	includes := func(item string) bool { return containsString(include, item) }
+	var cdrs strings.Builder
+	for _, record := range records {
+		if includes(ExportTranscripts) {
+			diarized, _ := json.MarshalIndent(DiarizedTranscript{
+				CallSid:  record.CallSid,
+				Duration: record.DurationSec,
+				Speakers: []string{diarizationLabels[SpeakerCaller], diarizationLabels[SpeakerAssistant]},
+				Segments: transcriptSegments(record),
+			}, "", "  ")
+			if err := archive.add("transcripts/"+record.CallSid+".json", diarized); err != nil {
+				return err
+			}
+			if err := archive.add("transcripts/"+record.CallSid+".txt", []byte(transcriptText(record.Transcript))); err != nil {
+				return err
+			}
+		}
+		if includes(ExportRecordings) && record.Recording != nil {
+			wav, err := recordingWAV(record.Recording)
+			if err != nil {
+				log.Printf("Skipping recording for call %s in export: %v\n", record.CallSid, err)
+			} else if err := archive.add("recordings/"+record.CallSid+".wav", wav); err != nil {
+				return err
+			}
+		}
+		if includes(ExportCDRs) {
+			if !includes(ExportTranscripts) {
+				record.Transcript = nil
+				record.Turns = nil
+				record.Summary = ""
+			}
+			line, _ := json.Marshal(record)
+			cdrs.Write(line)
+			cdrs.WriteByte('\n')
+		}
+	}
+	if includes(ExportCDRs) {
+		return archive.add("cdrs.jsonl", []byte(cdrs.String()))
+	}
+	return nil
+}
+
+// recordingWAV renders a whole recording, both tracks mixed, as WAV
+func recordingWAV(info *RecordingInfo) ([]byte, error) {
+	var size int64
+	for _, path := range []string{info.CallerFile, info.AssistantFile} {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if fi.Size() > size {
+			size = fi.Size()
+		}
+	}
+	pcm, err := sliceRecording(info, "both", 0, size)
+	if err != nil {
+		return nil, err
+	}
+	return encodeWAV(pcm), nil
+}
+
+// archiveWriter adds files to a zip or tar.gz bundle
+type archiveWriter interface {
+	add(name string, data []byte) error
+	Close() error
+}
+
+// newArchiveWriter returns a writer for the archive format
+func newArchiveWriter(w io.Writer, format string) archiveWriter {
+	if format == ArchiveTarGz {
+		gz := gzip.NewWriter(w)
+		return &tarArchive{gz: gz, tw: tar.NewWriter(gz)}
+	}
+	return &zipArchive{zw: zip.NewWriter(w)}
+}
+
+type zipArchive struct{ zw *zip.Writer }
+
+func (a *zipArchive) add(name string, data []byte) error {
+	w, err := a.zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (a *zipArchive) Close() error { return a.zw.Close() }
+
+type tarArchive struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func (a *tarArchive) add(name string, data []byte) error {
+	header := &tar.Header{Name: name, Mode: 0o600, Size: int64(len(data)), ModTime: time.Now()}
+	if err := a.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := a.tw.Write(data)
+	return err
+}
+
+func (a *tarArchive) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	return a.gz.Close()
+}
+
+// exportSigningKey signs download links; it defaults to the admin token
+func exportSigningKey() []byte {
+	return []byte(getEnv("EXPORT_SIGNING_KEY", getEnv("ADMIN_TOKEN", "")))
+}
+
+// exportSignature signs a job ID and expiry
+func exportSignature(id string, expires int64) string {
+	return hex.EncodeToString(hmacSHA256(exportSigningKey(), id+":"+strconv.FormatInt(expires, 10)))
+}
+
+// downloadURL returns a time-limited signed link to a completed download job
+func downloadURL(job ExportJob) string {
+	if job.Status != ExportCompleted || job.Request.Destination != DeliverDownload {
+		return ""
+	}
+	expires := time.Now().Add(getEnvDuration("EXPORT_URL_TTL", time.Hour)).Unix()
+	return fmt.Sprintf("%s/exports/%s/download?expires=%d&signature=%s",
+		strings.TrimRight(getEnv("PUBLIC_BASE_URL", ""), "/"), job.ID, expires, exportSignature(job.ID, expires))
+}
+
+// handleCreateExport serves POST /admin/exports
+func handleCreateExport(c *gin.Context) {
+	var req ExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	job, err := exportJobs.create(req, auditActor(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
+
+// handleListExports serves GET /admin/exports
+func handleListExports(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"exports": exportJobs.list()})
+}
+
+// handleGetExport serves GET /admin/exports/:id with a fresh download link
+func handleGetExport(c *gin.Context) {
+	job, ok := exportJobs.get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "export not found"})
+		return
+	}
+	job.DownloadURL = downloadURL(job)
+	c.JSON(http.StatusOK, job)
+}
+
+// handleDownloadExport serves GET /exports/:id/download for signed links
+func handleDownloadExport(c *gin.Context) {
+	id := c.Param("id")
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires || len(exportSigningKey()) == 0 ||
+		!hmac.Equal([]byte(c.Query("signature")), []byte(exportSignature(id, expires))) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid or expired link"})
+		return
+	}
+	c.Set(auditActorKey, "signed-link")
+	job, ok := exportJobs.get(id)
+	if !ok || job.Status != ExportCompleted || job.Request.Destination != DeliverDownload {
+		c.JSON(http.StatusNotFound, gin.H{"error": "export not available"})
+		return
+	}
+	c.Set(auditCallsKey, job.CallSids)
+	c.Set(auditExportKey, job.ID)
+	c.FileAttachment(exportJobs.archivePath(job), job.ID+"."+job.Request.Format)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Known feature flags
+const (
+	// FlagSemanticVAD switches turn detection to the semantic VAD model
+	FlagSemanticVAD = "semantic_vad"
+)
+
+// FeatureFlag enables a feature for a slice of calls
+type FeatureFlag struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+
+	// Tenants and Agents restrict the flag to the listed IDs when set
+	Tenants []string `json:"tenants,omitempty"`
+	Agents  []string `json:"agents,omitempty"`
+
+	// Percentage of callers, bucketed by a hash of their number, that get
+	// the flag; all of them when omitted
+	Percentage int `json:"percentage"`
+}
+
+// UnmarshalJSON defaults an omitted percentage to 100, so enabling a flag
+// without one turns it on for everyone
+func (flag *FeatureFlag) UnmarshalJSON(data []byte) error {
+	type plain FeatureFlag
+	decoded := plain{Percentage: 100}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*flag = FeatureFlag(decoded)
+	return nil
+}
+
+// FeatureFlags holds the flag definitions; flags set through the API are
+// saved to DATA_DIR and override FLAGS_FILE
+type FeatureFlags struct {
+	sync.RWMutex
+	path    string
+	flags   map[string]FeatureFlag
+	managed map[string]bool
+	// inFile keeps the FLAGS_FILE definitions, restored when an API
+	// override of one is deleted
+	inFile map[string]FeatureFlag
+}
+
+// loadFeatureFlags reads FLAGS_FILE, then applies flags saved through the admin API
+func loadFeatureFlags() *FeatureFlags {
+	f := &FeatureFlags{
+		path:    dataPath("flags.json"),
+		flags:   make(map[string]FeatureFlag),
+		managed: make(map[string]bool),
+		inFile:  make(map[string]FeatureFlag),
+	}
+	var list []FeatureFlag
+	if _, err := loadJSONFile("FLAGS_FILE", &list); err != nil {
+		log.Println("Error loading FLAGS_FILE:", err)
+	}
+	var saved []FeatureFlag
+	if err := readJSONFile(f.path, &saved); err != nil {
+		log.Println("Error loading saved flags:", err)
+	}
+	for _, flag := range list {
+		if flag.Name == "" {
+			log.Println("Skipping feature flag without name")
+			continue
+		}
+		f.flags[flag.Name] = flag
+		f.inFile[flag.Name] = flag
+	}
+	for _, flag := range saved {
+		if flag.Name == "" {
+			continue
+		}
+		f.flags[flag.Name] = flag
+		f.managed[flag.Name] = true
+	}
+	return f
+}
+
+// evaluate returns the flags that are on for a call
+func (f *FeatureFlags) evaluate(tenantID, agentID, caller string) map[string]bool {
+	f.RLock()
+	defer f.RUnlock()
+	result := make(map[string]bool, len(f.flags))
+	for name, flag := range f.flags {
+		result[name] = flag.appliesTo(tenantID, agentID, caller)
+	}
+	return result
+}
+
+// appliesTo reports whether the flag is on for a tenant, agent and caller
+func (flag FeatureFlag) appliesTo(tenantID, agentID, caller string) bool {
+	if !flag.Enabled {
+		return false
+	}
+	if len(flag.Tenants) > 0 && !containsString(flag.Tenants, tenantID) {
+		return false
+	}
+	if len(flag.Agents) > 0 && !containsString(flag.Agents, agentID) {
+		return false
+	}
+	return rolloutBucket(flag.Name, caller) < flag.Percentage
+}
+
+// rolloutBucket maps a caller to a stable bucket in [0, 100) per flag
+func rolloutBucket(flag, caller string) int {
+	sum := sha256.Sum256([]byte(flag + ":" + caller))
+	return int(binary.BigEndian.Uint32(sum[:4]) % 100)
+}
+
+// containsString reports whether list contains value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// list returns the flag definitions sorted by name
+func (f *FeatureFlags) list() []FeatureFlag {
+	f.RLock()
+	defer f.RUnlock()
+	list := make([]FeatureFlag, 0, len(f.flags))
+	for _, flag := range f.flags {
+		list = append(list, flag)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// put creates or replaces a flag and saves the flags set through the API
+func (f *FeatureFlags) put(flag FeatureFlag) error {
+	f.Lock()
+	f.flags[flag.Name] = flag
+	f.managed[flag.Name] = true
+	f.Unlock()
+	return f.save()
+}
+
+// errFlagInFile is returned when deleting a flag FLAGS_FILE would bring back
+var errFlagInFile = errors.New("flag is defined in FLAGS_FILE; set enabled to false or remove it from the file")
+
+// remove deletes a flag set through the API and saves the rest. Deleting an
+// override of a FLAGS_FILE flag restores the file's definition; a flag only
+// in FLAGS_FILE cannot be deleted, since the next start would restore it
+func (f *FeatureFlags) remove(name string) (bool, error) {
+	f.Lock()
+	_, ok := f.flags[name]
+	if !f.managed[name] {
+		f.Unlock()
+		if ok {
+			return true, errFlagInFile
+		}
+		return false, nil
+	}
+	delete(f.managed, name)
+	if flag, inFile := f.inFile[name]; inFile {
+		f.flags[name] = flag
+	} else {
+		delete(f.flags, name)
+	}
+	f.Unlock()
+	return true, f.save()
+}
+
+// save writes the flags set through the API
+func (f *FeatureFlags) save() error {
+	f.RLock()
+	list := make([]FeatureFlag, 0, len(f.managed))
+	for name := range f.managed {
+		list = append(list, f.flags[name])
+	}
+	f.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return writeJSONFile(f.path, list)
+}
+
+// flag reports whether a feature flag is on for this call
+func (s *Session) flag(name string) bool {
+	return s.flags[name]
+}
+
+// handleListFlags serves GET /admin/flags
+func handleListFlags(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"flags": featureFlags.list()})
+}
+
+// handlePutFlag serves PUT /admin/flags/:name
+func handlePutFlag(c *gin.Context) {
+	var flag FeatureFlag
+	if err := c.ShouldBindJSON(&flag); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	flag.Name = c.Param("name")
+	if flag.Percentage < 0 || flag.Percentage > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "percentage must be between 0 and 100"})
+		return
+	}
+	if err := featureFlags.put(flag); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, flag)
+}
+
+// handleDeleteFlag serves DELETE /admin/flags/:name
+func handleDeleteFlag(c *gin.Context) {
+	ok, err := featureFlags.remove(c.Param("name"))
+	if errors.Is(err, errFlagInFile) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "flag not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
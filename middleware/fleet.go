@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Redis keys of the fleet registry
+const (
+	fleetWorkersKey  = "fleet:workers"
+	fleetWorkerKey   = "fleet:worker:"
+	fleetAssignedKey = "fleet:assigned:"
+)
+
+// WorkerStatus is the capacity a worker instance advertises to routers
+type WorkerStatus struct {
+	ID        string    `json:"id"`
+	StreamURL string    `json:"stream_url"`
+	Active    int       `json:"active"`
+	Capacity  int       `json:"capacity"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Draining  bool      `json:"draining,omitempty"`
+
+	// Assigned counts calls routed to the worker whose media stream has not
+	// connected yet, so they are not in Active
+	Assigned int `json:"assigned"`
+}
+
+// load is the worker's utilization including calls still being set up
+func (w WorkerStatus) load() float64 {
+	if w.Capacity <= 0 {
+		return 1
+	}
+	return float64(w.Active+w.Assigned) / float64(w.Capacity)
+}
+
+// Fleet tracks this instance's calls and, with REDIS_URL set, shares them
+// with the rest of the fleet. In router mode /incoming-call sends each call's
+// media stream to the least-loaded worker
+type Fleet struct {
+	sync.Mutex
+	redis     *redisClient
+	router    bool
+	worker    bool
+	id        string
+	streamURL string
+	capacity  int
+	heartbeat time.Duration
+	sessions  map[*Session]bool
+	draining  bool
+
+	// snapshots hold calls recycled on this instance when there is no Redis
+	snapshots map[string]SessionSnapshot
+}
+
+// newFleet reads the fleet settings and starts the worker heartbeat
+func newFleet() *Fleet {
+	hostname, _ := os.Hostname()
+	f := &Fleet{
+		router:    getEnvBool("ROUTER_MODE", false),
+		id:        getEnv("INSTANCE_ID", hostname),
+		streamURL: getEnv("WORKER_STREAM_URL", defaultWorkerStreamURL()),
+		capacity:  getEnvInt("WORKER_CAPACITY", 50),
+		heartbeat: getEnvDuration("FLEET_HEARTBEAT", 5*time.Second),
+		sessions:  make(map[*Session]bool),
+		snapshots: make(map[string]SessionSnapshot),
+	}
+	redisURL := getEnv("REDIS_URL", "")
+	if redisURL == "" {
+		if f.router {
+			log.Println("ROUTER_MODE needs REDIS_URL; routing calls to this instance")
+			f.router = false
+		}
+		return f
+	}
+	client, err := newRedisClient(redisURL)
+	if err != nil {
+		log.Println("Error parsing REDIS_URL:", err)
+		f.router = false
+		return f
+	}
+	f.redis = client
+
+	// A dedicated router takes no calls itself unless told to
+	f.worker = getEnvBool("FLEET_WORKER", !f.router)
+	if f.worker {
+		if f.streamURL == "" {
+			log.Println("Fleet worker needs WORKER_STREAM_URL or PUBLIC_BASE_URL; not registering")
+			f.worker = false
+		} else {
+			go f.heartbeatLoop()
+			log.Printf("Registered as fleet worker %s (%s, capacity %d)\n", f.id, f.streamURL, f.capacity)
+		}
+	}
+	if f.router {
+		log.Println("Router mode: incoming calls are sent to the least-loaded worker")
+	}
+	return f
+}
+
+// defaultWorkerStreamURL derives the media stream URL from PUBLIC_BASE_URL
+func defaultWorkerStreamURL() string {
+	base := strings.TrimRight(getEnv("PUBLIC_BASE_URL", ""), "/")
+	if base == "" {
+		return ""
+	}
+	base = strings.Replace(base, "https://", "wss://", 1)
+	base = strings.Replace(base, "http://", "ws://", 1)
+	return base + "/media-stream"
+}
+
+// track and untrack maintain the sessions this instance is bridging
+func (f *Fleet) track(s *Session) {
+	f.Lock()
+	f.sessions[s] = true
+	f.Unlock()
+}
+
+func (f *Fleet) untrack(s *Session) {
+	f.Lock()
+	delete(f.sessions, s)
+	f.Unlock()
+}
+
+// active returns the number of calls this instance is bridging
+func (f *Fleet) active() int {
+	f.Lock()
+	defer f.Unlock()
+	return len(f.sessions)
+}
+
+// liveSessions returns the sessions this instance is bridging
+func (f *Fleet) liveSessions() []*Session {
+	f.Lock()
+	defer f.Unlock()
+	sessions := make([]*Session, 0, len(f.sessions))
+	for s := range f.sessions {
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+// heartbeatLoop advertises this worker's load until the process exits
+func (f *Fleet) heartbeatLoop() {
+	for {
+		if err := f.publish(); err != nil {
+			log.Println("Error publishing fleet heartbeat:", err)
+		}
+		time.Sleep(f.heartbeat)
+	}
+}
+
+// publish writes this worker's status with a TTL so dead workers drop out
+func (f *Fleet) publish() error {
+	f.Lock()
+	status := WorkerStatus{
+		ID:        f.id,
+		StreamURL: f.streamURL,
+		Active:    len(f.sessions),
+		Capacity:  f.capacity,
+		UpdatedAt: time.Now().UTC(),
+		Draining:  f.draining,
+	}
+	f.Unlock()
+	data, _ := json.Marshal(status)
+	ttl := strconv.Itoa(int((3 * f.heartbeat).Seconds()) + 1)
+	if _, err := f.redis.do("SET", fleetWorkerKey+f.id, string(data), "EX", ttl); err != nil {
+		return err
+	}
+	if _, err := f.redis.do("SADD", fleetWorkersKey, f.id); err != nil {
+		return err
+	}
+	// Assignments whose stream never connected, such as callers who hung up
+	// during the greeting, stop counting once they expire
+	_, err := f.redis.do("ZREMRANGEBYSCORE", fleetAssignedKey+f.id, "-inf", strconv.FormatInt(time.Now().Unix(), 10))
+	return err
+}
+
+// streamStarted drops a call's assignment to this worker once its media
+// stream connects and the call counts in Active
+func (f *Fleet) streamStarted(callSid string) {
+	if f.redis == nil || !f.worker || callSid == "" {
+		return
+	}
+	if _, err := f.redis.do("ZREM", fleetAssignedKey+f.id, callSid); err != nil {
+		log.Printf("Error clearing the fleet assignment of %s: %v\n", callSid, err)
+	}
+}
+
+// workers returns the live workers with their pending assignments
+func (f *Fleet) workers() ([]WorkerStatus, error) {
+	reply, err := f.redis.do("SMEMBERS", fleetWorkersKey)
+	if err != nil {
+		return nil, err
+	}
+	ids := redisStrings(reply)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	statusKeys := make([]string, len(ids))
+	for i, id := range ids {
+		statusKeys[i] = fleetWorkerKey + id
+	}
+	reply, err = f.redis.do(append([]string{"MGET"}, statusKeys...)...)
+	if err != nil {
+		return nil, err
+	}
+	statuses := redisStrings(reply)
+
+	var workers []WorkerStatus
+	for i, id := range ids {
+		if statuses[i] == "" {
+			// The heartbeat expired; forget the worker
+			f.redis.do("SREM", fleetWorkersKey, id)
+			continue
+		}
+		var status WorkerStatus
+		if err := json.Unmarshal([]byte(statuses[i]), &status); err != nil {
+			continue
+		}
+		reply, err := f.redis.do("ZCOUNT", fleetAssignedKey+id, strconv.FormatInt(time.Now().Unix(), 10), "+inf")
+		if err != nil {
+			return nil, err
+		}
+		assigned, _ := reply.(int64)
+		status.Assigned = int(assigned)
+		workers = append(workers, status)
+	}
+	sort.Slice(workers, func(i, j int) bool { return workers[i].ID < workers[j].ID })
+	return workers, nil
+}
+
+// pickWorker reserves a slot for a call on the least-loaded worker with
+// spare capacity, skipping draining workers and the excluded one. The slot
+// is held until the call's stream connects there, or FLEET_ASSIGNMENT_TTL
+// passes
+func (f *Fleet) pickWorker(exclude, callSid string) (WorkerStatus, error) {
+	workers, err := f.workers()
+	if err != nil {
+		return WorkerStatus{}, err
+	}
+	best := -1
+	for i, w := range workers {
+		if w.Draining || w.ID == exclude || w.Active+w.Assigned >= w.Capacity {
+			continue
+		}
+		if best < 0 || w.load() < workers[best].load() {
+			best = i
+		}
+	}
+	if best < 0 {
+		return WorkerStatus{}, fmt.Errorf("no worker has spare capacity (%d registered)", len(workers))
+	}
+	w := workers[best]
+	ttl := getEnvDuration("FLEET_ASSIGNMENT_TTL", 2*time.Minute)
+	if callSid == "" {
+		callSid = newID("call")
+	}
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	if _, err := f.redis.do("ZADD", fleetAssignedKey+w.ID, expires, callSid); err != nil {
+		return WorkerStatus{}, err
+	}
+	f.redis.do("EXPIRE", fleetAssignedKey+w.ID, strconv.Itoa(int(ttl.Seconds())+1))
+	return w, nil
+}
+
+// mediaStreamURL returns the stream URL for a new call: a fleet worker in
+// router mode, the active instance of an HA pair, otherwise this instance
+func (f *Fleet) mediaStreamURL(host, callSid string) string {
+	local := "wss://" + host + "/media-stream"
+	if !f.router {
+		if ha != nil {
+			return ha.activeStreamURL(local)
+		}
+		return local
+	}
+	w, err := f.pickWorker("", callSid)
+	if err != nil {
+		log.Println("Error routing call, handling it locally:", err)
+		return local
+	}
+	return w.StreamURL
+}
+
+// handleFleetStatus serves GET /admin/fleet
+func handleFleetStatus(c *gin.Context) {
+	self := gin.H{
+		"id":       fleet.id,
+		"router":   fleet.router,
+		"worker":   fleet.worker,
+		"active":   fleet.active(),
+		"capacity": fleet.capacity,
+		"draining": fleet.isDraining(),
+	}
+	if fleet.redis == nil {
+		c.JSON(http.StatusOK, gin.H{"instance": self})
+		return
+	}
+	workers, err := fleet.workers()
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"instance": self, "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"instance": self, "workers": workers})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"text/template"
+	"time"
+)
+
+// defaultGreetingTemplate opens with the time of day and welcomes back known callers
+const defaultGreetingTemplate = `{{.Salutation}}{{if .Returning}}, {{.WelcomeBack}}{{if .Name}} {{.Name}}{{end}}{{end}}. {{.Greeting}}`
+
+// GreetingData is available to greeting templates
+type GreetingData struct {
+	Salutation  string
+	WelcomeBack string
+	Greeting    string
+	Name        string
+	Returning   bool
+	CallCount   int
+}
+
+// buildGreeting renders the opening prompt for a caller; without the tenant's
+// opt-in it uses only the time of day and never consults caller history
+func buildGreeting(tenant *Tenant, locale Locale, from string, now time.Time) string {
+	data := GreetingData{
+		Salutation:  locale.salutation(now),
+		WelcomeBack: locale.WelcomeBack,
+		Greeting:    locale.Greeting,
+	}
+	if tenant.PersonalizeGreeting && from != "" {
+		if memory, ok := memories.get(tenant.ID, from); ok && memory.CallCount > 0 {
+			data.Returning = true
+			data.Name = cleanCallerName(memory.Name)
+			data.CallCount = memory.CallCount
+		}
+	}
+
+	text := tenant.GreetingTemplate
+	if text == "" {
+		text = defaultGreetingTemplate
+	}
+	tmpl, err := template.New("greeting").Parse(text)
+	if err != nil {
+		log.Printf("Invalid greeting template for tenant %s: %v\n", tenant.ID, err)
+		return locale.Greeting
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		log.Printf("Error rendering greeting for tenant %s: %v\n", tenant.ID, err)
+		return locale.Greeting
+	}
+	return buf.String()
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AlertFailover is raised when the standby of an HA pair takes over
+const AlertFailover = "ha_failover"
+
+// HA pair roles
+const (
+	RoleActive  = "active"
+	RoleStandby = "standby"
+)
+
+// renewLeaseScript extends the leader lease only if we still hold it
+const renewLeaseScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+
+// HAPair elects one of two instances as active through a Redis lease. The
+// active instance mirrors its calls' context into Redis; when it dies Twilio
+// follows the <Redirect> after the stream to HA_RECONNECT_URL, and the
+// instance holding the lease resumes the call from the mirrored snapshot
+type HAPair struct {
+	sync.Mutex
+	group        string
+	lease        time.Duration
+	snapshotTTL  time.Duration
+	reconnectURL string
+	maxResumes   int
+
+	role         string
+	leader       string
+	roleSince    time.Time
+	failovers    int
+	lastFailover time.Time
+	reconnects   int
+	resumed      int
+}
+
+// newHAPair starts leader election when HA_PAIR is enabled
+func newHAPair() *HAPair {
+	if !getEnvBool("HA_PAIR", false) {
+		return nil
+	}
+	if fleet.redis == nil || fleet.streamURL == "" {
+		log.Println("HA_PAIR needs REDIS_URL and WORKER_STREAM_URL or PUBLIC_BASE_URL; running standalone")
+		return nil
+	}
+	h := &HAPair{
+		group:        getEnv("HA_GROUP", "default"),
+		lease:        getEnvDuration("HA_LEASE_TTL", 10*time.Second),
+		snapshotTTL:  getEnvDuration("HA_SNAPSHOT_TTL", time.Minute),
+		reconnectURL: getEnv("HA_RECONNECT_URL", strings.TrimRight(getEnv("PUBLIC_BASE_URL", ""), "/")+"/reconnect-stream"),
+		maxResumes:   getEnvInt("HA_MAX_RESUMES", 3),
+		role:         RoleStandby,
+		roleSince:    time.Now(),
+	}
+	if _, err := fleet.redis.do("SET", h.memberKey(fleet.id), fleet.streamURL); err != nil {
+		log.Println("Error registering HA pair member:", err)
+	}
+	go h.electionLoop()
+	go h.mirrorLoop()
+	log.Printf("HA pair %s: %s joined as %s\n", h.group, fleet.id, RoleStandby)
+	return h
+}
+
+// Redis keys of the pair
+func (h *HAPair) leaderKey() string            { return "ha:" + h.group + ":leader" }
+func (h *HAPair) memberKey(id string) string   { return "ha:" + h.group + ":member:" + id }
+func (h *HAPair) callsKey() string             { return "ha:" + h.group + ":calls" }
+func (h *HAPair) resumesKey(sid string) string { return "ha:" + h.group + ":resumes:" + sid }
+
+// isActive reports whether this instance holds the lease
+func (h *HAPair) isActive() bool {
+	h.Lock()
+	defer h.Unlock()
+	return h.role == RoleActive
+}
+
+// setRole records a role change; the caller holds the lock
+func (h *HAPair) setRole(role, leader string) {
+	h.role = role
+	h.leader = leader
+	h.roleSince = time.Now()
+}
+
+// electionLoop acquires or renews the leader lease a few times per TTL
+func (h *HAPair) electionLoop() {
+	for {
+		if err := h.elect(); err != nil {
+			log.Println("Error in HA leader election:", err)
+		}
+		time.Sleep(h.lease / 3)
+	}
+}
+
+// elect runs one election round
+func (h *HAPair) elect() error {
+	if h.isActive() {
+		reply, err := fleet.redis.do("EVAL", renewLeaseScript, "1", h.leaderKey(), fleet.id, strconv.FormatInt(h.lease.Milliseconds(), 10))
+		if err != nil {
+			return err
+		}
+		if n, _ := reply.(int64); n == 0 {
+			h.Lock()
+			h.setRole(RoleStandby, "")
+			h.Unlock()
+			log.Printf("HA pair %s: %s lost the lease and is now %s\n", h.group, fleet.id, RoleStandby)
+		}
+		return nil
+	}
+
+	reply, err := fleet.redis.do("SET", h.leaderKey(), fleet.id, "NX", "PX", strconv.FormatInt(h.lease.Milliseconds(), 10))
+	if err != nil {
+		return err
+	}
+	if reply != "OK" {
+		leader, err := fleet.redis.do("GET", h.leaderKey())
+		if err == nil {
+			h.Lock()
+			h.leader, _ = leader.(string)
+			h.Unlock()
+		}
+		return nil
+	}
+
+	h.Lock()
+	previous := h.leader
+	h.setRole(RoleActive, fleet.id)
+	if previous != "" && previous != fleet.id {
+		h.failovers++
+		h.lastFailover = time.Now()
+	}
+	h.Unlock()
+	log.Printf("HA pair %s: %s is now %s\n", h.group, fleet.id, RoleActive)
+	if previous != "" && previous != fleet.id {
+		alerts.raise(Alert{
+			Kind:     AlertFailover,
+			Severity: "critical",
+			Message:  fmt.Sprintf("HA pair %s failed over from %s to %s", h.group, previous, fleet.id),
+			Subject:  h.group,
+		})
+	}
+	return nil
+}
+
+// mirrorLoop keeps a fresh snapshot of every live call in Redis while active
+func (h *HAPair) mirrorLoop() {
+	interval := getEnvDuration("HA_SNAPSHOT_INTERVAL", 2*time.Second)
+	for range time.Tick(interval) {
+		if !h.isActive() {
+			continue
+		}
+		sessions := fleet.liveSessions()
+		for _, s := range sessions {
+			s.Lock()
+			if s.callSid == "" || s.migratedTo != "" || s.killed {
+				s.Unlock()
+				continue
+			}
+			snapshot := s.snapshot(fleet.id)
+			s.Unlock()
+			if err := fleet.saveSnapshot(snapshot, h.snapshotTTL); err != nil {
+				log.Println("Error mirroring call snapshot:", err)
+				continue
+			}
+			fleet.redis.do("SADD", h.callsKey(), snapshot.Record.CallSid)
+		}
+	}
+}
+
+// forget drops a call's mirrored snapshot once it ends, or as soon as it is
+// ended on purpose, so that its stream closing hangs up instead of resuming
+func (h *HAPair) forget(callSid string) {
+	if h == nil || callSid == "" {
+		return
+	}
+	fleet.redis.do("DEL", fleetSnapshotKey+callSid)
+	fleet.redis.do("SREM", h.callsKey(), callSid)
+	fleet.redis.do("DEL", h.resumesKey(callSid))
+}
+
+// activeStreamURL returns the media stream URL of the current leader
+func (h *HAPair) activeStreamURL(local string) string {
+	if h.isActive() {
+		return fleet.streamURL
+	}
+	reply, err := fleet.redis.do("GET", h.leaderKey())
+	leader, _ := reply.(string)
+	if err != nil || leader == "" {
+		return local
+	}
+	reply, err = fleet.redis.do("GET", h.memberKey(leader))
+	streamURL, _ := reply.(string)
+	if err != nil || streamURL == "" {
+		return local
+	}
+	return streamURL
+}
+
+// redirectVerb is placed after <Connect> so Twilio asks what to do when the
+// stream ends; only a mirrored call dropped by its instance is reconnected
+func (h *HAPair) redirectVerb(tenant string) string {
+	if h == nil {
+		return ""
+	}
+	target := h.reconnectURL
+	if tenant != "" {
+		target += "?tenant=" + url.QueryEscape(tenant)
+	}
+	return "\n    <Redirect method=\"POST\">" + html.EscapeString(target) + "</Redirect>"
+}
+
+// handleReconnectStream serves /reconnect-stream, which Twilio requests
+// whenever a media stream ends without the call ending. Only calls the active
+// instance was mirroring, and that were not ended on purpose, are resumed on
+// a new stream; every other call, and one that keeps failing, hangs up
+func handleReconnectStream(c *gin.Context) {
+	c.Header("Content-Type", "text/xml")
+	hangup := `<?xml version="1.0" encoding="UTF-8"?><Response><Hangup/></Response>`
+	if ha == nil {
+		c.String(http.StatusOK, hangup)
+		return
+	}
+	callSid := c.Request.FormValue("CallSid")
+	ha.Lock()
+	ha.reconnects++
+	ha.Unlock()
+
+	reply, err := fleet.redis.do("SISMEMBER", ha.callsKey(), callSid)
+	if err != nil || reply != int64(1) {
+		log.Printf("Media stream of call %s ended; hanging up\n", callSid)
+		c.String(http.StatusOK, hangup)
+		return
+	}
+	attempts, err := fleet.redis.do("INCR", ha.resumesKey(callSid))
+	fleet.redis.do("EXPIRE", ha.resumesKey(callSid), strconv.Itoa(int(time.Hour.Seconds())))
+	if n, _ := attempts.(int64); err != nil || n > int64(ha.maxResumes) {
+		log.Printf("Call %s was resumed %d time(s) already; hanging up\n", callSid, ha.maxResumes)
+		ha.forget(callSid)
+		c.String(http.StatusOK, hangup)
+		return
+	}
+	ha.Lock()
+	ha.resumed++
+	ha.Unlock()
+	log.Printf("Reconnecting the media stream of call %s\n", callSid)
+
+	streamURL := ha.activeStreamURL("wss://" + c.Request.Host + "/media-stream")
+	c.String(http.StatusOK, `<?xml version="1.0" encoding="UTF-8"?>
+<Response>
+    <Connect>
+        <Stream url="`+html.EscapeString(streamURL)+`">
+            <Parameter name="Resume" value="true" />`+streamParameters(c)+`
+        </Stream>
+    </Connect>`+ha.redirectVerb(c.Query("tenant"))+`
+</Response>`)
+}
+
+// handleHAStatus serves GET /admin/ha
+func handleHAStatus(c *gin.Context) {
+	if ha == nil {
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+		return
+	}
+	ha.Lock()
+	defer ha.Unlock()
+	status := gin.H{
+		"enabled":    true,
+		"group":      ha.group,
+		"instance":   fleet.id,
+		"role":       ha.role,
+		"leader":     ha.leader,
+		"role_since": ha.roleSince.UTC(),
+		"failovers":  ha.failovers,
+		"reconnects": ha.reconnects,
+		"resumed":    ha.resumed,
+	}
+	if !ha.lastFailover.IsZero() {
+		status["last_failover"] = ha.lastFailover.UTC()
+	}
+	c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Fallback codes used when the classifier cannot pick from the taxonomy
+const (
+	IntentUnknown          = "unknown"
+	DispositionFailed      = "failed"
+	DispositionVoicemail   = "voicemail"
+	DispositionUnknown     = "unknown"
+	DispositionTransferred = "transferred"
+)
+
+// TaxonomyCode is one intent or disposition an agent can assign
+type TaxonomyCode struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+
+	// Contained marks dispositions where the AI resolved the call without a human
+	Contained bool `json:"contained,omitempty"`
+}
+
+// IntentTaxonomy is the classification scheme configured on an agent
+type IntentTaxonomy struct {
+	Intents      []TaxonomyCode `json:"intents"`
+	Dispositions []TaxonomyCode `json:"dispositions"`
+}
+
+// Classification is the result of tagging a finished call
+type Classification struct {
+	Intent      string `json:"intent"`
+	Disposition string `json:"disposition"`
+	Summary     string `json:"summary"`
+}
+
+// classifyCall tags the call with intent and disposition codes from the agent's
+// taxonomy using a text model over the transcript once the call has ended
+func classifyCall(agent *Agent, record CallRecord) (Classification, error) {
+	switch record.Status {
+	case CallFailed:
+		return Classification{Intent: IntentUnknown, Disposition: DispositionFailed}, nil
+	case CallVoicemail:
+		return Classification{Intent: IntentUnknown, Disposition: DispositionVoicemail}, nil
+	}
+	taxonomy := agent.Taxonomy
+	if taxonomy == nil || len(record.Transcript) == 0 {
+		return Classification{}, nil
+	}
+
+	var prompt strings.Builder
+	prompt.WriteString("Classify this phone call between a caller and an AI assistant.\n")
+	prompt.WriteString("Reply with a JSON object with keys \"intent\", \"disposition\" and \"summary\" (one or two sentences).\n")
+	prompt.WriteString("\nAllowed intents:\n")
+	for _, c := range taxonomy.Intents {
+		fmt.Fprintf(&prompt, "- %s: %s\n", c.Code, c.Description)
+	}
+	prompt.WriteString("\nAllowed dispositions:\n")
+	for _, c := range taxonomy.Dispositions {
+		fmt.Fprintf(&prompt, "- %s: %s\n", c.Code, c.Description)
+	}
+	fmt.Fprintf(&prompt, "\nUse %q if nothing fits.\n", IntentUnknown)
+
+	messages := []chatMessage{
+		{Role: "system", Content: prompt.String()},
+		{Role: "user", Content: transcriptText(record.Transcript)},
+	}
+	reply, err := chatCompletion(tenants.get(record.Tenant), agent.TextModel, messages, 0, true)
+	if err != nil {
+		return Classification{}, err
+	}
+	var result Classification
+	if err := json.Unmarshal([]byte(reply), &result); err != nil {
+		return Classification{}, fmt.Errorf("parsing classification: %w", err)
+	}
+	if !hasCode(taxonomy.Intents, result.Intent) {
+		result.Intent = IntentUnknown
+	}
+	if !hasCode(taxonomy.Dispositions, result.Disposition) {
+		result.Disposition = DispositionUnknown
+	}
+	return result, nil
+}
+
+// isContained reports whether a disposition counts as handled by the AI alone
+func isContained(agent *Agent, record CallRecord) bool {
+	if record.Status != CallCompleted || record.Disposition == DispositionTransferred {
+		return false
+	}
+	if agent.Taxonomy == nil || record.Disposition == "" {
+		return true
+	}
+	for _, c := range agent.Taxonomy.Dispositions {
+		if c.Code == record.Disposition {
+			return c.Contained
+		}
+	}
+	return false
+}
+
+// hasCode reports whether code is part of the list
+func hasCode(codes []TaxonomyCode, code string) bool {
+	for _, c := range codes {
+		if c.Code == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// What happened to a call when the instance stopped
+const (
+	// ShutdownFlushed calls were live at shutdown and saved as interrupted
+	ShutdownFlushed = "flushed"
+	// ShutdownMigrated calls were handed to another instance during the drain
+	ShutdownMigrated = "migrated"
+	// ShutdownRecovered calls were saved from the journal on the next start
+	ShutdownRecovered = "recovered"
+)
+
+// JournalEntry is a live call's latest checkpoint
+type JournalEntry struct {
+	Record    CallRecord `json:"record"`
+	Instance  string     `json:"instance"`
+	WrittenAt time.Time  `json:"written_at"`
+}
+
+// AffectedCall is one call listed in a shutdown report
+type AffectedCall struct {
+	CallSid     string    `json:"call_sid"`
+	Tenant      string    `json:"tenant"`
+	Agent       string    `json:"agent"`
+	StartedAt   time.Time `json:"started_at"`
+	DurationSec float64   `json:"duration_sec"`
+	Turns       int       `json:"turns"`
+	Action      string    `json:"action"`
+	Target      string    `json:"target,omitempty"`
+}
+
+// ShutdownReport lists the calls a shutdown, or the crash before a start,
+// cut short and what became of them
+type ShutdownReport struct {
+	ID         string         `json:"id"`
+	Instance   string         `json:"instance"`
+	Reason     string         `json:"reason"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	Calls      []AffectedCall `json:"calls"`
+}
+
+// Journal checkpoints every live call to DATA_DIR/journal so that a
+// restart, clean or not, never loses a call from billing and history. A
+// call's entry is removed once its record is saved
+type Journal struct {
+	sync.Mutex
+	dir      string
+	reports  string
+	interval time.Duration
+}
+
+// newJournal starts the checkpoint loop, and the loop that recovers the
+// calls of instances that stopped after this one started
+func newJournal() *Journal {
+	j := &Journal{dir: dataDir("journal"), reports: dataDir("shutdown_reports"), interval: getEnvDuration("JOURNAL_INTERVAL", 15*time.Second)}
+	go func() {
+		for range time.Tick(j.interval) {
+			for _, s := range fleet.liveSessions() {
+				j.checkpoint(s)
+			}
+		}
+	}()
+	go func() {
+		for range time.Tick(3 * j.interval) {
+			j.recover(false)
+		}
+	}()
+	return j
+}
+
+// checkpoint writes a live call's record so far; content the caller has not
+// consented to storing is left out, as in the final record
+func (j *Journal) checkpoint(s *Session) {
+	s.Lock()
+	if s.callSid == "" || s.ended || s.migratedTo != "" {
+		s.Unlock()
+		return
+	}
+	record := s.callRecord()
+	s.Unlock()
+	if !s.hasConsent(ConsentDataStorage) {
+		withoutContent(&record)
+	}
+	entry := JournalEntry{Record: record, Instance: fleet.id, WrittenAt: time.Now().UTC()}
+	j.Lock()
+	defer j.Unlock()
+	if err := writeJSONFile(j.path(record.CallSid), entry); err != nil {
+		log.Printf("Error journaling call %s: %v\n", record.CallSid, err)
+	}
+}
+
+// remove drops a call's entry once its record is saved or another instance owns it
+func (j *Journal) remove(callSid string) {
+	j.Lock()
+	defer j.Unlock()
+	if err := os.Remove(j.path(callSid)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error removing journal entry for %s: %v\n", callSid, err)
+	}
+}
+
+// path returns a call's journal file
+func (j *Journal) path(callSid string) string {
+	return filepath.Join(j.dir, callSid+".json")
+}
+
+// recover saves the calls left in the journal by a run that did not shut
+// down cleanly, and reports them; with a shared DATA_DIR, the entries of
+// other instances still running are theirs to keep. At startup this
+// instance's own entries are from its previous run; later they are its
+// live calls
+func (j *Journal) recover(startup bool) {
+	files, err := filepath.Glob(filepath.Join(j.dir, "*.json"))
+	if err != nil {
+		log.Println("Error listing the journal:", err)
+		return
+	}
+	report := ShutdownReport{ID: newID("shutdown"), Instance: fleet.id, Reason: "crash_recovery", StartedAt: time.Now().UTC()}
+	for _, file := range files {
+		var entry JournalEntry
+		if err := readJSONFile(file, &entry); err != nil || entry.Record.CallSid == "" {
+			log.Printf("Error reading journal entry %s: %v\n", file, err)
+			continue
+		}
+		if entry.Instance == fleet.id && !startup {
+			continue
+		}
+		if entry.Instance != "" && entry.Instance != fleet.id && j.instanceLive(entry) {
+			continue
+		}
+		callSid := entry.Record.CallSid
+		if _, saved := callStore.get(callSid); !saved {
+			record := entry.Record
+			record.Status = CallInterrupted
+			record.EndedAt = entry.WrittenAt
+			callStore.save(record)
+			report.Calls = append(report.Calls, affectedCall(record, ShutdownRecovered))
+		}
+		j.remove(callSid)
+	}
+	if len(report.Calls) > 0 {
+		j.report(report)
+	}
+}
+
+// instanceLive reports whether the instance that wrote an entry is still
+// running: its fleet heartbeat is current, or it has checkpointed the call
+// recently, as a running instance does every JOURNAL_INTERVAL
+func (j *Journal) instanceLive(entry JournalEntry) bool {
+	if fleet.redis != nil {
+		if reply, err := fleet.redis.do("EXISTS", fleetWorkerKey+entry.Instance); err == nil && reply == int64(1) {
+			return true
+		}
+	}
+	return time.Since(entry.WrittenAt) < 3*j.interval
+}
+
+// shutdown hands live calls to other instances when there is a fleet to
+// take them, saves the rest as interrupted and reports them all
+func (j *Journal) shutdown(reason string) {
+	report := ShutdownReport{ID: newID("shutdown"), Instance: fleet.id, Reason: reason, StartedAt: time.Now().UTC()}
+	if fleet.redis != nil && getEnvBool("SHUTDOWN_DRAIN", true) {
+		results, err := fleet.drain()
+		if err != nil {
+			log.Println("Error draining before shutdown:", err)
+		}
+		for _, result := range results {
+			if result.Error != "" {
+				continue
+			}
+			call := AffectedCall{CallSid: result.CallSid, Action: ShutdownMigrated, Target: result.Target}
+			if s := fleet.findSession(result.CallSid); s != nil {
+				s.Lock()
+				call = affectedCall(s.callRecord(), ShutdownMigrated)
+				call.Target = result.Target
+				s.Unlock()
+			}
+			report.Calls = append(report.Calls, call)
+		}
+	}
+
+	for _, s := range fleet.liveSessions() {
+		s.Lock()
+		if s.callSid == "" || s.ended || s.migratedTo != "" {
+			s.Unlock()
+			continue
+		}
+		s.interrupted = true
+		record := s.callRecord()
+		recorder := s.recorder
+		s.Unlock()
+		// end returns early for interrupted calls, so the recording is
+		// closed and attached here
+		if recorder != nil {
+			info := recorder.close()
+			record.Recording = &info
+			record.RecordingURL = recordingURL(record.CallSid)
+		}
+		if !s.hasConsent(ConsentDataStorage) {
+			withoutContent(&record)
+		}
+		record.Status = CallInterrupted
+		callStore.save(record)
+		j.remove(record.CallSid)
+		report.Calls = append(report.Calls, affectedCall(record, ShutdownFlushed))
+	}
+	j.report(report)
+}
+
+// affectedCall summarizes a record for a shutdown report
+func affectedCall(record CallRecord, action string) AffectedCall {
+	return AffectedCall{
+		CallSid:     record.CallSid,
+		Tenant:      record.Tenant,
+		Agent:       record.Agent,
+		StartedAt:   record.StartedAt,
+		DurationSec: record.duration().Seconds(),
+		Turns:       len(record.Turns),
+		Action:      action,
+	}
+}
+
+// report stores and logs a shutdown report
+func (j *Journal) report(report ShutdownReport) {
+	report.FinishedAt = time.Now().UTC()
+	sort.Slice(report.Calls, func(a, b int) bool { return report.Calls[a].CallSid < report.Calls[b].CallSid })
+	if err := writeJSONFile(filepath.Join(j.reports, report.ID+".json"), report); err != nil {
+		log.Println("Error saving shutdown report:", err)
+	}
+	ids := make([]string, 0, len(report.Calls))
+	for _, call := range report.Calls {
+		ids = append(ids, call.CallSid+" ("+call.Action+")")
+	}
+	log.Printf("Shutdown report %s (%s): %d call(s) affected %s\n", report.ID, report.Reason, len(report.Calls), strings.Join(ids, ", "))
+}
+
+// list returns the stored shutdown reports, newest first
+func (j *Journal) list() []ShutdownReport {
+	files, err := filepath.Glob(filepath.Join(j.reports, "*.json"))
+	if err != nil {
+		log.Println("Error listing shutdown reports:", err)
+	}
+	reports := []ShutdownReport{}
+	for _, file := range files {
+		var report ShutdownReport
+		if err := readJSONFile(file, &report); err != nil {
+			log.Printf("Error reading shutdown report %s: %v\n", file, err)
+			continue
+		}
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(a, b int) bool { return reports[a].StartedAt.After(reports[b].StartedAt) })
+	return reports
+}
+
+// serveUntilSignal runs the HTTP server until SIGINT or SIGTERM, then saves
+// the live calls before the server stops
+func serveUntilSignal(server *http.Server) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	stopped := make(chan struct{})
+	go func() {
+		sig := <-signals
+		log.Printf("Received %s, shutting down\n", sig)
+		journal.shutdown("signal: " + sig.String())
+		ctx, cancel := context.WithTimeout(context.Background(), getEnvDuration("SHUTDOWN_TIMEOUT", 10*time.Second))
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Println("Error shutting down the HTTP server:", err)
+		}
+		close(stopped)
+	}()
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	<-stopped
+	return nil
+}
+
+// handleShutdownReports serves GET /admin/shutdown-reports
+func handleShutdownReports(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"reports": journal.list()})
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Locale controls the language and formatting used on a call
+type Locale struct {
+	Language     string `json:"language"`
+	LanguageName string `json:"language_name"`
+	SayVoice     string `json:"say_voice"`
+	Greeting     string `json:"greeting"`
+	Connected    string `json:"connected"`
+	DateLayout   string `json:"date_layout"`
+	DecimalMark  string `json:"decimal_mark"`
+	ThousandsSep string `json:"thousands_separator"`
+	Timezone     string `json:"timezone"`
+
+	GoodMorning   string `json:"good_morning"`
+	GoodAfternoon string `json:"good_afternoon"`
+	GoodEvening   string `json:"good_evening"`
+	WelcomeBack   string `json:"welcome_back"`
+}
+
+// countryCodes maps the ITU-T E.164 calling codes to ISO country codes.
+// A code shared by several countries maps to the main one, with NANP
+// numbers placed by nanpAreaCodes; the non-geographic codes have no country
+var countryCodes = map[string]string{
+	"1": "US", "7": "RU",
+	"20": "EG", "27": "ZA", "30": "GR", "31": "NL", "32": "BE", "33": "FR", "34": "ES", "36": "HU",
+	"39": "IT", "40": "RO", "41": "CH", "43": "AT", "44": "GB", "45": "DK", "46": "SE", "47": "NO",
+	"48": "PL", "49": "DE", "51": "PE", "52": "MX", "53": "CU", "54": "AR", "55": "BR", "56": "CL",
+	"57": "CO", "58": "VE", "60": "MY", "61": "AU", "62": "ID", "63": "PH", "64": "NZ", "65": "SG",
+	"66": "TH", "81": "JP", "82": "KR", "84": "VN", "86": "CN", "90": "TR", "91": "IN", "92": "PK",
+	"93": "AF", "94": "LK", "95": "MM", "98": "IR",
+	"211": "SS", "212": "MA", "213": "DZ", "216": "TN", "218": "LY", "220": "GM", "221": "SN",
+	"222": "MR", "223": "ML", "224": "GN", "225": "CI", "226": "BF", "227": "NE", "228": "TG",
+	"229": "BJ", "230": "MU", "231": "LR", "232": "SL", "233": "GH", "234": "NG", "235": "TD",
+	"236": "CF", "237": "CM", "238": "CV", "239": "ST", "240": "GQ", "241": "GA", "242": "CG",
+	"243": "CD", "244": "AO", "245": "GW", "246": "IO", "247": "AC", "248": "SC", "249": "SD",
+	"250": "RW", "251": "ET", "252": "SO", "253": "DJ", "254": "KE", "255": "TZ", "256": "UG",
+	"257": "BI", "258": "MZ", "260": "ZM", "261": "MG", "262": "RE", "263": "ZW", "264": "NA",
+	"265": "MW", "266": "LS", "267": "BW", "268": "SZ", "269": "KM", "290": "SH", "291": "ER",
+	"297": "AW", "298": "FO", "299": "GL",
+	"350": "GI", "351": "PT", "352": "LU", "353": "IE", "354": "IS", "355": "AL", "356": "MT",
+	"357": "CY", "358": "FI", "359": "BG", "370": "LT", "371": "LV", "372": "EE", "373": "MD",
+	"374": "AM", "375": "BY", "376": "AD", "377": "MC", "378": "SM", "380": "UA", "381": "RS",
+	"382": "ME", "383": "XK", "385": "HR", "386": "SI", "387": "BA", "389": "MK", "420": "CZ",
+	"421": "SK", "423": "LI",
+	"500": "FK", "501": "BZ", "502": "GT", "503": "SV", "504": "HN", "505": "NI", "506": "CR",
+	"507": "PA", "508": "PM", "509": "HT", "590": "GP", "591": "BO", "592": "GY", "593": "EC",
+	"594": "GF", "595": "PY", "596": "MQ", "597": "SR", "598": "UY", "599": "CW",
+	"670": "TL", "672": "NF", "673": "BN", "674": "NR", "675": "PG", "676": "TO", "677": "SB",
+	"678": "VU", "679": "FJ", "680": "PW", "681": "WF", "682": "CK", "683": "NU", "685": "WS",
+	"686": "KI", "687": "NC", "688": "TV", "689": "PF", "690": "TK", "691": "FM", "692": "MH",
+	"850": "KP", "852": "HK", "853": "MO", "855": "KH", "856": "LA", "880": "BD", "886": "TW",
+	"960": "MV", "961": "LB", "962": "JO", "963": "SY", "964": "IQ", "965": "KW", "966": "SA",
+	"967": "YE", "968": "OM", "970": "PS", "971": "AE", "972": "IL", "973": "BH", "974": "QA",
+	"975": "BT", "976": "MN", "977": "NP", "992": "TJ", "993": "TM", "994": "AZ", "995": "GE",
+	"996": "KG", "998": "UZ",
+	"800": "", "808": "", "870": "", "878": "", "881": "", "882": "", "883": "", "888": "", "979": "",
+}
+
+// nanpAreaCodes maps the area codes of NANP countries other than the US;
+// numbers under calling code 1 with any other area code are taken as US
+var nanpAreaCodes = map[string]string{
+	"204": "CA", "226": "CA", "236": "CA", "249": "CA", "250": "CA", "257": "CA", "263": "CA", "289": "CA",
+	"306": "CA", "343": "CA", "354": "CA", "365": "CA", "367": "CA", "368": "CA", "382": "CA", "387": "CA",
+	"403": "CA", "416": "CA", "418": "CA", "428": "CA", "431": "CA", "437": "CA", "438": "CA", "450": "CA",
+	"460": "CA", "468": "CA", "474": "CA", "506": "CA", "514": "CA", "519": "CA", "548": "CA", "579": "CA",
+	"581": "CA", "584": "CA", "587": "CA", "600": "CA", "604": "CA", "613": "CA", "639": "CA", "647": "CA",
+	"672": "CA", "683": "CA", "705": "CA", "709": "CA", "742": "CA", "753": "CA", "778": "CA", "780": "CA",
+	"782": "CA", "807": "CA", "819": "CA", "825": "CA", "867": "CA", "873": "CA", "879": "CA", "902": "CA",
+	"905": "CA", "942": "CA",
+	"242": "BS", "246": "BB", "264": "AI", "268": "AG", "284": "VG", "340": "VI", "345": "KY", "441": "BM",
+	"473": "GD", "649": "TC", "658": "JM", "664": "MS", "670": "MP", "671": "GU", "684": "AS", "721": "SX",
+	"758": "LC", "767": "DM", "784": "VC", "787": "PR", "809": "DO", "829": "DO", "849": "DO", "868": "TT",
+	"869": "KN", "876": "JM", "939": "PR",
+}
+
+// languageLocales are the built-in locales keyed by language tag
+var languageLocales = map[string]Locale{
+	"en-US": {Language: "en-US", LanguageName: "English", Greeting: "Please wait while we connect your call to the AI voice assistant.", Connected: "O.K., you can start talking!", DateLayout: "January 2, 2006", DecimalMark: ".", ThousandsSep: ",", GoodMorning: "Good morning", GoodAfternoon: "Good afternoon", GoodEvening: "Good evening", WelcomeBack: "welcome back"},
+	"en-GB": {Language: "en-GB", LanguageName: "English", Greeting: "Please wait while we connect your call to the AI voice assistant.", Connected: "OK, you can start talking!", DateLayout: "2 January 2006", DecimalMark: ".", ThousandsSep: ",", GoodMorning: "Good morning", GoodAfternoon: "Good afternoon", GoodEvening: "Good evening", WelcomeBack: "welcome back"},
+	"es-ES": {Language: "es-ES", LanguageName: "Spanish", Greeting: "Por favor, espere mientras le conectamos con el asistente de voz.", Connected: "Ya puede empezar a hablar.", DateLayout: "2/1/2006", DecimalMark: ",", ThousandsSep: ".", GoodMorning: "Buenos días", GoodAfternoon: "Buenas tardes", GoodEvening: "Buenas noches", WelcomeBack: "bienvenido de nuevo"},
+	"es-MX": {Language: "es-MX", LanguageName: "Spanish", Greeting: "Por favor, espere mientras lo conectamos con el asistente de voz.", Connected: "Ya puede empezar a hablar.", DateLayout: "2/1/2006", DecimalMark: ".", ThousandsSep: ",", GoodMorning: "Buenos días", GoodAfternoon: "Buenas tardes", GoodEvening: "Buenas noches", WelcomeBack: "bienvenido de nuevo"},
+	"fr-FR": {Language: "fr-FR", LanguageName: "French", Greeting: "Veuillez patienter pendant que nous vous mettons en relation avec l'assistant vocal.", Connected: "Vous pouvez commencer à parler.", DateLayout: "02/01/2006", DecimalMark: ",", ThousandsSep: " ", GoodMorning: "Bonjour", GoodAfternoon: "Bonjour", GoodEvening: "Bonsoir", WelcomeBack: "bon retour parmi nous"},
+	"de-DE": {Language: "de-DE", LanguageName: "German", Greeting: "Bitte warten Sie, während wir Sie mit dem Sprachassistenten verbinden.", Connected: "Sie können jetzt sprechen.", DateLayout: "02.01.2006", DecimalMark: ",", ThousandsSep: ".", GoodMorning: "Guten Morgen", GoodAfternoon: "Guten Tag", GoodEvening: "Guten Abend", WelcomeBack: "willkommen zurück"},
+	"it-IT": {Language: "it-IT", LanguageName: "Italian", Greeting: "Attenda mentre la colleghiamo con l'assistente vocale.", Connected: "Ora può iniziare a parlare.", DateLayout: "02/01/2006", DecimalMark: ",", ThousandsSep: ".", GoodMorning: "Buongiorno", GoodAfternoon: "Buon pomeriggio", GoodEvening: "Buonasera", WelcomeBack: "bentornato"},
+	"pt-BR": {Language: "pt-BR", LanguageName: "Portuguese", Greeting: "Aguarde enquanto conectamos sua chamada ao assistente de voz.", Connected: "Pode começar a falar.", DateLayout: "02/01/2006", DecimalMark: ",", ThousandsSep: ".", GoodMorning: "Bom dia", GoodAfternoon: "Boa tarde", GoodEvening: "Boa noite", WelcomeBack: "bem-vindo de volta"},
+	"pt-PT": {Language: "pt-PT", LanguageName: "Portuguese", Greeting: "Aguarde enquanto ligamos a sua chamada ao assistente de voz.", Connected: "Pode começar a falar.", DateLayout: "02/01/2006", DecimalMark: ",", ThousandsSep: " ", GoodMorning: "Bom dia", GoodAfternoon: "Boa tarde", GoodEvening: "Boa noite", WelcomeBack: "bem-vindo de volta"},
+	"nl-NL": {Language: "nl-NL", LanguageName: "Dutch", Greeting: "Een moment geduld, we verbinden u met de spraakassistent.", Connected: "U kunt nu beginnen met praten.", DateLayout: "2-1-2006", DecimalMark: ",", ThousandsSep: ".", GoodMorning: "Goedemorgen", GoodAfternoon: "Goedemiddag", GoodEvening: "Goedenavond", WelcomeBack: "welkom terug"},
+}
+
+// countryLanguages picks the default language for a country
+var countryLanguages = map[string]string{
+	"US": "en-US", "CA": "en-US", "GB": "en-GB", "IE": "en-GB", "AU": "en-GB", "NZ": "en-GB", "ZA": "en-GB",
+	"IN": "en-GB", "SG": "en-GB", "ES": "es-ES", "MX": "es-MX", "AR": "es-MX", "CO": "es-MX", "CL": "es-MX",
+	"PE": "es-MX", "VE": "es-MX", "EC": "es-MX", "UY": "es-MX", "FR": "fr-FR", "BE": "fr-FR", "LU": "fr-FR",
+	"DE": "de-DE", "AT": "de-DE", "CH": "de-DE", "IT": "it-IT", "BR": "pt-BR", "PT": "pt-PT", "NL": "nl-NL",
+}
+
+// countryTimezones gives each country a representative time zone for greetings
+var countryTimezones = map[string]string{
+	"US": "America/New_York", "CA": "America/Toronto", "GB": "Europe/London", "IE": "Europe/Dublin",
+	"AU": "Australia/Sydney", "NZ": "Pacific/Auckland", "ZA": "Africa/Johannesburg", "IN": "Asia/Kolkata",
+	"SG": "Asia/Singapore", "ES": "Europe/Madrid", "MX": "America/Mexico_City", "AR": "America/Argentina/Buenos_Aires",
+	"CO": "America/Bogota", "CL": "America/Santiago", "PE": "America/Lima", "VE": "America/Caracas",
+	"EC": "America/Guayaquil", "UY": "America/Montevideo", "FR": "Europe/Paris", "BE": "Europe/Brussels",
+	"LU": "Europe/Luxembourg", "DE": "Europe/Berlin", "AT": "Europe/Vienna", "CH": "Europe/Zurich",
+	"IT": "Europe/Rome", "BR": "America/Sao_Paulo", "PT": "Europe/Lisbon", "NL": "Europe/Amsterdam",
+	"JP": "Asia/Tokyo", "KR": "Asia/Seoul", "CN": "Asia/Shanghai", "HK": "Asia/Hong_Kong",
+	"AE": "Asia/Dubai", "IL": "Asia/Jerusalem", "TR": "Europe/Istanbul", "PL": "Europe/Warsaw",
+	"SE": "Europe/Stockholm", "NO": "Europe/Oslo", "DK": "Europe/Copenhagen", "FI": "Europe/Helsinki",
+}
+
+// LocaleResolver picks a locale per call from the caller's country
+type LocaleResolver struct {
+	fallback  string
+	overrides map[string]Locale
+}
+
+// newLocaleResolver loads per-country overrides from LOCALES_FILE
+func newLocaleResolver() *LocaleResolver {
+	r := &LocaleResolver{
+		fallback:  getEnv("DEFAULT_LANGUAGE", "en-US"),
+		overrides: make(map[string]Locale),
+	}
+	if _, err := loadJSONFile("LOCALES_FILE", &r.overrides); err != nil {
+		log.Println("Error loading LOCALES_FILE:", err)
+	}
+	return r
+}
+
+// forNumber returns the locale for a caller number, applying any country override
+func (r *LocaleResolver) forNumber(number string) Locale {
+	country := countryForNumber(number)
+	language, ok := countryLanguages[country]
+	if !ok {
+		language = r.fallback
+	}
+	locale, ok := languageLocales[language]
+	if !ok {
+		locale = languageLocales["en-US"]
+	}
+	if tz, ok := countryTimezones[country]; ok {
+		locale.Timezone = tz
+	}
+	if override, ok := r.overrides[country]; ok {
+		locale = mergeLocale(locale, override)
+	}
+	return locale
+}
+
+// mergeLocale overlays the non-empty fields of override onto base
+func mergeLocale(base, override Locale) Locale {
+	if override.Language != "" {
+		if lang, ok := languageLocales[override.Language]; ok {
+			lang.Timezone = base.Timezone
+			base = lang
+		}
+		base.Language = override.Language
+	}
+	for _, f := range []struct{ dst, src *string }{
+		{&base.LanguageName, &override.LanguageName},
+		{&base.SayVoice, &override.SayVoice},
+		{&base.Greeting, &override.Greeting},
+		{&base.Connected, &override.Connected},
+		{&base.DateLayout, &override.DateLayout},
+		{&base.DecimalMark, &override.DecimalMark},
+		{&base.ThousandsSep, &override.ThousandsSep},
+		{&base.Timezone, &override.Timezone},
+		{&base.GoodMorning, &override.GoodMorning},
+		{&base.GoodAfternoon, &override.GoodAfternoon},
+		{&base.GoodEvening, &override.GoodEvening},
+		{&base.WelcomeBack, &override.WelcomeBack},
+	} {
+		if *f.src != "" {
+			*f.dst = *f.src
+		}
+	}
+	return base
+}
+
+// sayAttributes returns the language and voice attributes for TwiML <Say>
+func (l Locale) sayAttributes() string {
+	attrs := ` language="` + l.Language + `"`
+	if l.SayVoice != "" {
+		attrs += ` voice="` + l.SayVoice + `"`
+	}
+	return attrs
+}
+
+// instructions tells the model which language and formats to use
+func (l Locale) instructions() string {
+	return fmt.Sprintf("Speak %s unless the caller clearly prefers another language. "+
+		"Write dates like %q and numbers like %q.",
+		l.LanguageName, l.formatDate(time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC)), l.formatNumber(1234.5))
+}
+
+// formatDate formats a date using the locale's layout
+func (l Locale) formatDate(t time.Time) string {
+	return t.Format(l.DateLayout)
+}
+
+// formatNumber formats a number with the locale's decimal and thousands separators
+func (l Locale) formatNumber(value float64) string {
+	text := strconv.FormatFloat(value, 'f', -1, 64)
+	whole, frac, _ := strings.Cut(strings.TrimPrefix(text, "-"), ".")
+
+	var b strings.Builder
+	if value < 0 {
+		b.WriteString("-")
+	}
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(l.ThousandsSep)
+		}
+		b.WriteRune(digit)
+	}
+	if frac != "" {
+		b.WriteString(l.DecimalMark + frac)
+	}
+	return b.String()
+}
+
+// location returns the locale's time zone, falling back to UTC
+func (l Locale) location() *time.Location {
+	if l.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(l.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// salutation returns the time-of-day greeting for the caller's local time
+func (l Locale) salutation(now time.Time) string {
+	switch hour := now.In(l.location()).Hour(); {
+	case hour >= 5 && hour < 12:
+		return l.GoodMorning
+	case hour >= 12 && hour < 18:
+		return l.GoodAfternoon
+	default:
+		return l.GoodEvening
+	}
+}
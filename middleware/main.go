@@ -1,13 +1,16 @@
 package main
 
 import (
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"html"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -23,8 +26,43 @@ const (
 
 // Global variables
 var (
-	openAIAPIKey string
-	upgrader     = websocket.Upgrader{
+	openAIAPIKey      string
+	openAIRealtimeURL string
+	recordCassettes   bool
+	alerts            *Alerter
+	notifier          *Notifier
+	webhooks          *WebhookDispatcher
+	tenants           *TenantRegistry
+	agents            *AgentRegistry
+	smsThreads        *SMSThreads
+	locales           *LocaleResolver
+	memories          *MemoryStore
+	callStore         *CallStore
+	escalationBoard   *EscalationBoard
+	crm               *CRMWriter
+	restrictedNumbers *RestrictedList
+	featureFlags      *FeatureFlags
+	providerMetrics   *ProviderMetrics
+	exportJobs        *ExportJobs
+	canary            *Canary
+	fleet             *Fleet
+	ha                *HAPair
+	degrader          *Degrader
+	priorityClasses   *PriorityClasses
+	dncRegistry       *DNCRegistry
+	assets            *AssetStore
+	residency         *Residency
+	auditLog          *AuditLog
+	numberTable       *NumberTable
+	rollouts          *Rollouts
+	sandbox           *Sandbox
+	budgets           *BudgetTracker
+	pipeline          *Pipeline
+	memoryGuard       *MemoryGuard
+	journal           *Journal
+	pricing           Pricing
+	downgradePricing  Pricing
+	upgrader          = websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
 		// Allow all origins for simplicity. Adjust in production.
@@ -35,10 +73,112 @@ var (
 // Session represents a connection between FreeSWITCH and OpenAI
 type Session struct {
 	sync.Mutex
-	streamSid string
+	streamSid    string
 	isResponding bool
-	openAIConn *websocket.Conn
-	clientConn *websocket.Conn
+	openAIConn   *websocket.Conn
+	clientConn   *websocket.Conn
+	callSid      string
+	from         string
+	to           string
+	answeredBy   string
+	tenant       *Tenant
+	agent        *Agent
+	locale       Locale
+	startedAt    time.Time
+	usage        Usage
+	failed       bool
+	transcript   []TranscriptEntry
+
+	escalation  escalationState
+	escalations []string
+	priority    string
+	transferred bool
+	policy      policyState
+	dtmf        dtmfState
+
+	consent   map[string]ConsentDecision
+	audioRing []byte
+	recorder  *Recorder
+	// recordingBytes is how far a resumed call's previous stream recorded
+	recordingBytes int64
+
+	// flags are evaluated once when the stream starts
+	flags map[string]bool
+
+	callerQuality    qualityMeter
+	assistantQuality qualityMeter
+	turnLog          turnState
+
+	// canary marks synthetic calls placed by the canary scheduler
+	canary bool
+
+	// outbound marks calls the assistant placed; from is still the contact
+	outbound bool
+
+	// rollout is the agent rollout whose comparison the call counts toward
+	rollout string
+
+	// model is the realtime model the call runs on; downgrade says why it is
+	// not the primary one when the agent was over budget
+	model     string
+	downgrade string
+
+	// copilot streams the call to agent-assist UIs
+	copilot copilotFeed
+
+	// whisper bridges the caller to a human agent the model whispers to
+	whisper *whisperBridge
+
+	toolCalls []ToolCallRecord
+
+	// cassette captures the OpenAI event stream when RECORD_CASSETTES is set
+	cassette *cassetteRecorder
+
+	// migratedTo names the instance the call was handed to during a drain;
+	// migrations lists the instances it passed through before this one
+	migratedTo string
+	migrations []string
+
+	// trace holds the pipeline spans of a call sampled for tracing;
+	// traceCallSid labels the spans once the stream has started
+	trace        atomic.Pointer[pipelineTrace]
+	traceCallSid atomic.Pointer[string]
+
+	// res accounts the session's goroutines, traffic and handling time;
+	// connectedAt is when this instance's stream started, whatever the
+	// call's age; memoryLimit names the ceiling the call was ended for
+	connectedAt time.Time
+	memoryLimit string
+
+	// ended is set once the call's record is being produced; interrupted
+	// when a shutdown saved the call before it ended
+	ended       bool
+	interrupted bool
+
+	// killed is set when an operator terminates the call
+	res    sessionResources
+	killed bool
+
+	// degradation is the load degradation level when the stream started
+	degradation int
+
+	// priorityClass is the admission class the call was placed in
+	priorityClass string
+
+	// voiceprint streams caller audio to the speaker-verification provider
+	voiceprint *voiceprintState
+
+	// captured holds structured details by field name, validated and
+	// awaiting or past the caller's confirmation
+	captured map[string]CapturedValue
+
+	// pending holds the Twilio messages read before the session was created
+	pending [][]byte
+
+	// writeMu serializes writes to the OpenAI connection across goroutines;
+	// clientMu does the same for the Twilio connection
+	writeMu  sync.Mutex
+	clientMu sync.Mutex
 }
 
 // Event represents the structure of events exchanged with OpenAI
@@ -47,6 +187,13 @@ type Event struct {
 	Session json.RawMessage `json:"session,omitempty"`
 	Item    json.RawMessage `json:"item,omitempty"`
 	Delta   string          `json:"delta,omitempty"`
+	Error   json.RawMessage `json:"error,omitempty"`
+
+	Transcript   string `json:"transcript,omitempty"`
+	Text         string `json:"text,omitempty"`
+	ItemID       string `json:"item_id,omitempty"`
+	AudioStartMs int64  `json:"audio_start_ms,omitempty"`
+	AudioEndMs   int64  `json:"audio_end_ms,omitempty"`
 }
 
 // initialize loads environment variables
@@ -56,32 +203,240 @@ func initialize() {
 		log.Println("No .env file found. Using environment variables.")
 	}
 
+	sandbox = newSandbox()
 	openAIAPIKey = os.Getenv("OPENAI_API_KEY")
 	if openAIAPIKey == "" {
 		log.Fatal("Missing OpenAI API key. Please set it in the environment variables.")
 	}
+	openAIRealtimeURL = getEnv("OPENAI_REALTIME_URL", OpenAIWebSocketURL)
+	if sandbox != nil {
+		openAIRealtimeURL = sandbox.realtimeURL()
+	}
+	recordCassettes = getEnvBool("RECORD_CASSETTES", false)
+	defaultCountry = getEnv("DEFAULT_COUNTRY", defaultCountry)
+
+	alerts = newAlerter(loadAlertConfig())
+	pricing = loadPricing()
+	downgradePricing = loadDowngradePricing()
+	notifier = newNotifier()
+	webhooks = newWebhookDispatcher()
+	tenants = loadTenants()
+	agents = loadAgents()
+	smsThreads = newSMSThreads()
+	locales = newLocaleResolver()
+	memories = newMemoryStore()
+	callStore = newCallStore()
+	escalationBoard = newEscalationBoard()
+	crm = newCRMWriter()
+	restrictedNumbers = loadRestrictedList()
+	featureFlags = loadFeatureFlags()
+	providerMetrics = newProviderMetrics()
+	pipeline = newPipeline()
+	memoryGuard = newMemoryGuard()
+	exportJobs = newExportJobs()
+	canary = newCanary()
+	fleet = newFleet()
+	ha = newHAPair()
+	degrader = newDegrader()
+	priorityClasses = loadPriorityClasses()
+	dncRegistry = loadDNCRegistry()
+	assets = newAssetStore()
+	residency = loadResidency()
+	auditLog = newAuditLog()
+	numberTable = loadNumberTable()
+	rollouts = loadRollouts()
+	budgets = newBudgetTracker()
+	journal = newJournal()
+	journal.recover(true)
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "regress" {
+		os.Exit(runRegress(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "openapi" {
+		os.Exit(runOpenAPI(os.Args[2:]))
+	}
 	initialize()
 
-	router := gin.Default()
+	// Start the server
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "5050"
+	}
+
+	log.Printf("Listening on :%s\n", port)
+	if err := serveUntilSignal(&http.Server{Addr: ":" + port, Handler: newRouter()}); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// newRouter registers every HTTP and WebSocket route
+func newRouter() *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery(), accessLogger())
 
 	// Route for incoming calls
-	router.GET("/incoming-call", func(c *gin.Context) {
+	router.Match([]string{http.MethodGet, http.MethodPost}, "/incoming-call", func(c *gin.Context) {
+		from, to := callParties(c)
+		locale := locales.forNumber(from)
+		if restrictedNumbers.checkInbound(to, c.Request.FormValue("ForwardedFrom"), c.Request.FormValue("CallSid")) {
+			c.Header("Content-Type", "text/xml")
+			c.String(http.StatusOK, `<?xml version="1.0" encoding="UTF-8"?>
+<Response>
+    <Say`+locale.sayAttributes()+`>`+html.EscapeString(restrictedNumbers.notice)+`</Say>
+    <Hangup/>
+</Response>`)
+			return
+		}
+		route := callRoute(c)
+		tenant := tenants.get(route.Tenant)
+		if _, err := residency.regionFor(tenant); err != nil {
+			log.Printf("Refusing call %s: %v\n", c.Request.FormValue("CallSid"), err)
+			c.Header("Content-Type", "text/xml")
+			c.String(http.StatusOK, residency.unavailableTwiML(locale))
+			return
+		}
+		class := priorityClasses.classify(tenant, from, to, c.Query("class"))
+		if !degrader.admitCall(class.Rank) {
+			log.Printf("Shedding %s call %s for tenant %s under load\n", class.Name, c.Request.FormValue("CallSid"), tenant.ID)
+			c.Header("Content-Type", "text/xml")
+			c.String(http.StatusOK, degrader.shedTwiML(locale))
+			return
+		}
+		agent, _ := routedAgent(tenant, route.Agent, from)
+		if !priorityClasses.admit(c.Request.FormValue("CallSid"), class) {
+			// Hold the caller and ask again; Twilio resolves the relative URL
+			retryURL := "/incoming-call"
+			if c.Request.URL.RawQuery != "" {
+				retryURL += "?" + c.Request.URL.RawQuery
+			}
+			c.Header("Content-Type", "text/xml")
+			c.String(http.StatusOK, priorityClasses.holdTwiML(locale, agentAsset(c, agent, AssetHold), retryURL))
+			return
+		}
+		greeting := agentAsset(c, agent, AssetGreeting)
+		if greeting == "" {
+			greeting = `<Say` + locale.sayAttributes() + `>` + html.EscapeString(agent.pronounce(buildGreeting(tenant, locale, from, time.Now()))) + `</Say>`
+		}
 		twiml := `<?xml version="1.0" encoding="UTF-8"?>
 <Response>
-    <Say>Please wait while we connect your call to the AI voice assistant.</Say>
+    ` + greeting + `
     <Pause length="1"/>
-    <Say>O.K., you can start talking!</Say>
+    <Say` + locale.sayAttributes() + `>` + html.EscapeString(locale.Connected) + `</Say>
     <Connect>
-        <Stream url="wss://` + c.Request.Host + `/media-stream" />
-    </Connect>
+        <Stream url="` + html.EscapeString(fleet.mediaStreamURL(c.Request.Host, c.Request.FormValue("CallSid"))) + `">` + streamParameters(c) + `
+        </Stream>
+    </Connect>` + ha.redirectVerb(c.Query("tenant")) + `
 </Response>`
+		if agent.Whisper != nil {
+			twiml = whisperTwiML(c, greeting)
+		}
 		c.Header("Content-Type", "text/xml")
 		c.String(http.StatusOK, twiml)
 	})
 
+	// Twilio falls through to this when a media stream drops mid-call in HA mode
+	router.Match([]string{http.MethodGet, http.MethodPost}, "/reconnect-stream", requireTwilioSignature(), handleReconnectStream)
+
+	// Recorded prompts fetched by Twilio for <Play>
+	router.GET("/assets/:name/:file", handleAssetAudio)
+
+	// Whispers Twilio reads to the human agent's leg of a whisper call
+	router.GET("/whisper/:id/:n", handleWhisperAnnounce)
+
+	// Version and API information for tooling and integrators
+	router.GET("/version", handleVersion)
+	router.GET("/openapi.json", handleOpenAPI(router))
+
+	// Route for inbound SMS, answered by the same agents in text mode
+	router.POST("/incoming-sms", requireTwilioSignature(), handleIncomingSMS)
+
+	// Admin API
+	admin := router.Group("/admin", requireAdmin())
+	admin.GET("/version", handleVersionDetails)
+	admin.GET("/reports/summary", handleCallSummaryReport)
+	admin.GET("/reports/providers", handleProviderReport)
+	admin.GET("/search", auditAccess(AuditSearch), handleSearch)
+	admin.POST("/exports", handleCreateExport)
+	admin.GET("/exports", handleListExports)
+	admin.GET("/exports/:id", handleGetExport)
+	admin.GET("/qa/queue", handleQAQueue)
+	admin.POST("/qa/:id/review", handleQAReview)
+	admin.GET("/canary", handleCanaryStatus)
+	admin.POST("/canary/run", handleCanaryRun)
+	admin.GET("/escalations", handleListEscalations)
+	admin.POST("/escalations/:id/ack", handleAcknowledgeEscalation)
+	admin.GET("/flags", handleListFlags)
+	admin.PUT("/flags/:name", handlePutFlag)
+	admin.DELETE("/flags/:name", handleDeleteFlag)
+	admin.GET("/fleet", handleFleetStatus)
+	admin.POST("/drain", handleDrain)
+	admin.DELETE("/drain", handleUndrain)
+	admin.GET("/ha", handleHAStatus)
+	admin.GET("/sessions", handleSessionUsage)
+	admin.DELETE("/sessions/:id", handleKillSession)
+	admin.GET("/degradation", handleDegradationStatus)
+	admin.GET("/priority", handlePriorityStatus)
+	admin.POST("/outbound", handleOutboundCalls)
+	admin.GET("/campaigns/:id", handleCampaignContacts)
+	admin.GET("/dnc", handleListDNC)
+	admin.GET("/dnc/:number", handleCheckDNC)
+	admin.PUT("/dnc/:number", handlePutDNC)
+	admin.DELETE("/dnc/:number", handleDeleteDNC)
+	admin.GET("/assets", handleListAssets)
+	admin.GET("/assets/:name", handleGetAsset)
+	admin.POST("/assets/tts", handleTTSAsset)
+	admin.POST("/assets/:name", handleUploadAsset)
+	admin.PUT("/assets/:name/current", handleSetAssetVersion)
+	admin.DELETE("/assets/:name", handleDeleteAsset)
+	admin.GET("/regions", handleRegionStatus)
+	admin.PUT("/regions/:name", handlePutRegion)
+	admin.GET("/audit", handleAuditLog)
+	admin.GET("/agents", handleListAgents)
+	admin.GET("/agents/:id", handleGetAgent)
+	admin.PUT("/agents/:id", handlePutAgent)
+	admin.DELETE("/agents/:id", handleDeleteAgent)
+	admin.GET("/numbers", handleListNumbers)
+	admin.GET("/numbers/:number", handleGetNumber)
+	admin.PUT("/numbers/:number", handlePutNumber)
+	admin.DELETE("/numbers/:number", handleDeleteNumber)
+	admin.POST("/numbers/reload", handleReloadNumbers)
+	admin.GET("/webhooks", handleListWebhooks)
+	admin.GET("/webhooks/:id", handleGetWebhook)
+	admin.PUT("/webhooks/:id", handlePutWebhook)
+	admin.DELETE("/webhooks/:id", handleDeleteWebhook)
+	admin.POST("/apply", handleApply)
+	admin.GET("/rollouts", handleListRollouts)
+	admin.GET("/rollouts/:id", handleGetRollout)
+	admin.PUT("/rollouts/:id", handlePutRollout)
+	admin.DELETE("/rollouts/:id", handleDeleteRollout)
+	admin.POST("/rollouts/:id/promote", handleFinishRollout(RolloutPromoted))
+	admin.POST("/rollouts/:id/rollback", handleFinishRollout(RolloutRolledBack))
+	admin.GET("/sandbox/captures", handleSandboxCaptures)
+	admin.GET("/budgets", handleBudgetStatus)
+	admin.GET("/pipeline", handlePipelineMetrics)
+	admin.GET("/memory", handleMemoryStatus)
+	admin.GET("/shutdown-reports", handleShutdownReports)
+	admin.DELETE("/sandbox/captures", handleClearSandboxCaptures)
+
+	// Call data API, behind the same admin token
+	calls := router.Group("/calls", requireAdmin())
+	calls.GET("/:id/turns", auditAccess(AuditTurns), handleCallTurns)
+	calls.GET("/:id/audio", auditAccess(AuditRecording), handleCallAudio)
+	calls.GET("/:id/transcript", auditAccess(AuditTranscript), handleCallTranscript)
+	calls.GET("/:id/access", handleCallAccessReport)
+	calls.GET("/:id/copilot", auditAccess(AuditCopilot), handleCopilotStream)
+	calls.GET("/:id/trace", auditAccess(AuditTrace), handleCallTrace)
+	calls.GET("/:id/whisper", auditAccess(AuditWhisper), handleGetWhisper)
+	calls.PUT("/:id/whisper", auditAccess(AuditWhisperSet), handlePutWhisper)
+	calls.PUT("/:id/dataset", handleSetDatasetInclusion)
+	calls.PUT("/:id/csat", handleSetCSAT)
+
+	// Signed export downloads and transcript links carry their own authorization
+	router.GET("/exports/:id/download", auditAccess(AuditDownload), handleDownloadExport)
+	router.GET("/transcripts/:id", auditAccess(AuditTranscript), handleSignedTranscript)
+
 	// WebSocket route for media-stream
 	router.GET("/media-stream", func(c *gin.Context) {
 		clientConn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
@@ -92,61 +447,159 @@ func main() {
 		defer clientConn.Close()
 		log.Println("Client connected")
 
+		// The tenant, and with it the region the call must be processed in,
+		// is only known once Twilio sends the start event
+		pending, params, err := awaitStreamStart(clientConn)
+		if err != nil {
+			log.Println("Error waiting for the stream to start:", err)
+			return
+		}
+		tenant := tenants.get(params["Tenant"])
+		region, err := residency.regionFor(tenant)
+		if err != nil {
+			log.Println("Refusing media stream:", err)
+			ha.forget(params["CallSid"])
+			return
+		}
+
+		// The model is chosen before dialing: an agent over its budget gets
+		// the cheaper one
+		from, to := normalizeNumber(params["From"]), normalizeNumber(params["To"])
+		agent, _ := routedAgent(tenant, params["Agent"], from)
+		class := priorityClasses.classify(tenant, from, to, params["Class"]).Name
+		realtimeURL := region.realtimeURL()
+		model, downgrade := budgets.modelFor(agent, class)
+		if params["Resume"] == "true" && params["Model"] != "" {
+			// A migrated or recycled call stays on the model it started on
+			model, downgrade = params["Model"], ""
+		}
+		if model != "" {
+			realtimeURL = withRealtimeModel(realtimeURL, model)
+		}
+		if downgrade != "" {
+			log.Printf("Agent %s is over budget, using %s: %s\n", agent.ID, model, downgrade)
+		}
+
 		// Establish connection to OpenAI Realtime API
 		headers := http.Header{}
-		headers.Add("Authorization", "Bearer "+openAIAPIKey)
+		headers.Add("Authorization", "Bearer "+region.apiKey())
 		headers.Add("OpenAI-Beta", "realtime=v1")
 
-		openAIConn, _, err := websocket.DefaultDialer.Dial(OpenAIWebSocketURL, headers)
+		dialStarted := time.Now()
+		openAIConn, _, err := websocket.DefaultDialer.Dial(realtimeURL, headers)
+		providerMetrics.record(ProviderOpenAIRealtime, time.Since(dialStarted), err)
 		if err != nil {
 			log.Println("Error connecting to OpenAI Realtime API:", err)
+			alerts.recordDialFailure(err)
+			ha.forget(params["CallSid"])
 			return
 		}
 		defer openAIConn.Close()
 		log.Println("Connected to OpenAI Realtime API")
 
 		session := &Session{
-			clientConn: clientConn,
-			openAIConn: openAIConn,
+			clientConn:   clientConn,
+			openAIConn:   openAIConn,
+			pending:      pending,
 			isResponding: false,
+			startedAt:    time.Now(),
+			connectedAt:  time.Now(),
+			tenant:       tenants.get(DefaultTenantID),
+			agent:        agents.get(DefaultAgentID),
+			consent:      make(map[string]ConsentDecision),
+			captured:     make(map[string]CapturedValue),
+			turnLog:      turnState{assistantOpen: -1},
+			cassette:     newCassetteRecorder(),
+			model:        realtimeModel(realtimeURL),
+			downgrade:    downgrade,
 		}
-
-		// Send session update after connection
-		session.sendSessionUpdate()
+		fleet.track(session)
+		defer fleet.untrack(session)
 
 		// Start goroutines for bidirectional communication
-		go session.handleOpenAIMessages()
-		go session.handleClientMessages()
+		done := make(chan string, 2)
+		session.spawn(func() {
+			session.handleOpenAIMessages()
+			done <- "openai"
+		})
+		session.spawn(func() {
+			session.handleClientMessages()
+			done <- "client"
+		})
 
-		// Block until connection is closed
-		select {}
+		// Block until either side closes; the deferred closes stop the other loop
+		if <-done == "openai" && !session.wasKilled() {
+			session.markFailed()
+		}
+		session.end()
 	})
 
-	// Start the server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "5050"
-	}
+	return router
+}
 
-	router.Run(":" + port)
+// identity returns the session's tenant, agent and caller number, which the
+// start event sets while the OpenAI goroutine may already be reading them
+func (s *Session) identity() (*Tenant, *Agent, string) {
+	s.Lock()
+	defer s.Unlock()
+	return s.tenant, s.agent, s.from
 }
 
-// sendSessionUpdate sends the initial session.update event to OpenAI
+// instructions composes the agent prompt with locale and caller context
+func (s *Session) instructions() string {
+	_, agent, _ := s.identity()
+	s.Lock()
+	locale, whisper := s.locale, s.whisper
+	s.Unlock()
+	if whisper != nil {
+		return whisperInstructions(whisper.config, agent, locale)
+	}
+	text := agent.instructionsFor(locale.Language) + "\n\n" + locale.instructions()
+	if context := s.callerContext(); context != "" {
+		text += "\n\n" + context
+	}
+	if extra := s.policyInstructions(); extra != "" {
+		text += "\n\n" + extra
+	}
+	if consent := s.consentInstructions(); consent != "" {
+		text += "\n\n" + consent
+	}
+	if vocabulary := agent.vocabularyInstructions(); vocabulary != "" {
+		text += "\n\n" + vocabulary
+	}
+	if capture := s.captureInstructions(); capture != "" {
+		text += "\n\n" + capture
+	}
+	return text
+}
+
+// sendSessionUpdate sends the session.update event to OpenAI; it is resent
+// whenever the conversation policy changes the session settings
 func (s *Session) sendSessionUpdate() {
+	_, agent, _ := s.identity()
 	sessionUpdate := map[string]interface{}{
 		"type": "session.update",
 		"session": map[string]interface{}{
-			"turn_detection": map[string]interface{}{
-				"type": "server_vad",
+			"turn_detection":     s.turnDetection(),
+			"input_audio_format": "g711_alaw",
+			"input_audio_transcription": map[string]interface{}{
+				"model": "whisper-1",
 			},
-			"input_audio_format":  "g711_alaw",
 			"output_audio_format": "g711_alaw",
-			"voice":               VOICE,
-			"instructions":        SYSTEM_MESSAGE,
-			"modalities":          []string{"text", "audio"},
-			"temperature":         0.8,
+			"voice":               agent.Voice,
+			"instructions":        s.instructions(),
+			"modalities":          s.modalities(),
+			"temperature":         agent.Temperature,
+			"tools":               s.toolDefinitions(),
 		},
 	}
+	if prompt := agent.transcriptionPrompt(); prompt != "" {
+		sessionUpdate["session"].(map[string]interface{})["input_audio_transcription"].(map[string]interface{})["prompt"] = prompt
+	}
+	if s.degradation >= DegradeMedia {
+		// Under load the caller's audio is not transcribed
+		delete(sessionUpdate["session"].(map[string]interface{}), "input_audio_transcription")
+	}
 
 	data, err := json.Marshal(sessionUpdate)
 	if err != nil {
@@ -154,7 +607,7 @@ func (s *Session) sendSessionUpdate() {
 		return
 	}
 
-	err = s.openAIConn.WriteMessage(websocket.TextMessage, data)
+	err = s.writeOpenAI(data)
 	if err != nil {
 		log.Println("Error sending session.update:", err)
 		return
@@ -165,15 +618,20 @@ func (s *Session) sendSessionUpdate() {
 
 // handleOpenAIMessages listens for messages from OpenAI and forwards them to FreeSWITCH
 func (s *Session) handleOpenAIMessages() {
+	timer := busyTimer{res: &s.res}
 	for {
+		timer.idle()
 		_, message, err := s.openAIConn.ReadMessage()
 		if err != nil {
 			log.Println("Error reading from OpenAI WebSocket:", err)
 			return
 		}
+		timer.busy()
+		s.received(message)
+		s.cassette.server(message)
 
 		var event Event
-		err = json.Unmarshal(message, &event)
+		err = s.stage(PathOutbound, StageDecode, len(message), func() error { return json.Unmarshal(message, &event) })
 		if err != nil {
 			log.Println("Error unmarshaling OpenAI message:", err)
 			continue
@@ -187,9 +645,41 @@ func (s *Session) handleOpenAIMessages() {
 		case "response.done":
 			s.Lock()
 			s.isResponding = false
+			s.usage.add(message)
 			s.Unlock()
+			s.responseFinished(message)
+		case "input_audio_buffer.speech_started":
+			s.callerSpeechStarted(event.ItemID, event.AudioStartMs)
+		case "input_audio_buffer.speech_stopped":
+			s.callerSpeechStopped(event.ItemID, event.AudioEndMs)
+		case "conversation.item.input_audio_transcription.completed":
+			s.setTurnTranscript(SpeakerCaller, event.ItemID, event.Transcript)
+			s.addTranscript(SpeakerCaller, event.Transcript)
+		case "conversation.item.input_audio_transcription.failed":
+			s.applyConversationPolicy(SpeakerCaller, "")
+		case "response.audio_transcript.done":
+			s.setTurnTranscript(SpeakerAssistant, event.ItemID, event.Transcript)
+			s.addTranscript(SpeakerAssistant, event.Transcript)
+		case "response.audio_transcript.delta", "response.text.delta":
+			s.copilot.publish(CopilotEvent{Type: CopilotTextDelta, ItemID: event.ItemID, Text: event.Delta})
+		case "response.text.done":
+			s.copilot.publish(CopilotEvent{Type: CopilotTextDone, ItemID: event.ItemID, Text: event.Text})
+			if s.whisper != nil {
+				text := event.Text
+				s.spawn(func() { s.whisperText(text) })
+			}
+		case "response.function_call_arguments.done":
+			s.spawn(func() { s.handleFunctionCall(message) })
+		case "error":
+			log.Printf("Error event from OpenAI: %s\n", event.Error)
+			providerMetrics.recordError(ProviderOpenAIRealtime, realtimeErrorCategory(event.Error))
+			s.markFailed()
 		case "response.audio.delta":
 			if event.Delta != "" {
+				s.stage(PathOutbound, StageDSP, len(event.Delta), func() error {
+					s.recordAssistantAudio(event.Delta)
+					return nil
+				})
 				audioPayload := map[string]interface{}{
 					"event":     "media",
 					"streamSid": s.streamSid,
@@ -197,12 +687,16 @@ func (s *Session) handleOpenAIMessages() {
 						"payload": event.Delta,
 					},
 				}
-				data, err := json.Marshal(audioPayload)
+				var data []byte
+				err := s.stage(PathOutbound, StageEncode, len(event.Delta), func() (err error) {
+					data, err = json.Marshal(audioPayload)
+					return err
+				})
 				if err != nil {
 					log.Println("Error marshaling audio delta:", err)
 					continue
 				}
-				err = s.clientConn.WriteMessage(websocket.TextMessage, data)
+				err = s.stage(PathOutbound, StageForward, len(data), func() error { return s.writeClient(data) })
 				if err != nil {
 					log.Println("Error sending audio delta to client:", err)
 					return
@@ -217,15 +711,19 @@ func (s *Session) handleOpenAIMessages() {
 
 // handleClientMessages listens for messages from FreeSWITCH and forwards them to OpenAI
 func (s *Session) handleClientMessages() {
+	timer := busyTimer{res: &s.res}
 	for {
-		_, message, err := s.clientConn.ReadMessage()
+		timer.idle()
+		message, err := s.readClient()
 		if err != nil {
 			log.Println("Error reading from client WebSocket:", err)
 			return
 		}
+		timer.busy()
+		s.received(message)
 
 		var data map[string]interface{}
-		err = json.Unmarshal(message, &data)
+		err = s.stage(PathInbound, StageDecode, len(message), func() error { return json.Unmarshal(message, &data) })
 		if err != nil {
 			log.Println("Error unmarshaling client message:", err)
 			continue
@@ -245,21 +743,41 @@ func (s *Session) handleClientMessages() {
 				continue
 			}
 
+			// Whisper calls carry both legs of the conference and never barge in
+			if s.whisper != nil {
+				s.forwardWhisperAudio(data["media"].(map[string]interface{}), audioPayload)
+				continue
+			}
+			s.stage(PathInbound, StageDSP, len(audioPayload), func() error {
+				s.recordCallerAudio(data["media"].(map[string]interface{}), audioPayload)
+				return nil
+			})
+
+			// In DTMF menu mode the caller's audio never reaches the model
+			if s.dtmfActive() {
+				continue
+			}
+
 			// Send input_audio_buffer.append event to OpenAI
 			audioAppend := map[string]interface{}{
-				"type": "input_audio_buffer.append",
+				"type":  "input_audio_buffer.append",
 				"audio": audioPayload,
 			}
-			appendData, err := json.Marshal(audioAppend)
+			var appendData []byte
+			err := s.stage(PathInbound, StageEncode, len(audioPayload), func() (err error) {
+				appendData, err = json.Marshal(audioAppend)
+				return err
+			})
 			if err != nil {
 				log.Println("Error marshaling input_audio_buffer.append:", err)
 				continue
 			}
-			err = s.openAIConn.WriteMessage(websocket.TextMessage, appendData)
+			err = s.stage(PathInbound, StageProvider, len(appendData), func() error { return s.writeOpenAI(appendData) })
 			if err != nil {
 				log.Println("Error sending input_audio_buffer.append to OpenAI:", err)
 				continue
 			}
+			s.inputAudioSent(base64Size(audioPayload))
 
 			// If OpenAI is responding, interrupt the response
 			s.Lock()
@@ -271,7 +789,7 @@ func (s *Session) handleClientMessages() {
 				if err != nil {
 					log.Println("Error marshaling response.cancel:", err)
 				} else {
-					err = s.openAIConn.WriteMessage(websocket.TextMessage, cancelData)
+					err = s.writeOpenAI(cancelData)
 					if err != nil {
 						log.Println("Error sending response.cancel to OpenAI:", err)
 					} else {
@@ -289,10 +807,260 @@ func (s *Session) handleClientMessages() {
 				continue
 			}
 			s.streamSid = streamSid
+			s.Lock()
+			resuming, whisper := false, false
+			requestedClass, agentID := "", ""
+			if callSid, ok := data["start"].(map[string]interface{})["callSid"].(string); ok {
+				s.callSid = callSid
+				s.startTrace(callSid)
+			}
+			if params, ok := data["start"].(map[string]interface{})["customParameters"].(map[string]interface{}); ok {
+				from, _ := params["From"].(string)
+				to, _ := params["To"].(string)
+				s.from, s.to = normalizeNumber(from), normalizeNumber(to)
+				s.answeredBy, _ = params["AnsweredBy"].(string)
+				s.canary = params["Canary"] == "true"
+				s.outbound = params["Direction"] == "outbound"
+				resuming = params["Resume"] == "true"
+				whisper = params["Whisper"] == "true"
+				if tenantID, ok := params["Tenant"].(string); ok {
+					s.tenant = tenants.get(tenantID)
+				}
+				requestedClass, _ = params["Class"].(string)
+				agentID, _ = params["Agent"].(string)
+			}
+			s.priorityClass = priorityClasses.classify(s.tenant, s.from, s.to, requestedClass).Name
+			s.agent, s.rollout = routedAgent(s.tenant, agentID, s.from)
+			if whisper && s.agent.Whisper != nil {
+				s.whisper = newWhisperBridge(*s.agent.Whisper, s.callSid)
+			}
+			s.locale = locales.forNumber(s.from)
+			s.flags = featureFlags.evaluate(s.tenant.ID, s.agent.ID, s.from)
+			s.degradation = degrader.current()
+			callSid := s.callSid
+			s.Unlock()
+			priorityClasses.streamStarted(callSid)
+			fleet.streamStarted(callSid)
+
+			// A migrated call picks up where it left off on the old instance
+			if resuming {
+				if err := s.resume(); err != nil {
+					log.Println("Error resuming migrated call:", err)
+					resuming = false
+				}
+			}
+
+			// Send session update once the tenant and agent are known
+			s.sendSessionUpdate()
+			s.startVoiceprint()
+			s.startRecordingIfAllowed()
+			if s.whisper != nil {
+				s.spawn(s.startWhisper)
+			}
+			s.spawn(func() { journal.checkpoint(s) })
 			log.Println("Incoming stream has started:", streamSid)
+			if !resuming && s.agent.Assets != nil && s.agent.Assets.Disclosure != "" {
+				if err := s.playAsset(s.agent.Assets.Disclosure); err != nil {
+					log.Println("Error playing disclosure:", err)
+				}
+			}
+			if !resuming && s.hasDTMFMenu() && s.agent.DTMFMenu.Start {
+				s.enterDTMFMode()
+			}
+
+		case "dtmf":
+			digit, ok := data["dtmf"].(map[string]interface{})["digit"].(string)
+			if !ok {
+				log.Println("Invalid digit in dtmf event")
+				continue
+			}
+			s.handleDTMF(digit)
 
 		default:
 			log.Printf("Received non-media event from client: %s\n", eventType)
 		}
 	}
 }
+
+// markFailed flags the call as failed for error-rate tracking
+func (s *Session) markFailed() {
+	s.Lock()
+	s.failed = true
+	s.Unlock()
+}
+
+// end records the outcome of the call once both connections are done
+func (s *Session) end() {
+	s.copilot.close()
+	s.stopVoiceprint()
+	s.Lock()
+	s.ended = true
+	record := s.callRecord()
+	recorder := s.recorder
+	migratedTo, interrupted := s.migratedTo, s.interrupted
+	s.Unlock()
+	if recorder != nil {
+		info := recorder.close()
+		record.Recording = &info
+		record.RecordingURL = recordingURL(record.CallSid)
+	}
+	if migratedTo != "" {
+		// The instance that resumed the call writes its record
+		log.Printf("Call %s handed off to %s\n", record.CallSid, migratedTo)
+		journal.remove(record.CallSid)
+		return
+	}
+	if interrupted {
+		// The shutdown already saved the call as interrupted
+		return
+	}
+
+	record.Degraded = degradedSteps(s.degradation)
+	if degrader.skipAnalysis() {
+		if s.degradation < DegradeAnalysis {
+			record.Degraded = degradedSteps(DegradeAnalysis)
+		}
+	} else {
+		classification, err := classifyCall(s.agent, record)
+		if err != nil {
+			log.Printf("Error classifying call %s: %v\n", record.CallSid, err)
+		}
+		record.Intent = classification.Intent
+		record.Disposition = classification.Disposition
+		record.Summary = classification.Summary
+		record.Rubric, err = scoreRubric(s.agent, record)
+		if err != nil {
+			log.Printf("Error scoring call %s against the QA rubric: %v\n", record.CallSid, err)
+		}
+	}
+	if record.Transferred {
+		record.Disposition = DispositionTransferred
+	}
+	record.Contained = isContained(s.agent, record)
+	if !s.hasConsent(ConsentDataStorage) {
+		// Without storage consent only the call metadata is kept
+		withoutContent(&record)
+	}
+	if !record.Canary {
+		record.Review = sampleForReview(s.agent, record)
+	}
+	callStore.save(record)
+	journal.remove(record.CallSid)
+	ha.forget(record.CallSid)
+	if s.hasConsent(ConsentDataStorage) {
+		s.saveCassette()
+	}
+
+	log.Printf("Call %s ended after %s (cost $%.4f, status=%s)\n", record.CallSid, record.duration().Round(time.Second), record.Cost, record.Status)
+	alerts.recordCallEnd(record.CallSid, record.Tenant, record.duration(), record.Cost, record.Status == CallFailed)
+	if record.Canary {
+		// Synthetic calls must not reach customers' notification channels or CRM
+		return
+	}
+	budgets.observe(s.agent, record)
+
+	event := CallNotification{CallSid: record.CallSid, From: record.From, To: record.To}
+	switch record.Status {
+	case CallFailed:
+		event.Trigger = TriggerCallFailed
+		event.Detail = "The OpenAI session ended unexpectedly."
+		notifier.notify(event)
+		webhooks.send(EventCallFailed, record)
+	case CallVoicemail:
+		event.Trigger = TriggerVoicemailLeft
+		notifier.notify(event)
+		webhooks.send(EventVoicemailLeft, record)
+	default:
+		webhooks.send(EventCallCompleted, record)
+	}
+	crm.logCall(s.tenant, record)
+	smsThreads.noteCall(record)
+	if remembersCallers(s) && s.hasConsent(ConsentDataStorage) {
+		memories.recordCall(record.Tenant, record.From, record.StartedAt)
+	}
+}
+
+// streamParameters forwards call metadata from the webhook into the media stream
+func streamParameters(c *gin.Context) string {
+	route := callRoute(c)
+	params := map[string]string{"Tenant": route.Tenant, "Agent": route.Agent, "Class": c.Query("class"), "AnsweredBy": c.Request.FormValue("AnsweredBy")}
+	params["From"], params["To"] = callParties(c)
+	if isOutbound(c) {
+		params["Direction"] = "outbound"
+	}
+
+	var b strings.Builder
+	for _, name := range []string{"Tenant", "Agent", "Class", "From", "To", "AnsweredBy", "Direction"} {
+		value := params[name]
+		if value == "" {
+			continue
+		}
+		b.WriteString("\n            <Parameter name=\"" + name + "\" value=\"" + html.EscapeString(value) + "\" />")
+	}
+	return b.String()
+}
+
+// awaitStreamStart reads the stream's opening messages up to the start event
+// and returns them, to be handled once the session exists, with the start
+// event's custom parameters and, as CallSid, the call it belongs to
+func awaitStreamStart(conn *websocket.Conn) ([][]byte, map[string]string, error) {
+	conn.SetReadDeadline(time.Now().Add(getEnvDuration("STREAM_START_TIMEOUT", 10*time.Second)))
+	defer conn.SetReadDeadline(time.Time{})
+	var pending [][]byte
+	for len(pending) < 10 {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return nil, nil, err
+		}
+		pending = append(pending, message)
+		var event struct {
+			Event string `json:"event"`
+			Start struct {
+				CallSid          string            `json:"callSid"`
+				CustomParameters map[string]string `json:"customParameters"`
+			} `json:"start"`
+		}
+		if json.Unmarshal(message, &event) == nil && event.Event == "start" {
+			params := event.Start.CustomParameters
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params["CallSid"] = event.Start.CallSid
+			return pending, params, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("no start event in the first %d messages", len(pending))
+}
+
+// readClient returns the next message from Twilio, starting with those read
+// before the session existed
+func (s *Session) readClient() ([]byte, error) {
+	if len(s.pending) > 0 {
+		message := s.pending[0]
+		s.pending = s.pending[1:]
+		return message, nil
+	}
+	_, message, err := s.clientConn.ReadMessage()
+	return message, err
+}
+
+// writeOpenAI writes a raw message to the OpenAI connection
+func (s *Session) writeOpenAI(data []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.cassette.client(data)
+	s.sent(data)
+	return s.openAIConn.WriteMessage(websocket.TextMessage, data)
+}
+
+// sendOpenAI marshals and sends an event to OpenAI, logging failures
+func (s *Session) sendOpenAI(event map[string]interface{}) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error marshaling %v: %v\n", event["type"], err)
+		return
+	}
+	if err := s.writeOpenAI(data); err != nil {
+		log.Printf("Error sending %v to OpenAI: %v\n", event["type"], err)
+	}
+}
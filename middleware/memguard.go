@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AlertMemoryLimit is raised when a call is ended to keep memory under a ceiling
+const AlertMemoryLimit = "memory_limit"
+
+// Memory ceilings a call can be ended for
+const (
+	LimitSession = "session"
+	LimitProcess = "process"
+)
+
+// Memory guard actions
+const (
+	MemoryTerminated = "terminated"
+	MemoryRecycled   = "recycled"
+)
+
+// MemoryAction is one call the guard ended or recycled
+type MemoryAction struct {
+	At       time.Time `json:"at"`
+	CallSid  string    `json:"call_sid"`
+	Action   string    `json:"action"`
+	Limit    string    `json:"limit,omitempty"`
+	MemoryMB float64   `json:"memory_mb"`
+	HeapMB   float64   `json:"heap_mb"`
+	AgeSec   float64   `json:"age_sec"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// MemoryStatus is the guard's configuration and what it has done
+type MemoryStatus struct {
+	SessionLimitMB  float64        `json:"session_limit_mb"`
+	ProcessLimitMB  float64        `json:"process_limit_mb"`
+	RecycleAfterSec float64        `json:"recycle_after_sec"`
+	HeapMB          float64        `json:"heap_mb"`
+	Sessions        int            `json:"sessions"`
+	Terminated      int            `json:"terminated"`
+	Recycled        int            `json:"recycled"`
+	Actions         []MemoryAction `json:"actions"`
+}
+
+// MemoryGuard keeps multi-hour calls from exhausting the instance. A call
+// whose buffers pass the per-session ceiling, or the largest call while the
+// heap is over the process ceiling, is ended with an apology; calls older
+// than the recycle age move to a fresh session through the resumption
+// mechanism, shedding the model context and buffers they built up
+type MemoryGuard struct {
+	sync.Mutex
+	sessionLimit float64
+	processLimit float64
+	recycleAfter time.Duration
+	message      string
+	terminated   int
+	recycled     int
+	actions      []MemoryAction
+}
+
+// newMemoryGuard reads the ceilings and starts the check loop. The process
+// ceiling defaults to 90% of GOMEMLIMIT when that is set
+func newMemoryGuard() *MemoryGuard {
+	processDefault := 0.0
+	if limit := debug.SetMemoryLimit(-1); limit < math.MaxInt64 {
+		processDefault = 0.9 * float64(limit) / (1 << 20)
+	}
+	g := &MemoryGuard{
+		sessionLimit: getEnvFloat("SESSION_MEMORY_LIMIT_MB", 32),
+		processLimit: getEnvFloat("PROCESS_MEMORY_LIMIT_MB", processDefault),
+		recycleAfter: getEnvDuration("SESSION_RECYCLE_AFTER", 0),
+		message:      getEnv("MEMORY_LIMIT_MESSAGE", "We're sorry, we're having technical difficulties and need to end this call. Please call us back."),
+	}
+	if g.sessionLimit <= 0 && g.processLimit <= 0 && g.recycleAfter <= 0 {
+		return g
+	}
+	go func() {
+		for range time.Tick(getEnvDuration("MEMORY_CHECK_INTERVAL", 10*time.Second)) {
+			g.check()
+		}
+	}()
+	log.Printf("Memory guard enabled (session %.0f MB, process %.0f MB, recycle after %s)\n", g.sessionLimit, g.processLimit, g.recycleAfter)
+	return g
+}
+
+// memoryCandidate is a live call as the guard sees it
+type memoryCandidate struct {
+	s       *Session
+	callSid string
+	bytes   int
+	age     time.Duration
+}
+
+// check enforces the ceilings and recycles long calls
+func (g *MemoryGuard) check() {
+	var candidates []memoryCandidate
+	for _, s := range fleet.liveSessions() {
+		s.Lock()
+		candidate := memoryCandidate{s: s, callSid: s.callSid, bytes: s.memoryEstimate(), age: time.Since(s.connectedAt)}
+		skip := s.callSid == "" || s.killed || s.migratedTo != ""
+		s.Unlock()
+		if !skip {
+			candidates = append(candidates, candidate)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].bytes > candidates[j].bytes })
+
+	ended := make(map[*Session]bool)
+	if g.sessionLimit > 0 {
+		for _, c := range candidates {
+			if float64(c.bytes)/(1<<20) >= g.sessionLimit {
+				g.terminate(c, LimitSession, heapMB())
+				ended[c.s] = true
+			}
+		}
+	}
+
+	// Over the process ceiling, the largest remaining call goes; one per
+	// check so the heap can settle before the next
+	if g.processLimit > 0 {
+		if heap := heapMB(); heap >= g.processLimit {
+			runtime.GC()
+			if heap = heapMB(); heap >= g.processLimit {
+				for _, c := range candidates {
+					if !ended[c.s] {
+						g.terminate(c, LimitProcess, heap)
+						ended[c.s] = true
+						break
+					}
+				}
+			}
+		}
+	}
+
+	if g.recycleAfter > 0 {
+		for _, c := range candidates {
+			if !ended[c.s] && c.age >= g.recycleAfter {
+				g.recycle(c)
+			}
+		}
+	}
+}
+
+// terminate apologizes to the caller and ends the call
+func (g *MemoryGuard) terminate(c memoryCandidate, limit string, heap float64) {
+	s := c.s
+	s.Lock()
+	s.memoryLimit = limit
+	locale := s.locale
+	s.Unlock()
+	action := MemoryAction{
+		At:       time.Now().UTC(),
+		CallSid:  c.callSid,
+		Action:   MemoryTerminated,
+		Limit:    limit,
+		MemoryMB: float64(c.bytes) / (1 << 20),
+		HeapMB:   heap,
+		AgeSec:   c.age.Seconds(),
+	}
+	// The apology replaces the stream; closing the connections frees the
+	// session's buffers whether or not Twilio took the redirect
+	twiml := `<Response><Say` + locale.sayAttributes() + `>` + html.EscapeString(g.message) + `</Say><Hangup/></Response>`
+	if err := redirectCall(c.callSid, twiml); err != nil {
+		action.Error = err.Error()
+	}
+	s.kill()
+	g.record(action)
+
+	severity, message := "warning", fmt.Sprintf("Call %s ended after its buffers reached %.1f MB (limit %.0f MB)", c.callSid, action.MemoryMB, g.sessionLimit)
+	if limit == LimitProcess {
+		severity = "critical"
+		message = fmt.Sprintf("Call %s (%.1f MB) ended to bring the heap under %.0f MB; heap was %.0f MB", c.callSid, action.MemoryMB, g.processLimit, heap)
+	}
+	log.Println(message)
+	alerts.raise(Alert{Kind: AlertMemoryLimit, Severity: severity, Message: message, CallSid: c.callSid, Subject: limit})
+}
+
+// recycle hands a long call to a fresh session on this instance, the way a
+// drain hands calls to other instances; calls mid-response wait for the
+// next check, and whisper calls, which are not bridged by <Connect>, are
+// left alone
+func (g *MemoryGuard) recycle(c memoryCandidate) {
+	s := c.s
+	if fleet.streamURL == "" {
+		return
+	}
+	s.Lock()
+	if s.isResponding || s.whisper != nil {
+		s.Unlock()
+		return
+	}
+	snapshot := s.snapshot(fleet.id)
+	s.migratedTo = fleet.id
+	s.Unlock()
+
+	action := MemoryAction{
+		At:       time.Now().UTC(),
+		CallSid:  c.callSid,
+		Action:   MemoryRecycled,
+		MemoryMB: float64(c.bytes) / (1 << 20),
+		HeapMB:   heapMB(),
+		AgeSec:   c.age.Seconds(),
+	}
+	err := fleet.saveSnapshot(snapshot, 5*time.Minute)
+	if err == nil {
+		err = redirectCall(c.callSid, resumeTwiML(fleet.streamURL, snapshot))
+	}
+	if err != nil {
+		s.Lock()
+		s.migratedTo = ""
+		s.Unlock()
+		action.Error = err.Error()
+		log.Printf("Error recycling call %s: %v\n", c.callSid, err)
+	} else {
+		log.Printf("Recycled call %s after %s\n", c.callSid, c.age.Round(time.Second))
+	}
+	g.record(action)
+}
+
+// record keeps an action for the status report
+func (g *MemoryGuard) record(action MemoryAction) {
+	g.Lock()
+	defer g.Unlock()
+	if action.Error == "" {
+		if action.Action == MemoryRecycled {
+			g.recycled++
+		} else {
+			g.terminated++
+		}
+	}
+	g.actions = append(g.actions, action)
+	if len(g.actions) > 100 {
+		g.actions = g.actions[len(g.actions)-100:]
+	}
+}
+
+// heapMB returns the allocated heap in MB
+func heapMB() float64 {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return float64(mem.HeapAlloc) / (1 << 20)
+}
+
+// handleMemoryStatus serves GET /admin/memory
+func handleMemoryStatus(c *gin.Context) {
+	memoryGuard.Lock()
+	status := MemoryStatus{
+		SessionLimitMB:  memoryGuard.sessionLimit,
+		ProcessLimitMB:  memoryGuard.processLimit,
+		RecycleAfterSec: memoryGuard.recycleAfter.Seconds(),
+		Terminated:      memoryGuard.terminated,
+		Recycled:        memoryGuard.recycled,
+		Actions:         append([]MemoryAction{}, memoryGuard.actions...),
+	}
+	memoryGuard.Unlock()
+	status.HeapMB = heapMB()
+	status.Sessions = fleet.active()
+	c.JSON(http.StatusOK, status)
+}
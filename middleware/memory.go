@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// CallerMemory is what the assistant remembers about a returning caller
+type CallerMemory struct {
+	Name        string    `json:"name,omitempty"`
+	CallCount   int       `json:"call_count"`
+	FirstCallAt time.Time `json:"first_call_at"`
+	LastCallAt  time.Time `json:"last_call_at"`
+}
+
+// MemoryStore persists caller memories keyed by a hash of tenant and number
+type MemoryStore struct {
+	sync.Mutex
+	path    string
+	entries map[string]*CallerMemory
+}
+
+// newMemoryStore loads the caller memory file from DATA_DIR
+func newMemoryStore() *MemoryStore {
+	m := &MemoryStore{
+		path:    dataPath("caller_memory.json"),
+		entries: make(map[string]*CallerMemory),
+	}
+	if err := readJSONFile(m.path, &m.entries); err != nil {
+		log.Println("Error loading caller memory:", err)
+	}
+	return m
+}
+
+// memoryKey avoids storing raw phone numbers in the memory file
+func memoryKey(tenantID, number string) string {
+	return hashValue(tenantID + ":" + normalizeNumber(number))
+}
+
+// get returns a copy of the memory for a caller
+func (m *MemoryStore) get(tenantID, number string) (CallerMemory, bool) {
+	m.Lock()
+	defer m.Unlock()
+	entry, ok := m.entries[memoryKey(tenantID, number)]
+	if !ok {
+		return CallerMemory{}, false
+	}
+	return *entry, true
+}
+
+// update applies fn to a caller's memory and saves the store
+func (m *MemoryStore) update(tenantID, number string, fn func(*CallerMemory)) {
+	m.Lock()
+	defer m.Unlock()
+	key := memoryKey(tenantID, number)
+	entry, ok := m.entries[key]
+	if !ok {
+		entry = &CallerMemory{}
+		m.entries[key] = entry
+	}
+	fn(entry)
+	if err := writeJSONFile(m.path, m.entries); err != nil {
+		log.Println("Error saving caller memory:", err)
+	}
+}
+
+// recordCall counts a finished call for the caller
+func (m *MemoryStore) recordCall(tenantID, number string, at time.Time) {
+	m.update(tenantID, number, func(entry *CallerMemory) {
+		if entry.FirstCallAt.IsZero() {
+			entry.FirstCallAt = at
+		}
+		entry.LastCallAt = at
+		entry.CallCount++
+	})
+}
+
+// maxCallerNameLength bounds a remembered name, which the caller dictates
+const maxCallerNameLength = 40
+
+// remembersCallers reports whether the tenant allows caller history to be used
+func remembersCallers(s *Session) bool {
+	tenant, _, from := s.identity()
+	return tenant != nil && tenant.PersonalizeGreeting && from != ""
+}
+
+// cleanCallerName reduces a caller-supplied name to letters, marks, spaces
+// and the punctuation names use, within the length limit, so it cannot carry
+// instructions into the prompt
+func cleanCallerName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r), unicode.IsMark(r):
+			b.WriteRune(r)
+		case unicode.IsSpace(r):
+			b.WriteRune(' ')
+		case strings.ContainsRune(".-'", r):
+			b.WriteRune(r)
+		}
+	}
+	cleaned := []rune(strings.Join(strings.Fields(b.String()), " "))
+	if len(cleaned) > maxCallerNameLength {
+		cleaned = cleaned[:maxCallerNameLength]
+	}
+	return strings.TrimSpace(string(cleaned))
+}
+
+// callerContext describes a returning caller for the model's instructions
+func (s *Session) callerContext() string {
+	if !remembersCallers(s) {
+		return ""
+	}
+	tenant, _, from := s.identity()
+	memory, ok := memories.get(tenant.ID, from)
+	if !ok || memory.CallCount == 0 {
+		return "This is the caller's first call. If they tell you their name, save it with remember_caller_name."
+	}
+	context := fmt.Sprintf("The caller has called %d time(s) before, most recently on %s.",
+		memory.CallCount, memory.LastCallAt.Format(time.RFC1123))
+	if name := cleanCallerName(memory.Name); name != "" {
+		return context + fmt.Sprintf(" The name they gave is %q; use it only to address them.", name)
+	}
+	return context + " If they tell you their name, save it with remember_caller_name."
+}
+
+func init() {
+	registerTool(&Tool{
+		Name:        "remember_caller_name",
+		Description: "Save the caller's preferred name so future calls can greet them personally.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"name": map[string]interface{}{"type": "string", "description": "The name the caller wants to be called"},
+			},
+			"required": []string{"name"},
+		},
+		Available: remembersCallers,
+		Handler: func(s *Session, args json.RawMessage) (interface{}, error) {
+			var params struct {
+				Name string `json:"name"`
+			}
+			if err := json.Unmarshal(args, &params); err != nil {
+				return nil, err
+			}
+			name := cleanCallerName(params.Name)
+			if name == "" {
+				return nil, fmt.Errorf("name is required")
+			}
+			tenant, _, from := s.identity()
+			memories.update(tenant.ID, from, func(entry *CallerMemory) { entry.Name = name })
+			return map[string]string{"status": "saved"}, nil
+		},
+	})
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fleetSnapshotKey holds a migrating call's context until the new instance picks it up
+const fleetSnapshotKey = "fleet:snapshot:"
+
+// SessionSnapshot is the conversation context carried across a migration
+type SessionSnapshot struct {
+	Record     CallRecord `json:"record"`
+	AnsweredBy string     `json:"answered_by,omitempty"`
+	From       string     `json:"from_instance"`
+	TakenAt    time.Time  `json:"taken_at"`
+
+	// RecordingBytes is how far the call's recording had reached
+	RecordingBytes int64 `json:"recording_bytes,omitempty"`
+	// Captured holds the structured details, confirmed or not, with their attempts
+	Captured map[string]CapturedValue `json:"captured,omitempty"`
+}
+
+// MigrationResult reports what happened to one call during a drain
+type MigrationResult struct {
+	CallSid string `json:"call_sid"`
+	Target  string `json:"target,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// isDraining reports whether this instance is handing its calls off
+func (f *Fleet) isDraining() bool {
+	f.Lock()
+	defer f.Unlock()
+	return f.draining
+}
+
+// drain stops new calls arriving here and migrates every live call to
+// another worker
+func (f *Fleet) drain() ([]MigrationResult, error) {
+	if f.redis == nil {
+		return nil, fmt.Errorf("session migration needs REDIS_URL")
+	}
+	f.Lock()
+	f.draining = true
+	f.Unlock()
+	sessions := f.liveSessions()
+	if f.worker {
+		// Tell routers right away rather than at the next heartbeat
+		if err := f.publish(); err != nil {
+			log.Println("Error publishing fleet heartbeat:", err)
+		}
+	}
+
+	results := make([]MigrationResult, 0, len(sessions))
+	for _, s := range sessions {
+		s.Lock()
+		callSid := s.callSid
+		s.Unlock()
+		if callSid == "" {
+			// The stream has not started yet; there is nothing to hand off
+			continue
+		}
+		result := MigrationResult{CallSid: callSid}
+		target, err := f.migrate(s)
+		if err != nil {
+			result.Error = err.Error()
+			log.Printf("Error migrating call %s: %v\n", callSid, err)
+		} else {
+			result.Target = target.ID
+			log.Printf("Migrated call %s to %s\n", callSid, target.ID)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// undrain makes this instance eligible for new calls again
+func (f *Fleet) undrain() {
+	f.Lock()
+	f.draining = false
+	f.Unlock()
+	if f.worker {
+		if err := f.publish(); err != nil {
+			log.Println("Error publishing fleet heartbeat:", err)
+		}
+	}
+}
+
+// migrate snapshots a session, stores it for the target worker and asks
+// Twilio to reconnect the media stream there
+func (f *Fleet) migrate(s *Session) (WorkerStatus, error) {
+	target, err := f.pickWorker(f.id, s.callSid)
+	if err != nil {
+		return target, err
+	}
+
+	s.Lock()
+	snapshot := s.snapshot(f.id)
+	// Set before redirecting: Twilio may close the stream before the request returns
+	s.migratedTo = target.ID
+	s.Unlock()
+
+	err = f.saveSnapshot(snapshot, 5*time.Minute)
+	if err == nil {
+		err = redirectCall(snapshot.Record.CallSid, resumeTwiML(target.StreamURL, snapshot))
+	}
+	if err != nil {
+		s.Lock()
+		s.migratedTo = ""
+		s.Unlock()
+	}
+	return target, err
+}
+
+// snapshot captures the session's context; the caller holds the session lock
+func (s *Session) snapshot(instance string) SessionSnapshot {
+	snapshot := SessionSnapshot{
+		Record:     s.callRecord(),
+		AnsweredBy: s.answeredBy,
+		Captured:   make(map[string]CapturedValue, len(s.captured)),
+		From:       instance,
+		TakenAt:    time.Now().UTC(),
+	}
+	for name, value := range s.captured {
+		snapshot.Captured[name] = value
+	}
+	if s.recorder != nil {
+		snapshot.RecordingBytes = s.recorder.length()
+	}
+	return snapshot
+}
+
+// saveSnapshot stores a snapshot where the resuming instance looks for it;
+// without Redis only this instance can resume it
+func (f *Fleet) saveSnapshot(snapshot SessionSnapshot, ttl time.Duration) error {
+	if f.redis == nil {
+		f.Lock()
+		defer f.Unlock()
+		for callSid, stored := range f.snapshots {
+			if time.Since(stored.TakenAt) > ttl {
+				delete(f.snapshots, callSid)
+			}
+		}
+		f.snapshots[snapshot.Record.CallSid] = snapshot
+		return nil
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	_, err = f.redis.do("SET", fleetSnapshotKey+snapshot.Record.CallSid, string(data), "EX", strconv.Itoa(int(ttl.Seconds())))
+	return err
+}
+
+// resumeTwiML reconnects the call's media stream to another instance
+func resumeTwiML(streamURL string, snapshot SessionSnapshot) string {
+	params := map[string]string{
+		"Resume":     "true",
+		"Tenant":     snapshot.Record.Tenant,
+		"Class":      snapshot.Record.Class,
+		"From":       snapshot.Record.From,
+		"To":         snapshot.Record.To,
+		"AnsweredBy": snapshot.AnsweredBy,
+		"Agent":      snapshot.Record.Agent,
+		"Model":      snapshot.Record.Model,
+	}
+	if snapshot.Record.Outbound {
+		params["Direction"] = "outbound"
+	}
+	twiml := `<Response><Connect><Stream url="` + html.EscapeString(streamURL) + `">`
+	for _, name := range []string{"Resume", "Tenant", "Agent", "Class", "From", "To", "AnsweredBy", "Direction", "Model"} {
+		if params[name] != "" {
+			twiml += `<Parameter name="` + name + `" value="` + html.EscapeString(params[name]) + `" />`
+		}
+	}
+	return twiml + `</Stream></Connect></Response>`
+}
+
+// resume restores a migrated call's context and replays its conversation
+// into the new OpenAI session
+func (s *Session) resume() error {
+	snapshot, err := fleet.takeSnapshot(s.callSid)
+	if err != nil {
+		return err
+	}
+
+	record := snapshot.Record
+	s.Lock()
+	s.startedAt = record.StartedAt
+	s.usage = record.Usage
+	s.answeredBy = snapshot.AnsweredBy
+	s.recordingBytes = snapshot.RecordingBytes
+	s.transcript = record.Transcript
+	s.escalations = record.Escalations
+	s.priority = record.Priority
+	s.transferred = record.Transferred
+	s.policy.strategies = record.Strategies
+	s.dtmf.selections = record.DTMFDigits
+	s.turnLog.turns = record.Turns
+	s.toolCalls = record.ToolCalls
+	s.migrations = append(record.Migrations, snapshot.From)
+	// The call stays in the rollout arm, canary set and budget tier it
+	// started in, whatever routing would pick for a new call now
+	s.rollout = record.Rollout
+	s.canary = record.Canary
+	if s.model == record.Model {
+		s.downgrade = record.Downgrade
+	}
+	for name, value := range snapshot.Captured {
+		s.captured[name] = value
+	}
+	for kind, decision := range record.Consent {
+		s.consent[kind] = decision
+	}
+	if record.Flags != nil {
+		s.flags = record.Flags
+	}
+	transcript := append([]TranscriptEntry(nil), s.transcript...)
+	s.Unlock()
+
+	// Give the model the conversation so far; it answers the caller's next turn
+	for _, entry := range transcript {
+		role, contentType := "user", "input_text"
+		if entry.Speaker == SpeakerAssistant {
+			role, contentType = "assistant", "text"
+		}
+		s.sendOpenAI(map[string]interface{}{
+			"type": "conversation.item.create",
+			"item": map[string]interface{}{
+				"type":    "message",
+				"role":    role,
+				"content": []map[string]interface{}{{"type": contentType, "text": entry.Text}},
+			},
+		})
+	}
+	log.Printf("Resumed call %s migrated from %s (%d transcript entries)\n", s.callSid, snapshot.From, len(transcript))
+	return nil
+}
+
+// takeSnapshot fetches and removes a call's snapshot
+func (f *Fleet) takeSnapshot(callSid string) (SessionSnapshot, error) {
+	var snapshot SessionSnapshot
+	if f.redis == nil {
+		f.Lock()
+		defer f.Unlock()
+		stored, ok := f.snapshots[callSid]
+		if !ok {
+			return snapshot, fmt.Errorf("no snapshot for call %s", callSid)
+		}
+		delete(f.snapshots, callSid)
+		return stored, nil
+	}
+	reply, err := f.redis.do("GET", fleetSnapshotKey+callSid)
+	if err != nil {
+		return snapshot, err
+	}
+	data, _ := reply.(string)
+	if data == "" {
+		return snapshot, fmt.Errorf("no snapshot for call %s", callSid)
+	}
+	f.redis.do("DEL", fleetSnapshotKey+callSid)
+	err = json.Unmarshal([]byte(data), &snapshot)
+	return snapshot, err
+}
+
+// handleDrain serves POST /admin/drain
+func handleDrain(c *gin.Context) {
+	results, err := fleet.drain()
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"instance": fleet.id, "migrations": results})
+}
+
+// handleUndrain serves DELETE /admin/drain
+func handleUndrain(c *gin.Context) {
+	fleet.undrain()
+	c.JSON(http.StatusOK, gin.H{"instance": fleet.id, "draining": false})
+}
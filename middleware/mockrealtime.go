@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+// Mock VAD settings: a turn ends after this much caller silence
+const (
+	mockSpeechDBFS = -45.0
+	mockSilenceMs  = 500
+)
+
+// MockTurn scripts the mock model's handling of one caller utterance
+type MockTurn struct {
+	// Caller is the transcription reported for the utterance
+	Caller string `json:"caller"`
+
+	// Assistant is what the model answers, after the tool call if there is one
+	Assistant string `json:"assistant"`
+
+	ToolCall *MockToolCall `json:"tool_call,omitempty"`
+}
+
+// MockToolCall is a function call the mock model makes
+type MockToolCall struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// mockRealtimeHandler serves a scripted stand-in for the OpenAI Realtime API:
+// it detects caller turns by audio energy and answers from the script
+func mockRealtimeHandler(turns []MockTurn) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Println("Mock realtime upgrade error:", err)
+			return
+		}
+		defer conn.Close()
+		m := &mockRealtimeConn{conn: conn, turns: turns}
+		m.serve()
+	})
+}
+
+// mockRealtimeConn is the state of one mock realtime session
+type mockRealtimeConn struct {
+	conn  *websocket.Conn
+	turns []MockTurn
+	next  int
+
+	audioMs     int64
+	inSpeech    bool
+	silenceMs   int64
+	item        int
+	pendingTool *MockTurn
+}
+
+// serve reads client events until the connection closes
+func (m *mockRealtimeConn) serve() {
+	for {
+		_, message, err := m.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var event struct {
+			Type  string `json:"type"`
+			Audio string `json:"audio"`
+		}
+		if json.Unmarshal(message, &event) != nil {
+			continue
+		}
+		switch event.Type {
+		case "session.update":
+			m.send(map[string]interface{}{"type": "session.updated"})
+		case "input_audio_buffer.append":
+			audio, _ := base64.StdEncoding.DecodeString(event.Audio)
+			m.listen(audio)
+		case "response.create":
+			if m.pendingTool != nil {
+				turn := m.pendingTool
+				m.pendingTool = nil
+				m.speak(turn.Assistant)
+			}
+		}
+	}
+}
+
+// listen runs a simple energy VAD over caller audio
+func (m *mockRealtimeConn) listen(audio []byte) {
+	for start := 0; start < len(audio); start += qualityFrameBytes {
+		end := start + qualityFrameBytes
+		if end > len(audio) {
+			end = len(audio)
+		}
+		frame := audio[start:end]
+		frameMs := int64(len(frame) / bytesPerMs)
+		var energy float64
+		for _, b := range frame {
+			sample := float64(alawToLinear(b))
+			energy += sample * sample
+		}
+		level := 20 * math.Log10(math.Sqrt(energy/float64(len(frame)))/32768+1e-9)
+
+		switch {
+		case level > mockSpeechDBFS:
+			if !m.inSpeech {
+				m.inSpeech = true
+				m.item++
+				m.send(map[string]interface{}{"type": "input_audio_buffer.speech_started", "audio_start_ms": m.audioMs, "item_id": m.itemID()})
+			}
+			m.silenceMs = 0
+		case m.inSpeech:
+			m.silenceMs += frameMs
+			if m.silenceMs >= mockSilenceMs {
+				m.inSpeech = false
+				m.send(map[string]interface{}{"type": "input_audio_buffer.speech_stopped", "audio_end_ms": m.audioMs, "item_id": m.itemID()})
+				m.answer()
+			}
+		}
+		m.audioMs += frameMs
+	}
+}
+
+// answer replies to the caller turn that just ended with the next scripted turn
+func (m *mockRealtimeConn) answer() {
+	if m.next >= len(m.turns) {
+		m.send(map[string]interface{}{"type": "response.done", "response": map[string]interface{}{"status": "completed"}})
+		return
+	}
+	turn := m.turns[m.next]
+	m.next++
+	m.send(map[string]interface{}{
+		"type":       "conversation.item.input_audio_transcription.completed",
+		"item_id":    m.itemID(),
+		"transcript": turn.Caller,
+	})
+	if turn.ToolCall != nil {
+		args, _ := json.Marshal(turn.ToolCall.Arguments)
+		m.send(map[string]interface{}{
+			"type":      "response.function_call_arguments.done",
+			"call_id":   fmt.Sprintf("call_mock_%d", m.next),
+			"name":      turn.ToolCall.Name,
+			"arguments": string(args),
+		})
+		m.send(map[string]interface{}{"type": "response.done", "response": map[string]interface{}{"status": "completed"}})
+		m.pendingTool = &turn
+		return
+	}
+	m.speak(turn.Assistant)
+}
+
+// speak sends a response with placeholder audio and the scripted transcript
+func (m *mockRealtimeConn) speak(text string) {
+	if text != "" {
+		// Roughly 60 ms of audio per word, sent as a single delta
+		words := len(bytes.Fields([]byte(text)))
+		audio := bytes.Repeat([]byte{alawSilence}, words*60*bytesPerMs)
+		m.send(map[string]interface{}{"type": "response.audio.delta", "delta": base64.StdEncoding.EncodeToString(audio)})
+		m.send(map[string]interface{}{"type": "response.audio_transcript.done", "transcript": text})
+	}
+	m.send(map[string]interface{}{"type": "response.done", "response": map[string]interface{}{"status": "completed"}})
+}
+
+// itemID names the current caller item
+func (m *mockRealtimeConn) itemID() string {
+	return fmt.Sprintf("item_mock_%d", m.item)
+}
+
+// send writes one server event
+func (m *mockRealtimeConn) send(event map[string]interface{}) {
+	data, _ := json.Marshal(event)
+	if err := m.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		log.Println("Mock realtime write error:", err)
+	}
+}
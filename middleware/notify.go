@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"text/template"
+)
+
+// Notification triggers for chat integrations
+const (
+	TriggerEscalation        = "escalation_requested"
+	TriggerNegativeSentiment = "negative_sentiment"
+	TriggerVoicemailLeft     = "voicemail_left"
+	TriggerCallFailed        = "call_failed"
+)
+
+// defaultNotifyTemplates are used when no NOTIFY_TEMPLATE_<TRIGGER> override is set
+var defaultNotifyTemplates = map[string]string{
+	TriggerEscalation:        "Caller {{.From}} asked for a human on call {{.CallSid}}.{{if .Detail}} {{.Detail}}{{end}}{{if .TranscriptURL}} Transcript: {{.TranscriptURL}}{{end}}",
+	TriggerNegativeSentiment: "Negative sentiment detected on call {{.CallSid}} from {{.From}}.{{if .Detail}} {{.Detail}}{{end}}{{if .TranscriptURL}} Transcript: {{.TranscriptURL}}{{end}}",
+	TriggerVoicemailLeft:     "Voicemail left for {{.To}} on call {{.CallSid}}.{{if .TranscriptURL}} Transcript: {{.TranscriptURL}}{{end}}",
+	TriggerCallFailed:        "Call {{.CallSid}} from {{.From}} failed.{{if .Detail}} {{.Detail}}{{end}}{{if .TranscriptURL}} Transcript: {{.TranscriptURL}}{{end}}",
+}
+
+// CallNotification carries the fields available to notification templates
+type CallNotification struct {
+	Trigger       string
+	CallSid       string
+	From          string
+	To            string
+	Detail        string
+	TranscriptURL string
+}
+
+// Notifier posts call event messages to Slack and Microsoft Teams channels
+type Notifier struct {
+	slackURLs     []string
+	teamsURLs     []string
+	triggers      map[string]bool
+	templates     map[string]*template.Template
+	transcriptURL *template.Template
+}
+
+// newNotifier builds a notifier from the environment
+func newNotifier() *Notifier {
+	n := &Notifier{
+		slackURLs: getEnvList("NOTIFY_SLACK_WEBHOOK_URLS"),
+		teamsURLs: getEnvList("NOTIFY_TEAMS_WEBHOOK_URLS"),
+		triggers:  make(map[string]bool),
+		templates: make(map[string]*template.Template),
+	}
+
+	enabled := getEnvList("NOTIFY_TRIGGERS")
+	if len(enabled) == 0 {
+		enabled = []string{TriggerEscalation, TriggerNegativeSentiment, TriggerVoicemailLeft, TriggerCallFailed}
+	}
+	for _, trigger := range enabled {
+		n.triggers[trigger] = true
+	}
+
+	for trigger, text := range defaultNotifyTemplates {
+		text = getEnv("NOTIFY_TEMPLATE_"+strings.ToUpper(trigger), text)
+		tmpl, err := template.New(trigger).Parse(text)
+		if err != nil {
+			log.Printf("Invalid notification template for %s: %v\n", trigger, err)
+			tmpl = template.Must(template.New(trigger).Parse(defaultNotifyTemplates[trigger]))
+		}
+		n.templates[trigger] = tmpl
+	}
+
+	// Without a template, links are signed and expiring, since the call data
+	// API behind the admin token is no use to notification recipients
+	if text := getEnv("TRANSCRIPT_URL_TEMPLATE", ""); text != "" {
+		tmpl, err := template.New("transcript_url").Parse(text)
+		if err != nil {
+			log.Println("Invalid TRANSCRIPT_URL_TEMPLATE:", err)
+		} else {
+			n.transcriptURL = tmpl
+		}
+	}
+	return n
+}
+
+// notify renders and sends a notification if the trigger is enabled
+func (n *Notifier) notify(event CallNotification) {
+	if !n.triggers[event.Trigger] || (len(n.slackURLs) == 0 && len(n.teamsURLs) == 0) {
+		return
+	}
+	tmpl, ok := n.templates[event.Trigger]
+	if !ok {
+		log.Println("No notification template for trigger:", event.Trigger)
+		return
+	}
+
+	if n.transcriptURL != nil && event.TranscriptURL == "" {
+		var buf bytes.Buffer
+		if err := n.transcriptURL.Execute(&buf, event); err == nil {
+			event.TranscriptURL = buf.String()
+		}
+	} else if event.TranscriptURL == "" {
+		event.TranscriptURL = transcriptLink(event.CallSid)
+	}
+
+	event.From, event.To = displayNumber(event.From), displayNumber(event.To)
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, event); err != nil {
+		log.Printf("Error rendering %s notification: %v\n", event.Trigger, err)
+		return
+	}
+	text := buf.String()
+
+	go func() {
+		for _, url := range n.slackURLs {
+			if err := postJSON(url, map[string]interface{}{"text": text}, nil); err != nil {
+				log.Println("Error sending Slack notification:", err)
+			}
+		}
+		for _, url := range n.teamsURLs {
+			card := map[string]interface{}{
+				"@type":    "MessageCard",
+				"@context": "https://schema.org/extensions",
+				"summary":  event.Trigger,
+				"text":     text,
+			}
+			if err := postJSON(url, card, nil); err != nil {
+				log.Println("Error sending Teams notification:", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NumberRoute sends calls and texts to a dialed number to a tenant, and
+// optionally to an agent other than the tenant's
+type NumberRoute struct {
+	// Number is the E.164 number callers dial, Twilio's To; a number ending
+	// in * matches by prefix, the longest prefix winning, and "*" alone
+	// catches every number without a route
+	Number string `json:"number"`
+	Tenant string `json:"tenant"`
+	Agent  string `json:"agent,omitempty"`
+}
+
+// NumberTable is the routing table for dialed numbers. Routes come from
+// NUMBERS_FILE, which is reloaded when it changes, and from the admin API,
+// which saves them to DATA_DIR
+type NumberTable struct {
+	sync.RWMutex
+	path   string
+	routes map[string]NumberRoute
+
+	file       string
+	fileMod    time.Time
+	fileRoutes map[string]NumberRoute
+}
+
+// loadNumberTable reads NUMBERS_FILE and the routes saved through the admin
+// API, and watches NUMBERS_FILE for changes
+func loadNumberTable() *NumberTable {
+	t := &NumberTable{
+		path:       dataPath("numbers.json"),
+		routes:     make(map[string]NumberRoute),
+		file:       getEnv("NUMBERS_FILE", ""),
+		fileRoutes: make(map[string]NumberRoute),
+	}
+	if _, err := t.reloadFile(); err != nil {
+		log.Println("Error loading NUMBERS_FILE:", err)
+	}
+	var saved []NumberRoute
+	if err := readJSONFile(t.path, &saved); err != nil {
+		log.Println("Error loading saved numbers:", err)
+	}
+	for _, route := range saved {
+		t.routes[route.Number] = route
+	}
+	if t.file != "" {
+		go t.watch(getEnvDuration("NUMBERS_RELOAD_INTERVAL", 10*time.Second))
+	}
+	log.Printf("Loaded %d number route(s)\n", len(t.list()))
+	return t
+}
+
+// reloadFile rereads NUMBERS_FILE if it changed since it was last read;
+// invalid routes are skipped, and a file that cannot be parsed leaves the
+// current routes in place
+func (t *NumberTable) reloadFile() (bool, error) {
+	if t.file == "" {
+		return false, nil
+	}
+	info, err := os.Stat(t.file)
+	if err != nil {
+		return false, err
+	}
+	t.RLock()
+	unchanged := info.ModTime().Equal(t.fileMod)
+	t.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	var list []NumberRoute
+	if _, err := loadJSONFile("NUMBERS_FILE", &list); err != nil {
+		return false, err
+	}
+	routes := make(map[string]NumberRoute, len(list))
+	for _, route := range list {
+		if err := validateNumberRoute(&route, nil); err != nil {
+			log.Println("Skipping route in NUMBERS_FILE:", err)
+			continue
+		}
+		routes[route.Number] = route
+	}
+	t.Lock()
+	t.fileRoutes = routes
+	t.fileMod = info.ModTime()
+	t.Unlock()
+	return true, nil
+}
+
+// watch reloads NUMBERS_FILE when its modification time changes
+func (t *NumberTable) watch(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		reloaded, err := t.reloadFile()
+		if err != nil {
+			log.Println("Error reloading NUMBERS_FILE:", err)
+		} else if reloaded {
+			log.Println("Reloaded NUMBERS_FILE")
+		}
+	}
+}
+
+// lookup returns the route for a dialed number: an exact match, else the
+// longest matching prefix, else the catch-all
+func (t *NumberTable) lookup(number string) (NumberRoute, bool) {
+	t.RLock()
+	defer t.RUnlock()
+	if route, ok := t.get(number); ok {
+		return route, true
+	}
+	best, found := NumberRoute{}, false
+	for _, routes := range []map[string]NumberRoute{t.fileRoutes, t.routes} {
+		for key, route := range routes {
+			prefix, ok := strings.CutSuffix(key, "*")
+			if ok && prefix != "" && strings.HasPrefix(number, prefix) && (!found || len(key) > len(best.Number)) {
+				best, found = route, true
+			}
+		}
+	}
+	if found {
+		return best, true
+	}
+	return t.get("*")
+}
+
+// get returns the route stored for an exact key, NUMBERS_FILE first
+func (t *NumberTable) get(key string) (NumberRoute, bool) {
+	if route, ok := t.fileRoutes[key]; ok {
+		return route, true
+	}
+	route, ok := t.routes[key]
+	return route, ok
+}
+
+// route returns the route stored for a number or pattern, without matching
+func (t *NumberTable) route(key string) (NumberRoute, bool) {
+	t.RLock()
+	defer t.RUnlock()
+	return t.get(key)
+}
+
+// list returns every route sorted by number
+func (t *NumberTable) list() []NumberRoute {
+	t.RLock()
+	defer t.RUnlock()
+	list := make([]NumberRoute, 0, len(t.fileRoutes)+len(t.routes))
+	for _, route := range t.fileRoutes {
+		list = append(list, route)
+	}
+	for key, route := range t.routes {
+		if _, shadowed := t.fileRoutes[key]; !shadowed {
+			list = append(list, route)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Number < list[j].Number })
+	return list
+}
+
+// managedList returns the routes managed through the admin API
+func (t *NumberTable) managedList() []NumberRoute {
+	t.RLock()
+	defer t.RUnlock()
+	list := make([]NumberRoute, 0, len(t.routes))
+	for _, route := range t.routes {
+		list = append(list, route)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Number < list[j].Number })
+	return list
+}
+
+// planned returns the routes the table would hold after putting routes and
+// removing the managed routes not among them, as a pruning apply does
+func (t *NumberTable) planned(routes []NumberRoute) []NumberRoute {
+	t.RLock()
+	defer t.RUnlock()
+	planned := make([]NumberRoute, 0, len(t.fileRoutes)+len(routes))
+	for _, route := range t.fileRoutes {
+		planned = append(planned, route)
+	}
+	for _, route := range routes {
+		if _, shadowed := t.fileRoutes[route.Number]; !shadowed {
+			planned = append(planned, route)
+		}
+	}
+	return planned
+}
+
+// plan reports what putting the route would do
+func (t *NumberTable) plan(route NumberRoute) (string, error) {
+	t.RLock()
+	defer t.RUnlock()
+	return t.planLocked(route)
+}
+
+// planLocked is plan with the table locked
+func (t *NumberTable) planLocked(route NumberRoute) (string, error) {
+	if _, ok := t.fileRoutes[route.Number]; ok {
+		return "", fmt.Errorf("number %s is routed in NUMBERS_FILE", route.Number)
+	}
+	current, ok := t.routes[route.Number]
+	return changeAction(ok, current, route), nil
+}
+
+// put creates or replaces a managed route
+func (t *NumberTable) put(route NumberRoute) (string, error) {
+	t.Lock()
+	action, err := t.planLocked(route)
+	if err != nil || action == ChangeUnchanged {
+		t.Unlock()
+		return action, err
+	}
+	t.routes[route.Number] = route
+	t.Unlock()
+	return action, writeJSONFile(t.path, t.managedList())
+}
+
+// remove deletes a managed route
+func (t *NumberTable) remove(number string) (bool, error) {
+	t.Lock()
+	_, ok := t.routes[number]
+	delete(t.routes, number)
+	t.Unlock()
+	if !ok {
+		return false, nil
+	}
+	return true, writeJSONFile(t.path, t.managedList())
+}
+
+// managedNumbers returns the numbers routed through the admin API
+func (t *NumberTable) managedNumbers() []string {
+	var numbers []string
+	for _, route := range t.managedList() {
+		numbers = append(numbers, route.Number)
+	}
+	return numbers
+}
+
+// routeKey normalizes a number or pattern from a path or route
+func routeKey(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if prefix, ok := strings.CutSuffix(raw, "*"); ok {
+		return strings.ReplaceAll(prefix, " ", "") + "*"
+	}
+	return normalizeNumber(raw)
+}
+
+// validateNumberRoute normalizes a route's number and checks its tenant and
+// agent exist; declaredAgents are agents about to be created
+func validateNumberRoute(route *NumberRoute, declaredAgents map[string]bool) error {
+	if prefix, ok := strings.CutSuffix(strings.TrimSpace(route.Number), "*"); ok {
+		digits := strings.TrimPrefix(prefix, "+")
+		if prefix != "" && (!strings.HasPrefix(prefix, "+") || digits == "" || strings.Trim(digits, "0123456789") != "") {
+			return fmt.Errorf("number pattern %q must be * or + and digits followed by *", route.Number)
+		}
+		route.Number = prefix + "*"
+	} else {
+		parsed, err := parseNumber(route.Number)
+		if err != nil {
+			return err
+		}
+		route.Number = parsed.E164
+	}
+	tenants.RLock()
+	_, ok := tenants.tenants[route.Tenant]
+	tenants.RUnlock()
+	if !ok {
+		return fmt.Errorf("number %s: unknown tenant %q", route.Number, route.Tenant)
+	}
+	if route.Agent != "" && !declaredAgents[route.Agent] && !agents.exists(route.Agent) {
+		return fmt.Errorf("number %s: unknown agent %q", route.Number, route.Agent)
+	}
+	return nil
+}
+
+// callRoute returns where a Twilio webhook's call or text goes: the tenant
+// its query names, or else the route of its dialed number
+func callRoute(c *gin.Context) NumberRoute {
+	if id := c.Query("tenant"); id != "" {
+		return NumberRoute{Tenant: id}
+	}
+	_, to := callParties(c)
+	if route, ok := numberTable.lookup(to); ok {
+		return route
+	}
+	return NumberRoute{}
+}
+
+// callParties returns a voice webhook's contact and business numbers. Calls
+// the assistant places reach the webhook with the business number as From,
+// so outbound calls are turned around to keep from the contact's side
+func callParties(c *gin.Context) (from, to string) {
+	from, to = normalizeNumber(c.Request.FormValue("From")), normalizeNumber(c.Request.FormValue("To"))
+	if isOutbound(c) {
+		return to, from
+	}
+	return from, to
+}
+
+// isOutbound reports whether a voice webhook is for a call placed through the API
+func isOutbound(c *gin.Context) bool {
+	return strings.HasPrefix(c.Request.FormValue("Direction"), "outbound")
+}
+
+// routedAgent returns a route's agent, falling back to the tenant's, as the
+// agent's rollout assigns it to the caller, and the active rollout if any
+func routedAgent(tenant *Tenant, agentID, caller string) (*Agent, string) {
+	agent := agentFor(tenant)
+	if agentID != "" && agents.exists(agentID) {
+		agent = agents.get(agentID)
+	}
+	return rollouts.route(agent, caller)
+}
+
+// handleReloadNumbers serves POST /admin/numbers/reload, rereading
+// NUMBERS_FILE without waiting for the next check
+func handleReloadNumbers(c *gin.Context) {
+	if numberTable.file == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "NUMBERS_FILE is not set"})
+		return
+	}
+	numberTable.Lock()
+	numberTable.fileMod = time.Time{}
+	numberTable.Unlock()
+	if _, err := numberTable.reloadFile(); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"numbers": numberTable.list()})
+}
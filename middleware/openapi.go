@@ -0,0 +1,1129 @@
+package main
+
+//go:generate go run . openapi -client client/api.go
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiOperation documents a REST route for the OpenAPI document and the
+// generated Go client; samples are zero values whose types describe the
+// JSON bodies
+type apiOperation struct {
+	// Name is the operation ID and the client method name
+	Name    string
+	Summary string
+	Tag     string
+	Query   []apiParam
+
+	// Request is the JSON body sent; RequestContent instead names the media
+	// type of a raw body such as an audio upload
+	Request        interface{}
+	RequestContent string
+
+	// Response is the JSON body returned; Content instead names the media
+	// type of a raw response such as a recording
+	Response interface{}
+	Content  string
+	Status   int
+
+	// Public routes do not take the admin token
+	Public bool
+}
+
+// apiParam is a query parameter
+type apiParam struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+// statusResponse is the body of endpoints that only confirm an action
+type statusResponse struct {
+	Status string `json:"status"`
+}
+
+// callFilterParams are the call filter parameters read by callFilterFromQuery
+var callFilterParams = []apiParam{
+	{"tenant", "string", "Only calls for this tenant"},
+	{"agent", "string", "Only calls handled by this agent"},
+	{"caller", "string", "Only calls from this number"},
+	{"disposition", "string", "Only calls with this disposition"},
+	{"from", "string", "Calls starting at or after this RFC 3339 time or YYYY-MM-DD date"},
+	{"to", "string", "Calls starting before this RFC 3339 time or YYYY-MM-DD date"},
+	{"since", "string", "Lookback window such as 36h or 7d, replacing from"},
+	{"canary", "boolean", "Include synthetic canary calls, which are left out by default"},
+}
+
+// withParams appends parameters to a shared list without aliasing it
+func withParams(base []apiParam, extra ...apiParam) []apiParam {
+	return append(append([]apiParam{}, base...), extra...)
+}
+
+// apiOperations documents the REST API by "METHOD /path" as registered with
+// gin; add an entry alongside each new admin, call or reporting route
+var apiOperations = map[string]apiOperation{
+	"GET /version": {
+		Name: "Version", Tag: "meta", Public: true,
+		Summary: "The running version",
+		Response: struct {
+			Version string `json:"version"`
+		}{},
+	},
+	"GET /admin/version": {
+		Name: "VersionDetails", Tag: "meta",
+		Summary: "Build information and configured capabilities",
+		Response: struct {
+			Build        BuildInfo    `json:"build"`
+			Capabilities Capabilities `json:"capabilities"`
+		}{},
+	},
+	"GET /openapi.json": {
+		Name: "OpenAPI", Tag: "meta", Public: true,
+		Summary: "This OpenAPI document",
+		Content: "application/json",
+	},
+
+	"GET /admin/reports/summary": {
+		Name: "CallSummary", Tag: "reports",
+		Summary:  "Summarize calls by status, intent and disposition",
+		Query:    callFilterParams,
+		Response: CallSummaryReport{},
+	},
+	"GET /admin/reports/providers": {
+		Name: "ProviderReport", Tag: "reports",
+		Summary: "Daily latency and error rollups per provider; format=csv returns CSV",
+		Query: []apiParam{
+			{"from", "string", "First day, RFC 3339 time or YYYY-MM-DD date"},
+			{"to", "string", "Last day, RFC 3339 time or YYYY-MM-DD date"},
+			{"provider", "string", "Only this provider"},
+			{"format", "string", "json (default) or csv"},
+		},
+		Response: struct {
+			Rollups []ProviderReportRow `json:"rollups"`
+		}{},
+	},
+	"GET /admin/search": {
+		Name: "SearchTranscripts", Tag: "calls",
+		Summary: "Full-text search over call transcripts",
+		Query: withParams(callFilterParams,
+			apiParam{"q", "string", "Search terms"},
+			apiParam{"limit", "integer", "Results per page, default 50"},
+			apiParam{"offset", "integer", "Results to skip"},
+		),
+		Response: struct {
+			Query   string      `json:"query"`
+			Total   int         `json:"total"`
+			Results []SearchHit `json:"results"`
+		}{},
+	},
+
+	"POST /admin/exports": {
+		Name: "CreateExport", Tag: "exports",
+		Summary:  "Start a bulk export of calls",
+		Request:  ExportRequest{},
+		Response: ExportJob{},
+		Status:   http.StatusAccepted,
+	},
+	"GET /admin/exports": {
+		Name: "ListExports", Tag: "exports",
+		Summary: "List export jobs",
+		Response: struct {
+			Exports []ExportJob `json:"exports"`
+		}{},
+	},
+	"GET /admin/exports/:id": {
+		Name: "GetExport", Tag: "exports",
+		Summary:  "Get an export job",
+		Response: ExportJob{},
+	},
+	"GET /exports/:id/download": {
+		Name: "DownloadExport", Tag: "exports", Public: true,
+		Summary: "Download a completed export through its signed link",
+		Query: []apiParam{
+			{"expires", "integer", "Link expiry, Unix seconds"},
+			{"signature", "string", "Link signature"},
+		},
+		Content: "application/octet-stream",
+	},
+
+	"GET /admin/qa/queue": {
+		Name: "QAQueue", Tag: "qa",
+		Summary: "Calls sampled for QA review",
+		Query:   withParams(callFilterParams, apiParam{"status", "string", "Review status, default pending"}),
+		Response: struct {
+			Calls []struct {
+				CallSid     string    `json:"call_sid"`
+				Tenant      string    `json:"tenant"`
+				Agent       string    `json:"agent"`
+				StartedAt   time.Time `json:"started_at"`
+				Intent      string    `json:"intent"`
+				Disposition string    `json:"disposition"`
+				Review      *QAReview `json:"review"`
+			} `json:"calls"`
+		}{},
+	},
+	"POST /admin/qa/:id/review": {
+		Name: "ReviewCall", Tag: "qa",
+		Summary: "Record a QA review of a call",
+		Request: struct {
+			Status   string   `json:"status"`
+			Score    *float64 `json:"score"`
+			Reviewer string   `json:"reviewer"`
+			Notes    string   `json:"notes"`
+		}{},
+		Response: QAReview{},
+	},
+
+	"GET /admin/canary": {
+		Name: "CanaryStatus", Tag: "operations",
+		Summary: "Synthetic canary call history",
+		Response: struct {
+			Configured bool        `json:"configured"`
+			Running    bool        `json:"running"`
+			Runs       []CanaryRun `json:"runs"`
+		}{},
+	},
+	"POST /admin/canary/run": {
+		Name: "RunCanary", Tag: "operations",
+		Summary:  "Place a canary call now",
+		Response: CanaryRun{},
+	},
+	"GET /admin/escalations": {
+		Name: "ListEscalations", Tag: "operations",
+		Summary: "Open escalations, high priority first",
+		Query:   []apiParam{{"all", "boolean", "Include acknowledged escalations"}},
+		Response: struct {
+			Escalations []Escalation `json:"escalations"`
+		}{},
+	},
+	"POST /admin/escalations/:id/ack": {
+		Name: "AcknowledgeEscalation", Tag: "operations",
+		Summary:  "Acknowledge an escalation",
+		Response: statusResponse{},
+	},
+
+	"GET /admin/flags": {
+		Name: "ListFlags", Tag: "flags",
+		Summary: "List feature flags",
+		Response: struct {
+			Flags []FeatureFlag `json:"flags"`
+		}{},
+	},
+	"PUT /admin/flags/:name": {
+		Name: "PutFlag", Tag: "flags",
+		Summary:  "Create or replace a feature flag",
+		Request:  FeatureFlag{},
+		Response: FeatureFlag{},
+	},
+	"DELETE /admin/flags/:name": {
+		Name: "DeleteFlag", Tag: "flags",
+		Summary:  "Delete a feature flag set through the API, restoring its FLAGS_FILE definition if it has one; flags only in FLAGS_FILE cannot be deleted",
+		Response: statusResponse{},
+	},
+
+	"GET /admin/fleet": {
+		Name: "FleetStatus", Tag: "fleet",
+		Summary: "This instance and the workers registered in Redis",
+		Response: struct {
+			Instance map[string]interface{} `json:"instance"`
+			Workers  []WorkerStatus         `json:"workers,omitempty"`
+		}{},
+	},
+	"POST /admin/drain": {
+		Name: "Drain", Tag: "fleet",
+		Summary: "Stop taking calls and migrate live calls to other workers",
+		Response: struct {
+			Instance   string            `json:"instance"`
+			Migrations []MigrationResult `json:"migrations"`
+		}{},
+	},
+	"DELETE /admin/drain": {
+		Name: "Undrain", Tag: "fleet",
+		Summary: "Take calls again after a drain",
+		Response: struct {
+			Instance string `json:"instance"`
+			Draining bool   `json:"draining"`
+		}{},
+	},
+	"GET /admin/ha": {
+		Name: "HAStatus", Tag: "fleet",
+		Summary:  "High availability role and failover counts",
+		Response: map[string]interface{}{},
+	},
+	"GET /admin/sessions": {
+		Name: "SessionUsage", Tag: "fleet",
+		Summary: "Resource usage of live sessions on this instance",
+		Query: []apiParam{
+			{"limit", "integer", "Sessions to return, default 10"},
+			{"sort", "string", "memory (default), goroutines, buffered or age"},
+		},
+		Response: struct {
+			Process struct {
+				Goroutines int    `json:"goroutines"`
+				HeapBytes  uint64 `json:"heap_bytes"`
+				Sessions   int    `json:"sessions"`
+			} `json:"process"`
+			Sessions []SessionUsage `json:"sessions"`
+		}{},
+	},
+	"DELETE /admin/sessions/:id": {
+		Name: "KillSession", Tag: "fleet",
+		Summary: "End a live session on this instance",
+		Response: struct {
+			Killed SessionUsage `json:"killed"`
+		}{},
+	},
+	"GET /admin/degradation": {
+		Name: "DegradationStatus", Tag: "fleet",
+		Summary:  "Load shedding level, thresholds and recent steps",
+		Response: map[string]interface{}{},
+	},
+	"GET /admin/memory": {
+		Name: "MemoryStatus", Tag: "fleet",
+		Summary:  "Memory ceilings, heap usage and the calls ended or recycled to stay under them",
+		Response: MemoryStatus{},
+	},
+	"GET /admin/shutdown-reports": {
+		Name: "ShutdownReports", Tag: "fleet",
+		Summary: "Calls cut short by shutdowns and crash recoveries, newest first",
+		Response: struct {
+			Reports []ShutdownReport `json:"reports"`
+		}{},
+	},
+	"GET /admin/priority": {
+		Name: "PriorityStatus", Tag: "fleet",
+		Summary: "Priority classes, active calls per class and the waiting queue",
+		Response: struct {
+			Capacity int             `json:"capacity"`
+			Classes  []PriorityClass `json:"classes"`
+			Active   map[string]int  `json:"active"`
+			Waiting  []struct {
+				CallSid string    `json:"call_sid"`
+				Rank    int       `json:"rank"`
+				Since   time.Time `json:"since"`
+			} `json:"waiting"`
+		}{},
+	},
+
+	"POST /admin/outbound": {
+		Name: "StartOutbound", Tag: "outbound",
+		Summary: "Screen a campaign's contacts against DNC and consent, then dial them",
+		Request: OutboundRequest{},
+		Response: struct {
+			Campaign string            `json:"campaign"`
+			Contacts []CampaignContact `json:"contacts"`
+		}{},
+	},
+	"GET /admin/campaigns/:id": {
+		Name: "CampaignContacts", Tag: "outbound",
+		Summary: "Contacts of a campaign and their outcomes",
+		Response: struct {
+			Campaign string            `json:"campaign"`
+			Contacts []CampaignContact `json:"contacts"`
+		}{},
+	},
+	"GET /admin/dnc": {
+		Name: "ListDNC", Tag: "outbound",
+		Summary: "Numbers on the internal do-not-call list",
+		Response: struct {
+			Numbers []DNCEntry `json:"numbers"`
+		}{},
+	},
+	"GET /admin/dnc/:number": {
+		Name: "CheckDNC", Tag: "outbound",
+		Summary:  "Check a number against the do-not-call lists",
+		Response: DNCCheck{},
+	},
+	"PUT /admin/dnc/:number": {
+		Name: "PutDNC", Tag: "outbound",
+		Summary:  "Add a number to the do-not-call list",
+		Request:  DNCEntry{},
+		Response: DNCEntry{},
+	},
+	"DELETE /admin/dnc/:number": {
+		Name: "DeleteDNC", Tag: "outbound",
+		Summary:  "Remove a number added through the API from the do-not-call list; numbers from DNC_FILE cannot be removed",
+		Response: statusResponse{},
+	},
+
+	"GET /admin/assets": {
+		Name: "ListAssets", Tag: "assets",
+		Summary: "List recorded prompts",
+		Response: struct {
+			Assets []Asset `json:"assets"`
+		}{},
+	},
+	"GET /admin/assets/:name": {
+		Name: "GetAsset", Tag: "assets",
+		Summary:  "Get a recorded prompt and its versions",
+		Response: Asset{},
+	},
+	"POST /admin/assets/tts": {
+		Name: "SynthesizeAsset", Tag: "assets",
+		Summary: "Synthesize a prompt with text to speech and store it as a new version",
+		Request: TTSAssetRequest{},
+		Response: struct {
+			ID      string `json:"id"`
+			Version int    `json:"version"`
+			Asset   Asset  `json:"asset"`
+		}{},
+		Status: http.StatusCreated,
+	},
+	"POST /admin/assets/:name": {
+		Name: "UploadAsset", Tag: "assets",
+		Summary:        "Upload audio as a new version of a prompt",
+		Query:          []apiParam{{"kind", "string", "greeting, hold or disclosure"}},
+		RequestContent: "audio/*",
+		Response:       Asset{},
+		Status:         http.StatusCreated,
+	},
+	"PUT /admin/assets/:name/current": {
+		Name: "SetAssetVersion", Tag: "assets",
+		Summary: "Roll a prompt forward or back to a version",
+		Request: struct {
+			Version int `json:"version" binding:"required"`
+		}{},
+		Response: Asset{},
+	},
+	"DELETE /admin/assets/:name": {
+		Name: "DeleteAsset", Tag: "assets",
+		Summary:  "Delete a prompt and all its versions",
+		Response: statusResponse{},
+	},
+
+	"GET /admin/regions": {
+		Name: "RegionStatus", Tag: "residency",
+		Summary: "Regions, their availability and pinned tenants",
+		Response: struct {
+			DeploymentRegion string         `json:"deployment_region"`
+			Regions          []RegionStatus `json:"regions"`
+		}{},
+	},
+	"PUT /admin/regions/:name": {
+		Name: "SetRegionAvailability", Tag: "residency",
+		Summary: "Take a region out of service or back in",
+		Request: struct {
+			Available *bool `json:"available" binding:"required"`
+		}{},
+		Response: struct {
+			Name      string `json:"name"`
+			Available bool   `json:"available"`
+		}{},
+	},
+	"GET /admin/audit": {
+		Name: "AuditLog", Tag: "audit",
+		Summary: "Accesses to recordings and transcripts",
+		Query: []apiParam{
+			{"actor", "string", "Only this actor"},
+			{"action", "string", "Only this action"},
+			{"from", "string", "At or after this RFC 3339 time or YYYY-MM-DD date"},
+			{"to", "string", "Before this RFC 3339 time or YYYY-MM-DD date"},
+		},
+		Response: struct {
+			Entries []AuditEntry `json:"entries"`
+		}{},
+	},
+
+	"GET /admin/agents": {
+		Name: "ListAgents", Tag: "provisioning",
+		Summary: "Agents as declared, and which are managed through the API",
+		Response: struct {
+			Agents  []Agent  `json:"agents"`
+			Managed []string `json:"managed"`
+		}{},
+	},
+	"GET /admin/agents/:id": {
+		Name: "GetAgent", Tag: "provisioning",
+		Summary:  "Get an agent as declared",
+		Response: Agent{},
+	},
+	"PUT /admin/agents/:id": {
+		Name: "PutAgent", Tag: "provisioning",
+		Summary:  "Create or replace an agent; 201 when created",
+		Request:  Agent{},
+		Response: Agent{},
+	},
+	"DELETE /admin/agents/:id": {
+		Name: "DeleteAgent", Tag: "provisioning",
+		Summary:  "Delete an agent managed through the API",
+		Response: statusResponse{},
+	},
+	"GET /admin/numbers": {
+		Name: "ListNumbers", Tag: "provisioning",
+		Summary: "Dialed numbers and patterns and the tenants and agents they route to",
+		Response: struct {
+			Numbers []NumberRoute `json:"numbers"`
+			Managed []string      `json:"managed"`
+		}{},
+	},
+	"GET /admin/numbers/:number": {
+		Name: "GetNumber", Tag: "provisioning",
+		Summary:  "Get the route stored for a number or pattern",
+		Response: NumberRoute{},
+	},
+	"PUT /admin/numbers/:number": {
+		Name: "PutNumber", Tag: "provisioning",
+		Summary:  "Create or replace a number's route; 201 when created",
+		Request:  NumberRoute{},
+		Response: NumberRoute{},
+	},
+	"POST /admin/numbers/reload": {
+		Name: "ReloadNumbers", Tag: "provisioning",
+		Summary: "Reread NUMBERS_FILE now instead of at the next check",
+		Response: struct {
+			Numbers []NumberRoute `json:"numbers"`
+		}{},
+	},
+	"DELETE /admin/numbers/:number": {
+		Name: "DeleteNumber", Tag: "provisioning",
+		Summary:  "Delete a number's route",
+		Response: statusResponse{},
+	},
+	"GET /admin/webhooks": {
+		Name: "ListWebhooks", Tag: "provisioning",
+		Summary: "Webhook subscriptions, without secrets",
+		Response: struct {
+			Webhooks []WebhookView `json:"webhooks"`
+			Managed  []string      `json:"managed"`
+		}{},
+	},
+	"GET /admin/webhooks/:id": {
+		Name: "GetWebhook", Tag: "provisioning",
+		Summary:  "Get a webhook subscription, without its secret",
+		Response: WebhookView{},
+	},
+	"PUT /admin/webhooks/:id": {
+		Name: "PutWebhook", Tag: "provisioning",
+		Summary:  "Create or replace a webhook subscription; 201 when created",
+		Request:  WebhookSubscription{},
+		Response: WebhookView{},
+	},
+	"DELETE /admin/webhooks/:id": {
+		Name: "DeleteWebhook", Tag: "provisioning",
+		Summary:  "Delete a webhook subscription managed through the API",
+		Response: statusResponse{},
+	},
+	"POST /admin/apply": {
+		Name: "Apply", Tag: "provisioning",
+		Summary: "Converge agents, numbers and webhooks on a declared state",
+		Request: ProvisioningDocument{},
+		Response: struct {
+			DryRun  bool                 `json:"dry_run"`
+			Changes []ProvisioningChange `json:"changes"`
+		}{},
+	},
+
+	"GET /admin/rollouts": {
+		Name: "ListRollouts", Tag: "rollouts",
+		Summary: "List agent rollouts with each arm's metrics over the window",
+		Response: struct {
+			Rollouts []RolloutStatus `json:"rollouts"`
+		}{},
+	},
+	"GET /admin/rollouts/:id": {
+		Name: "GetRollout", Tag: "rollouts",
+		Summary:  "Get an agent rollout with each arm's metrics over the window",
+		Response: RolloutStatus{},
+	},
+	"PUT /admin/rollouts/:id": {
+		Name: "PutRollout", Tag: "rollouts",
+		Summary:  "Start or adjust a rollout of a candidate agent; at least one threshold is required",
+		Request:  Rollout{},
+		Response: Rollout{},
+	},
+	"DELETE /admin/rollouts/:id": {
+		Name: "DeleteRollout", Tag: "rollouts",
+		Summary:  "Delete a rollout, returning its callers to the stable agent",
+		Response: statusResponse{},
+	},
+	"POST /admin/rollouts/:id/promote": {
+		Name: "PromoteRollout", Tag: "rollouts",
+		Summary:  "Send every caller to the candidate agent",
+		Response: Rollout{},
+	},
+	"POST /admin/rollouts/:id/rollback": {
+		Name: "RollbackRollout", Tag: "rollouts",
+		Summary:  "Send every caller back to the stable agent",
+		Response: Rollout{},
+	},
+
+	"GET /admin/budgets": {
+		Name: "BudgetStatus", Tag: "agents",
+		Summary: "Each budgeted agent's recent cost and latency against its budget",
+		Response: struct {
+			Budgets []BudgetStatus `json:"budgets"`
+		}{},
+	},
+
+	"GET /admin/pipeline": {
+		Name: "PipelineMetrics", Tag: "fleet",
+		Summary: "Per-stage counters and latency of the media pipeline, with the slowest recent spans",
+		Response: struct {
+			Stages    []StageMetrics `json:"stages"`
+			BucketsUs []int64        `json:"buckets_us"`
+			SlowSpans []PipelineSpan `json:"slow_spans"`
+		}{},
+	},
+
+	"GET /admin/sandbox/captures": {
+		Name: "SandboxCaptures", Tag: "sandbox",
+		Summary: "Requests the sandbox captured instead of sending, oldest first",
+		Query: []apiParam{
+			{Name: "kind", Type: "string", Description: "sms, outbound_call, call_update, twilio or http"},
+		},
+		Response: struct {
+			Captures []SandboxCapture `json:"captures"`
+		}{},
+	},
+	"DELETE /admin/sandbox/captures": {
+		Name: "ClearSandboxCaptures", Tag: "sandbox",
+		Summary:  "Empty the sandbox capture log",
+		Response: statusResponse{},
+	},
+
+	"GET /calls/:id/turns": {
+		Name: "CallTurns", Tag: "calls",
+		Summary: "Turn-level timing and transcripts of a call",
+		Response: struct {
+			CallSid   string         `json:"call_sid"`
+			Recording *RecordingInfo `json:"recording"`
+			Turns     []Turn         `json:"turns"`
+		}{},
+	},
+	"GET /calls/:id/copilot": {
+		Name: "CopilotStream", Tag: "calls",
+		Summary: "Server-sent events of a live call's transcript, response text and tool results",
+		Content: "text/event-stream",
+	},
+	"GET /calls/:id/trace": {
+		Name: "CallTrace", Tag: "calls",
+		Summary: "Pipeline spans of a live call sampled for tracing",
+		Response: struct {
+			CallSid string         `json:"call_sid"`
+			Spans   []PipelineSpan `json:"spans"`
+			Dropped int            `json:"dropped"`
+		}{},
+	},
+	"GET /calls/:id/whisper": {
+		Name: "GetWhisper", Tag: "calls",
+		Summary:  "A live whisper call's conference bridge and audio routing",
+		Response: WhisperStatus{},
+	},
+	"PUT /calls/:id/whisper": {
+		Name: "SetWhisper", Tag: "calls",
+		Summary:  "Change which legs of a live whisper call the model hears and where it whispers",
+		Request:  WhisperControls{},
+		Response: WhisperStatus{},
+	},
+	"GET /calls/:id/audio": {
+		Name: "CallAudio", Tag: "calls",
+		Summary: "A call's recording, or a slice of one track",
+		Query: []apiParam{
+			{"track", "string", "caller or assistant; both when empty"},
+			{"from", "string", "Start offset, e.g. 12.5s"},
+			{"to", "string", "End offset, e.g. 20s"},
+			{"format", "string", "wav (default) or mp3"},
+		},
+		Content: "audio/wav",
+	},
+	"GET /calls/:id/transcript": {
+		Name: "CallTranscript", Tag: "calls",
+		Summary: "A call's transcript as text, srt, vtt or diarized json",
+		Query:   []apiParam{{"format", "string", "text (default), srt, vtt or json"}},
+		Content: "text/plain",
+	},
+	"GET /transcripts/:id": {
+		Name: "SignedTranscript", Tag: "calls", Public: true,
+		Summary: "A call's transcript through the signed link sent in notifications",
+		Query: []apiParam{
+			{"format", "string", "text (default), srt, vtt or json"},
+			{"expires", "integer", "Link expiry, Unix seconds"},
+			{"signature", "string", "Link signature"},
+		},
+		Content: "text/plain",
+	},
+	"GET /calls/:id/access": {
+		Name: "CallAccess", Tag: "audit",
+		Summary: "Every recorded access to a call's recording and transcript",
+		Response: struct {
+			CallSid  string       `json:"call_sid"`
+			Accesses []AuditEntry `json:"accesses"`
+		}{},
+	},
+	"PUT /calls/:id/dataset": {
+		Name: "SetDatasetInclusion", Tag: "calls",
+		Summary: "Flag a call in or out of dataset exports, which only take calls flagged in; null clears the flag",
+		Request: struct {
+			Include *bool `json:"include"`
+		}{},
+		Response: struct {
+			CallSid string `json:"call_sid"`
+			Include *bool  `json:"include"`
+		}{},
+	},
+	"PUT /calls/:id/csat": {
+		Name: "SetCSAT", Tag: "calls",
+		Summary: "Record a call's 1-5 satisfaction score; null clears it",
+		Request: struct {
+			Score *float64 `json:"score"`
+		}{},
+		Response: struct {
+			CallSid string   `json:"call_sid"`
+			Score   *float64 `json:"score"`
+		}{},
+	},
+}
+
+// documentedRoute is a registered route with its documentation
+type documentedRoute struct {
+	Method string
+	Path   string
+	apiOperation
+}
+
+// apiRoutes returns the router's REST routes in path order; Twilio webhooks
+// and the media stream are left out, and admin and call routes missing from
+// apiOperations are returned with only their handler name
+func apiRoutes(router *gin.Engine) []documentedRoute {
+	var routes []documentedRoute
+	for _, route := range router.Routes() {
+		op, ok := apiOperations[route.Method+" "+route.Path]
+		if !ok {
+			if !strings.HasPrefix(route.Path, "/admin/") && !strings.HasPrefix(route.Path, "/calls/") {
+				continue
+			}
+			name := route.Handler[strings.LastIndex(route.Handler, ".")+1:]
+			op = apiOperation{Name: strings.TrimPrefix(name, "handle"), Summary: "Undocumented"}
+		}
+		routes = append(routes, documentedRoute{Method: route.Method, Path: route.Path, apiOperation: op})
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// pathParams returns a gin path's parameter names in order
+func pathParams(path string) []string {
+	var params []string
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			params = append(params, segment[1:])
+		}
+	}
+	return params
+}
+
+// openAPIPath converts a gin path to an OpenAPI path template
+func openAPIPath(path string) string {
+	for _, param := range pathParams(path) {
+		path = strings.Replace(path, ":"+param, "{"+param+"}", 1)
+	}
+	return path
+}
+
+// schemaBuilder derives JSON schemas from Go types, collecting named
+// structs as components
+type schemaBuilder struct {
+	components map[string]interface{}
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schema returns the JSON schema of a type
+func (b *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawJSONType:
+		return map[string]interface{}{}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return b.schema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		name := exportedName(t.Name())
+		if _, ok := b.components[name]; !ok {
+			// Reserve the name first so recursive types terminate
+			b.components[name] = nil
+			b.components[name] = b.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema returns the object schema of a struct's JSON fields
+func (b *schemaBuilder) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	for _, field := range jsonFields(t) {
+		properties[field.name] = b.schema(field.Type)
+		if strings.Contains(field.Tag.Get("binding"), "required") {
+			required = append(required, field.name)
+		}
+	}
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// jsonField is a struct field as encoding/json sees it
+type jsonField struct {
+	reflect.StructField
+	name      string
+	omitEmpty bool
+}
+
+// jsonFields lists a struct's JSON fields, flattening embedded structs
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			fields = append(fields, jsonFields(field.Type)...)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, jsonField{StructField: field, name: name, omitEmpty: strings.Contains(options, "omitempty")})
+	}
+	return fields
+}
+
+// exportedName capitalizes a type name for the client package
+func exportedName(name string) string {
+	if name == "" {
+		return name
+	}
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// openAPIDocument builds the OpenAPI 3 document for the router's REST routes
+func openAPIDocument(router *gin.Engine) map[string]interface{} {
+	builder := &schemaBuilder{components: map[string]interface{}{}}
+	errorSchema := map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"error": map[string]interface{}{"type": "string"}},
+	}
+	paths := map[string]interface{}{}
+	for _, route := range apiRoutes(router) {
+		op := map[string]interface{}{"operationId": route.Name, "summary": route.Summary}
+		if route.Tag != "" {
+			op["tags"] = []string{route.Tag}
+		}
+		var params []interface{}
+		for _, name := range pathParams(route.Path) {
+			params = append(params, map[string]interface{}{
+				"name": name, "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		for _, param := range route.Query {
+			params = append(params, map[string]interface{}{
+				"name": param.Name, "in": "query", "description": param.Description, "schema": map[string]interface{}{"type": param.Type},
+			})
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		switch {
+		case route.Request != nil:
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": builder.schema(reflect.TypeOf(route.Request))}},
+			}
+		case route.RequestContent != "":
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  map[string]interface{}{route.RequestContent: map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}}},
+			}
+		}
+		success := map[string]interface{}{"description": "OK"}
+		switch {
+		case route.Response != nil:
+			success["content"] = map[string]interface{}{"application/json": map[string]interface{}{"schema": builder.schema(reflect.TypeOf(route.Response))}}
+		case route.Content != "":
+			success["content"] = map[string]interface{}{route.Content: map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}}}
+		}
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		op["responses"] = map[string]interface{}{
+			fmt.Sprint(status): success,
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": errorSchema}},
+			},
+		}
+		if route.Public {
+			op["security"] = []interface{}{}
+		}
+		path := openAPIPath(route.Path)
+		item, _ := paths[path].(map[string]interface{})
+		if item == nil {
+			item = map[string]interface{}{}
+			paths[path] = item
+		}
+		item[strings.ToLower(route.Method)] = op
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "Voice assistant middleware",
+			"version":     version,
+			"description": "Admin, call data and reporting API. Admin routes take the ADMIN_TOKEN as a bearer token.",
+		},
+		"paths":    paths,
+		"security": []interface{}{map[string]interface{}{"adminToken": []string{}}},
+		"components": map[string]interface{}{
+			"schemas": builder.components,
+			"securitySchemes": map[string]interface{}{
+				"adminToken": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+// handleOpenAPI serves GET /openapi.json
+func handleOpenAPI(router *gin.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, openAPIDocument(router))
+	}
+}
+
+// runOpenAPI implements the openapi command: it prints the OpenAPI document,
+// or with -client writes the generated Go client's types and methods
+func runOpenAPI(args []string) int {
+	flags := flag.NewFlagSet("openapi", flag.ExitOnError)
+	clientPath := flags.String("client", "", "write the generated Go client to this file")
+	flags.Parse(args)
+
+	gin.SetMode(gin.ReleaseMode)
+	router := newRouter()
+	for _, route := range apiRoutes(router) {
+		if route.Summary == "Undocumented" {
+			fmt.Fprintf(os.Stderr, "warning: %s %s has no entry in apiOperations\n", route.Method, route.Path)
+		}
+	}
+	if *clientPath == "" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(openAPIDocument(router)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+	source, err := generateClient(apiRoutes(router))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := os.WriteFile(*clientPath, source, 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// clientGenerator renders Go types for the client package
+type clientGenerator struct {
+	declared map[string]string
+	order    []string
+	imports  map[string]bool
+}
+
+// goType returns the client package's type expression for t, declaring named
+// structs as it meets them
+func (g *clientGenerator) goType(t reflect.Type) string {
+	switch {
+	case t == timeType:
+		g.imports["time"] = true
+		return "time.Time"
+	case t == rawJSONType:
+		g.imports["encoding/json"] = true
+		return "json.RawMessage"
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + g.goType(t.Elem())
+	case reflect.Slice:
+		return "[]" + g.goType(t.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), g.goType(t.Elem()))
+	case reflect.Map:
+		return "map[" + g.goType(t.Key()) + "]" + g.goType(t.Elem())
+	case reflect.Interface:
+		return "interface{}"
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structType(t)
+		}
+		return g.declare(exportedName(t.Name()), t)
+	case reflect.Bool, reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		// Named scalars such as Speaker become their underlying type
+		return t.Kind().String()
+	}
+	return "interface{}"
+}
+
+// declare adds a named struct declaration and returns its name
+func (g *clientGenerator) declare(name string, t reflect.Type) string {
+	if _, ok := g.declared[name]; !ok {
+		g.declared[name] = ""
+		g.order = append(g.order, name)
+		g.declared[name] = g.structType(t)
+	}
+	return name
+}
+
+// structType renders a struct type with its JSON fields
+func (g *clientGenerator) structType(t reflect.Type) string {
+	var b strings.Builder
+	b.WriteString("struct {\n")
+	for _, field := range jsonFields(t) {
+		tag := field.name
+		if field.omitEmpty {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(&b, "%s %s `json:%q`\n", field.Name, g.goType(field.Type), tag)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// bodyType returns the client type of a sample body, naming anonymous
+// structs after the operation
+func (g *clientGenerator) bodyType(sample interface{}, name string) string {
+	t := reflect.TypeOf(sample)
+	if t.Kind() == reflect.Struct && t.Name() == "" {
+		return g.declare(name, t)
+	}
+	return g.goType(t)
+}
+
+// generateClient renders the client package's types and one method per
+// documented operation
+func generateClient(routes []documentedRoute) ([]byte, error) {
+	g := &clientGenerator{declared: map[string]string{}, imports: map[string]bool{"context": true, "net/url": true}}
+	var methods bytes.Buffer
+	for _, route := range routes {
+		if route.Summary == "Undocumented" {
+			continue
+		}
+		params := []string{"ctx context.Context"}
+		path := `"` + route.Path + `"`
+		for _, name := range pathParams(route.Path) {
+			params = append(params, name+" string")
+			path = strings.Replace(path, ":"+name, `"+url.PathEscape(`+name+`)+"`, 1)
+		}
+		path = strings.TrimSuffix(path, `+""`)
+		query := "nil"
+		if len(route.Query) > 0 {
+			params = append(params, "query url.Values")
+			query = "query"
+		}
+		body := "nil"
+		switch {
+		case route.Request != nil:
+			params = append(params, "body "+g.bodyType(route.Request, route.Name+"Request"))
+			body = "body"
+		case route.RequestContent != "":
+			params = append(params, "body io.Reader", "contentType string")
+			g.imports["io"] = true
+		}
+
+		fmt.Fprintf(&methods, "\n// %s calls %s %s: %s\n", route.Name, route.Method, route.Path, route.Summary)
+		switch {
+		case route.Response != nil:
+			out := g.bodyType(route.Response, route.Name+"Response")
+			// Maps and slices are returned as they are, structs by pointer
+			ref, result := "&out", "*"+out
+			if kind := reflect.TypeOf(route.Response).Kind(); kind == reflect.Map || kind == reflect.Slice {
+				ref, result = "out", out
+			}
+			fmt.Fprintf(&methods, "func (c *Client) %s(%s) (%s, error) {\n", route.Name, strings.Join(params, ", "), result)
+			fmt.Fprintf(&methods, "var out %s\n", out)
+			if route.RequestContent != "" {
+				fmt.Fprintf(&methods, "if err := c.upload(ctx, %q, %s, %s, body, contentType, &out); err != nil {\n", route.Method, path, query)
+			} else {
+				fmt.Fprintf(&methods, "if err := c.do(ctx, %q, %s, %s, %s, &out); err != nil {\n", route.Method, path, query, body)
+			}
+			fmt.Fprintf(&methods, "return nil, err\n}\nreturn %s, nil\n}\n", ref)
+		case route.Content == "text/event-stream":
+			g.imports["io"] = true
+			fmt.Fprintf(&methods, "func (c *Client) %s(%s) (io.ReadCloser, error) {\n", route.Name, strings.Join(params, ", "))
+			fmt.Fprintf(&methods, "return c.stream(ctx, %q, %s, %s)\n}\n", route.Method, path, query)
+		default:
+			fmt.Fprintf(&methods, "func (c *Client) %s(%s) ([]byte, error) {\n", route.Name, strings.Join(params, ", "))
+			fmt.Fprintf(&methods, "return c.raw(ctx, %q, %s, %s)\n}\n", route.Method, path, query)
+		}
+	}
+
+	var out bytes.Buffer
+	out.WriteString("// Code generated by \"middleware openapi -client\"; DO NOT EDIT.\n\npackage client\n\nimport (\n")
+	for _, path := range sortedBoolKeys(g.imports) {
+		fmt.Fprintf(&out, "%q\n", path)
+	}
+	out.WriteString(")\n")
+	sort.Strings(g.order)
+	for _, name := range g.order {
+		fmt.Fprintf(&out, "\ntype %s %s\n", name, g.declared[name])
+	}
+	out.Write(methods.Bytes())
+	return format.Source(out.Bytes())
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// outboundClient is shared by all outbound webhook and integration calls
+var outboundClient = &http.Client{Timeout: 10 * time.Second}
+
+// statusError is returned when a provider answers with a non-2xx status
+type statusError struct {
+	msg        string
+	StatusCode int
+}
+
+func (e *statusError) Error() string { return e.msg }
+
+// newStatusError formats a provider error with a snippet of the response body
+func newStatusError(prefix string, resp *http.Response) error {
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return &statusError{
+		msg:        fmt.Sprintf("%s returned status %d: %s", prefix, resp.StatusCode, bytes.TrimSpace(snippet)),
+		StatusCode: resp.StatusCode,
+	}
+}
+
+// postJSON sends a JSON body to a URL and fails on non-2xx responses
+func postJSON(url string, body interface{}, headers map[string]string) error {
+	return doJSON(http.MethodPost, url, body, headers, nil)
+}
+
+// doJSON sends an optional JSON body and decodes the JSON response into out when non-nil
+func doJSON(method, url string, body interface{}, headers map[string]string, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return newStatusError(method+" "+url, resp)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// postForm sends a form-encoded body and decodes the JSON response into out
+func postForm(endpoint string, form url.Values, out interface{}) error {
+	resp, err := outboundClient.PostForm(endpoint, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return newStatusError("POST "+endpoint, resp)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultCountry is assumed for numbers dialed in national format; set
+// from DEFAULT_COUNTRY at startup
+var defaultCountry = "US"
+
+// E.164 allows at most 15 digits including the country code
+const (
+	minNumberDigits = 7
+	maxNumberDigits = 15
+)
+
+// nationalLengths bounds the national significant number length where it is
+// fixed or narrow; other countries only get the E.164 bounds
+var nationalLengths = map[string][2]int{
+	"US": {10, 10}, "GB": {9, 10}, "FR": {9, 9}, "ES": {9, 9}, "IT": {6, 11}, "DE": {6, 13},
+	"NL": {9, 9}, "BE": {8, 9}, "PT": {9, 9}, "IE": {7, 9}, "AU": {9, 9}, "NZ": {8, 10},
+	"BR": {10, 11}, "MX": {10, 10}, "IN": {10, 10}, "JP": {9, 10}, "CN": {9, 11}, "SG": {8, 8},
+}
+
+// PhoneNumber is a parsed telephone number
+type PhoneNumber struct {
+	E164        string `json:"e164"`
+	CallingCode string `json:"calling_code"`
+	Country     string `json:"country,omitempty"`
+	National    string `json:"national"`
+}
+
+// callingCodeFor returns the calling code of an ISO country
+func callingCodeFor(country string) string {
+	for _, c := range nanpAreaCodes {
+		if c == country {
+			return "1"
+		}
+	}
+	for code, c := range countryCodes {
+		if c == country {
+			return code
+		}
+	}
+	return ""
+}
+
+// parseNumber reads a number in E.164, international (00) or national
+// format, ignoring punctuation. National numbers are taken to be in
+// DEFAULT_COUNTRY, dropping a trunk prefix 0 except in Italy, where the 0
+// is part of the number
+func parseNumber(raw string) (PhoneNumber, error) {
+	raw = strings.TrimSpace(raw)
+	international := strings.HasPrefix(raw, "+")
+	var digits strings.Builder
+	for _, r := range raw {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' || r == ' ' || r == '-' || r == '.' || r == '(' || r == ')' || r == '/':
+		default:
+			return PhoneNumber{}, fmt.Errorf("invalid character %q in number %q", r, raw)
+		}
+	}
+	number := digits.String()
+	if !international && strings.HasPrefix(number, "00") {
+		international, number = true, number[2:]
+	}
+	if !international {
+		code := callingCodeFor(defaultCountry)
+		switch {
+		case code == "":
+			return PhoneNumber{}, fmt.Errorf("number %q has no country code and DEFAULT_COUNTRY %q is unknown", raw, defaultCountry)
+		case code == "1" && len(number) == 11 && strings.HasPrefix(number, "1"):
+			// NANP numbers are often written with the leading 1
+		case defaultCountry == "IT":
+			number = code + number
+		default:
+			number = code + strings.TrimPrefix(number, "0")
+		}
+	}
+	if len(number) < minNumberDigits || len(number) > maxNumberDigits {
+		return PhoneNumber{}, fmt.Errorf("number %q has %d digits", raw, len(number))
+	}
+
+	parsed := PhoneNumber{E164: "+" + number}
+	for n := 3; n >= 1; n-- {
+		if country, ok := countryCodes[number[:n]]; ok {
+			parsed.CallingCode, parsed.Country = number[:n], country
+			break
+		}
+	}
+	if parsed.CallingCode == "" {
+		return parsed, fmt.Errorf("number %q has an unknown country code", raw)
+	}
+	parsed.National = number[len(parsed.CallingCode):]
+	if parsed.CallingCode == "1" && len(parsed.National) >= 3 {
+		if country, ok := nanpAreaCodes[parsed.National[:3]]; ok {
+			parsed.Country = country
+		}
+	}
+	return parsed, nil
+}
+
+// normalizeNumber returns the E.164 form of a number, or the number as given
+// when it cannot be parsed, so short codes and anonymous callers still match
+func normalizeNumber(raw string) string {
+	parsed, err := parseNumber(raw)
+	if err != nil || parsed.E164 == "" {
+		return strings.TrimSpace(raw)
+	}
+	return parsed.E164
+}
+
+// countryForNumber returns the ISO country of a number, or "" if unknown
+func countryForNumber(number string) string {
+	parsed, err := parseNumber(number)
+	if err != nil {
+		return ""
+	}
+	return parsed.Country
+}
+
+// validateDestination checks that a number can be dialed: it parses, its
+// country is known and its national part has a plausible length
+func validateDestination(raw string) (PhoneNumber, error) {
+	parsed, err := parseNumber(raw)
+	if err != nil {
+		return parsed, err
+	}
+	if bounds, ok := nationalLengths[parsed.Country]; ok {
+		if n := len(parsed.National); n < bounds[0] || n > bounds[1] {
+			return parsed, fmt.Errorf("number %q is not a valid %s number", raw, parsed.Country)
+		}
+	}
+	if parsed.CallingCode == "1" && (len(parsed.National) != 10 || parsed.National[0] < '2' || parsed.National[3] < '2') {
+		return parsed, fmt.Errorf("number %q is not a valid NANP number", raw)
+	}
+	return parsed, nil
+}
+
+// formatInternational renders a number for people to read, such as
+// "+1 415-555-0100" or "+44 2071 838750"
+func (p PhoneNumber) formatInternational() string {
+	n := p.National
+	if p.CallingCode == "1" && len(n) == 10 {
+		return "+1 " + n[:3] + "-" + n[3:6] + "-" + n[6:]
+	}
+	if len(n) > 6 {
+		return "+" + p.CallingCode + " " + n[:4] + " " + n[4:]
+	}
+	return "+" + p.CallingCode + " " + n
+}
+
+// displayNumber formats a number for notifications, leaving anything that
+// does not parse as it is
+func displayNumber(raw string) string {
+	parsed, err := parseNumber(raw)
+	if err != nil {
+		return raw
+	}
+	return parsed.formatInternational()
+}
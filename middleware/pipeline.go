@@ -0,0 +1,247 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Stages of the media pipeline. Messages are decoded from JSON and base64,
+// run through DSP (quality meters, recording, consent buffer, voiceprint),
+// encoded for the other side, then forwarded to Twilio or written to the
+// model provider
+const (
+	StageDecode   = "decode"
+	StageDSP      = "dsp"
+	StageEncode   = "encode"
+	StageForward  = "forward"
+	StageProvider = "provider"
+)
+
+// Pipeline directions
+const (
+	// PathInbound carries the caller's audio and Twilio events to the model
+	PathInbound = "inbound"
+	// PathOutbound carries the model's audio and events to the caller
+	PathOutbound = "outbound"
+)
+
+// stageBucketsUs are the upper bounds of the stage latency histogram; most
+// stages take microseconds, writes to a slow peer milliseconds
+var stageBucketsUs = []int64{10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 25000, 100000}
+
+// StageMetrics are one pipeline stage's counters since the process started
+type StageMetrics struct {
+	Path      string  `json:"path"`
+	Stage     string  `json:"stage"`
+	Count     int64   `json:"count"`
+	Errors    int64   `json:"errors"`
+	Bytes     int64   `json:"bytes"`
+	SumUs     int64   `json:"latency_sum_us"`
+	MaxUs     int64   `json:"latency_max_us"`
+	AvgUs     float64 `json:"avg_latency_us"`
+	P50Us     int64   `json:"p50_latency_us"`
+	P95Us     int64   `json:"p95_latency_us"`
+	P99Us     int64   `json:"p99_latency_us"`
+	Histogram []int64 `json:"latency_histogram"`
+}
+
+// PipelineSpan is one traced run of a stage
+type PipelineSpan struct {
+	CallSid    string    `json:"call_sid,omitempty"`
+	Path       string    `json:"path"`
+	Stage      string    `json:"stage"`
+	Start      time.Time `json:"start"`
+	DurationUs int64     `json:"duration_us"`
+	Bytes      int       `json:"bytes"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// pipelineTrace holds the spans of a call sampled for tracing
+type pipelineTrace struct {
+	sync.Mutex
+	spans   []PipelineSpan
+	dropped int
+}
+
+// Pipeline keeps per-stage metrics and the slowest recent spans across calls
+type Pipeline struct {
+	sync.Mutex
+	stages     map[string]*StageMetrics
+	slow       []PipelineSpan
+	slowAfter  time.Duration
+	slowLimit  int
+	sample     int
+	traceLimit int
+}
+
+// newPipeline reads the tracing settings
+func newPipeline() *Pipeline {
+	return &Pipeline{
+		stages:     make(map[string]*StageMetrics),
+		slowAfter:  getEnvDuration("PIPELINE_SLOW_SPAN", 20*time.Millisecond),
+		slowLimit:  getEnvInt("PIPELINE_SLOW_SPANS", 200),
+		sample:     getEnvInt("PIPELINE_TRACE_PERCENT", 0),
+		traceLimit: getEnvInt("PIPELINE_TRACE_SPANS", 5000),
+	}
+}
+
+// observe counts a stage run and keeps it as a slow span when over the threshold
+func (p *Pipeline) observe(span PipelineSpan) {
+	p.Lock()
+	defer p.Unlock()
+	key := span.Path + "/" + span.Stage
+	m, ok := p.stages[key]
+	if !ok {
+		m = &StageMetrics{Path: span.Path, Stage: span.Stage, Histogram: make([]int64, len(stageBucketsUs)+1)}
+		p.stages[key] = m
+	}
+	m.Count++
+	if span.Error != "" {
+		m.Errors++
+	}
+	m.Bytes += int64(span.Bytes)
+	m.SumUs += span.DurationUs
+	m.MaxUs = max(m.MaxUs, span.DurationUs)
+	m.Histogram[sort.Search(len(stageBucketsUs), func(i int) bool { return span.DurationUs <= stageBucketsUs[i] })]++
+
+	if p.slowAfter > 0 && span.DurationUs >= p.slowAfter.Microseconds() {
+		p.slow = append(p.slow, span)
+		if len(p.slow) > p.slowLimit {
+			p.slow = p.slow[len(p.slow)-p.slowLimit:]
+		}
+	}
+}
+
+// metrics returns every stage's counters, inbound then outbound in pipeline order
+func (p *Pipeline) metrics() []StageMetrics {
+	order := map[string]int{StageDecode: 0, StageDSP: 1, StageEncode: 2, StageForward: 3, StageProvider: 4}
+	p.Lock()
+	list := make([]StageMetrics, 0, len(p.stages))
+	for _, m := range p.stages {
+		stage := *m
+		stage.Histogram = append([]int64(nil), m.Histogram...)
+		list = append(list, stage)
+	}
+	p.Unlock()
+	for i := range list {
+		m := &list[i]
+		if m.Count > 0 {
+			m.AvgUs = float64(m.SumUs) / float64(m.Count)
+		}
+		m.P50Us, m.P95Us, m.P99Us = m.percentile(0.5), m.percentile(0.95), m.percentile(0.99)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Path != list[j].Path {
+			return list[i].Path < list[j].Path
+		}
+		return order[list[i].Stage] < order[list[j].Stage]
+	})
+	return list
+}
+
+// slowSpans returns the recent slow spans, slowest first
+func (p *Pipeline) slowSpans() []PipelineSpan {
+	p.Lock()
+	spans := append([]PipelineSpan{}, p.slow...)
+	p.Unlock()
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].DurationUs > spans[j].DurationUs })
+	return spans
+}
+
+// percentile estimates a latency percentile from the histogram bucket bounds
+func (m *StageMetrics) percentile(q float64) int64 {
+	target := int64(float64(m.Count)*q + 0.5)
+	var seen int64
+	for i, count := range m.Histogram {
+		seen += count
+		if seen >= target && seen > 0 {
+			if i < len(stageBucketsUs) {
+				return stageBucketsUs[i]
+			}
+			return m.MaxUs
+		}
+	}
+	return 0
+}
+
+// startTrace labels the call's spans once its call SID is known and samples
+// the call for tracing
+func (s *Session) startTrace(callSid string) {
+	s.traceCallSid.Store(&callSid)
+	if pipeline.sample > 0 && rolloutBucket("pipeline-trace", callSid) < pipeline.sample {
+		s.trace.Store(&pipelineTrace{})
+	}
+}
+
+// stage runs one step of the media pipeline, counting it against the stage's
+// metrics and, when the call is traced, recording it as a span
+func (s *Session) stage(path, name string, size int, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	span := PipelineSpan{
+		CallSid:    s.traceID(),
+		Path:       path,
+		Stage:      name,
+		Start:      start.UTC(),
+		DurationUs: time.Since(start).Microseconds(),
+		Bytes:      size,
+	}
+	if err != nil {
+		span.Error = err.Error()
+	}
+	pipeline.observe(span)
+	if trace := s.trace.Load(); trace != nil {
+		trace.add(span, pipeline.traceLimit)
+	}
+	return err
+}
+
+// traceID returns the call SID once the stream has started
+func (s *Session) traceID() string {
+	if id := s.traceCallSid.Load(); id != nil {
+		return *id
+	}
+	return ""
+}
+
+// add appends a span, counting the ones past the limit instead of keeping them
+func (t *pipelineTrace) add(span PipelineSpan, limit int) {
+	t.Lock()
+	defer t.Unlock()
+	if limit > 0 && len(t.spans) >= limit {
+		t.dropped++
+		return
+	}
+	t.spans = append(t.spans, span)
+}
+
+// handlePipelineMetrics serves GET /admin/pipeline
+func handlePipelineMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"stages":     pipeline.metrics(),
+		"buckets_us": stageBucketsUs,
+		"slow_spans": pipeline.slowSpans(),
+	})
+}
+
+// handleCallTrace serves GET /calls/:id/trace, the pipeline spans of a live
+// call sampled for tracing
+func handleCallTrace(c *gin.Context) {
+	s := fleet.findSession(c.Param("id"))
+	if s == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no live session for that call on this instance"})
+		return
+	}
+	trace := s.trace.Load()
+	if trace == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "call is not sampled for tracing"})
+		return
+	}
+	trace.Lock()
+	defer trace.Unlock()
+	c.JSON(http.StatusOK, gin.H{"call_sid": c.Param("id"), "spans": trace.spans, "dropped": trace.dropped})
+}
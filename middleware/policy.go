@@ -0,0 +1,167 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Strategies the conversation policy can switch to after repeated failed turns
+const (
+	StrategySlowDown = "slow_down"
+	StrategyTransfer = "transfer"
+)
+
+// slowDownInstructions are appended to the prompt once the policy slows the conversation
+const slowDownInstructions = "The caller is having trouble understanding or being understood. " +
+	"Speak slowly and clearly, use short sentences, ask one question at a time, and confirm what you heard."
+
+// ConversationPolicy decides how to react when turns keep failing
+type ConversationPolicy struct {
+	// Threshold is the number of consecutive failed turns before the next strategy applies
+	Threshold int `json:"threshold"`
+
+	// Strategies are applied in order, one step per threshold breach
+	Strategies []string `json:"strategies"`
+
+	// SlowSilenceMs is the VAD silence window used after slowing down
+	SlowSilenceMs int `json:"slow_silence_ms"`
+}
+
+// policyState tracks the conversation policy for one call
+type policyState struct {
+	failedTurns int
+	step        int
+	slowDown    bool
+	strategies  []string
+}
+
+// conversationPolicy returns the agent's policy, or the environment defaults
+func (a *Agent) conversationPolicy() ConversationPolicy {
+	policy := ConversationPolicy{}
+	if a.Policy != nil {
+		policy = *a.Policy
+	}
+	if policy.Threshold == 0 {
+		policy.Threshold = getEnvInt("POLICY_FAILED_TURNS", 3)
+	}
+	if len(policy.Strategies) == 0 {
+		policy.Strategies = getEnvList("POLICY_STRATEGIES")
+		if len(policy.Strategies) == 0 {
+			policy.Strategies = []string{StrategySlowDown, StrategyTransfer}
+		}
+	}
+	if policy.SlowSilenceMs == 0 {
+		policy.SlowSilenceMs = getEnvInt("POLICY_SLOW_SILENCE_MS", 900)
+	}
+	return policy
+}
+
+// isFailedTurn reports whether an utterance shows the conversation is not getting through
+func (p ConversationPolicy) isFailedTurn(speaker, text string) bool {
+	switch speaker {
+	case SpeakerCaller:
+		return isUnintelligible(text)
+	case SpeakerAssistant:
+		return isMisunderstanding(text)
+	}
+	return false
+}
+
+// noiseMarker matches the bracketed annotations transcription inserts for
+// sounds, such as "[inaudible]" or "(coughs)"
+var noiseMarker = regexp.MustCompile(`\[[^\]]*\]|\([^)]*\)`)
+
+// isUnintelligible reports whether a caller transcript is empty or holds no
+// words, such as a failed transcription or one made only of noise markers;
+// short answers like "no" or "sí" are normal turns
+func isUnintelligible(text string) bool {
+	text = noiseMarker.ReplaceAllString(text, "")
+	return strings.IndexFunc(text, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) < 0
+}
+
+// applyConversationPolicy counts failed turns and switches strategy at the threshold
+func (s *Session) applyConversationPolicy(speaker, text string) {
+	policy := s.agent.conversationPolicy()
+	failed := policy.isFailedTurn(speaker, text)
+
+	s.Lock()
+	state := &s.policy
+	if !failed {
+		// A caller turn that went through resets the streak; assistant turns are neutral
+		if speaker == SpeakerCaller {
+			state.failedTurns = 0
+		}
+		s.Unlock()
+		return
+	}
+	state.failedTurns++
+	if state.failedTurns < policy.Threshold || state.step >= len(policy.Strategies) {
+		s.Unlock()
+		return
+	}
+	strategy := policy.Strategies[state.step]
+	state.step++
+	state.failedTurns = 0
+	state.strategies = append(state.strategies, strategy)
+	s.Unlock()
+
+	log.Printf("Conversation policy on stream %s switching to %s\n", s.streamSid, strategy)
+	s.applyStrategy(strategy)
+}
+
+// applyStrategy carries out a conversation policy strategy
+func (s *Session) applyStrategy(strategy string) {
+	switch strategy {
+	case StrategySlowDown:
+		s.Lock()
+		s.policy.slowDown = true
+		s.Unlock()
+		s.sendSessionUpdate()
+	case StrategyTransfer:
+		number := s.agent.escalationPolicy().TransferNumber
+		if number == "" {
+			log.Println("transfer strategy configured without a transfer number")
+			return
+		}
+		s.injectSystemMessage("Tell the caller, briefly, that you are connecting them with a colleague who can help.", true)
+		s.spawn(func() {
+			// Give the model a moment to announce the transfer
+			time.Sleep(getEnvDuration("POLICY_TRANSFER_DELAY", 4*time.Second))
+			if err := s.transfer(number); err != nil {
+				log.Println("Error transferring call:", err)
+				return
+			}
+		})
+	case StrategyDTMFMenu:
+		s.enterDTMFMode()
+	default:
+		log.Println("Unknown conversation strategy:", strategy)
+	}
+}
+
+// turnDetection returns the VAD settings, lengthened once the policy slows down
+func (s *Session) turnDetection() map[string]interface{} {
+	td := map[string]interface{}{"type": "server_vad"}
+	if s.flag(FlagSemanticVAD) {
+		td = map[string]interface{}{"type": "semantic_vad"}
+		if s.policy.slowDown {
+			td["eagerness"] = "low"
+		}
+		return td
+	}
+	if s.policy.slowDown {
+		td["silence_duration_ms"] = s.agent.conversationPolicy().SlowSilenceMs
+	}
+	return td
+}
+
+// policyInstructions returns extra prompt text required by the active strategies
+func (s *Session) policyInstructions() string {
+	if s.policy.slowDown {
+		return slowDownInstructions
+	}
+	return ""
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+// TestIsUnintelligible checks noise markers count as failed caller turns
+// while short answers do not
+func TestIsUnintelligible(t *testing.T) {
+	cases := map[string]bool{
+		"":                      true,
+		"...":                   true,
+		"[inaudible]":           true,
+		"[inaudible] (coughs)":  true,
+		"no":                    false,
+		"sí":                    false,
+		"[inaudible] yes":       false,
+		"my number is 555-0100": false,
+	}
+	for text, want := range cases {
+		if got := isUnintelligible(text); got != want {
+			t.Errorf("isUnintelligible(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
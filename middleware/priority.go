@@ -0,0 +1,227 @@
+package main
+
+import (
+	"html"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultPriorityClass is the class of calls no rule matches
+const DefaultPriorityClass = "standard"
+
+// PriorityClass groups calls that share an admission priority
+type PriorityClass struct {
+	Name string `json:"name"`
+
+	// Rank orders classes; higher ranks are admitted first and shed last
+	Rank int `json:"rank"`
+
+	// Reserved call slots on this instance that lower-ranked calls cannot use
+	Reserved int `json:"reserved"`
+
+	// A call joins the class if its caller or dialed number, or its tenant,
+	// matches; numbers ending in * match by prefix
+	Numbers []string `json:"numbers,omitempty"`
+	Tenants []string `json:"tenants,omitempty"`
+}
+
+// matches reports whether a call falls into the class
+func (c PriorityClass) matches(tenantID, from, to string) bool {
+	if containsString(c.Tenants, tenantID) {
+		return true
+	}
+	for _, pattern := range c.Numbers {
+		for _, number := range []string{from, to} {
+			if number == "" {
+				continue
+			}
+			if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(number, prefix) || pattern == number {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// waitingCall is a call held in the admission queue
+type waitingCall struct {
+	rank     int
+	since    time.Time
+	lastSeen time.Time
+}
+
+// PriorityClasses classifies calls and admits them against this instance's
+// capacity, holding lower classes in a queue when slots are reserved or full
+type PriorityClasses struct {
+	sync.Mutex
+	classes     []PriorityClass
+	holdMessage string
+	waiting     map[string]*waitingCall
+
+	// admitted counts calls let in whose media stream has not started yet
+	admitted map[string]admittedCall
+}
+
+// admittedCall is a call between admission and its media stream
+type admittedCall struct {
+	class string
+	at    time.Time
+}
+
+// loadPriorityClasses reads PRIORITY_CLASSES_FILE; without it every call is
+// standard and admission is not limited
+func loadPriorityClasses() *PriorityClasses {
+	p := &PriorityClasses{
+		holdMessage: getEnv("PRIORITY_HOLD_MESSAGE", "All of our assistants are busy. Please hold and we will be with you shortly."),
+		waiting:     make(map[string]*waitingCall),
+		admitted:    make(map[string]admittedCall),
+	}
+	if _, err := loadJSONFile("PRIORITY_CLASSES_FILE", &p.classes); err != nil {
+		log.Println("Error loading PRIORITY_CLASSES_FILE:", err)
+	}
+	sort.SliceStable(p.classes, func(i, j int) bool { return p.classes[i].Rank > p.classes[j].Rank })
+	if len(p.classes) > 0 {
+		log.Printf("Loaded %d priority class(es)\n", len(p.classes))
+	}
+	return p
+}
+
+// classify returns the highest-ranked class the call belongs to. A class
+// named in the call's parameters wins; otherwise the standard class takes
+// the tenant's priority
+func (p *PriorityClasses) classify(tenant *Tenant, from, to, requested string) PriorityClass {
+	for _, class := range p.classes {
+		if requested != "" && class.Name == requested {
+			return class
+		}
+	}
+	for _, class := range p.classes {
+		if class.matches(tenant.ID, from, to) {
+			return class
+		}
+	}
+	return PriorityClass{Name: DefaultPriorityClass, Rank: tenant.Priority}
+}
+
+// admit decides whether a call may connect now. Calls are held while the
+// instance is full, while the free slots are reserved for higher classes, or
+// while a call ahead of them in the queue is still waiting
+func (p *PriorityClasses) admit(callSid string, class PriorityClass) bool {
+	if len(p.classes) == 0 || callSid == "" {
+		return true
+	}
+	active := make(map[string]int)
+	total := 0
+	for _, s := range fleet.liveSessions() {
+		s.Lock()
+		active[s.priorityClass]++
+		s.Unlock()
+		total++
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	now := time.Now()
+	for sid, a := range p.admitted {
+		if now.Sub(a.at) > 30*time.Second {
+			delete(p.admitted, sid)
+			continue
+		}
+		active[a.class]++
+		total++
+	}
+	for sid, w := range p.waiting {
+		// Callers who hung up stop polling
+		if now.Sub(w.lastSeen) > 30*time.Second {
+			delete(p.waiting, sid)
+		}
+	}
+
+	reserved := 0
+	for _, other := range p.classes {
+		if other.Rank > class.Rank && other.Reserved > active[other.Name] {
+			reserved += other.Reserved - active[other.Name]
+		}
+	}
+	w, ok := p.waiting[callSid]
+	if !ok {
+		w = &waitingCall{rank: class.Rank, since: now}
+	}
+	w.lastSeen = now
+	ahead := false
+	for sid, other := range p.waiting {
+		if sid != callSid && (other.rank > w.rank || other.rank == w.rank && other.since.Before(w.since)) {
+			ahead = true
+			break
+		}
+	}
+	if total < fleet.capacity-reserved && !ahead {
+		delete(p.waiting, callSid)
+		p.admitted[callSid] = admittedCall{class: class.Name, at: now}
+		return true
+	}
+	p.waiting[callSid] = w
+	return false
+}
+
+// streamStarted clears a call's admission once its media stream is up
+func (p *PriorityClasses) streamStarted(callSid string) {
+	p.Lock()
+	delete(p.admitted, callSid)
+	p.Unlock()
+}
+
+// holdTwiML keeps a queued caller on the line and asks for admission again,
+// playing hold audio when the agent has some
+func (p *PriorityClasses) holdTwiML(locale Locale, play, retryURL string) string {
+	hold := `<Say` + locale.sayAttributes() + `>` + html.EscapeString(p.holdMessage) + `</Say>
+    <Pause length="10"/>`
+	if play != "" {
+		hold = play
+	}
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<Response>
+    ` + hold + `
+    <Redirect method="POST">` + html.EscapeString(retryURL) + `</Redirect>
+</Response>`
+}
+
+// handlePriorityStatus serves GET /admin/priority: the classes, the live
+// calls in each and the callers waiting for a slot
+func handlePriorityStatus(c *gin.Context) {
+	active := make(map[string]int)
+	for _, s := range fleet.liveSessions() {
+		s.Lock()
+		active[s.priorityClass]++
+		s.Unlock()
+	}
+	priorityClasses.Lock()
+	defer priorityClasses.Unlock()
+	type waiting struct {
+		CallSid string    `json:"call_sid"`
+		Rank    int       `json:"rank"`
+		Since   time.Time `json:"since"`
+	}
+	queue := make([]waiting, 0, len(priorityClasses.waiting))
+	for sid, w := range priorityClasses.waiting {
+		queue = append(queue, waiting{CallSid: sid, Rank: w.rank, Since: w.since.UTC()})
+	}
+	sort.Slice(queue, func(i, j int) bool {
+		if queue[i].Rank != queue[j].Rank {
+			return queue[i].Rank > queue[j].Rank
+		}
+		return queue[i].Since.Before(queue[j].Since)
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"capacity": fleet.capacity,
+		"classes":  priorityClasses.classes,
+		"active":   active,
+		"waiting":  queue,
+	})
+}
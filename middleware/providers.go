@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// Providers tracked for SLA reporting
+const (
+	ProviderOpenAIRealtime    = "openai_realtime"
+	ProviderOpenAIChat        = "openai_chat"
+	ProviderOpenAISpeech      = "openai_speech"
+	ProviderAddressValidation = "address_validation"
+	ProviderTwilio            = "twilio"
+)
+
+// Error categories for provider failures
+const (
+	ErrorTimeout     = "timeout"
+	ErrorNetwork     = "network"
+	ErrorAuth        = "auth"
+	ErrorRateLimited = "rate_limited"
+	ErrorClient      = "client_error"
+	ErrorServer      = "server_error"
+	ErrorProtocol    = "protocol"
+)
+
+// latencyBucketsMs are the upper bounds of the latency histogram
+var latencyBucketsMs = []int64{50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// ProviderRollup aggregates one provider's requests for one UTC day
+type ProviderRollup struct {
+	Date         string         `json:"date"`
+	Provider     string         `json:"provider"`
+	Requests     int            `json:"requests"`
+	Successes    int            `json:"successes"`
+	Failures     int            `json:"failures"`
+	LatencySumMs int64          `json:"latency_sum_ms"`
+	LatencyMaxMs int64          `json:"latency_max_ms"`
+	Histogram    []int          `json:"latency_histogram"`
+	Errors       map[string]int `json:"errors"`
+
+	// SessionErrors counts errors reported mid-session by category; they
+	// belong to no single request, so they are not in Failures or Errors
+	SessionErrors map[string]int `json:"session_errors,omitempty"`
+}
+
+// ProviderReportRow is a rollup with derived SLA figures
+type ProviderReportRow struct {
+	ProviderRollup
+	SuccessRate  float64 `json:"success_rate"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	P95LatencyMs int64   `json:"p95_latency_ms"`
+}
+
+// ProviderMetrics keeps daily rollups in DATA_DIR and flushes them periodically
+type ProviderMetrics struct {
+	sync.Mutex
+	path    string
+	rollups map[string]*ProviderRollup
+	dirty   bool
+}
+
+// newProviderMetrics loads stored rollups and starts the flush loop
+func newProviderMetrics() *ProviderMetrics {
+	m := &ProviderMetrics{
+		path:    dataPath("provider_metrics.json"),
+		rollups: make(map[string]*ProviderRollup),
+	}
+	var stored []*ProviderRollup
+	if err := readJSONFile(m.path, &stored); err != nil {
+		log.Println("Error loading provider metrics:", err)
+	}
+	for _, r := range stored {
+		m.rollups[r.Date+"|"+r.Provider] = r
+	}
+	go m.flushLoop(getEnvDuration("PROVIDER_METRICS_FLUSH", time.Minute))
+	return m
+}
+
+// rollup returns today's rollup for a provider; the caller must hold the lock
+func (m *ProviderMetrics) rollup(provider string) *ProviderRollup {
+	date := time.Now().UTC().Format("2006-01-02")
+	key := date + "|" + provider
+	r, ok := m.rollups[key]
+	if !ok {
+		r = &ProviderRollup{
+			Date:      date,
+			Provider:  provider,
+			Histogram: make([]int, len(latencyBucketsMs)+1),
+			Errors:    make(map[string]int),
+		}
+		m.rollups[key] = r
+	}
+	return r
+}
+
+// record counts one request to a provider with its latency and outcome
+func (m *ProviderMetrics) record(provider string, latency time.Duration, err error) {
+	m.Lock()
+	defer m.Unlock()
+	r := m.rollup(provider)
+	r.Requests++
+	if err != nil {
+		r.Failures++
+		r.Errors[errorCategory(err)]++
+	} else {
+		r.Successes++
+	}
+	ms := latency.Milliseconds()
+	r.LatencySumMs += ms
+	if ms > r.LatencyMaxMs {
+		r.LatencyMaxMs = ms
+	}
+	r.Histogram[sort.Search(len(latencyBucketsMs), func(i int) bool { return ms <= latencyBucketsMs[i] })]++
+	m.dirty = true
+}
+
+// recordError counts a failure reported mid-session, outside any single request
+func (m *ProviderMetrics) recordError(provider, category string) {
+	m.Lock()
+	defer m.Unlock()
+	r := m.rollup(provider)
+	if r.SessionErrors == nil {
+		r.SessionErrors = make(map[string]int)
+	}
+	r.SessionErrors[category]++
+	m.dirty = true
+}
+
+// errorCategory classifies a provider error for the SLA breakdown
+func errorCategory(err error) string {
+	var status *statusError
+	var netErr net.Error
+	var closeErr *websocket.CloseError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorTimeout
+	case errors.As(err, &status):
+		return statusCategory(status.StatusCode)
+	case errors.Is(err, websocket.ErrBadHandshake):
+		return ErrorProtocol
+	case errors.As(err, &closeErr):
+		return ErrorProtocol
+	case errors.As(err, &netErr):
+		return ErrorNetwork
+	}
+	return ErrorProtocol
+}
+
+// statusCategory maps an HTTP status code to an error category
+func statusCategory(code int) string {
+	switch {
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return ErrorAuth
+	case code == http.StatusTooManyRequests:
+		return ErrorRateLimited
+	case code >= 500:
+		return ErrorServer
+	}
+	return ErrorClient
+}
+
+// realtimeErrorCategory maps an OpenAI realtime error event to an error category
+func realtimeErrorCategory(raw json.RawMessage) string {
+	var detail struct {
+		Type string `json:"type"`
+		Code string `json:"code"`
+	}
+	json.Unmarshal(raw, &detail)
+	switch {
+	case detail.Code == "rate_limit_exceeded":
+		return ErrorRateLimited
+	case detail.Type == "server_error":
+		return ErrorServer
+	case detail.Type == "authentication_error":
+		return ErrorAuth
+	case detail.Type == "invalid_request_error":
+		return ErrorClient
+	}
+	return ErrorProtocol
+}
+
+// flushLoop saves changed rollups and drops days past the retention window
+func (m *ProviderMetrics) flushLoop(interval time.Duration) {
+	for range time.Tick(interval) {
+		m.flush()
+	}
+}
+
+// flush writes the rollups to disk if anything changed
+func (m *ProviderMetrics) flush() {
+	m.Lock()
+	if !m.dirty {
+		m.Unlock()
+		return
+	}
+	cutoff := time.Now().UTC().AddDate(0, 0, -getEnvInt("PROVIDER_METRICS_RETENTION_DAYS", 400)).Format("2006-01-02")
+	list := make([]ProviderRollup, 0, len(m.rollups))
+	for key, r := range m.rollups {
+		if r.Date < cutoff {
+			delete(m.rollups, key)
+			continue
+		}
+		list = append(list, *r)
+	}
+	m.dirty = false
+	m.Unlock()
+
+	if err := writeJSONFile(m.path, list); err != nil {
+		log.Println("Error saving provider metrics:", err)
+	}
+}
+
+// report returns rollups between two dates (inclusive, YYYY-MM-DD), optionally for one provider
+func (m *ProviderMetrics) report(from, to, provider string) []ProviderReportRow {
+	m.Lock()
+	defer m.Unlock()
+	var rows []ProviderReportRow
+	for _, r := range m.rollups {
+		if (from != "" && r.Date < from) || (to != "" && r.Date > to) || (provider != "" && r.Provider != provider) {
+			continue
+		}
+		row := ProviderReportRow{ProviderRollup: *r, P95LatencyMs: r.percentile(0.95)}
+		row.Errors = make(map[string]int, len(r.Errors))
+		for k, v := range r.Errors {
+			row.Errors[k] = v
+		}
+		if r.SessionErrors != nil {
+			row.SessionErrors = make(map[string]int, len(r.SessionErrors))
+			for k, v := range r.SessionErrors {
+				row.SessionErrors[k] = v
+			}
+		}
+		if r.Requests > 0 {
+			row.SuccessRate = float64(r.Successes) / float64(r.Requests)
+			row.AvgLatencyMs = float64(r.LatencySumMs) / float64(r.Requests)
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Date != rows[j].Date {
+			return rows[i].Date < rows[j].Date
+		}
+		return rows[i].Provider < rows[j].Provider
+	})
+	return rows
+}
+
+// percentile estimates a latency percentile from the histogram bucket bounds
+func (r *ProviderRollup) percentile(p float64) int64 {
+	target := int(float64(r.Requests)*p + 0.5)
+	seen := 0
+	for i, count := range r.Histogram {
+		seen += count
+		if seen >= target && seen > 0 {
+			if i < len(latencyBucketsMs) {
+				return latencyBucketsMs[i]
+			}
+			return r.LatencyMaxMs
+		}
+	}
+	return 0
+}
+
+// handleProviderReport serves GET /admin/reports/providers as JSON or CSV
+func handleProviderReport(c *gin.Context) {
+	from, err := parseTimeParam(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var fromDate, toDate string
+	if !from.IsZero() {
+		fromDate = from.UTC().Format("2006-01-02")
+	}
+	if !to.IsZero() {
+		toDate = to.UTC().Format("2006-01-02")
+	}
+	rows := providerMetrics.report(fromDate, toDate, c.Query("provider"))
+
+	if c.Query("format") != "csv" {
+		c.JSON(http.StatusOK, gin.H{"rollups": rows})
+		return
+	}
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", `attachment; filename="provider_metrics.csv"`)
+	w := csv.NewWriter(c.Writer)
+	categories := []string{ErrorTimeout, ErrorNetwork, ErrorAuth, ErrorRateLimited, ErrorClient, ErrorServer, ErrorProtocol}
+	w.Write(append([]string{"date", "provider", "requests", "successes", "failures", "success_rate", "avg_latency_ms", "p95_latency_ms", "max_latency_ms"}, append(categories, "session_errors")...))
+	for _, row := range rows {
+		record := []string{
+			row.Date, row.Provider,
+			strconv.Itoa(row.Requests), strconv.Itoa(row.Successes), strconv.Itoa(row.Failures),
+			strconv.FormatFloat(row.SuccessRate, 'f', 4, 64),
+			strconv.FormatFloat(row.AvgLatencyMs, 'f', 1, 64),
+			strconv.FormatInt(row.P95LatencyMs, 10),
+			strconv.FormatInt(row.LatencyMaxMs, 10),
+		}
+		for _, category := range categories {
+			record = append(record, strconv.Itoa(row.Errors[category]))
+		}
+		sessionErrors := 0
+		for _, n := range row.SessionErrors {
+			sessionErrors += n
+		}
+		w.Write(append(record, strconv.Itoa(sessionErrors)))
+	}
+	w.Flush()
+}
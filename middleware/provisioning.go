@@ -0,0 +1,495 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// What applying a declared resource did, or would do
+const (
+	ChangeCreated   = "created"
+	ChangeUpdated   = "updated"
+	ChangeUnchanged = "unchanged"
+	ChangeDeleted   = "deleted"
+)
+
+// Kinds of resources managed declaratively
+const (
+	ResourceAgent   = "agent"
+	ResourceNumber  = "number"
+	ResourceWebhook = "webhook"
+)
+
+// resourceIDPattern restricts the stable IDs of agents and webhooks
+var resourceIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// changeAction compares a declared resource with the current one; resources
+// are equal when they encode to the same JSON
+func changeAction(exists bool, current, declared interface{}) string {
+	if !exists {
+		return ChangeCreated
+	}
+	a, errA := json.Marshal(current)
+	b, errB := json.Marshal(declared)
+	if errA == nil && errB == nil && string(a) == string(b) {
+		return ChangeUnchanged
+	}
+	return ChangeUpdated
+}
+
+// validateAgentSpec checks an agent before it is stored
+func validateAgentSpec(spec Agent) error {
+	if !resourceIDPattern.MatchString(spec.ID) {
+		return fmt.Errorf("agent id %q must be letters, digits, '.', '-' and '_'", spec.ID)
+	}
+	if spec.Temperature < 0 || spec.Temperature > 2 {
+		return fmt.Errorf("agent %s: temperature must be between 0 and 2", spec.ID)
+	}
+	for _, field := range spec.Capture {
+		if field.Name == "" {
+			return fmt.Errorf("agent %s: capture fields need a name", spec.ID)
+		}
+	}
+	if b := spec.Budget; b != nil && (b.MaxAvgCost < 0 || b.MaxWindowCost < 0 || b.MaxAvgLatencyMs < 0 || b.WindowMinutes < 0 || b.MinCalls < 0) {
+		return fmt.Errorf("agent %s: budget limits must not be negative", spec.ID)
+	}
+	if w := spec.Whisper; w != nil {
+		switch {
+		case w.AgentNumber == "":
+			return fmt.Errorf("agent %s: whisper needs the human agent's number", spec.ID)
+		case w.Mode != "" && w.Mode != WhisperTranslate && w.Mode != WhisperSuggest:
+			return fmt.Errorf("agent %s: whisper mode must be %s or %s", spec.ID, WhisperTranslate, WhisperSuggest)
+		case w.Listen != "" && w.Listen != LegCaller && w.Listen != LegAgent && w.Listen != LegBoth:
+			return fmt.Errorf("agent %s: whisper listen must be %s, %s or %s", spec.ID, LegCaller, LegAgent, LegBoth)
+		}
+	}
+	return nil
+}
+
+// webhookEvents are the events subscriptions may name
+var webhookEvents = []string{"*", EventCallCompleted, EventCallFailed, EventVoicemailLeft, EventEscalation}
+
+// validateWebhookSpec checks a subscription before it is stored
+func validateWebhookSpec(spec WebhookSubscription) error {
+	if !resourceIDPattern.MatchString(spec.ID) {
+		return fmt.Errorf("webhook id %q must be letters, digits, '.', '-' and '_'", spec.ID)
+	}
+	target, err := url.Parse(spec.URL)
+	if err != nil || (target.Scheme != "https" && target.Scheme != "http") || target.Host == "" {
+		return fmt.Errorf("webhook %s: url must be an http or https URL", spec.ID)
+	}
+	if spec.Format != "" && spec.Format != FormatStandard && spec.Format != FormatFlat {
+		return fmt.Errorf("webhook %s: format must be standard or flat", spec.ID)
+	}
+	for _, event := range spec.Events {
+		if !containsString(webhookEvents, event) {
+			return fmt.Errorf("webhook %s: unknown event %q", spec.ID, event)
+		}
+	}
+	return nil
+}
+
+// agentInUse returns the tenants, number routes and rollouts that use an
+// agent, given the number routes to check
+func agentInUse(id string, routes []NumberRoute) []string {
+	var users []string
+	tenants.RLock()
+	for _, tenant := range tenants.tenants {
+		if tenant.AgentID == id {
+			users = append(users, "tenant "+tenant.ID)
+		}
+	}
+	tenants.RUnlock()
+	for _, route := range routes {
+		if route.Agent == id {
+			users = append(users, "number "+route.Number)
+		}
+	}
+	for _, rolloutID := range rollouts.usedBy(id) {
+		users = append(users, "rollout "+rolloutID)
+	}
+	sort.Strings(users)
+	return users
+}
+
+// WebhookView is a subscription as the API returns it, without its secret
+type WebhookView struct {
+	ID        string   `json:"id"`
+	URL       string   `json:"url"`
+	Format    string   `json:"format,omitempty"`
+	Events    []string `json:"events,omitempty"`
+	SecretSet bool     `json:"secret_set"`
+}
+
+// webhookView hides a subscription's secret
+func webhookView(sub WebhookSubscription) WebhookView {
+	return WebhookView{ID: sub.ID, URL: sub.URL, Format: sub.Format, Events: sub.Events, SecretSet: sub.Secret != ""}
+}
+
+// putStatus is the response status of a PUT that made a change
+func putStatus(action string) int {
+	if action == ChangeCreated {
+		return http.StatusCreated
+	}
+	return http.StatusOK
+}
+
+// handleListAgents serves GET /admin/agents
+func handleListAgents(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"agents": agents.specs(), "managed": agents.managedIDs()})
+}
+
+// handleGetAgent serves GET /admin/agents/:id
+func handleGetAgent(c *gin.Context) {
+	spec, ok := agents.spec(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+		return
+	}
+	c.JSON(http.StatusOK, spec)
+}
+
+// handlePutAgent serves PUT /admin/agents/:id; putting the same definition
+// again changes nothing
+func handlePutAgent(c *gin.Context) {
+	var spec Agent
+	if err := c.ShouldBindJSON(&spec); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if spec.ID != "" && spec.ID != c.Param("id") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id in body does not match the path"})
+		return
+	}
+	spec.ID = c.Param("id")
+	if err := validateAgentSpec(spec); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	action, err := agents.put(spec)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if action != ChangeUnchanged {
+		log.Printf("Agent %s %s through the admin API\n", spec.ID, action)
+	}
+	c.JSON(putStatus(action), spec)
+}
+
+// handleDeleteAgent serves DELETE /admin/agents/:id
+func handleDeleteAgent(c *gin.Context) {
+	id := c.Param("id")
+	if users := agentInUse(id, numberTable.list()); len(users) > 0 && id != DefaultAgentID {
+		c.JSON(http.StatusConflict, gin.H{"error": "agent is used by " + strings.Join(users, ", ")})
+		return
+	}
+	removed, err := agents.remove(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no agent with that id is managed through the API"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+// handleListNumbers serves GET /admin/numbers
+func handleListNumbers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"numbers": numberTable.list(), "managed": numberTable.managedNumbers()})
+}
+
+// handleGetNumber serves GET /admin/numbers/:number; patterns are looked up
+// as written, so GET /admin/numbers/+4420* returns that route itself
+func handleGetNumber(c *gin.Context) {
+	route, ok := numberTable.route(routeKey(c.Param("number")))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "number not found"})
+		return
+	}
+	c.JSON(http.StatusOK, route)
+}
+
+// handlePutNumber serves PUT /admin/numbers/:number
+func handlePutNumber(c *gin.Context) {
+	var route NumberRoute
+	if err := c.ShouldBindJSON(&route); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	number := routeKey(c.Param("number"))
+	if route.Number != "" && routeKey(route.Number) != number {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "number in body does not match the path"})
+		return
+	}
+	route.Number = number
+	if err := validateNumberRoute(&route, nil); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	action, err := numberTable.put(route)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(putStatus(action), route)
+}
+
+// handleDeleteNumber serves DELETE /admin/numbers/:number
+func handleDeleteNumber(c *gin.Context) {
+	removed, err := numberTable.remove(routeKey(c.Param("number")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no route for that number is managed through the API"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+// handleListWebhooks serves GET /admin/webhooks
+func handleListWebhooks(c *gin.Context) {
+	views := []WebhookView{}
+	for _, sub := range webhooks.specs() {
+		views = append(views, webhookView(sub))
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": views, "managed": webhooks.managedIDs()})
+}
+
+// handleGetWebhook serves GET /admin/webhooks/:id
+func handleGetWebhook(c *gin.Context) {
+	sub, ok := webhooks.spec(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return
+	}
+	c.JSON(http.StatusOK, webhookView(sub))
+}
+
+// handlePutWebhook serves PUT /admin/webhooks/:id
+func handlePutWebhook(c *gin.Context) {
+	var spec WebhookSubscription
+	if err := c.ShouldBindJSON(&spec); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if spec.ID != "" && spec.ID != c.Param("id") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id in body does not match the path"})
+		return
+	}
+	spec.ID = c.Param("id")
+	if err := validateWebhookSpec(spec); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	action, err := webhooks.put(spec)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(putStatus(action), webhookView(spec))
+}
+
+// handleDeleteWebhook serves DELETE /admin/webhooks/:id
+func handleDeleteWebhook(c *gin.Context) {
+	removed, err := webhooks.remove(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no webhook with that id is managed through the API"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+// ProvisioningDocument is the desired state sent to POST /admin/apply
+type ProvisioningDocument struct {
+	Agents   []Agent               `json:"agents"`
+	Numbers  []NumberRoute         `json:"numbers"`
+	Webhooks []WebhookSubscription `json:"webhooks"`
+
+	// Prune deletes API-managed resources the document leaves out, so the
+	// document is the whole desired state
+	Prune bool `json:"prune"`
+
+	// DryRun reports the changes without making them
+	DryRun bool `json:"dry_run"`
+}
+
+// ProvisioningChange is what applying one resource did, or would do
+type ProvisioningChange struct {
+	Kind   string `json:"kind"`
+	ID     string `json:"id"`
+	Action string `json:"action"`
+}
+
+// provisioningPlan is a validated document ready to apply
+type provisioningPlan struct {
+	doc     ProvisioningDocument
+	changes []ProvisioningChange
+}
+
+// planProvisioning validates a document as a whole and works out its
+// changes; nothing is applied unless every resource is valid
+func planProvisioning(doc ProvisioningDocument) (provisioningPlan, error) {
+	plan := provisioningPlan{doc: doc}
+	declaredAgents := map[string]bool{}
+	for _, spec := range doc.Agents {
+		if err := validateAgentSpec(spec); err != nil {
+			return plan, err
+		}
+		if declaredAgents[spec.ID] {
+			return plan, fmt.Errorf("agent %s is declared twice", spec.ID)
+		}
+		declaredAgents[spec.ID] = true
+		action, err := agents.plan(spec)
+		if err != nil {
+			return plan, err
+		}
+		plan.changes = append(plan.changes, ProvisioningChange{Kind: ResourceAgent, ID: spec.ID, Action: action})
+	}
+
+	declaredNumbers := map[string]bool{}
+	for i := range plan.doc.Numbers {
+		route := &plan.doc.Numbers[i]
+		if err := validateNumberRoute(route, declaredAgents); err != nil {
+			return plan, err
+		}
+		if declaredNumbers[route.Number] {
+			return plan, fmt.Errorf("number %s is declared twice", route.Number)
+		}
+		declaredNumbers[route.Number] = true
+		action, err := numberTable.plan(*route)
+		if err != nil {
+			return plan, err
+		}
+		plan.changes = append(plan.changes, ProvisioningChange{Kind: ResourceNumber, ID: route.Number, Action: action})
+	}
+
+	declaredWebhooks := map[string]bool{}
+	for _, spec := range doc.Webhooks {
+		if err := validateWebhookSpec(spec); err != nil {
+			return plan, err
+		}
+		if declaredWebhooks[spec.ID] {
+			return plan, fmt.Errorf("webhook %s is declared twice", spec.ID)
+		}
+		declaredWebhooks[spec.ID] = true
+		action, err := webhooks.plan(spec)
+		if err != nil {
+			return plan, err
+		}
+		plan.changes = append(plan.changes, ProvisioningChange{Kind: ResourceWebhook, ID: spec.ID, Action: action})
+	}
+
+	if !doc.Prune {
+		return plan, nil
+	}
+	// Agents are checked against the routes as they will be, so a document
+	// that moves a number off an agent can prune it
+	routes := numberTable.planned(plan.doc.Numbers)
+	for _, id := range agents.managedIDs() {
+		if declaredAgents[id] {
+			continue
+		}
+		if users := agentInUse(id, routes); len(users) > 0 && id != DefaultAgentID {
+			return plan, fmt.Errorf("cannot prune agent %s: used by %s", id, strings.Join(users, ", "))
+		}
+		plan.changes = append(plan.changes, ProvisioningChange{Kind: ResourceAgent, ID: id, Action: ChangeDeleted})
+	}
+	for _, number := range numberTable.managedNumbers() {
+		if !declaredNumbers[number] {
+			plan.changes = append(plan.changes, ProvisioningChange{Kind: ResourceNumber, ID: number, Action: ChangeDeleted})
+		}
+	}
+	for _, id := range webhooks.managedIDs() {
+		if !declaredWebhooks[id] {
+			plan.changes = append(plan.changes, ProvisioningChange{Kind: ResourceWebhook, ID: id, Action: ChangeDeleted})
+		}
+	}
+	return plan, nil
+}
+
+// apply makes the plan's changes
+func (p provisioningPlan) apply() error {
+	for _, spec := range p.doc.Agents {
+		if _, err := agents.put(spec); err != nil {
+			return err
+		}
+	}
+	for _, route := range p.doc.Numbers {
+		if _, err := numberTable.put(route); err != nil {
+			return err
+		}
+	}
+	for _, spec := range p.doc.Webhooks {
+		if _, err := webhooks.put(spec); err != nil {
+			return err
+		}
+	}
+	for _, change := range p.changes {
+		if change.Action != ChangeDeleted {
+			continue
+		}
+		var err error
+		switch change.Kind {
+		case ResourceAgent:
+			_, err = agents.remove(change.ID)
+		case ResourceNumber:
+			_, err = numberTable.remove(change.ID)
+		case ResourceWebhook:
+			_, err = webhooks.remove(change.ID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleApply serves POST /admin/apply, converging agents, numbers and
+// webhooks on a declared state in one request
+func handleApply(c *gin.Context) {
+	var doc ProvisioningDocument
+	if err := c.ShouldBindJSON(&doc); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	plan, err := planProvisioning(doc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	changes := plan.changes
+	if changes == nil {
+		changes = []ProvisioningChange{}
+	}
+	if !doc.DryRun {
+		if err := plan.apply(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "changes": changes})
+			return
+		}
+		changed := 0
+		for _, change := range changes {
+			if change.Action != ChangeUnchanged {
+				changed++
+			}
+		}
+		log.Printf("Applied provisioning document by %s: %d change(s)\n", auditActor(c), changed)
+	}
+	c.JSON(http.StatusOK, gin.H{"dry_run": doc.DryRun, "changes": changes})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// QA review statuses
+const (
+	ReviewPending   = "pending"
+	ReviewCompleted = "completed"
+	ReviewSkipped   = "skipped"
+)
+
+// Reasons a call is always sent for review
+const (
+	SampleEscalated   = "escalated"
+	SampleFailed      = "failed"
+	SampleTransferred = "transferred"
+	SampleRandom      = "random"
+)
+
+// QASampling decides which of an agent's calls go to the QA review queue
+type QASampling struct {
+	// Rate is the fraction of calls sampled at random, 0-1
+	Rate float64 `json:"rate"`
+
+	// Always lists call outcomes that are always reviewed
+	Always []string `json:"always"`
+}
+
+// QAReview is the review state of a sampled call, stored in the CDR
+type QAReview struct {
+	Status     string    `json:"status"`
+	Reason     string    `json:"reason"`
+	SampledAt  time.Time `json:"sampled_at"`
+	Score      *float64  `json:"score,omitempty"`
+	Reviewer   string    `json:"reviewer,omitempty"`
+	Notes      string    `json:"notes,omitempty"`
+	ReviewedAt time.Time `json:"reviewed_at,omitempty"`
+}
+
+// qaSampling returns the agent's sampling policy, or the environment defaults
+func (a *Agent) qaSampling() QASampling {
+	if a.QA != nil {
+		return *a.QA
+	}
+	always := getEnvList("QA_ALWAYS")
+	if len(always) == 0 {
+		always = []string{SampleEscalated, SampleFailed}
+	}
+	return QASampling{Rate: getEnvFloat("QA_SAMPLE_RATE", 0.05), Always: always}
+}
+
+// sampleForReview returns a pending review if the call should go to QA
+func sampleForReview(agent *Agent, record CallRecord) *QAReview {
+	policy := agent.qaSampling()
+	reasons := map[string]bool{
+		SampleEscalated:   len(record.Escalations) > 0,
+		SampleFailed:      record.Status == CallFailed,
+		SampleTransferred: record.Transferred,
+	}
+	reason := ""
+	for _, always := range policy.Always {
+		if reasons[always] {
+			reason = always
+			break
+		}
+	}
+	if reason == "" && rand.Float64() < policy.Rate {
+		reason = SampleRandom
+	}
+	if reason == "" {
+		return nil
+	}
+	return &QAReview{Status: ReviewPending, Reason: reason, SampledAt: time.Now().UTC()}
+}
+
+// reviewQueue returns sampled calls with the given review status, oldest first
+func (st *CallStore) reviewQueue(status string, filter CallFilter) []CallRecord {
+	var queue []CallRecord
+	for _, record := range st.list(filter) {
+		if record.Review != nil && (status == "" || record.Review.Status == status) {
+			queue = append(queue, record)
+		}
+	}
+	sort.Slice(queue, func(i, j int) bool { return queue[i].StartedAt.Before(queue[j].StartedAt) })
+	return queue
+}
+
+// handleQAQueue serves GET /admin/qa/queue
+func handleQAQueue(c *gin.Context) {
+	filter, err := callFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	queue := callStore.reviewQueue(c.DefaultQuery("status", ReviewPending), filter)
+	items := make([]gin.H, 0, len(queue))
+	for _, record := range queue {
+		items = append(items, gin.H{
+			"call_sid":    record.CallSid,
+			"tenant":      record.Tenant,
+			"agent":       record.Agent,
+			"started_at":  record.StartedAt,
+			"intent":      record.Intent,
+			"disposition": record.Disposition,
+			"review":      record.Review,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"calls": items})
+}
+
+// handleQAReview serves POST /admin/qa/:id/review
+func handleQAReview(c *gin.Context) {
+	var body struct {
+		Status   string   `json:"status"`
+		Score    *float64 `json:"score"`
+		Reviewer string   `json:"reviewer"`
+		Notes    string   `json:"notes"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if body.Status == "" {
+		body.Status = ReviewCompleted
+	}
+	if body.Status != ReviewCompleted && body.Status != ReviewSkipped {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be completed or skipped"})
+		return
+	}
+	if body.Status == ReviewCompleted && (body.Score == nil || *body.Score < 0 || *body.Score > 100) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a completed review needs a score between 0 and 100"})
+		return
+	}
+
+	var review *QAReview
+	err := callStore.update(c.Param("id"), func(record *CallRecord) error {
+		// Calls outside the sample can still be reviewed on request
+		updated := QAReview{Reason: "manual", SampledAt: time.Now().UTC()}
+		if record.Review != nil {
+			updated = *record.Review
+		}
+		updated.Status = body.Status
+		updated.Score = body.Score
+		updated.Reviewer = body.Reviewer
+		updated.Notes = body.Notes
+		updated.ReviewedAt = time.Now().UTC()
+		record.Review = &updated
+		review = &updated
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, review)
+}
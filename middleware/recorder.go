@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Recording format constants; media streams carry 8 kHz G.711 A-law
+const (
+	alawSilence    = 0xD5
+	bytesPerSecond = 8000
+	bytesPerMs     = bytesPerSecond / 1000
+)
+
+// Recording tracks
+const (
+	TrackCaller    = "caller"
+	TrackAssistant = "assistant"
+)
+
+// RecordingInfo describes a stored call recording in the CDR
+type RecordingInfo struct {
+	CallerFile    string    `json:"caller_file"`
+	AssistantFile string    `json:"assistant_file"`
+	StartedAt     time.Time `json:"started_at"`
+	Format        string    `json:"format"`
+	SampleRate    int       `json:"sample_rate"`
+}
+
+// Recorder writes caller and assistant audio as two raw A-law tracks that
+// share the stream timeline, so byte offsets map directly to call time. A
+// call resumed on a new stream continues the tracks after the audio already
+// recorded, since the new stream's timestamps start again from zero
+type Recorder struct {
+	sync.Mutex
+	info      RecordingInfo
+	caller    *os.File
+	assistant *os.File
+
+	base         int64 // where this stream's timeline starts in the tracks
+	callerEnd    int64 // bytes written to the caller track
+	assistantPos int64 // where the next assistant chunk starts
+}
+
+// newRecorder opens the track files for a call under DATA_DIR/recordings,
+// keeping any audio already recorded for it; a resumed call continues no
+// earlier than after, the length its previous stream reached
+func newRecorder(callSid string, startedAt time.Time, after int64) (*Recorder, error) {
+	dir := dataDir("recordings")
+	r := &Recorder{info: RecordingInfo{
+		CallerFile:    filepath.Join(dir, callSid+"."+TrackCaller+".alaw"),
+		AssistantFile: filepath.Join(dir, callSid+"."+TrackAssistant+".alaw"),
+		StartedAt:     startedAt.UTC(),
+		Format:        "alaw",
+		SampleRate:    bytesPerSecond,
+	}}
+	var err error
+	if r.caller, err = os.OpenFile(r.info.CallerFile, os.O_RDWR|os.O_CREATE, 0o644); err != nil {
+		return nil, err
+	}
+	if r.assistant, err = os.OpenFile(r.info.AssistantFile, os.O_RDWR|os.O_CREATE, 0o644); err != nil {
+		r.caller.Close()
+		return nil, err
+	}
+	callerSize, assistantSize := fileSize(r.caller), fileSize(r.assistant)
+	r.base = max(callerSize, assistantSize, after)
+	r.pad(r.caller, callerSize, r.base)
+	r.pad(r.assistant, assistantSize, r.base)
+	r.callerEnd, r.assistantPos = r.base, r.base
+	if r.base > 0 {
+		log.Printf("Continuing recording of call %s after %s\n", callSid, time.Duration(r.base/bytesPerMs)*time.Millisecond)
+	}
+	return r, nil
+}
+
+// fileSize returns the size of an open file, or zero if it cannot be read
+func fileSize(f *os.File) int64 {
+	info, err := f.Stat()
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// writeCaller stores caller audio at its stream timestamp, padding gaps with silence
+func (r *Recorder) writeCaller(timestampMs int64, audio []byte) {
+	r.Lock()
+	defer r.Unlock()
+	offset := r.base + timestampMs*bytesPerMs
+	if offset < r.callerEnd {
+		offset = r.callerEnd
+	}
+	r.pad(r.caller, r.callerEnd, offset)
+	if _, err := r.caller.WriteAt(audio, offset); err != nil {
+		log.Println("Error writing caller recording:", err)
+		return
+	}
+	r.callerEnd = offset + int64(len(audio))
+}
+
+// writeAssistant appends assistant audio after the previous chunk, or at the
+// current caller position when the assistant has been silent, and returns the
+// offset it was written at
+func (r *Recorder) writeAssistant(audio []byte) int64 {
+	r.Lock()
+	defer r.Unlock()
+	if r.assistantPos < r.callerEnd {
+		r.pad(r.assistant, r.assistantPos, r.callerEnd)
+		r.assistantPos = r.callerEnd
+	}
+	offset := r.assistantPos
+	if _, err := r.assistant.WriteAt(audio, offset); err != nil {
+		log.Println("Error writing assistant recording:", err)
+		return offset
+	}
+	r.assistantPos += int64(len(audio))
+	return offset
+}
+
+// position returns the current caller-track offset in bytes
+func (r *Recorder) position() int64 {
+	r.Lock()
+	defer r.Unlock()
+	return r.callerEnd
+}
+
+// length returns the end of the longer track, where a resumed stream continues
+func (r *Recorder) length() int64 {
+	r.Lock()
+	defer r.Unlock()
+	return max(r.callerEnd, r.assistantPos)
+}
+
+// pad fills [from, to) with A-law silence
+func (r *Recorder) pad(f *os.File, from, to int64) {
+	if to <= from {
+		return
+	}
+	silence := bytes.Repeat([]byte{alawSilence}, int(min(to-from, bytesPerSecond)))
+	for from < to {
+		chunk := silence[:min(to-from, int64(len(silence)))]
+		if _, err := f.WriteAt(chunk, from); err != nil {
+			log.Println("Error padding recording:", err)
+			return
+		}
+		from += int64(len(chunk))
+	}
+}
+
+// close flushes both tracks and returns the recording description
+func (r *Recorder) close() RecordingInfo {
+	r.Lock()
+	defer r.Unlock()
+	r.caller.Close()
+	r.assistant.Close()
+	return r.info
+}
+
+// recordCallerAudio decodes a media event payload for the consent buffer and recorder
+func (s *Session) recordCallerAudio(media map[string]interface{}, payload string) {
+	audio, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		log.Println("Error decoding media payload:", err)
+		return
+	}
+	timestamp, _ := media["timestamp"].(string)
+	ms, _ := strconv.ParseInt(timestamp, 10, 64)
+	s.callerQuality.addTimed(ms, audio)
+	s.captureCallerAudio(ms, audio)
+	s.feedVoiceprint(audio)
+}
+
+// recordAssistantAudio adds an audio delta from the model to quality scoring and the recording
+func (s *Session) recordAssistantAudio(delta string) {
+	audio, err := base64.StdEncoding.DecodeString(delta)
+	if err != nil {
+		log.Println("Error decoding audio delta:", err)
+		return
+	}
+	s.assistantQuality.add(audio)
+	s.Lock()
+	recorder := s.recorder
+	if s.migratedTo != "" {
+		// The resumed stream records from here on
+		recorder = nil
+	}
+	s.Unlock()
+	offset := int64(-1)
+	if recorder != nil {
+		offset = recorder.writeAssistant(audio)
+	}
+	s.assistantAudio(offset, len(audio))
+}
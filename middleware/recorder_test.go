@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestResumedRecordingKeepsEarlierAudio reopens a call's recording the way a
+// resumed stream does and checks the first stream's audio is still there
+func TestResumedRecordingKeepsEarlierAudio(t *testing.T) {
+	t.Setenv("DATA_DIR", t.TempDir())
+	started := time.Now()
+	first := bytes.Repeat([]byte{0x11}, 160)
+	second := bytes.Repeat([]byte{0x22}, 160)
+
+	r, err := newRecorder("CAresume", started, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.writeCaller(0, first)
+	r.writeCaller(20, first)
+	r.writeAssistant(first)
+	r.close()
+
+	// The resumed stream's timestamps start from zero again
+	r, err = newRecorder("CAresume", started, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.writeCaller(0, second)
+	r.writeAssistant(second)
+	info := r.close()
+
+	// Both tracks keep the first stream, silence pads the caller track up to
+	// the end of the assistant's reply, and the resumed stream follows
+	caller, err := os.ReadFile(info.CallerFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	silence := bytes.Repeat([]byte{alawSilence}, 160)
+	if want := join(first, first, silence, second); !bytes.Equal(caller, want) {
+		t.Fatalf("caller track has %d bytes, want %d with the first stream's audio first", len(caller), len(want))
+	}
+	assistant, err := os.ReadFile(info.AssistantFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := join(silence, silence, first, silence, second); !bytes.Equal(assistant, want) {
+		t.Fatalf("assistant track has %d bytes, want %d with the first stream's audio first", len(assistant), len(want))
+	}
+}
+
+// TestResumedRecordingStartsAfterHandoff checks a resumed stream starts
+// where the previous one reached even when the tracks on disk are shorter
+func TestResumedRecordingStartsAfterHandoff(t *testing.T) {
+	t.Setenv("DATA_DIR", t.TempDir())
+	audio := bytes.Repeat([]byte{0x33}, 160)
+	r, err := newRecorder("CAhandoff", time.Now(), 480)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.writeCaller(0, audio)
+	info := r.close()
+	caller, err := os.ReadFile(info.CallerFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := join(bytes.Repeat([]byte{alawSilence}, 480), audio); !bytes.Equal(caller, want) {
+		t.Fatalf("caller track has %d bytes, want %d starting after the handoff", len(caller), len(want))
+	}
+}
+
+// join concatenates audio chunks
+func join(chunks ...[]byte) []byte {
+	return bytes.Join(chunks, nil)
+}
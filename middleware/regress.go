@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegressFixture is a golden call: recorded caller audio, the mock model's
+// script and the outcome the call must produce
+type RegressFixture struct {
+	Name string `json:"name"`
+	SimScript
+
+	// Mock scripts the model when the fixture runs without -live
+	Mock []MockTurn `json:"mock"`
+
+	// Cassette replays a recorded OpenAI session instead of the mock script;
+	// without steps the caller audio is taken from the cassette too
+	Cassette string `json:"cassette,omitempty"`
+
+	Expect RegressExpect `json:"expect"`
+}
+
+// RegressExpect lists the assertions checked against a replayed call's CDR
+type RegressExpect struct {
+	// Transcript entries must appear in this order; other entries may sit between them
+	Transcript []ExpectedLine `json:"transcript"`
+
+	// ToolCalls must be made in this order; arguments are matched as a subset
+	ToolCalls []ExpectedToolCall `json:"tool_calls"`
+
+	Status      string `json:"status"`
+	Disposition string `json:"disposition"`
+}
+
+// ExpectedLine is an utterance the transcript must contain
+type ExpectedLine struct {
+	Speaker  string `json:"speaker"`
+	Contains string `json:"contains"`
+}
+
+// ExpectedToolCall is a tool call the assistant must make
+type ExpectedToolCall struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+}
+
+// runRegress implements the regress command: it replays every fixture through
+// an in-process server and reports how each call differs from its golden outcome
+func runRegress(args []string) int {
+	flags := flag.NewFlagSet("regress", flag.ExitOnError)
+	dir := flags.String("dir", "regress", "directory of fixture JSON files")
+	live := flags.Bool("live", false, "replay against the real OpenAI Realtime API instead of the mock")
+	only := flags.String("run", "", "only replay fixtures whose name contains this")
+	record := flags.Bool("record", false, "with -live, record each call into the fixture's cassette")
+	verbose := flags.Bool("v", false, "show server logs")
+	flags.Parse(args)
+	if *record && !*live {
+		fmt.Fprintln(os.Stderr, "regress: -record needs -live")
+		return 2
+	}
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+		accessLog.SetOutput(io.Discard)
+		gin.SetMode(gin.ReleaseMode)
+	}
+	fixtures, err := loadFixtures(*dir, *only)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "regress:", err)
+		return 2
+	}
+	if len(fixtures) == 0 {
+		fmt.Fprintln(os.Stderr, "regress: no fixtures in", *dir)
+		return 2
+	}
+
+	// Replayed calls must not touch the real call store or any live integration state
+	tmp, err := os.MkdirTemp("", "regress")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "regress:", err)
+		return 2
+	}
+	defer os.RemoveAll(tmp)
+	os.Setenv("DATA_DIR", tmp)
+	if os.Getenv("OPENAI_API_KEY") == "" {
+		if *live {
+			fmt.Fprintln(os.Stderr, "regress: -live needs OPENAI_API_KEY")
+			return 2
+		}
+		os.Setenv("OPENAI_API_KEY", "regress")
+	}
+	initialize()
+	recordCassettes = *record
+	server := httptest.NewServer(newRouter())
+	defer server.Close()
+	streamURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/media-stream"
+
+	failed := 0
+	for i, fixture := range fixtures {
+		started := time.Now()
+		diffs := runFixture(streamURL, fmt.Sprintf("CAregress%04d", i), fixture, *live, *record)
+		elapsed := time.Since(started).Round(time.Millisecond)
+		if len(diffs) == 0 {
+			fmt.Printf("ok   %s (%s)\n", fixture.Name, elapsed)
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL %s (%s)\n", fixture.Name, elapsed)
+		for _, diff := range diffs {
+			fmt.Println("    " + strings.ReplaceAll(diff, "\n", "\n    "))
+		}
+	}
+	fmt.Printf("%d/%d fixtures passed\n", len(fixtures)-failed, len(fixtures))
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// loadFixtures reads every fixture in dir, resolving audio paths relative to the fixture file
+func loadFixtures(dir, only string) ([]RegressFixture, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var fixtures []RegressFixture
+	for _, path := range paths {
+		if strings.HasSuffix(path, ".cassette.json") {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var fixture RegressFixture
+		if err := json.Unmarshal(data, &fixture); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if fixture.Name == "" {
+			fixture.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+		}
+		if only != "" && !strings.Contains(fixture.Name, only) {
+			continue
+		}
+		if fixture.From == "" {
+			fixture.From = "+15005550006"
+		}
+		if fixture.Cassette != "" && !filepath.IsAbs(fixture.Cassette) {
+			fixture.Cassette = filepath.Join(filepath.Dir(path), fixture.Cassette)
+		}
+		if fixture.Cassette == "" {
+			fixture.Cassette = strings.TrimSuffix(path, ".json") + ".cassette.json"
+		}
+		for i, step := range fixture.Steps {
+			if !filepath.IsAbs(step.AudioFile) {
+				fixture.Steps[i].AudioFile = filepath.Join(filepath.Dir(path), step.AudioFile)
+			}
+		}
+		fixtures = append(fixtures, fixture)
+	}
+	return fixtures, nil
+}
+
+// runFixture replays one fixture against the live API, its cassette or the mock script
+func runFixture(streamURL, callSid string, fixture RegressFixture, live, record bool) []string {
+	if live {
+		openAIRealtimeURL = getEnv("OPENAI_REALTIME_URL", OpenAIWebSocketURL)
+		diffs := replayFixture(streamURL, callSid, fixture)
+		if record {
+			data, err := os.ReadFile(dataPath("cassettes", callSid+".json"))
+			if err == nil {
+				err = os.WriteFile(fixture.Cassette, data, 0o644)
+			}
+			if err != nil {
+				diffs = append(diffs, "recording cassette: "+err.Error())
+			}
+		}
+		return diffs
+	}
+
+	var cassette *Cassette
+	if data, err := os.ReadFile(fixture.Cassette); err == nil {
+		cassette = &Cassette{}
+		if err := json.Unmarshal(data, cassette); err != nil {
+			return []string{fmt.Sprintf("%s: %v", fixture.Cassette, err)}
+		}
+	}
+	if cassette == nil {
+		mock := httptest.NewServer(mockRealtimeHandler(fixture.Mock))
+		defer mock.Close()
+		openAIRealtimeURL = "ws" + strings.TrimPrefix(mock.URL, "http")
+		return replayFixture(streamURL, callSid, fixture)
+	}
+
+	if len(fixture.Steps) == 0 {
+		fixture.Steps = []SimStep{{Audio: cassette.callerAudio(), WaitMs: 1000}}
+	}
+	replay := newCassetteReplay(cassette)
+	mock := httptest.NewServer(replay)
+	openAIRealtimeURL = "ws" + strings.TrimPrefix(mock.URL, "http")
+	diffs := replayFixture(streamURL, callSid, fixture)
+	mock.Close()
+	for _, divergence := range replay.Divergences() {
+		diffs = append(diffs, "cassette: "+divergence)
+	}
+	return diffs
+}
+
+// replayFixture places the fixture's call and diffs the stored CDR against its expectations
+func replayFixture(url, callSid string, fixture RegressFixture) []string {
+	if _, err := simulateCall(url, callSid, fixture.SimScript, nil); err != nil {
+		return []string{err.Error()}
+	}
+
+	// The CDR is written once the server finishes tearing the call down
+	record, ok := callStore.await(callSid, 10*time.Second)
+	if !ok {
+		return []string{"no call record was stored"}
+	}
+
+	var diffs []string
+	if fixture.Expect.Status != "" && record.Status != fixture.Expect.Status {
+		diffs = append(diffs, fmt.Sprintf("status: expected %q, got %q", fixture.Expect.Status, record.Status))
+	}
+	if fixture.Expect.Disposition != "" && record.Disposition != fixture.Expect.Disposition {
+		diffs = append(diffs, fmt.Sprintf("disposition: expected %q, got %q", fixture.Expect.Disposition, record.Disposition))
+	}
+	if diff := diffTranscript(fixture.Expect.Transcript, record.Transcript); diff != "" {
+		diffs = append(diffs, diff)
+	}
+	if diff := diffToolCalls(fixture.Expect.ToolCalls, record.ToolCalls); diff != "" {
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+// diffTranscript matches expected lines in order and renders a -/+ diff if any are missing
+func diffTranscript(expected []ExpectedLine, actual []TranscriptEntry) string {
+	next := 0
+	for _, entry := range actual {
+		if next < len(expected) && lineMatches(expected[next], entry) {
+			next++
+		}
+	}
+	if next == len(expected) {
+		return ""
+	}
+
+	var diff strings.Builder
+	diff.WriteString("transcript:")
+	for _, line := range expected {
+		fmt.Fprintf(&diff, "\n- %s: ...%s...", line.Speaker, line.Contains)
+	}
+	for _, entry := range actual {
+		fmt.Fprintf(&diff, "\n+ %s: %s", entry.Speaker, entry.Text)
+	}
+	return diff.String()
+}
+
+// lineMatches reports whether a transcript entry satisfies an expected line
+func lineMatches(line ExpectedLine, entry TranscriptEntry) bool {
+	if line.Speaker != "" && line.Speaker != entry.Speaker {
+		return false
+	}
+	return strings.Contains(strings.ToLower(entry.Text), strings.ToLower(line.Contains))
+}
+
+// diffToolCalls matches expected tool calls in order and renders a -/+ diff if any are missing
+func diffToolCalls(expected []ExpectedToolCall, actual []ToolCallRecord) string {
+	next := 0
+	for _, call := range actual {
+		if next < len(expected) && toolCallMatches(expected[next], call) {
+			next++
+		}
+	}
+	if next == len(expected) {
+		return ""
+	}
+
+	var diff strings.Builder
+	diff.WriteString("tool calls:")
+	for _, call := range expected {
+		args, _ := json.Marshal(call.Arguments)
+		fmt.Fprintf(&diff, "\n- %s %s", call.Name, args)
+	}
+	for _, call := range actual {
+		fmt.Fprintf(&diff, "\n+ %s %s", call.Name, call.Arguments)
+	}
+	return diff.String()
+}
+
+// toolCallMatches reports whether a recorded call has the expected name and arguments
+func toolCallMatches(expected ExpectedToolCall, call ToolCallRecord) bool {
+	if expected.Name != call.Name {
+		return false
+	}
+	var args map[string]interface{}
+	json.Unmarshal(call.Arguments, &args)
+	for key, want := range expected.Arguments {
+		if !reflect.DeepEqual(args[key], want) {
+			return false
+		}
+	}
+	return true
+}
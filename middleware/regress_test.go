@@ -0,0 +1,14 @@
+package main
+
+import "testing"
+
+// TestRegressFixtures replays the fixtures in regress/ against the mock model
+func TestRegressFixtures(t *testing.T) {
+	if testing.Short() {
+		t.Skip("fixtures are replayed in real time")
+	}
+	t.Setenv("OPENAI_API_KEY", "regress")
+	if code := runRegress([]string{"-dir", "regress"}); code != 0 {
+		t.Fatalf("regress exited with status %d", code)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CallSummaryReport aggregates stored calls for the reporting API
+type CallSummaryReport struct {
+	TotalCalls      int            `json:"total_calls"`
+	ContainedCalls  int            `json:"contained_calls"`
+	ContainmentRate float64        `json:"containment_rate"`
+	AvgDurationSec  float64        `json:"avg_duration_sec"`
+	TotalCost       float64        `json:"total_cost_usd"`
+	ByStatus        map[string]int `json:"by_status"`
+	ByIntent        map[string]int `json:"by_intent"`
+	ByDisposition   map[string]int `json:"by_disposition"`
+	ByModel         map[string]int `json:"by_model"`
+
+	// DowngradedCalls ran on a cheaper model because their agent was over budget
+	DowngradedCalls int `json:"downgraded_calls"`
+
+	// QA review coverage and scores from the review queue
+	QASampled  int                `json:"qa_sampled"`
+	QAReviewed int                `json:"qa_reviewed"`
+	AvgQAScore float64            `json:"avg_qa_score"`
+	QAByAgent  map[string]float64 `json:"avg_qa_score_by_agent"`
+
+	// Automatic rubric scores: overall and per criterion, 0-100
+	RubricScored   int                `json:"rubric_scored"`
+	AvgRubricScore float64            `json:"avg_rubric_score"`
+	RubricCriteria map[string]float64 `json:"avg_rubric_criteria"`
+}
+
+// summarizeCalls builds containment and intent breakdowns over the records
+func summarizeCalls(records []CallRecord) CallSummaryReport {
+	report := CallSummaryReport{
+		ByStatus:       make(map[string]int),
+		ByIntent:       make(map[string]int),
+		ByDisposition:  make(map[string]int),
+		ByModel:        make(map[string]int),
+		QAByAgent:      make(map[string]float64),
+		RubricCriteria: make(map[string]float64),
+	}
+	var rubricTotal float64
+	criterionTotals := make(map[string]float64)
+	criterionCounts := make(map[string]int)
+	var totalDuration float64
+	var qaTotal float64
+	qaAgentTotals := make(map[string]float64)
+	qaAgentCounts := make(map[string]int)
+	for _, r := range records {
+		report.TotalCalls++
+		report.ByStatus[r.Status]++
+		if r.Intent != "" {
+			report.ByIntent[r.Intent]++
+		}
+		if r.Disposition != "" {
+			report.ByDisposition[r.Disposition]++
+		}
+		if r.Model != "" {
+			report.ByModel[r.Model]++
+		}
+		if r.Downgrade != "" {
+			report.DowngradedCalls++
+		}
+		if r.Contained {
+			report.ContainedCalls++
+		}
+		totalDuration += r.DurationSec
+		report.TotalCost += r.Cost
+		if r.Review != nil {
+			report.QASampled++
+			if r.Review.Status == ReviewCompleted && r.Review.Score != nil {
+				report.QAReviewed++
+				qaTotal += *r.Review.Score
+				qaAgentTotals[r.Agent] += *r.Review.Score
+				qaAgentCounts[r.Agent]++
+			}
+		}
+		if r.Rubric != nil {
+			report.RubricScored++
+			rubricTotal += r.Rubric.Score
+			for _, c := range r.Rubric.Criteria {
+				if c.Applicable {
+					criterionTotals[c.ID] += 100 * c.Score
+					criterionCounts[c.ID]++
+				}
+			}
+		}
+	}
+	if report.RubricScored > 0 {
+		report.AvgRubricScore = rubricTotal / float64(report.RubricScored)
+	}
+	for id, total := range criterionTotals {
+		report.RubricCriteria[id] = total / float64(criterionCounts[id])
+	}
+	if report.QAReviewed > 0 {
+		report.AvgQAScore = qaTotal / float64(report.QAReviewed)
+	}
+	for agent, total := range qaAgentTotals {
+		report.QAByAgent[agent] = total / float64(qaAgentCounts[agent])
+	}
+	if report.TotalCalls > 0 {
+		report.ContainmentRate = float64(report.ContainedCalls) / float64(report.TotalCalls)
+		report.AvgDurationSec = totalDuration / float64(report.TotalCalls)
+	}
+	return report
+}
+
+// handleCallSummaryReport serves GET /admin/reports/summary
+func handleCallSummaryReport(c *gin.Context) {
+	filter, err := callFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, summarizeCalls(callStore.list(filter)))
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Region pins where a tenant's calls are processed and stored: the provider
+// endpoints its audio and transcripts are sent to and the bucket its exports
+// land in. Calls are only bridged by instances deployed in the region
+type Region struct {
+	Name string `json:"name"`
+
+	// RealtimeURL, ChatURL and SpeechURL replace the global OpenAI
+	// endpoints, e.g. with a regional data residency endpoint; APIKey
+	// replaces OPENAI_API_KEY for projects created in that region
+	RealtimeURL string `json:"realtime_url,omitempty"`
+	ChatURL     string `json:"chat_url,omitempty"`
+	SpeechURL   string `json:"speech_url,omitempty"`
+	APIKey      string `json:"api_key,omitempty"`
+
+	// Storage is the bucket exports of the region's tenants are written to;
+	// credentials come from the environment
+	Storage *S3Config `json:"storage,omitempty"`
+
+	// HealthURL is probed periodically; the region is unavailable while the
+	// probe fails
+	HealthURL string `json:"health_url,omitempty"`
+}
+
+// regionHealth is a region's current availability
+type regionHealth struct {
+	healthy   bool
+	disabled  bool
+	checkedAt time.Time
+	lastError string
+}
+
+// Residency resolves tenants to their regions and tracks region availability
+type Residency struct {
+	sync.Mutex
+	local   string
+	regions map[string]*Region
+	health  map[string]*regionHealth
+	message string
+}
+
+// loadResidency reads regions from REGIONS_FILE; DEPLOYMENT_REGION names the
+// region this instance and its DATA_DIR run in
+func loadResidency() *Residency {
+	r := &Residency{
+		local:   getEnv("DEPLOYMENT_REGION", ""),
+		regions: make(map[string]*Region),
+		health:  make(map[string]*regionHealth),
+		message: getEnv("REGION_UNAVAILABLE_MESSAGE", "We're sorry, we can't take your call right now. Please try again later."),
+	}
+	var list []*Region
+	if _, err := loadJSONFile("REGIONS_FILE", &list); err != nil {
+		log.Println("Error loading REGIONS_FILE:", err)
+	}
+	for _, region := range list {
+		if region.Name == "" {
+			log.Println("Skipping region without name")
+			continue
+		}
+		r.regions[region.Name] = region
+		r.health[region.Name] = &regionHealth{healthy: true}
+	}
+	if len(r.regions) > 0 {
+		log.Printf("Loaded %d region(s); this instance runs in %q\n", len(r.regions), r.local)
+		go r.probeLoop(getEnvDuration("REGION_HEALTH_INTERVAL", 30*time.Second))
+	}
+	return r
+}
+
+// regionFor returns the region a tenant is pinned to, nil when it is not
+// pinned, or an error when its calls cannot be processed here right now
+func (r *Residency) regionFor(tenant *Tenant) (*Region, error) {
+	if tenant == nil || tenant.Region == "" {
+		return nil, nil
+	}
+	r.Lock()
+	defer r.Unlock()
+	region, ok := r.regions[tenant.Region]
+	if !ok {
+		return nil, fmt.Errorf("tenant %s is pinned to unknown region %q", tenant.ID, tenant.Region)
+	}
+	if region.Name != r.local {
+		return nil, fmt.Errorf("tenant %s is pinned to region %s but this instance runs in %q", tenant.ID, region.Name, r.local)
+	}
+	health := r.health[region.Name]
+	if health.disabled {
+		return nil, fmt.Errorf("region %s is disabled", region.Name)
+	}
+	if !health.healthy {
+		return nil, fmt.Errorf("region %s is unhealthy: %s", region.Name, health.lastError)
+	}
+	return region, nil
+}
+
+// probeLoop checks each region's health endpoint
+func (r *Residency) probeLoop(interval time.Duration) {
+	for {
+		r.Lock()
+		var probes []*Region
+		for _, region := range r.regions {
+			if region.HealthURL != "" {
+				probes = append(probes, region)
+			}
+		}
+		r.Unlock()
+		for _, region := range probes {
+			err := probeRegion(region.HealthURL)
+			r.Lock()
+			health := r.health[region.Name]
+			if err != nil && health.healthy {
+				log.Printf("Region %s became unavailable: %v\n", region.Name, err)
+			} else if err == nil && !health.healthy {
+				log.Printf("Region %s is available again\n", region.Name)
+			}
+			health.healthy = err == nil
+			health.checkedAt = time.Now().UTC()
+			health.lastError = ""
+			if err != nil {
+				health.lastError = err.Error()
+			}
+			r.Unlock()
+		}
+		time.Sleep(interval)
+	}
+}
+
+// probeRegion expects a 2xx answer from a health endpoint
+func probeRegion(url string) error {
+	resp, err := outboundClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return newStatusError("GET "+url, resp)
+	}
+	return nil
+}
+
+// unavailableTwiML turns away a call that cannot be processed in its region
+func (r *Residency) unavailableTwiML(locale Locale) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<Response>
+    <Say` + locale.sayAttributes() + `>` + html.EscapeString(r.message) + `</Say>
+    <Hangup/>
+</Response>`
+}
+
+// region returns a region's configuration by name, whatever its availability
+func (r *Residency) region(name string) *Region {
+	r.Lock()
+	defer r.Unlock()
+	return r.regions[name]
+}
+
+// realtimeURL returns the Realtime API endpoint for calls in the region; the
+// sandbox's mock model serves every region
+func (region *Region) realtimeURL() string {
+	if region == nil || region.RealtimeURL == "" || sandbox != nil {
+		return openAIRealtimeURL
+	}
+	return region.RealtimeURL
+}
+
+// chatURL returns the chat completions endpoint for the region
+func (region *Region) chatURL() string {
+	if region == nil || region.ChatURL == "" {
+		return openAIChatURL
+	}
+	return region.ChatURL
+}
+
+// speechURL returns the text to speech endpoint for the region
+func (region *Region) speechURL() string {
+	if region == nil || region.SpeechURL == "" {
+		return getEnv("OPENAI_SPEECH_URL", openAISpeechURL)
+	}
+	return region.SpeechURL
+}
+
+// apiKey returns the OpenAI key for the region
+func (region *Region) apiKey() string {
+	if region == nil || region.APIKey == "" {
+		return openAIAPIKey
+	}
+	return region.APIKey
+}
+
+// storage returns the export bucket for the region, falling back to the
+// global export bucket for tenants that are not pinned
+func (region *Region) storage() (S3Config, bool) {
+	if region == nil {
+		return loadS3Config()
+	}
+	if region.Storage == nil {
+		return S3Config{}, false
+	}
+	cfg := *region.Storage
+	cfg.AccessKey = getEnv("AWS_ACCESS_KEY_ID", "")
+	cfg.SecretKey = getEnv("AWS_SECRET_ACCESS_KEY", "")
+	return cfg, cfg.Bucket != "" && cfg.AccessKey != "" && cfg.SecretKey != ""
+}
+
+// pinnedTenants returns the IDs of tenants pinned to any region
+func pinnedTenants() map[string]bool {
+	tenants.RLock()
+	defer tenants.RUnlock()
+	pinned := make(map[string]bool)
+	for id, tenant := range tenants.tenants {
+		if tenant.Region != "" {
+			pinned[id] = true
+		}
+	}
+	return pinned
+}
+
+// RegionStatus is one region in GET /admin/regions
+type RegionStatus struct {
+	Name      string    `json:"name"`
+	Local     bool      `json:"local"`
+	Available bool      `json:"available"`
+	Disabled  bool      `json:"disabled"`
+	CheckedAt time.Time `json:"checked_at,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Tenants   []string  `json:"tenants"`
+}
+
+// handleRegionStatus serves GET /admin/regions
+func handleRegionStatus(c *gin.Context) {
+	byRegion := make(map[string][]string)
+	tenants.RLock()
+	for id, tenant := range tenants.tenants {
+		if tenant.Region != "" {
+			byRegion[tenant.Region] = append(byRegion[tenant.Region], id)
+		}
+	}
+	tenants.RUnlock()
+
+	residency.Lock()
+	statuses := []RegionStatus{}
+	for name, health := range residency.health {
+		status := RegionStatus{
+			Name:      name,
+			Local:     name == residency.local,
+			Available: name == residency.local && health.healthy && !health.disabled,
+			Disabled:  health.disabled,
+			CheckedAt: health.checkedAt,
+			Error:     health.lastError,
+			Tenants:   byRegion[name],
+		}
+		if status.Tenants == nil {
+			status.Tenants = []string{}
+		}
+		sort.Strings(status.Tenants)
+		statuses = append(statuses, status)
+	}
+	local := residency.local
+	residency.Unlock()
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	c.JSON(http.StatusOK, gin.H{"deployment_region": local, "regions": statuses})
+}
+
+// handlePutRegion serves PUT /admin/regions/:name, letting operators take a
+// region out of service so its tenants' calls are refused
+func handlePutRegion(c *gin.Context) {
+	var body struct {
+		Available *bool `json:"available" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := strings.TrimSpace(c.Param("name"))
+	residency.Lock()
+	health, ok := residency.health[name]
+	if ok {
+		health.disabled = !*body.Available
+	}
+	residency.Unlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "region not found"})
+		return
+	}
+	log.Printf("Region %s marked available=%t by operator\n", name, *body.Available)
+	c.JSON(http.StatusOK, gin.H{"name": name, "available": *body.Available})
+}
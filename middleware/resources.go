@@ -0,0 +1,232 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sessionResources counts what a session consumes. Go cannot attribute heap
+// or CPU to a goroutine, so memory is estimated from the session's own
+// buffers and CPU is the time its loops spend handling messages
+type sessionResources struct {
+	goroutines   atomic.Int64
+	pendingTools atomic.Int64
+	busyNanos    atomic.Int64
+	messagesIn   atomic.Int64
+	messagesOut  atomic.Int64
+	bytesIn      atomic.Int64
+	bytesOut     atomic.Int64
+}
+
+// SessionUsage is one session's row in the resource report
+type SessionUsage struct {
+	CallSid      string  `json:"call_sid"`
+	Tenant       string  `json:"tenant"`
+	Agent        string  `json:"agent"`
+	AgeSec       float64 `json:"age_sec"`
+	MemoryBytes  int     `json:"memory_bytes"`
+	CPUMs        int64   `json:"cpu_ms"`
+	CPUPercent   float64 `json:"cpu_percent"`
+	Goroutines   int64   `json:"goroutines"`
+	PendingTools int64   `json:"pending_tools"`
+	MessagesIn   int64   `json:"messages_in"`
+	MessagesOut  int64   `json:"messages_out"`
+	BytesIn      int64   `json:"bytes_in"`
+	BytesOut     int64   `json:"bytes_out"`
+}
+
+// spawn runs fn on a goroutine counted against the session
+func (s *Session) spawn(fn func()) {
+	s.res.goroutines.Add(1)
+	go func() {
+		defer s.res.goroutines.Add(-1)
+		fn()
+	}()
+}
+
+// received and sent count traffic through the session's connections
+func (s *Session) received(message []byte) {
+	s.res.messagesIn.Add(1)
+	s.res.bytesIn.Add(int64(len(message)))
+}
+
+func (s *Session) sent(message []byte) {
+	s.res.messagesOut.Add(1)
+	s.res.bytesOut.Add(int64(len(message)))
+}
+
+// busyTimer measures the time a read loop spends between reads
+type busyTimer struct {
+	res   *sessionResources
+	since time.Time
+}
+
+// idle stops the clock before the loop blocks on the next read
+func (t *busyTimer) idle() {
+	if !t.since.IsZero() {
+		t.res.busyNanos.Add(int64(time.Since(t.since)))
+	}
+}
+
+// busy starts the clock once a message has arrived
+func (t *busyTimer) busy() {
+	t.since = time.Now()
+}
+
+// memoryEstimate sums the sizes of the buffers the session holds; the
+// caller holds the session lock
+func (s *Session) memoryEstimate() int {
+	total := cap(s.audioRing)
+	for _, entry := range s.transcript {
+		total += len(entry.Text) + 64
+	}
+	for _, turn := range s.turnLog.turns {
+		total += len(turn.Transcript) + 128
+	}
+	for _, call := range s.toolCalls {
+		total += len(call.Arguments) + len(call.Error) + 64
+	}
+	if trace := s.trace.Load(); trace != nil {
+		trace.Lock()
+		total += len(trace.spans) * 160
+		trace.Unlock()
+	}
+	if s.whisper != nil {
+		s.whisper.Lock()
+		for _, line := range s.whisper.lines {
+			total += len(line) + 16
+		}
+		s.whisper.Unlock()
+	}
+	if s.cassette != nil {
+		s.cassette.Lock()
+		for _, e := range s.cassette.events {
+			total += len(e.Event) + 48
+		}
+		s.cassette.Unlock()
+	}
+	return total
+}
+
+// usageReport returns the session's current resource usage
+func (s *Session) usageReport() SessionUsage {
+	s.Lock()
+	usage := SessionUsage{
+		CallSid:     s.callSid,
+		Tenant:      s.tenant.ID,
+		Agent:       s.agent.ID,
+		AgeSec:      time.Since(s.startedAt).Seconds(),
+		MemoryBytes: s.memoryEstimate(),
+	}
+	s.Unlock()
+	busy := time.Duration(s.res.busyNanos.Load())
+	usage.CPUMs = busy.Milliseconds()
+	if usage.AgeSec > 0 {
+		usage.CPUPercent = 100 * busy.Seconds() / usage.AgeSec
+	}
+	usage.Goroutines = s.res.goroutines.Load()
+	usage.PendingTools = s.res.pendingTools.Load()
+	usage.MessagesIn = s.res.messagesIn.Load()
+	usage.MessagesOut = s.res.messagesOut.Load()
+	usage.BytesIn = s.res.bytesIn.Load()
+	usage.BytesOut = s.res.bytesOut.Load()
+	return usage
+}
+
+// kill closes both of a session's connections; the call ends as if the
+// caller had hung up
+func (s *Session) kill() {
+	s.Lock()
+	s.killed = true
+	callSid := s.callSid
+	s.Unlock()
+	// A killed call hangs up rather than reconnecting to a new stream
+	ha.forget(callSid)
+	s.clientConn.Close()
+	s.openAIConn.Close()
+}
+
+// wasKilled reports whether an operator terminated the call
+func (s *Session) wasKilled() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.killed
+}
+
+// findSession returns the live session for a call on this instance
+func (f *Fleet) findSession(callSid string) *Session {
+	f.Lock()
+	defer f.Unlock()
+	for s := range f.sessions {
+		s.Lock()
+		match := s.callSid == callSid
+		s.Unlock()
+		if match {
+			return s
+		}
+	}
+	return nil
+}
+
+// handleSessionUsage serves GET /admin/sessions: the top consumers by the
+// sort key (memory, cpu, goroutines, bytes or age)
+func handleSessionUsage(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		return
+	}
+	keys := map[string]func(SessionUsage) float64{
+		"memory":     func(u SessionUsage) float64 { return float64(u.MemoryBytes) },
+		"cpu":        func(u SessionUsage) float64 { return u.CPUPercent },
+		"goroutines": func(u SessionUsage) float64 { return float64(u.Goroutines) },
+		"bytes":      func(u SessionUsage) float64 { return float64(u.BytesIn + u.BytesOut) },
+		"age":        func(u SessionUsage) float64 { return u.AgeSec },
+	}
+	sortBy := c.DefaultQuery("sort", "memory")
+	key, ok := keys[sortBy]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be memory, cpu, goroutines, bytes or age"})
+		return
+	}
+
+	sessions := fleet.liveSessions()
+	usages := make([]SessionUsage, 0, len(sessions))
+	for _, s := range sessions {
+		usages = append(usages, s.usageReport())
+	}
+	sort.Slice(usages, func(i, j int) bool { return key(usages[i]) > key(usages[j]) })
+	total := len(usages)
+	if len(usages) > limit {
+		usages = usages[:limit]
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	c.JSON(http.StatusOK, gin.H{
+		"process": gin.H{
+			"goroutines": runtime.NumGoroutine(),
+			"heap_bytes": mem.HeapAlloc,
+			"sessions":   total,
+		},
+		"sessions": usages,
+	})
+}
+
+// handleKillSession serves DELETE /admin/sessions/:id
+func handleKillSession(c *gin.Context) {
+	s := fleet.findSession(c.Param("id"))
+	if s == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no live session for that call on this instance"})
+		return
+	}
+	usage := s.usageReport()
+	s.kill()
+	c.JSON(http.StatusOK, gin.H{"killed": usage})
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Categories of restricted numbers
+const (
+	RestrictedEmergency = "emergency"
+	RestrictedPremium   = "premium"
+	RestrictedBlocked   = "blocked"
+)
+
+// AlertRestrictedNumber is raised when a call touches a restricted number
+const AlertRestrictedNumber = "restricted_number"
+
+// defaultEmergencyNotice is played when a call arrives from or for an emergency number
+const defaultEmergencyNotice = "This automated line cannot handle emergencies. Please hang up and dial your local emergency number directly."
+
+// RestrictedRule matches numbers either exactly (short codes) or by E.164 prefix
+type RestrictedRule struct {
+	Number   string `json:"number,omitempty"`
+	Prefix   string `json:"prefix,omitempty"`
+	Category string `json:"category"`
+}
+
+// defaultRestrictedRules covers common emergency short codes and premium-rate ranges
+var defaultRestrictedRules = []RestrictedRule{
+	{Number: "911", Category: RestrictedEmergency},
+	{Number: "112", Category: RestrictedEmergency},
+	{Number: "999", Category: RestrictedEmergency},
+	{Number: "000", Category: RestrictedEmergency},
+	{Number: "110", Category: RestrictedEmergency},
+	{Number: "119", Category: RestrictedEmergency},
+	{Number: "061", Category: RestrictedEmergency},
+	{Number: "062", Category: RestrictedEmergency},
+	{Number: "091", Category: RestrictedEmergency},
+	{Number: "15", Category: RestrictedEmergency},
+	{Number: "17", Category: RestrictedEmergency},
+	{Number: "18", Category: RestrictedEmergency},
+	{Prefix: "+1900", Category: RestrictedPremium},
+	{Prefix: "+1976", Category: RestrictedPremium},
+	{Prefix: "+449", Category: RestrictedPremium},
+	{Prefix: "+34803", Category: RestrictedPremium},
+	{Prefix: "+34806", Category: RestrictedPremium},
+	{Prefix: "+34807", Category: RestrictedPremium},
+	{Prefix: "+34905", Category: RestrictedPremium},
+	{Prefix: "+3389", Category: RestrictedPremium},
+	{Prefix: "+49900", Category: RestrictedPremium},
+	{Prefix: "+39899", Category: RestrictedPremium},
+}
+
+// RestrictedList is the set of destinations calls must never reach
+type RestrictedList struct {
+	rules  []RestrictedRule
+	notice string
+}
+
+// loadRestrictedList combines the defaults with RESTRICTED_NUMBERS_FILE
+func loadRestrictedList() *RestrictedList {
+	l := &RestrictedList{
+		rules:  append([]RestrictedRule(nil), defaultRestrictedRules...),
+		notice: getEnv("EMERGENCY_NOTICE", defaultEmergencyNotice),
+	}
+	var extra []RestrictedRule
+	if _, err := loadJSONFile("RESTRICTED_NUMBERS_FILE", &extra); err != nil {
+		log.Println("Error loading RESTRICTED_NUMBERS_FILE:", err)
+	}
+	l.rules = append(l.rules, extra...)
+	return l
+}
+
+// match returns the rule a number falls under, if any
+func (l *RestrictedList) match(number string) (RestrictedRule, bool) {
+	// Short codes do not parse and are matched as dialed
+	cleaned := strings.Map(func(r rune) rune {
+		if r == '+' || (r >= '0' && r <= '9') {
+			return r
+		}
+		return -1
+	}, normalizeNumber(number))
+	if cleaned == "" {
+		return RestrictedRule{}, false
+	}
+	for _, rule := range l.rules {
+		if rule.Number != "" && strings.TrimPrefix(cleaned, "+") == rule.Number {
+			return rule, true
+		}
+		if rule.Prefix != "" && strings.HasPrefix(cleaned, rule.Prefix) {
+			return rule, true
+		}
+	}
+	return RestrictedRule{}, false
+}
+
+// checkInbound reports whether a call was dialed to or forwarded from an
+// emergency number, alerting operators when it was
+func (l *RestrictedList) checkInbound(to, forwardedFrom, callSid string) bool {
+	for _, number := range []string{to, forwardedFrom} {
+		rule, ok := l.match(number)
+		if !ok || rule.Category != RestrictedEmergency {
+			continue
+		}
+		alerts.raise(Alert{
+			Kind:     AlertRestrictedNumber,
+			Severity: "critical",
+			Message:  fmt.Sprintf("Call %s reached the assistant via emergency number %s", callSid, number),
+			CallSid:  callSid,
+			// Every emergency call alerts, however close to the last one
+			Subject: "inbound:" + callSid + ":" + number,
+		})
+		return true
+	}
+	return false
+}
+
+// transfer moves the caller to number unless the destination is restricted.
+// The number is checked as dialed first, since emergency short codes do not
+// parse as E.164, then again in its E.164 form for prefix rules
+func (s *Session) transfer(number string) error {
+	if err := s.refuseRestricted(number); err != nil {
+		return err
+	}
+	parsed, err := validateDestination(number)
+	if err != nil {
+		return err
+	}
+	number = parsed.E164
+	if err := s.refuseRestricted(number); err != nil {
+		return err
+	}
+	if err := transferCall(s.callSid, number); err != nil {
+		return err
+	}
+	s.Lock()
+	s.transferred = true
+	s.Unlock()
+	return nil
+}
+
+// refuseRestricted alerts and returns an error when a transfer destination
+// is restricted
+func (s *Session) refuseRestricted(number string) error {
+	rule, ok := restrictedNumbers.match(number)
+	if !ok {
+		return nil
+	}
+	alerts.raise(Alert{
+		Kind:     AlertRestrictedNumber,
+		Severity: "warning",
+		Message:  fmt.Sprintf("Refused transfer of call %s to %s number %s", s.callSid, rule.Category, number),
+		CallSid:  s.callSid,
+		Subject:  "transfer:" + s.callSid + ":" + number,
+	})
+	return fmt.Errorf("transfers to %s numbers are not allowed", rule.Category)
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AlertRollback is raised when a rollout is rolled back on a quality regression
+const AlertRollback = "rollout_rolled_back"
+
+// Rollout statuses
+const (
+	RolloutActive     = "active"
+	RolloutPromoted   = "promoted"
+	RolloutRolledBack = "rolled_back"
+)
+
+// RolloutThresholds bound how much worse the candidate may do than the
+// stable agent over the window; a zero threshold skips its check, and a
+// rollout must set at least one so it can roll back on its own
+type RolloutThresholds struct {
+	// MaxTransferRateIncrease and MaxErrorRateIncrease are fractions of calls,
+	// 0.05 allowing five more transfers or failures per hundred calls
+	MaxTransferRateIncrease float64 `json:"max_transfer_rate_increase,omitempty"`
+	MaxErrorRateIncrease    float64 `json:"max_error_rate_increase,omitempty"`
+	MaxCSATDrop             float64 `json:"max_csat_drop,omitempty"`
+	MaxAvgTurnsIncrease     float64 `json:"max_avg_turns_increase,omitempty"`
+}
+
+// Rollout sends a percentage of an agent's callers to a candidate version of
+// it. While active, calls on both arms are tagged with the rollout and
+// compared; a promoted rollout sends every caller to the candidate until it
+// is deleted
+type Rollout struct {
+	ID         string `json:"id"`
+	Agent      string `json:"agent"`
+	Candidate  string `json:"candidate"`
+	Percentage int    `json:"percentage"`
+
+	// WindowMinutes is how far back calls are compared, and MinCalls how many
+	// each arm needs in the window before the thresholds are checked
+	WindowMinutes int               `json:"window_minutes,omitempty"`
+	MinCalls      int               `json:"min_calls,omitempty"`
+	Thresholds    RolloutThresholds `json:"thresholds"`
+
+	Status    string     `json:"status"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+}
+
+// RolloutMetrics summarizes one arm's calls in the window
+type RolloutMetrics struct {
+	Calls        int      `json:"calls"`
+	TransferRate float64  `json:"transfer_rate"`
+	ErrorRate    float64  `json:"error_rate"`
+	AvgTurns     float64  `json:"avg_turns"`
+	Rated        int      `json:"rated"`
+	CSAT         *float64 `json:"csat,omitempty"`
+}
+
+// RolloutStatus is a rollout with its arms' metrics, as the API returns it
+type RolloutStatus struct {
+	Rollout
+	BaselineMetrics  RolloutMetrics `json:"baseline_metrics"`
+	CandidateMetrics RolloutMetrics `json:"candidate_metrics"`
+}
+
+// Rollouts holds the agent rollouts; changes are saved to DATA_DIR
+type Rollouts struct {
+	sync.RWMutex
+	path     string
+	rollouts map[string]Rollout
+}
+
+// loadRollouts reads the saved rollouts and starts checking the active ones
+func loadRollouts() *Rollouts {
+	r := &Rollouts{path: dataPath("rollouts.json"), rollouts: make(map[string]Rollout)}
+	var saved []Rollout
+	if err := readJSONFile(r.path, &saved); err != nil {
+		log.Println("Error loading saved rollouts:", err)
+	}
+	for _, rollout := range saved {
+		r.rollouts[rollout.ID] = rollout
+	}
+	go r.checkLoop(getEnvDuration("ROLLOUT_CHECK_INTERVAL", time.Minute))
+	return r
+}
+
+// route returns the agent a caller gets under the agent's rollout, and the
+// ID of the active rollout the call counts toward
+func (r *Rollouts) route(agent *Agent, caller string) (*Agent, string) {
+	r.RLock()
+	defer r.RUnlock()
+	for _, rollout := range r.rollouts {
+		if rollout.Agent != agent.ID || !agents.exists(rollout.Candidate) {
+			continue
+		}
+		switch rollout.Status {
+		case RolloutPromoted:
+			return agents.get(rollout.Candidate), ""
+		case RolloutActive:
+			if rolloutBucket(rollout.ID, caller) < rollout.Percentage {
+				return agents.get(rollout.Candidate), rollout.ID
+			}
+			return agent, rollout.ID
+		}
+	}
+	return agent, ""
+}
+
+// get returns a rollout by ID
+func (r *Rollouts) get(id string) (Rollout, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	rollout, ok := r.rollouts[id]
+	return rollout, ok
+}
+
+// list returns the rollouts sorted by ID
+func (r *Rollouts) list() []Rollout {
+	r.RLock()
+	defer r.RUnlock()
+	list := make([]Rollout, 0, len(r.rollouts))
+	for _, rollout := range r.rollouts {
+		list = append(list, rollout)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// put creates or replaces a rollout and saves the set; a rollout whose agents
+// change, or that had ended, starts over
+func (r *Rollouts) put(rollout Rollout) (string, error) {
+	r.Lock()
+	for _, other := range r.rollouts {
+		if other.ID != rollout.ID && other.Agent == rollout.Agent && other.Status != RolloutRolledBack {
+			r.Unlock()
+			return "", fmt.Errorf("agent %s is already in rollout %s", rollout.Agent, other.ID)
+		}
+	}
+	current, ok := r.rollouts[rollout.ID]
+	action := ChangeCreated
+	if ok {
+		action = ChangeUpdated
+	}
+	rollout.Status, rollout.StartedAt = RolloutActive, time.Now().UTC()
+	if ok && current.Status == RolloutActive && current.Agent == rollout.Agent && current.Candidate == rollout.Candidate {
+		rollout.StartedAt = current.StartedAt
+	}
+	r.rollouts[rollout.ID] = rollout
+	r.Unlock()
+	return action, writeJSONFile(r.path, r.list())
+}
+
+// remove deletes a rollout and saves the set
+func (r *Rollouts) remove(id string) (bool, error) {
+	r.Lock()
+	_, ok := r.rollouts[id]
+	delete(r.rollouts, id)
+	r.Unlock()
+	if !ok {
+		return false, nil
+	}
+	return true, writeJSONFile(r.path, r.list())
+}
+
+// finish ends an active rollout as promoted or rolled back
+func (r *Rollouts) finish(id, status, reason string) (Rollout, error) {
+	r.Lock()
+	rollout, ok := r.rollouts[id]
+	if !ok {
+		r.Unlock()
+		return Rollout{}, fmt.Errorf("rollout not found")
+	}
+	if rollout.Status != RolloutActive {
+		r.Unlock()
+		return rollout, fmt.Errorf("rollout is already %s", rollout.Status)
+	}
+	now := time.Now().UTC()
+	rollout.Status, rollout.EndedAt, rollout.Reason = status, &now, reason
+	r.rollouts[id] = rollout
+	r.Unlock()
+	return rollout, writeJSONFile(r.path, r.list())
+}
+
+// usedBy returns the rollouts that route to or from an agent
+func (r *Rollouts) usedBy(agentID string) []string {
+	var ids []string
+	for _, rollout := range r.list() {
+		if rollout.Status != RolloutRolledBack && (rollout.Agent == agentID || rollout.Candidate == agentID) {
+			ids = append(ids, rollout.ID)
+		}
+	}
+	return ids
+}
+
+// window returns when the rollout's comparison window starts
+func (rollout Rollout) window() time.Time {
+	minutes := rollout.WindowMinutes
+	if minutes <= 0 {
+		minutes = 60
+	}
+	since := time.Now().Add(-time.Duration(minutes) * time.Minute)
+	if rollout.StartedAt.After(since) {
+		return rollout.StartedAt
+	}
+	return since
+}
+
+// status returns the rollout with its arms' metrics over the window
+func (rollout Rollout) status() RolloutStatus {
+	var baseline, candidate []CallRecord
+	for _, record := range callStore.list(CallFilter{From: rollout.window()}) {
+		if record.Rollout != rollout.ID || record.Canary {
+			continue
+		}
+		if record.Agent == rollout.Candidate {
+			candidate = append(candidate, record)
+		} else {
+			baseline = append(baseline, record)
+		}
+	}
+	return RolloutStatus{
+		Rollout:          rollout,
+		BaselineMetrics:  rolloutMetrics(baseline),
+		CandidateMetrics: rolloutMetrics(candidate),
+	}
+}
+
+// rolloutMetrics summarizes an arm's calls
+func rolloutMetrics(records []CallRecord) RolloutMetrics {
+	m := RolloutMetrics{Calls: len(records)}
+	if m.Calls == 0 {
+		return m
+	}
+	transfers, failures, turns, csat := 0, 0, 0, 0.0
+	for _, record := range records {
+		if record.Transferred {
+			transfers++
+		}
+		if record.Status == CallFailed {
+			failures++
+		}
+		for _, turn := range record.Turns {
+			if turn.Speaker == SpeakerCaller {
+				turns++
+			}
+		}
+		if record.CSAT != nil {
+			m.Rated++
+			csat += *record.CSAT
+		}
+	}
+	m.TransferRate = float64(transfers) / float64(m.Calls)
+	m.ErrorRate = float64(failures) / float64(m.Calls)
+	m.AvgTurns = float64(turns) / float64(m.Calls)
+	if m.Rated > 0 {
+		average := csat / float64(m.Rated)
+		m.CSAT = &average
+	}
+	return m
+}
+
+// regression describes the first threshold the candidate breaks, or returns
+// "" while it holds up or either arm has too few calls to judge
+func (s RolloutStatus) regression() string {
+	minCalls := s.MinCalls
+	if minCalls <= 0 {
+		minCalls = 20
+	}
+	base, cand, t := s.BaselineMetrics, s.CandidateMetrics, s.Thresholds
+	if base.Calls < minCalls || cand.Calls < minCalls {
+		return ""
+	}
+	switch {
+	case t.MaxTransferRateIncrease > 0 && cand.TransferRate-base.TransferRate > t.MaxTransferRateIncrease:
+		return fmt.Sprintf("transfer rate %.1f%% against %.1f%%", cand.TransferRate*100, base.TransferRate*100)
+	case t.MaxErrorRateIncrease > 0 && cand.ErrorRate-base.ErrorRate > t.MaxErrorRateIncrease:
+		return fmt.Sprintf("error rate %.1f%% against %.1f%%", cand.ErrorRate*100, base.ErrorRate*100)
+	case t.MaxCSATDrop > 0 && base.CSAT != nil && cand.CSAT != nil && *base.CSAT-*cand.CSAT > t.MaxCSATDrop:
+		return fmt.Sprintf("CSAT %.2f against %.2f", *cand.CSAT, *base.CSAT)
+	case t.MaxAvgTurnsIncrease > 0 && cand.AvgTurns-base.AvgTurns > t.MaxAvgTurnsIncrease:
+		return fmt.Sprintf("%.1f caller turns per call against %.1f", cand.AvgTurns, base.AvgTurns)
+	}
+	return ""
+}
+
+// checkLoop periodically checks the active rollouts
+func (r *Rollouts) checkLoop(interval time.Duration) {
+	for range time.Tick(interval) {
+		r.check()
+	}
+}
+
+// check rolls back every active rollout whose candidate regressed
+func (r *Rollouts) check() {
+	for _, rollout := range r.list() {
+		if rollout.Status != RolloutActive {
+			continue
+		}
+		reason := rollout.status().regression()
+		if reason == "" {
+			continue
+		}
+		if _, err := r.finish(rollout.ID, RolloutRolledBack, reason); err != nil {
+			log.Printf("Error rolling back rollout %s: %v\n", rollout.ID, err)
+			continue
+		}
+		log.Printf("Rolled back rollout %s of agent %s to %s: %s\n", rollout.ID, rollout.Agent, rollout.Candidate, reason)
+		alerts.raise(Alert{
+			Kind:     AlertRollback,
+			Severity: "critical",
+			Message:  fmt.Sprintf("Rollout %s of agent %s to %s rolled back: %s", rollout.ID, rollout.Agent, rollout.Candidate, reason),
+			Subject:  rollout.ID,
+		})
+	}
+}
+
+// handleListRollouts serves GET /admin/rollouts
+func handleListRollouts(c *gin.Context) {
+	list := rollouts.list()
+	statuses := make([]RolloutStatus, 0, len(list))
+	for _, rollout := range list {
+		statuses = append(statuses, rollout.status())
+	}
+	c.JSON(http.StatusOK, gin.H{"rollouts": statuses})
+}
+
+// handleGetRollout serves GET /admin/rollouts/:id
+func handleGetRollout(c *gin.Context) {
+	rollout, ok := rollouts.get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rollout not found"})
+		return
+	}
+	c.JSON(http.StatusOK, rollout.status())
+}
+
+// handlePutRollout serves PUT /admin/rollouts/:id, starting or adjusting a rollout
+func handlePutRollout(c *gin.Context) {
+	var rollout Rollout
+	if err := c.ShouldBindJSON(&rollout); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rollout.ID = c.Param("id")
+	rollout.EndedAt, rollout.Reason = nil, ""
+	switch {
+	case !resourceIDPattern.MatchString(rollout.ID):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rollout id"})
+		return
+	case !agents.exists(rollout.Agent) || !agents.exists(rollout.Candidate):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "agent and candidate must be existing agents"})
+		return
+	case rollout.Agent == rollout.Candidate:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "candidate must differ from agent"})
+		return
+	case rollout.Percentage < 0 || rollout.Percentage > 100:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "percentage must be between 0 and 100"})
+		return
+	case rollout.Thresholds == RolloutThresholds{}:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "set at least one threshold so the rollout can roll back automatically"})
+		return
+	}
+	action, err := rollouts.put(rollout)
+	if action == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	rollout, _ = rollouts.get(rollout.ID)
+	c.JSON(putStatus(action), rollout)
+}
+
+// handleDeleteRollout serves DELETE /admin/rollouts/:id
+func handleDeleteRollout(c *gin.Context) {
+	ok, err := rollouts.remove(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rollout not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+// handleFinishRollout serves POST /admin/rollouts/:id/promote and
+// /admin/rollouts/:id/rollback
+func handleFinishRollout(status string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rollout, ok := rollouts.get(c.Param("id"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "rollout not found"})
+			return
+		}
+		if rollout.Status != RolloutActive {
+			c.JSON(http.StatusConflict, gin.H{"error": "rollout is already " + rollout.Status})
+			return
+		}
+		rollout, err := rollouts.finish(rollout.ID, status, "by "+auditActor(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, rollout)
+	}
+}
+
+// handleSetCSAT serves PUT /calls/:id/csat, recording the caller's
+// satisfaction score from a post-call survey
+func handleSetCSAT(c *gin.Context) {
+	var body struct {
+		Score *float64 `json:"score"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if body.Score != nil && (*body.Score < 1 || *body.Score > 5) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "score must be between 1 and 5"})
+		return
+	}
+	err := callStore.update(c.Param("id"), func(record *CallRecord) error {
+		record.CSAT = body.Score
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"call_sid": c.Param("id"), "score": body.Score})
+}
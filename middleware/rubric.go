@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// RubricCriterion is one item calls are scored against
+type RubricCriterion struct {
+	ID          string  `json:"id"`
+	Description string  `json:"description"`
+	Weight      float64 `json:"weight,omitempty"`
+}
+
+// CriterionScore is the evaluation of one criterion on a call
+type CriterionScore struct {
+	ID         string  `json:"id"`
+	Score      float64 `json:"score"`
+	Applicable bool    `json:"applicable"`
+	Evidence   string  `json:"evidence,omitempty"`
+}
+
+// RubricResult is the automatic QA evaluation stored in the CDR
+type RubricResult struct {
+	Criteria []CriterionScore `json:"criteria"`
+
+	// Score is the weighted average of applicable criteria, 0-100
+	Score float64 `json:"score"`
+}
+
+var (
+	defaultRubricOnce sync.Once
+	defaultRubric     []RubricCriterion
+)
+
+// rubricFor returns the agent's rubric, or the shared one from QA_RUBRIC_FILE
+func rubricFor(agent *Agent) []RubricCriterion {
+	if len(agent.Rubric) > 0 {
+		return agent.Rubric
+	}
+	defaultRubricOnce.Do(func() {
+		if _, err := loadJSONFile("QA_RUBRIC_FILE", &defaultRubric); err != nil {
+			log.Println("Error loading QA_RUBRIC_FILE:", err)
+		}
+	})
+	return defaultRubric
+}
+
+// scoreRubric evaluates a finished call's transcript against the agent's
+// rubric; a call none of the criteria apply to gets no result
+func scoreRubric(agent *Agent, record CallRecord) (*RubricResult, error) {
+	criteria := rubricFor(agent)
+	if len(criteria) == 0 || record.Status != CallCompleted || len(record.Transcript) == 0 {
+		return nil, nil
+	}
+
+	var prompt strings.Builder
+	prompt.WriteString("You are a call-center QA reviewer. Score this call between a caller and an AI assistant against each criterion.\n")
+	prompt.WriteString("Reply with a JSON object {\"criteria\": [{\"id\", \"score\", \"applicable\", \"evidence\"}]} with one entry per criterion. ")
+	prompt.WriteString("score is 0 (not met), 0.5 (partially met) or 1 (fully met); set applicable to false when the criterion could not apply to this call; ")
+	prompt.WriteString("evidence is a short quote or reason.\n\nCriteria:\n")
+	for _, c := range criteria {
+		fmt.Fprintf(&prompt, "- %s: %s\n", c.ID, c.Description)
+	}
+
+	messages := []chatMessage{
+		{Role: "system", Content: prompt.String()},
+		{Role: "user", Content: transcriptText(record.Transcript)},
+	}
+	reply, err := chatCompletion(tenants.get(record.Tenant), agent.TextModel, messages, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	var parsed RubricResult
+	if err := json.Unmarshal([]byte(reply), &parsed); err != nil {
+		return nil, fmt.Errorf("parsing rubric scores: %w", err)
+	}
+
+	scores := make(map[string]CriterionScore, len(parsed.Criteria))
+	for _, s := range parsed.Criteria {
+		scores[s.ID] = s
+	}
+	result := &RubricResult{}
+	var weighted, totalWeight float64
+	for _, c := range criteria {
+		score, ok := scores[c.ID]
+		if !ok {
+			// A criterion the model skipped counts as not evaluated
+			score = CriterionScore{ID: c.ID}
+		}
+		score.Score = clampUnit(score.Score)
+		result.Criteria = append(result.Criteria, score)
+		if !score.Applicable {
+			continue
+		}
+		weight := c.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		weighted += score.Score * weight
+		totalWeight += weight
+	}
+	if totalWeight == 0 {
+		// No criterion applied, so there is nothing to score the call on
+		return nil, nil
+	}
+	result.Score = 100 * weighted / totalWeight
+	return result, nil
+}
+
+// clampUnit limits a score to [0, 1]
+func clampUnit(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
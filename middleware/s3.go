@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// uploadClient is used for large uploads that outlast the outbound timeout
+var uploadClient = &http.Client{Timeout: 30 * time.Minute}
+
+// S3Config identifies a bucket and the credentials used to write to it
+type S3Config struct {
+	Bucket    string `json:"bucket"`
+	Region    string `json:"region"`
+	Prefix    string `json:"prefix,omitempty"`
+	Endpoint  string `json:"endpoint,omitempty"`
+	AccessKey string `json:"-"`
+	SecretKey string `json:"-"`
+}
+
+// loadS3Config reads the export bucket from the environment; ok is false when unset
+func loadS3Config() (S3Config, bool) {
+	cfg := S3Config{
+		Bucket:    getEnv("S3_EXPORT_BUCKET", ""),
+		Region:    getEnv("AWS_REGION", "us-east-1"),
+		Prefix:    getEnv("S3_EXPORT_PREFIX", ""),
+		Endpoint:  getEnv("S3_ENDPOINT", ""),
+		AccessKey: getEnv("AWS_ACCESS_KEY_ID", ""),
+		SecretKey: getEnv("AWS_SECRET_ACCESS_KEY", ""),
+	}
+	return cfg, cfg.Bucket != "" && cfg.AccessKey != "" && cfg.SecretKey != ""
+}
+
+// objectURL returns the virtual-hosted URL, or the path-style URL for custom endpoints
+func (cfg S3Config) objectURL(key string) (string, string) {
+	if cfg.Endpoint != "" {
+		endpoint := strings.TrimRight(cfg.Endpoint, "/")
+		host := strings.TrimPrefix(strings.TrimPrefix(endpoint, "https://"), "http://")
+		return endpoint + "/" + cfg.Bucket + "/" + key, host
+	}
+	host := cfg.Bucket + ".s3." + cfg.Region + ".amazonaws.com"
+	return "https://" + host + "/" + key, host
+}
+
+// putObject uploads a local file to the bucket with a SigV4-signed PUT
+func (cfg S3Config) putObject(key, path, contentType string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	key = strings.TrimLeft(cfg.Prefix+key, "/")
+	objectURL, host := cfg.objectURL(key)
+	req, err := http.NewRequest(http.MethodPut, objectURL, f)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", contentType)
+	cfg.sign(req, host, time.Now().UTC())
+
+	resp, err := uploadClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", newStatusError("s3 PUT "+key, resp)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return "s3://" + cfg.Bucket + "/" + key, nil
+}
+
+// sign adds AWS Signature Version 4 headers for an unsigned-payload request
+func (cfg S3Config) sign(req *http.Request, host string, now time.Time) {
+	const payloadHash = "UNSIGNED-PAYLOAD"
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + cfg.Region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+cfg.SecretKey), date)
+	key = hmacSHA256(key, cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data under key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
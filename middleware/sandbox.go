@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Kinds of side effects the sandbox captures
+const (
+	CaptureSMS          = "sms"
+	CaptureOutboundCall = "outbound_call"
+	CaptureCallUpdate   = "call_update"
+	CaptureTwilio       = "twilio"
+	CaptureHTTP         = "http"
+)
+
+// sandboxAccountSid stands in for the Twilio account in sandbox mode
+const sandboxAccountSid = "ACsandbox"
+
+// phonePattern finds anything that could be a phone number in captured
+// requests; captures err on the side of masking too much
+var phonePattern = regexp.MustCompile(`\+?\d{7,15}`)
+
+// defaultSandboxScript is what the mock model says when no script is configured
+var defaultSandboxScript = []MockTurn{
+	{Caller: "Hi, I'd like some help please.", Assistant: "Of course. This is the sandbox assistant; how can I help?"},
+	{Caller: "That's all, thanks.", Assistant: "Thanks for calling the sandbox. Goodbye!"},
+}
+
+// SandboxCapture is a request the sandbox answered instead of sending, with
+// secrets masked and phone numbers replaced by synthetic ones
+type SandboxCapture struct {
+	Time   time.Time   `json:"time"`
+	Kind   string      `json:"kind"`
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Body   interface{} `json:"body,omitempty"`
+	Bytes  int         `json:"bytes"`
+}
+
+// Sandbox runs the middleware safely on a laptop: the model is the scripted
+// mock, and every request that would leave the process is answered locally.
+// Texts, transfers, calls, webhooks and integrations land in the capture log
+type Sandbox struct {
+	sync.Mutex
+	mock     *httptest.Server
+	captures []SandboxCapture
+	limit    int
+}
+
+// newSandbox starts the sandbox when SANDBOX is enabled; it supplies
+// placeholder credentials and URLs so no real keys are needed
+func newSandbox() *Sandbox {
+	if !getEnvBool("SANDBOX", false) {
+		return nil
+	}
+	var script []MockTurn
+	if _, err := loadJSONFile("SANDBOX_SCRIPT_FILE", &script); err != nil {
+		log.Println("Error loading SANDBOX_SCRIPT_FILE, using the default script:", err)
+	}
+	if len(script) == 0 {
+		script = defaultSandboxScript
+	}
+	placeholders := map[string]string{
+		"OPENAI_API_KEY":  "sandbox",
+		"ADMIN_TOKEN":     "sandbox",
+		"PUBLIC_BASE_URL": "http://localhost:" + getEnv("PORT", "5050"),
+	}
+	tokenNote := "admin token from ADMIN_TOKEN"
+	for name, value := range placeholders {
+		if os.Getenv(name) == "" {
+			os.Setenv(name, value)
+			if name == "ADMIN_TOKEN" {
+				tokenNote = fmt.Sprintf("admin token %q", value)
+			}
+		}
+	}
+	sb := &Sandbox{
+		mock:  httptest.NewServer(mockRealtimeHandler(script)),
+		limit: getEnvInt("SANDBOX_CAPTURE_LIMIT", 500),
+	}
+	transport := &sandboxTransport{sb: sb}
+	outboundClient.Transport = transport
+	speechClient.Transport = transport
+	uploadClient.Transport = transport
+	// A configured token is a real secret; only the placeholder is printed
+	log.Printf("SANDBOX mode: mock model at %s, outbound requests captured, %s\n", sb.mock.URL, tokenNote)
+	return sb
+}
+
+// realtimeURL returns the mock model's WebSocket URL
+func (sb *Sandbox) realtimeURL() string {
+	return "ws" + strings.TrimPrefix(sb.mock.URL, "http")
+}
+
+// capture appends a request to the capture log, dropping the oldest past the limit
+func (sb *Sandbox) capture(entry SandboxCapture) {
+	sb.Lock()
+	sb.captures = append(sb.captures, entry)
+	if sb.limit > 0 && len(sb.captures) > sb.limit {
+		sb.captures = sb.captures[len(sb.captures)-sb.limit:]
+	}
+	sb.Unlock()
+	log.Printf("Sandbox captured %s %s (%s)\n", entry.Method, entry.URL, entry.Kind)
+}
+
+// list returns the captures of a kind, or all of them, oldest first
+func (sb *Sandbox) list(kind string) []SandboxCapture {
+	sb.Lock()
+	defer sb.Unlock()
+	out := []SandboxCapture{}
+	for _, entry := range sb.captures {
+		if kind == "" || entry.Kind == kind {
+			out = append(out, entry)
+		}
+	}
+	return out
+}
+
+// sandboxTransport answers outbound HTTP requests in sandbox mode: model
+// requests get canned replies, everything else is captured and acknowledged
+type sandboxTransport struct {
+	sb *Sandbox
+}
+
+func (t *sandboxTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+		req.Body.Close()
+	}
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/chat/completions"):
+		content := "This is a sandbox reply."
+		if bytes.Contains(body, []byte(`"response_format"`)) {
+			content = "{}"
+		}
+		reply, _ := json.Marshal(map[string]interface{}{
+			"choices": []interface{}{map[string]interface{}{"message": chatMessage{Role: "assistant", Content: content}}},
+		})
+		return sandboxResponse(req, "application/json", reply), nil
+	case strings.HasSuffix(req.URL.Path, "/audio/speech"):
+		return sandboxResponse(req, "audio/wav", encodeWAV(make([]int16, bytesPerSecond/2))), nil
+	}
+
+	kind, reply := CaptureHTTP, []byte("{}")
+	if strings.HasPrefix(req.URL.String(), twilioAPIURL) {
+		kind = twilioCaptureKind(req.URL.Path)
+		reply, _ = json.Marshal(map[string]string{"sid": newID("SB"), "status": "queued"})
+		if strings.HasSuffix(req.URL.Path, "/Participants.json") {
+			reply, _ = json.Marshal(map[string]string{"call_sid": newID("CA"), "conference_sid": newID("CF"), "status": "queued"})
+		}
+	}
+	t.sb.capture(SandboxCapture{
+		Time:   time.Now().UTC(),
+		Kind:   kind,
+		Method: req.Method,
+		URL:    redactSandboxURL(req.URL),
+		Body:   redactSandboxBody(req.Header.Get("Content-Type"), body),
+		Bytes:  len(body),
+	})
+	return sandboxResponse(req, "application/json", reply), nil
+}
+
+// sandboxResponse builds a 200 response to a request
+func sandboxResponse(req *http.Request, contentType string, body []byte) *http.Response {
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Status:        "200 OK",
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {contentType}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// twilioCaptureKind names the side effect of a Twilio REST request
+func twilioCaptureKind(path string) string {
+	switch {
+	case strings.HasSuffix(path, "/Messages.json"):
+		return CaptureSMS
+	case strings.HasSuffix(path, "/Calls.json"):
+		return CaptureOutboundCall
+	case strings.Contains(path, "/Calls/"):
+		return CaptureCallUpdate
+	}
+	return CaptureTwilio
+}
+
+// redactSandboxURL masks a URL's secrets and phone numbers
+func redactSandboxURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	redacted.Path = phonePattern.ReplaceAllStringFunc(u.Path, syntheticNumber)
+	redacted.RawPath = ""
+	if query := u.Query(); len(query) > 0 {
+		redacted.RawQuery = url.Values(redactSandboxValue("", query).(map[string][]string)).Encode()
+	}
+	return redacted.String()
+}
+
+// redactSandboxBody decodes a JSON or form body and masks it; other bodies
+// are only counted
+func redactSandboxBody(contentType string, body []byte) interface{} {
+	switch {
+	case strings.HasPrefix(contentType, "application/json"):
+		var decoded interface{}
+		if err := json.Unmarshal(body, &decoded); err == nil {
+			return redactSandboxValue("", decoded)
+		}
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+		if form, err := url.ParseQuery(string(body)); err == nil {
+			return redactSandboxValue("", form)
+		}
+	}
+	return nil
+}
+
+// redactSandboxValue masks values under secret-looking keys and swaps phone
+// numbers anywhere for synthetic ones
+func redactSandboxValue(key string, value interface{}) interface{} {
+	if key != "" && matchesAny(strings.ToLower(key), secretParams) {
+		return "[REDACTED]"
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = redactSandboxValue(k, item)
+		}
+		return out
+	case url.Values:
+		return redactSandboxValue(key, map[string][]string(v))
+	case map[string][]string:
+		out := make(map[string][]string, len(v))
+		for k, items := range v {
+			for _, item := range items {
+				redacted, _ := redactSandboxValue(k, item).(string)
+				out[k] = append(out[k], redacted)
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = redactSandboxValue(key, item)
+		}
+		return out
+	case string:
+		return phonePattern.ReplaceAllStringFunc(v, syntheticNumber)
+	}
+	return value
+}
+
+// syntheticNumber maps a phone number to a stable one in the 555-01XX range
+// reserved for fiction; synthetic numbers map to themselves
+func syntheticNumber(number string) string {
+	if isSyntheticNumber(number) {
+		return number
+	}
+	sum := sha256.Sum256([]byte(strings.TrimPrefix(number, "+")))
+	return fmt.Sprintf("+120255501%02d", binary.BigEndian.Uint32(sum[:4])%100)
+}
+
+// isSyntheticNumber reports whether a number is a fictional +1 NXX-555-01XX number
+func isSyntheticNumber(number string) bool {
+	number = "+" + strings.TrimPrefix(number, "+")
+	return len(number) == 12 && strings.HasPrefix(number, "+1") && number[5:10] == "55501"
+}
+
+// handleSandboxCaptures serves GET /admin/sandbox/captures
+func handleSandboxCaptures(c *gin.Context) {
+	if sandbox == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "sandbox mode is off"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"captures": sandbox.list(c.Query("kind"))})
+}
+
+// handleClearSandboxCaptures serves DELETE /admin/sandbox/captures
+func handleClearSandboxCaptures(c *gin.Context) {
+	if sandbox == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "sandbox mode is off"})
+		return
+	}
+	sandbox.Lock()
+	sandbox.captures = nil
+	sandbox.Unlock()
+	c.JSON(http.StatusOK, gin.H{"status": "cleared"})
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TranscriptIndex is an in-memory inverted index over call transcripts
+type TranscriptIndex struct {
+	sync.RWMutex
+	postings map[string]map[string]int // term -> call SID -> occurrences
+	docTerms map[string][]string       // call SID -> indexed terms
+}
+
+// SearchHit is one call matching a search, with the utterances that matched
+type SearchHit struct {
+	CallSid     string            `json:"call_sid"`
+	Tenant      string            `json:"tenant"`
+	Agent       string            `json:"agent"`
+	From        string            `json:"from"`
+	StartedAt   time.Time         `json:"started_at"`
+	Disposition string            `json:"disposition,omitempty"`
+	Score       int               `json:"score"`
+	Matches     []TranscriptEntry `json:"matches"`
+}
+
+// newTranscriptIndex creates an empty index
+func newTranscriptIndex() *TranscriptIndex {
+	return &TranscriptIndex{
+		postings: make(map[string]map[string]int),
+		docTerms: make(map[string][]string),
+	}
+}
+
+// tokenize lowercases text and splits it into words
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+}
+
+// add indexes a record's transcript, replacing any previous entry for the call
+func (idx *TranscriptIndex) add(record *CallRecord) {
+	idx.Lock()
+	defer idx.Unlock()
+	idx.removeLocked(record.CallSid)
+	counts := make(map[string]int)
+	for _, entry := range record.Transcript {
+		for _, term := range tokenize(entry.Text) {
+			counts[term]++
+		}
+	}
+	terms := make([]string, 0, len(counts))
+	for term, n := range counts {
+		if idx.postings[term] == nil {
+			idx.postings[term] = make(map[string]int)
+		}
+		idx.postings[term][record.CallSid] = n
+		terms = append(terms, term)
+	}
+	idx.docTerms[record.CallSid] = terms
+}
+
+// removeLocked drops a call from the index; the caller must hold the lock
+func (idx *TranscriptIndex) removeLocked(callSid string) {
+	for _, term := range idx.docTerms[callSid] {
+		delete(idx.postings[term], callSid)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	delete(idx.docTerms, callSid)
+}
+
+// lookup returns the calls containing every term with a relevance score;
+// a trailing * makes a term match as a prefix
+func (idx *TranscriptIndex) lookup(terms []string) map[string]int {
+	idx.RLock()
+	defer idx.RUnlock()
+	var result map[string]int
+	for _, term := range terms {
+		matches := make(map[string]int)
+		if prefix, ok := strings.CutSuffix(term, "*"); ok {
+			for indexed, calls := range idx.postings {
+				if strings.HasPrefix(indexed, prefix) {
+					for sid, n := range calls {
+						matches[sid] += n
+					}
+				}
+			}
+		} else {
+			for sid, n := range idx.postings[term] {
+				matches[sid] = n
+			}
+		}
+		if result == nil {
+			result = matches
+			continue
+		}
+		for sid := range result {
+			if n, ok := matches[sid]; ok {
+				result[sid] += n
+			} else {
+				delete(result, sid)
+			}
+		}
+	}
+	return result
+}
+
+// searchQuery is a parsed query: words that must all appear, and quoted phrases
+type searchQuery struct {
+	terms   []string
+	phrases []string
+}
+
+// parseSearchQuery splits a query into terms and "quoted phrases"
+func parseSearchQuery(q string) searchQuery {
+	var query searchQuery
+	parts := strings.Split(q, `"`)
+	for i, part := range parts {
+		if i%2 == 1 {
+			if phrase := strings.ToLower(strings.TrimSpace(part)); phrase != "" {
+				query.phrases = append(query.phrases, phrase)
+				query.terms = append(query.terms, tokenize(phrase)...)
+			}
+			continue
+		}
+		for _, word := range strings.Fields(strings.ToLower(part)) {
+			if strings.HasSuffix(word, "*") {
+				if prefix := tokenize(word); len(prefix) > 0 {
+					query.terms = append(query.terms, prefix[0]+"*")
+				}
+				continue
+			}
+			query.terms = append(query.terms, tokenize(word)...)
+		}
+	}
+	return query
+}
+
+// matchingEntries returns the utterances that contain any query term or phrase
+func (q searchQuery) matchingEntries(transcript []TranscriptEntry) ([]TranscriptEntry, bool) {
+	text := strings.ToLower(transcriptText(transcript))
+	for _, phrase := range q.phrases {
+		if !strings.Contains(text, phrase) {
+			return nil, false
+		}
+	}
+	var matches []TranscriptEntry
+	for _, entry := range transcript {
+		words := tokenize(entry.Text)
+		for _, term := range q.terms {
+			prefix, isPrefix := strings.CutSuffix(term, "*")
+			if containsTerm(words, prefix, isPrefix) {
+				matches = append(matches, entry)
+				break
+			}
+		}
+	}
+	return matches, true
+}
+
+// containsTerm reports whether words contain term, or a word starting with it
+func containsTerm(words []string, term string, prefix bool) bool {
+	for _, w := range words {
+		if w == term || (prefix && strings.HasPrefix(w, term)) {
+			return true
+		}
+	}
+	return false
+}
+
+// search finds calls whose transcripts match q and pass the filter, best matches first
+func (st *CallStore) search(q string, filter CallFilter) []SearchHit {
+	query := parseSearchQuery(q)
+	if len(query.terms) == 0 {
+		return nil
+	}
+	scores := st.index.lookup(query.terms)
+
+	st.RLock()
+	var hits []SearchHit
+	for sid, score := range scores {
+		record, ok := st.records[sid]
+		if !ok || !filter.matches(record) {
+			continue
+		}
+		matches, ok := query.matchingEntries(record.Transcript)
+		if !ok {
+			continue
+		}
+		hits = append(hits, SearchHit{
+			CallSid:     record.CallSid,
+			Tenant:      record.Tenant,
+			Agent:       record.Agent,
+			From:        record.From,
+			StartedAt:   record.StartedAt,
+			Disposition: record.Disposition,
+			Score:       score,
+			Matches:     matches,
+		})
+	}
+	st.RUnlock()
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].StartedAt.After(hits[j].StartedAt)
+	})
+	return hits
+}
+
+// handleSearch serves GET /admin/search?q=...
+func handleSearch(c *gin.Context) {
+	q := c.Query("q")
+	if strings.TrimSpace(q) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+	filter, err := callFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	hits := callStore.search(q, filter)
+	total := len(hits)
+	if offset > total {
+		offset = total
+	}
+	hits = hits[offset:]
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	if hits == nil {
+		hits = []SearchHit{}
+	}
+	callSids := make([]string, len(hits))
+	for i, hit := range hits {
+		callSids[i] = hit.CallSid
+	}
+	c.Set(auditCallsKey, callSids)
+	c.JSON(http.StatusOK, gin.H{"query": q, "total": total, "results": hits})
+}
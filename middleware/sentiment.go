@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// negativeWords and positiveWords form a small lexicon for caller sentiment
+var (
+	negativeWords = map[string]bool{
+		"angry": true, "annoyed": true, "awful": true, "bad": true, "broken": true,
+		"complaint": true, "disappointed": true, "frustrated": true, "frustrating": true, "furious": true,
+		"hate": true, "horrible": true, "ridiculous": true, "terrible": true, "unacceptable": true,
+		"upset": true, "useless": true, "waste": true, "worst": true, "stupid": true,
+		"enfadado": true, "fatal": true, "harto": true, "queja": true, "inútil": true,
+	}
+	positiveWords = map[string]bool{
+		"great": true, "good": true, "thanks": true, "thank": true, "perfect": true, "excellent": true,
+		"helpful": true, "happy": true, "awesome": true, "love": true, "wonderful": true,
+		"gracias": true, "perfecto": true, "genial": true, "excelente": true,
+	}
+)
+
+// sentimentScore returns a score in [-1, 1] for an utterance; zero means neutral
+func sentimentScore(text string) float64 {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	var pos, neg int
+	for _, w := range words {
+		switch {
+		case negativeWords[w]:
+			neg++
+		case positiveWords[w]:
+			pos++
+		}
+	}
+	if pos+neg == 0 {
+		return 0
+	}
+	return float64(pos-neg) / float64(pos+neg)
+}
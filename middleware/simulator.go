@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// SimStep is one caller utterance in a simulated call
+type SimStep struct {
+	// AudioFile is raw 8 kHz A-law caller audio
+	AudioFile string `json:"audio_file"`
+
+	// WaitMs is how long to listen for the assistant after the utterance
+	WaitMs int `json:"wait_ms"`
+
+	// Audio is used instead of AudioFile when set
+	Audio []byte `json:"-"`
+}
+
+// SimScript describes a synthetic call placed against the media stream endpoint
+type SimScript struct {
+	Tenant string    `json:"tenant"`
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Steps  []SimStep `json:"steps"`
+}
+
+// SimResult is what the simulated caller observed
+type SimResult struct {
+	CallSid        string        `json:"call_sid"`
+	AssistantBytes int           `json:"assistant_bytes"`
+	FirstAudio     time.Duration `json:"first_audio_ns"`
+	Duration       time.Duration `json:"duration_ns"`
+}
+
+// simulateCall connects to a media stream URL as a Twilio client, plays the
+// script's caller audio in real time and counts the assistant audio returned
+func simulateCall(url, callSid string, script SimScript, params map[string]string) (SimResult, error) {
+	result := SimResult{CallSid: callSid}
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		return result, fmt.Errorf("connecting to %s: %w", url, err)
+	}
+	defer conn.Close()
+
+	started := time.Now()
+	streamSid := "MZ" + callSid
+	var mu sync.Mutex
+	received := make(chan struct{})
+	go func() {
+		defer close(received)
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var event struct {
+				Event string `json:"event"`
+				Media struct {
+					Payload string `json:"payload"`
+				} `json:"media"`
+			}
+			if json.Unmarshal(message, &event) != nil || event.Event != "media" {
+				continue
+			}
+			audio, _ := base64.StdEncoding.DecodeString(event.Media.Payload)
+			mu.Lock()
+			if result.AssistantBytes == 0 {
+				result.FirstAudio = time.Since(started)
+			}
+			result.AssistantBytes += len(audio)
+			mu.Unlock()
+		}
+	}()
+
+	custom := map[string]string{"From": script.From, "To": script.To, "Tenant": script.Tenant}
+	for k, v := range params {
+		custom[k] = v
+	}
+	send := func(v interface{}) error {
+		data, _ := json.Marshal(v)
+		return conn.WriteMessage(websocket.TextMessage, data)
+	}
+	if err := send(map[string]interface{}{"event": "connected", "protocol": "Call", "version": "1.0.0"}); err != nil {
+		return result, err
+	}
+	if err := send(map[string]interface{}{
+		"event":     "start",
+		"streamSid": streamSid,
+		"start": map[string]interface{}{
+			"streamSid":        streamSid,
+			"callSid":          callSid,
+			"customParameters": custom,
+			"mediaFormat":      map[string]interface{}{"encoding": "audio/x-alaw", "sampleRate": bytesPerSecond, "channels": 1},
+		},
+	}); err != nil {
+		return result, err
+	}
+
+	var timestampMs int64
+	chunk := 0
+	// sendAudio streams audio in 20 ms frames at real-time pace
+	sendAudio := func(audio []byte) error {
+		for start := 0; start < len(audio); start += qualityFrameBytes {
+			end := start + qualityFrameBytes
+			if end > len(audio) {
+				end = len(audio)
+			}
+			chunk++
+			if err := send(map[string]interface{}{
+				"event":     "media",
+				"streamSid": streamSid,
+				"media": map[string]string{
+					"track":     "inbound",
+					"chunk":     strconv.Itoa(chunk),
+					"timestamp": strconv.FormatInt(timestampMs, 10),
+					"payload":   base64.StdEncoding.EncodeToString(audio[start:end]),
+				},
+			}); err != nil {
+				return err
+			}
+			timestampMs += int64((end - start) / bytesPerMs)
+			time.Sleep(time.Duration((end-start)/bytesPerMs) * time.Millisecond)
+		}
+		return nil
+	}
+
+	silence := func(ms int) []byte { return bytes.Repeat([]byte{alawSilence}, ms*bytesPerMs) }
+	for _, step := range script.Steps {
+		audio := step.Audio
+		if audio == nil {
+			var err error
+			if audio, err = os.ReadFile(step.AudioFile); err != nil {
+				return result, err
+			}
+		}
+		if err := sendAudio(audio); err != nil {
+			return result, err
+		}
+		wait := step.WaitMs
+		if wait == 0 {
+			wait = 5000
+		}
+		// Keep the line open with silence so server VAD ends the turn
+		if err := sendAudio(silence(wait)); err != nil {
+			return result, err
+		}
+	}
+
+	send(map[string]interface{}{"event": "stop", "streamSid": streamSid})
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	select {
+	case <-received:
+	case <-time.After(2 * time.Second):
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	result.Duration = time.Since(started)
+	return result, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// smsStyleNote is appended to the agent instructions for text replies
+const smsStyleNote = "You are replying by SMS. Keep answers short, plain text, and under 320 characters."
+
+// smsThread is the running conversation with one phone number at one tenant
+type smsThread struct {
+	messages  []chatMessage
+	updatedAt time.Time
+}
+
+// SMSThreads keeps one conversation thread per tenant and caller number
+type SMSThreads struct {
+	sync.Mutex
+	threads    map[string]*smsThread
+	ttl        time.Duration
+	maxHistory int
+}
+
+// newSMSThreads creates the thread store from the environment and starts
+// evicting expired threads
+func newSMSThreads() *SMSThreads {
+	t := &SMSThreads{
+		threads:    make(map[string]*smsThread),
+		ttl:        getEnvDuration("SMS_THREAD_TTL", 72*time.Hour),
+		maxHistory: getEnvInt("SMS_MAX_HISTORY", 20),
+	}
+	go func() {
+		for range time.Tick(min(t.ttl, time.Hour)) {
+			t.evict()
+		}
+	}()
+	return t
+}
+
+// evict drops threads idle for longer than the TTL
+func (t *SMSThreads) evict() {
+	t.Lock()
+	defer t.Unlock()
+	for key, th := range t.threads {
+		if time.Since(th.updatedAt) > t.ttl {
+			delete(t.threads, key)
+		}
+	}
+}
+
+// threadKey scopes a number's thread to the tenant it texted
+func threadKey(tenantID, number string) string {
+	return tenantID + ":" + normalizeNumber(number)
+}
+
+// thread returns the live thread for a key, starting a new one if it expired
+func (t *SMSThreads) thread(key string) *smsThread {
+	th, ok := t.threads[key]
+	if !ok || time.Since(th.updatedAt) > t.ttl {
+		th = &smsThread{}
+		t.threads[key] = th
+	}
+	return th
+}
+
+// append adds messages to a number's thread at a tenant and trims old history
+func (t *SMSThreads) append(tenantID, number string, messages ...chatMessage) []chatMessage {
+	t.Lock()
+	defer t.Unlock()
+	th := t.thread(threadKey(tenantID, number))
+	th.messages = append(th.messages, messages...)
+	if len(th.messages) > t.maxHistory {
+		th.messages = th.messages[len(th.messages)-t.maxHistory:]
+	}
+	th.updatedAt = time.Now()
+	return append([]chatMessage(nil), th.messages...)
+}
+
+// noteCall records a finished voice call so a follow-up text has context
+func (t *SMSThreads) noteCall(record CallRecord) {
+	if record.From == "" {
+		return
+	}
+	note := fmt.Sprintf("The caller spoke with you by phone on %s for %s (call %s). They may be following up on that call.",
+		record.StartedAt.Format(time.RFC1123), record.duration().Round(time.Second), record.CallSid)
+	t.append(record.Tenant, record.From, chatMessage{Role: "system", Content: note})
+}
+
+// handleIncomingSMS answers a Twilio inbound SMS webhook with the agent's reply
+func handleIncomingSMS(c *gin.Context) {
+	from := normalizeNumber(c.PostForm("From"))
+	body := c.PostForm("Body")
+	if from == "" || body == "" {
+		c.String(http.StatusBadRequest, "missing From or Body")
+		return
+	}
+
+	route := callRoute(c)
+	tenant := tenants.get(route.Tenant)
+	agent, _ := routedAgent(tenant, route.Agent, from)
+	history := smsThreads.append(tenant.ID, from, chatMessage{Role: "user", Content: body})
+
+	reply, err := completeChat(tenant, agent, history)
+	if err != nil {
+		log.Println("Error generating SMS reply:", err)
+		reply = "Sorry, we couldn't process your message right now. Please try again later."
+	} else {
+		smsThreads.append(tenant.ID, from, chatMessage{Role: "assistant", Content: reply})
+	}
+
+	c.Header("Content-Type", "text/xml")
+	c.String(http.StatusOK, `<?xml version="1.0" encoding="UTF-8"?>
+<Response>
+    <Message>`+html.EscapeString(reply)+`</Message>
+</Response>`)
+}
+
+// completeChat asks the agent's text model for the next reply in a thread
+func completeChat(tenant *Tenant, agent *Agent, history []chatMessage) (string, error) {
+	messages := append([]chatMessage{{Role: "system", Content: agent.Instructions + "\n\n" + smsStyleNote}}, history...)
+	return chatCompletion(tenant, agent.TextModel, messages, agent.Temperature, false)
+}
+
+func init() {
+	registerTool(&Tool{
+		Name:        "send_sms",
+		Description: "Send the caller a short text message follow-up, such as a confirmation or a link they asked for.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"message":  map[string]interface{}{"type": "string", "description": "Text to send, under 320 characters"},
+				"to_field": map[string]interface{}{"type": "string", "description": "Confirmed phone field to send to instead of the calling number"},
+			},
+			"required": []string{"message"},
+		},
+		Available: func(s *Session) bool {
+			return s.from != "" && s.to != "" && s.hasConsent(ConsentSMS)
+		},
+		Handler: func(s *Session, args json.RawMessage) (interface{}, error) {
+			var params struct {
+				Message string `json:"message"`
+				ToField string `json:"to_field"`
+			}
+			if err := json.Unmarshal(args, &params); err != nil {
+				return nil, err
+			}
+			if !s.hasConsent(ConsentSMS) {
+				return nil, fmt.Errorf("the caller has not agreed to receive text messages")
+			}
+			to := s.from
+			if params.ToField != "" {
+				// Only a number the caller confirmed on read-back, never one from the transcript
+				field, ok := s.captureField(params.ToField)
+				value, confirmed := s.capturedValue(params.ToField)
+				if !ok || field.Kind != CapturePhone || !confirmed {
+					return nil, fmt.Errorf("%s is not a confirmed phone number", params.ToField)
+				}
+				to = value
+			}
+			if err := sendSMS(s.to, to, params.Message); err != nil {
+				return nil, err
+			}
+			smsThreads.append(s.tenant.ID, to, chatMessage{Role: "assistant", Content: params.Message})
+			return map[string]string{"status": "sent"}, nil
+		},
+	})
+}
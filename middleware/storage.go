@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// dataPath returns a path inside DATA_DIR, creating the parent directory
+func dataPath(parts ...string) string {
+	path := filepath.Join(append([]string{getEnv("DATA_DIR", "data")}, parts...)...)
+	os.MkdirAll(filepath.Dir(path), 0o755)
+	return path
+}
+
+// dataDir returns a directory inside DATA_DIR, creating it
+func dataDir(parts ...string) string {
+	dir := filepath.Join(append([]string{getEnv("DATA_DIR", "data")}, parts...)...)
+	os.MkdirAll(dir, 0o755)
+	return dir
+}
+
+// readJSONFile decodes a JSON file; a missing file leaves v untouched
+func readJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// writeJSONFile atomically replaces a file with the JSON encoding of v
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
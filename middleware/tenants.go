@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log"
+	"sync"
+)
+
+// DefaultTenantID is used when a call does not name a tenant
+const DefaultTenantID = "default"
+
+// Tenant holds per-customer configuration
+type Tenant struct {
+	ID      string     `json:"id"`
+	Name    string     `json:"name"`
+	AgentID string     `json:"agent_id,omitempty"`
+	CRM     *CRMConfig `json:"crm,omitempty"`
+
+	// PersonalizeGreeting opts the tenant into remembering callers and
+	// greeting them by name; off by default for privacy
+	PersonalizeGreeting bool   `json:"personalize_greeting"`
+	GreetingTemplate    string `json:"greeting_template,omitempty"`
+
+	// RecordCalls stores two-track call audio, subject to recording consent
+	// when Consent requires it
+	RecordCalls bool           `json:"record_calls"`
+	Consent     *ConsentConfig `json:"consent,omitempty"`
+
+	// Priority ranks tenants for load shedding: under heavy load new calls
+	// for tenants below DEGRADE_SHED_PRIORITY are turned away
+	Priority int `json:"priority"`
+
+	// Region pins the tenant's calls and data to one region; its calls are
+	// refused when that region is unavailable
+	Region string `json:"region,omitempty"`
+}
+
+// TenantRegistry looks up tenants by ID
+type TenantRegistry struct {
+	sync.RWMutex
+	tenants map[string]*Tenant
+}
+
+// loadTenants reads tenants from TENANTS_FILE and always provides the default tenant
+func loadTenants() *TenantRegistry {
+	var list []*Tenant
+	if _, err := loadJSONFile("TENANTS_FILE", &list); err != nil {
+		log.Println("Error loading TENANTS_FILE:", err)
+	}
+	r := &TenantRegistry{tenants: make(map[string]*Tenant)}
+	for _, t := range list {
+		if t.ID == "" {
+			log.Println("Skipping tenant without id")
+			continue
+		}
+		r.tenants[t.ID] = t
+	}
+	if _, ok := r.tenants[DefaultTenantID]; !ok {
+		r.tenants[DefaultTenantID] = &Tenant{ID: DefaultTenantID, Name: "Default"}
+	}
+	log.Printf("Loaded %d tenant(s)\n", len(r.tenants))
+	return r
+}
+
+// get returns the tenant with the given ID, falling back to the default tenant
+func (r *TenantRegistry) get(id string) *Tenant {
+	r.RLock()
+	defer r.RUnlock()
+	if t, ok := r.tenants[id]; ok {
+		return t
+	}
+	return r.tenants[DefaultTenantID]
+}
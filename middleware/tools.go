@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Tool is a function the model can call during a voice session
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  map[string]interface{}
+
+	// Available reports whether the tool is offered on a session; nil means always
+	Available func(s *Session) bool
+
+	// Handler runs the tool and returns a JSON-serializable result
+	Handler func(s *Session, args json.RawMessage) (interface{}, error)
+}
+
+var (
+	toolsMu sync.RWMutex
+	toolSet = map[string]*Tool{}
+)
+
+// registerTool adds a tool to the global registry
+func registerTool(t *Tool) {
+	toolsMu.Lock()
+	defer toolsMu.Unlock()
+	toolSet[t.Name] = t
+}
+
+// lookupTool returns a registered tool by name
+func lookupTool(name string) (*Tool, bool) {
+	toolsMu.RLock()
+	defer toolsMu.RUnlock()
+	t, ok := toolSet[name]
+	return t, ok
+}
+
+// toolDefinitions returns the tools offered to the model on this session
+func (s *Session) toolDefinitions() []map[string]interface{} {
+	toolsMu.RLock()
+	defer toolsMu.RUnlock()
+	names := make([]string, 0, len(toolSet))
+	for name := range toolSet {
+		names = append(names, name)
+	}
+	// Sorted so identical sessions send identical tool lists
+	sort.Strings(names)
+	defs := []map[string]interface{}{}
+	for _, name := range names {
+		t := toolSet[name]
+		if t.Available != nil && !t.Available(s) {
+			continue
+		}
+		defs = append(defs, map[string]interface{}{
+			"type":        "function",
+			"name":        t.Name,
+			"description": t.Description,
+			"parameters":  t.Parameters,
+		})
+	}
+	return defs
+}
+
+// ToolCallRecord is one tool invocation, kept in the CDR
+type ToolCallRecord struct {
+	Name      string          `json:"name"`
+	CallID    string          `json:"call_id,omitempty"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+	Output    json.RawMessage `json:"output,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	At        time.Time       `json:"at"`
+}
+
+// functionCall mirrors a response.function_call_arguments.done event
+type functionCall struct {
+	CallID    string `json:"call_id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// handleFunctionCall runs the requested tool and returns its output to the model
+func (s *Session) handleFunctionCall(message []byte) {
+	s.res.pendingTools.Add(1)
+	defer s.res.pendingTools.Add(-1)
+
+	var call functionCall
+	if err := json.Unmarshal(message, &call); err != nil {
+		log.Println("Error unmarshaling function call:", err)
+		return
+	}
+
+	record := ToolCallRecord{Name: call.Name, CallID: call.CallID, At: time.Now().UTC()}
+	if json.Valid([]byte(call.Arguments)) {
+		record.Arguments = json.RawMessage(call.Arguments)
+	}
+	var output interface{}
+	tool, ok := lookupTool(call.Name)
+	if !ok || (tool.Available != nil && !tool.Available(s)) {
+		output = map[string]string{"error": "unknown tool " + call.Name}
+		record.Error = "unknown tool"
+	} else if s.voiceMatchRequired(call.Name) {
+		output = map[string]string{"error": "the caller's identity has not been verified by voice yet; keep talking with them and try again later"}
+		record.Error = "voice not verified"
+	} else {
+		result, err := tool.Handler(s, json.RawMessage(call.Arguments))
+		if err != nil {
+			log.Printf("Tool %s failed: %v\n", call.Name, err)
+			output = map[string]string{"error": err.Error()}
+			record.Error = err.Error()
+		} else {
+			output = result
+		}
+	}
+	log.Printf("Tool %s called on stream %s\n", call.Name, s.streamSid)
+	data, err := json.Marshal(output)
+	if err == nil && record.Error == "" {
+		record.Output = data
+	}
+	s.Lock()
+	s.toolCalls = append(s.toolCalls, record)
+	s.Unlock()
+	s.copilot.publish(CopilotEvent{Type: CopilotToolResult, Tool: &record})
+
+	if err != nil {
+		log.Println("Error marshaling tool output:", err)
+		return
+	}
+	s.sendOpenAI(map[string]interface{}{
+		"type": "conversation.item.create",
+		"item": map[string]interface{}{
+			"type":    "function_call_output",
+			"call_id": call.CallID,
+			"output":  string(data),
+		},
+	})
+	s.sendOpenAI(map[string]interface{}{"type": "response.create"})
+}
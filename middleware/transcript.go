@@ -0,0 +1,39 @@
+package main
+
+import "time"
+
+// Transcript speakers
+const (
+	SpeakerCaller    = "caller"
+	SpeakerAssistant = "assistant"
+)
+
+// TranscriptEntry is one utterance in a call transcript
+type TranscriptEntry struct {
+	Speaker string    `json:"speaker"`
+	Text    string    `json:"text"`
+	At      time.Time `json:"at"`
+}
+
+// addTranscript appends an utterance to the session transcript
+func (s *Session) addTranscript(speaker, text string) {
+	if text == "" {
+		return
+	}
+	s.Lock()
+	s.transcript = append(s.transcript, TranscriptEntry{Speaker: speaker, Text: text, At: time.Now().UTC()})
+	s.Unlock()
+	s.copilot.publish(CopilotEvent{Type: CopilotTranscript, Speaker: speaker, Text: text})
+
+	s.checkEscalation(speaker, text)
+	s.applyConversationPolicy(speaker, text)
+}
+
+// transcriptText renders a transcript as "speaker: text" lines
+func transcriptText(entries []TranscriptEntry) string {
+	text := ""
+	for _, e := range entries {
+		text += e.Speaker + ": " + e.Text + "\n"
+	}
+	return text
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const openAISpeechURL = "https://api.openai.com/v1/audio/speech"
+
+// maxTTSChars is the longest prompt the speech API accepts
+const maxTTSChars = 4096
+
+// speechClient allows for the time long prompts take to synthesize
+var speechClient = &http.Client{Timeout: 60 * time.Second}
+
+// synthesizeSpeech turns text into WAV audio with an OpenAI voice in the
+// tenant's region
+func synthesizeSpeech(tenant *Tenant, text, voice, instructions string) ([]byte, error) {
+	region, err := residency.regionFor(tenant)
+	if err != nil {
+		return nil, err
+	}
+	request := map[string]interface{}{
+		"model":           getEnv("TTS_MODEL", "gpt-4o-mini-tts"),
+		"input":           text,
+		"voice":           voice,
+		"response_format": "wav",
+	}
+	if instructions != "" {
+		request["instructions"] = instructions
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, region.speechURL(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+region.apiKey())
+
+	started := time.Now()
+	audio, err := doSpeech(req)
+	providerMetrics.record(ProviderOpenAISpeech, time.Since(started), err)
+	return audio, err
+}
+
+// doSpeech sends a speech request and reads the audio
+func doSpeech(req *http.Request) ([]byte, error) {
+	resp, err := speechClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, newStatusError("POST "+req.URL.String(), resp)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxAssetBytes))
+}
+
+// TTSAssetRequest asks for an asset to be synthesized from text
+type TTSAssetRequest struct {
+	Text string `json:"text" binding:"required"`
+	// Name defaults to one derived from the voice and text
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	// Voice defaults to the agent's voice, then the default voice; the
+	// agent's pronunciation hints are applied to the text
+	Voice        string `json:"voice"`
+	Agent        string `json:"agent"`
+	Instructions string `json:"instructions"`
+	// Tenant synthesizes in the tenant's region; the default tenant's
+	// otherwise
+	Tenant string `json:"tenant"`
+}
+
+// handleTTSAsset serves POST /admin/assets/tts
+func handleTTSAsset(c *gin.Context) {
+	var req TTSAssetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Text) > maxTTSChars {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("text is limited to %d characters", maxTTSChars)})
+		return
+	}
+	if req.Tenant != "" {
+		tenants.RLock()
+		_, ok := tenants.tenants[req.Tenant]
+		tenants.RUnlock()
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown tenant %q", req.Tenant)})
+			return
+		}
+	}
+	spoken := req.Text
+	if req.Agent != "" {
+		agent := agents.get(req.Agent)
+		spoken = agent.pronounce(req.Text)
+		if req.Voice == "" {
+			req.Voice = agent.Voice
+		}
+	}
+	if req.Voice == "" {
+		req.Voice = VOICE
+	}
+	if req.Name == "" {
+		sum := sha256.Sum256([]byte(req.Voice + "\x00" + req.Text))
+		req.Name = "tts-" + hex.EncodeToString(sum[:4])
+	}
+	if !assetNamePattern.MatchString(req.Name) || req.Name == "tts" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "asset names are lowercase letters, digits, - and _"})
+		return
+	}
+	if _, exists := assets.get(req.Name); !exists && req.Kind == "" {
+		req.Kind = AssetGreeting
+	}
+	if req.Kind != "" && !validAssetKind(req.Kind) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be greeting, hold or disclosure"})
+		return
+	}
+
+	audio, err := synthesizeSpeech(tenants.get(req.Tenant), spoken, req.Voice, req.Instructions)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "speech synthesis failed: " + err.Error()})
+		return
+	}
+	asset, err := assets.add(req.Name, req.Kind, "audio/wav", audio, AssetVersion{Text: req.Text, Voice: req.Voice})
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"id": asset.Name, "version": asset.Current, "asset": asset})
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Turn is one conversational turn with timing and recording offsets
+type Turn struct {
+	Index      int       `json:"index"`
+	Speaker    string    `json:"speaker"`
+	ItemID     string    `json:"item_id,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	EndedAt    time.Time `json:"ended_at,omitempty"`
+	Transcript string    `json:"transcript,omitempty"`
+
+	// AudioStart and AudioEnd are byte offsets into the speaker's recording
+	// track; they are -1 when the call was not recorded
+	AudioStart int64 `json:"audio_start"`
+	AudioEnd   int64 `json:"audio_end"`
+
+	// LatencyMs is the time from the end of caller speech to the first
+	// assistant audio, for assistant turns
+	LatencyMs int64 `json:"latency_ms,omitempty"`
+
+	// Interrupted marks an assistant turn cut off by the caller; BargeIn marks
+	// the caller turn that did so
+	Interrupted bool `json:"interrupted"`
+	BargeIn     bool `json:"barge_in"`
+}
+
+// turnState tracks the turns still in progress
+type turnState struct {
+	turns         []Turn
+	assistantOpen int // index of the assistant turn receiving audio, or -1
+	callerEndedAt time.Time
+
+	// VAD events carry times on the model's input buffer clock, which only
+	// advances with the audio sent to it; sentBytes is that clock in bytes
+	// and anchorPos the caller-track position when it last advanced
+	sentBytes int64
+	anchorPos int64
+}
+
+// openTurn appends a turn and returns its index; the caller must hold the lock
+func (s *Session) openTurn(turn Turn) int {
+	turn.Index = len(s.turnLog.turns)
+	s.turnLog.turns = append(s.turnLog.turns, turn)
+	return turn.Index
+}
+
+// findTurn returns the latest turn for a conversation item; the caller must hold the lock
+func (s *Session) findTurn(speaker, itemID string) *Turn {
+	for i := len(s.turnLog.turns) - 1; i >= 0; i-- {
+		t := &s.turnLog.turns[i]
+		if t.Speaker == speaker && (itemID == "" || t.ItemID == itemID) {
+			return t
+		}
+	}
+	return nil
+}
+
+// inputAudioSent advances the input buffer clock by a chunk of caller audio
+// sent to the model and anchors it to the recording's caller track
+func (s *Session) inputAudioSent(size int) {
+	s.Lock()
+	defer s.Unlock()
+	s.turnLog.sentBytes += int64(size)
+	s.turnLog.anchorPos = -1
+	if s.recorder != nil {
+		s.turnLog.anchorPos = s.recorder.position()
+	}
+}
+
+// base64Size returns the decoded length of a padded base64 payload
+func base64Size(payload string) int {
+	return len(payload)*3/4 - (len(payload) - len(strings.TrimRight(payload, "=")))
+}
+
+// recordingOffset maps a time on the input buffer clock to a caller-track
+// byte offset, or -1 when the call is not recorded; the caller must hold the lock
+func (s *Session) recordingOffset(bufferMs int64) int64 {
+	if s.recorder == nil || s.turnLog.anchorPos < 0 {
+		return -1
+	}
+	return max(0, s.turnLog.anchorPos-(s.turnLog.sentBytes-bufferMs*bytesPerMs))
+}
+
+// callerSpeechStarted opens a caller turn when the server VAD detects speech
+func (s *Session) callerSpeechStarted(itemID string, audioStartMs int64) {
+	s.Lock()
+	defer s.Unlock()
+	turn := Turn{Speaker: SpeakerCaller, ItemID: itemID, StartedAt: time.Now().UTC(), AudioStart: s.recordingOffset(audioStartMs), AudioEnd: -1}
+	if open := s.turnLog.assistantOpen; open >= 0 {
+		s.turnLog.turns[open].Interrupted = true
+		turn.BargeIn = true
+	}
+	s.openTurn(turn)
+}
+
+// callerSpeechStopped closes the caller turn when the server VAD detects silence
+func (s *Session) callerSpeechStopped(itemID string, audioEndMs int64) {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now().UTC()
+	s.turnLog.callerEndedAt = now
+	if turn := s.findTurn(SpeakerCaller, itemID); turn != nil {
+		turn.EndedAt = now
+		if turn.AudioStart >= 0 {
+			turn.AudioEnd = max(turn.AudioStart, s.recordingOffset(audioEndMs))
+		}
+	}
+}
+
+// assistantAudio extends the open assistant turn, opening one on the first delta
+func (s *Session) assistantAudio(offset int64, size int) {
+	s.Lock()
+	defer s.Unlock()
+	if s.turnLog.assistantOpen < 0 {
+		now := time.Now().UTC()
+		turn := Turn{Speaker: SpeakerAssistant, StartedAt: now, AudioStart: offset, AudioEnd: -1}
+		if !s.turnLog.callerEndedAt.IsZero() {
+			turn.LatencyMs = now.Sub(s.turnLog.callerEndedAt).Milliseconds()
+			s.turnLog.callerEndedAt = time.Time{}
+		}
+		s.turnLog.assistantOpen = s.openTurn(turn)
+	}
+	if offset >= 0 {
+		s.turnLog.turns[s.turnLog.assistantOpen].AudioEnd = offset + int64(size)
+	}
+}
+
+// responseFinished closes the assistant turn, marking cancelled responses as interrupted
+func (s *Session) responseFinished(message []byte) {
+	var done struct {
+		Response struct {
+			Status string `json:"status"`
+		} `json:"response"`
+	}
+	json.Unmarshal(message, &done)
+
+	s.Lock()
+	defer s.Unlock()
+	open := s.turnLog.assistantOpen
+	if open < 0 {
+		return
+	}
+	turn := &s.turnLog.turns[open]
+	turn.EndedAt = time.Now().UTC()
+	if done.Response.Status == "cancelled" {
+		turn.Interrupted = true
+	}
+	s.turnLog.assistantOpen = -1
+}
+
+// setTurnTranscript attaches a transcript to the matching turn
+func (s *Session) setTurnTranscript(speaker, itemID, text string) {
+	s.Lock()
+	defer s.Unlock()
+	if speaker == SpeakerAssistant {
+		// Assistant transcripts arrive before or after response.done; take the latest turn
+		itemID = ""
+	}
+	if turn := s.findTurn(speaker, itemID); turn != nil && turn.Transcript == "" {
+		turn.Transcript = text
+	}
+}
+
+// handleCallTurns serves GET /calls/:id/turns
+func handleCallTurns(c *gin.Context) {
+	record, ok := callStore.get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "call not found"})
+		return
+	}
+	turns := record.Turns
+	if turns == nil {
+		turns = []Turn{}
+	}
+	c.JSON(http.StatusOK, gin.H{"call_sid": record.CallSid, "recording": record.Recording, "turns": turns})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const twilioAPIURL = "https://api.twilio.com/2010-04-01"
+
+// twilioRequest posts a form to the Twilio REST API with account credentials
+func twilioRequest(path string, form url.Values) error {
+	return twilioRequestJSON(path, form, nil)
+}
+
+// twilioRequestJSON posts a form to the Twilio REST API and decodes the JSON
+// response into out when non-nil
+func twilioRequestJSON(path string, form url.Values, out interface{}) error {
+	accountSid := getEnv("TWILIO_ACCOUNT_SID", "")
+	authToken := getEnv("TWILIO_AUTH_TOKEN", "")
+	if sandbox != nil {
+		accountSid, authToken = sandboxAccountSid, "sandbox"
+	}
+	if accountSid == "" || authToken == "" {
+		return fmt.Errorf("TWILIO_ACCOUNT_SID and TWILIO_AUTH_TOKEN are required")
+	}
+	endpoint := twilioAPIURL + "/Accounts/" + accountSid + path
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(accountSid, authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	started := time.Now()
+	err = doTwilio(req, path, out)
+	providerMetrics.record(ProviderTwilio, time.Since(started), err)
+	return err
+}
+
+// doTwilio sends a prepared Twilio request and checks the response status
+func doTwilio(req *http.Request, path string, out interface{}) error {
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return newStatusError("twilio "+path, resp)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// redirectCall replaces the live call's TwiML, ending the media stream
+func redirectCall(callSid, twiml string) error {
+	if callSid == "" {
+		return fmt.Errorf("no call SID for this session")
+	}
+	return twilioRequest("/Calls/"+callSid+".json", url.Values{"Twiml": {twiml}})
+}
+
+// transferCall dials a destination number on the live call
+func transferCall(callSid, number string) error {
+	twiml := `<Response><Dial>` + html.EscapeString(number) + `</Dial></Response>`
+	return redirectCall(callSid, twiml)
+}
+
+// sendSMS sends a text message from one of our numbers
+func sendSMS(from, to, body string) error {
+	return twilioRequest("/Messages.json", url.Values{"From": {from}, "To": {to}, "Body": {body}})
+}
+
+// placeCall starts an outbound call that Twilio connects to webhookURL once
+// answered, returning the new call's SID
+func placeCall(from, to, webhookURL string) (string, error) {
+	var created struct {
+		Sid string `json:"sid"`
+	}
+	err := twilioRequestJSON("/Calls.json", url.Values{"From": {from}, "To": {to}, "Url": {webhookURL}}, &created)
+	return created.Sid, err
+}
+
+// twilioSignature computes the X-Twilio-Signature of a webhook request: the
+// HMAC-SHA1 of the URL followed by the sorted POST parameters
+func twilioSignature(authToken, requestURL string, form url.Values) string {
+	keys := make([]string, 0, len(form))
+	for key := range form {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var buf strings.Builder
+	buf.WriteString(requestURL)
+	for _, key := range keys {
+		for _, value := range form[key] {
+			buf.WriteString(key + value)
+		}
+	}
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(buf.String()))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// webhookURL returns the URL Twilio requested, which behind a proxy is
+// PUBLIC_BASE_URL rather than the address the server sees
+func webhookURL(c *gin.Context) string {
+	if base := strings.TrimRight(getEnv("PUBLIC_BASE_URL", ""), "/"); base != "" {
+		return base + c.Request.URL.RequestURI()
+	}
+	scheme := "https"
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	} else if c.Request.TLS == nil {
+		scheme = "http"
+	}
+	return scheme + "://" + c.Request.Host + c.Request.URL.RequestURI()
+}
+
+// requireTwilioSignature rejects webhook requests that were not signed with
+// TWILIO_AUTH_TOKEN; the sandbox, which has no real token, is exempt
+func requireTwilioSignature() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if sandbox != nil {
+			c.Next()
+			return
+		}
+		authToken := getEnv("TWILIO_AUTH_TOKEN", "")
+		if authToken == "" {
+			log.Println("Rejecting webhook to", c.Request.URL.Path, "because TWILIO_AUTH_TOKEN is not set")
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		if err := c.Request.ParseForm(); err != nil {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		expected := twilioSignature(authToken, webhookURL(c), c.Request.PostForm)
+		if !hmac.Equal([]byte(c.GetHeader("X-Twilio-Signature")), []byte(expected)) {
+			log.Println("Rejecting webhook to", c.Request.URL.Path, "with an invalid Twilio signature")
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import "encoding/json"
+
+// Usage accumulates token counts reported by OpenAI in response.done events
+type Usage struct {
+	TextInputTokens   int `json:"text_input_tokens"`
+	AudioInputTokens  int `json:"audio_input_tokens"`
+	CachedInputTokens int `json:"cached_input_tokens"`
+	TextOutputTokens  int `json:"text_output_tokens"`
+	AudioOutputTokens int `json:"audio_output_tokens"`
+}
+
+// Pricing holds USD prices per million tokens
+type Pricing struct {
+	TextInput   float64
+	AudioInput  float64
+	CachedInput float64
+	TextOutput  float64
+	AudioOutput float64
+}
+
+// responseUsage mirrors the usage block of a response.done event
+type responseUsage struct {
+	Response struct {
+		Status string `json:"status"`
+		Usage  struct {
+			InputTokenDetails struct {
+				TextTokens   int `json:"text_tokens"`
+				AudioTokens  int `json:"audio_tokens"`
+				CachedTokens int `json:"cached_tokens"`
+			} `json:"input_token_details"`
+			OutputTokenDetails struct {
+				TextTokens  int `json:"text_tokens"`
+				AudioTokens int `json:"audio_tokens"`
+			} `json:"output_token_details"`
+		} `json:"usage"`
+	} `json:"response"`
+}
+
+// loadPricing reads per-million-token prices from the environment
+func loadPricing() Pricing {
+	return Pricing{
+		TextInput:   getEnvFloat("PRICE_TEXT_INPUT", 5),
+		AudioInput:  getEnvFloat("PRICE_AUDIO_INPUT", 100),
+		CachedInput: getEnvFloat("PRICE_CACHED_INPUT", 2.5),
+		TextOutput:  getEnvFloat("PRICE_TEXT_OUTPUT", 20),
+		AudioOutput: getEnvFloat("PRICE_AUDIO_OUTPUT", 200),
+	}
+}
+
+// add merges the usage block of a raw response.done event
+func (u *Usage) add(message []byte) {
+	var done responseUsage
+	if err := json.Unmarshal(message, &done); err != nil {
+		return
+	}
+	in := done.Response.Usage.InputTokenDetails
+	out := done.Response.Usage.OutputTokenDetails
+	u.TextInputTokens += in.TextTokens
+	u.AudioInputTokens += in.AudioTokens
+	u.CachedInputTokens += in.CachedTokens
+	u.TextOutputTokens += out.TextTokens
+	u.AudioOutputTokens += out.AudioTokens
+}
+
+// cost returns the USD cost of the usage under the given pricing; cached tokens
+// are a subset of the text input and billed at the cached rate
+func (u Usage) cost(p Pricing) float64 {
+	uncached := u.TextInputTokens - u.CachedInputTokens
+	if uncached < 0 {
+		uncached = 0
+	}
+	return (float64(uncached)*p.TextInput +
+		float64(u.AudioInputTokens)*p.AudioInput +
+		float64(u.CachedInputTokens)*p.CachedInput +
+		float64(u.TextOutputTokens)*p.TextOutput +
+		float64(u.AudioOutputTokens)*p.AudioOutput) / 1e6
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Supported address validation providers
+const (
+	AddressGoogle = "google"
+	AddressSmarty = "smarty"
+)
+
+const (
+	googleAddressValidationURL = "https://addressvalidation.googleapis.com/v1:validateAddress"
+	smartyStreetURL            = "https://us-street.api.smarty.com/street-address"
+)
+
+// AddressResult is a provider's verdict on a spoken address
+type AddressResult struct {
+	Input     string   `json:"input"`
+	Formatted string   `json:"formatted,omitempty"`
+	Valid     bool     `json:"valid"`
+	Corrected bool     `json:"corrected,omitempty"`
+	Problems  []string `json:"problems,omitempty"`
+}
+
+// EmailResult is the verdict on a spoken email address
+type EmailResult struct {
+	Input      string `json:"input"`
+	Address    string `json:"address,omitempty"`
+	Valid      bool   `json:"valid"`
+	Suggestion string `json:"suggestion,omitempty"`
+	Problem    string `json:"problem,omitempty"`
+}
+
+// addressProvider returns the configured address validation provider, or ""
+func addressProvider() string {
+	return getEnv("ADDRESS_VALIDATION_PROVIDER", "")
+}
+
+// validateAddress standardizes an address with the configured provider
+func validateAddress(address, country string) (AddressResult, error) {
+	started := time.Now()
+	var result AddressResult
+	var err error
+	switch provider := addressProvider(); provider {
+	case AddressGoogle:
+		result, err = validateAddressGoogle(address, country)
+	case AddressSmarty:
+		result, err = validateAddressSmarty(address)
+	case "":
+		return AddressResult{}, fmt.Errorf("address validation is not configured")
+	default:
+		return AddressResult{}, fmt.Errorf("unknown ADDRESS_VALIDATION_PROVIDER %q", provider)
+	}
+	providerMetrics.record(ProviderAddressValidation, time.Since(started), err)
+	result.Input = address
+	if result.Formatted != "" && !strings.EqualFold(normalizeSpaces(result.Formatted), normalizeSpaces(address)) {
+		result.Corrected = true
+	}
+	return result, err
+}
+
+// validateAddressGoogle uses the Google Maps Address Validation API
+func validateAddressGoogle(address, country string) (AddressResult, error) {
+	request := map[string]interface{}{
+		"address": map[string]interface{}{
+			"regionCode":   country,
+			"addressLines": []string{address},
+		},
+	}
+	var resp struct {
+		Result struct {
+			Verdict struct {
+				AddressComplete          bool `json:"addressComplete"`
+				HasUnconfirmedComponents bool `json:"hasUnconfirmedComponents"`
+			} `json:"verdict"`
+			Address struct {
+				FormattedAddress          string   `json:"formattedAddress"`
+				MissingComponentTypes     []string `json:"missingComponentTypes"`
+				UnconfirmedComponentTypes []string `json:"unconfirmedComponentTypes"`
+			} `json:"address"`
+		} `json:"result"`
+	}
+	headers := map[string]string{"X-Goog-Api-Key": getEnv("GOOGLE_MAPS_API_KEY", "")}
+	if err := doJSON(http.MethodPost, getEnv("GOOGLE_ADDRESS_VALIDATION_URL", googleAddressValidationURL), request, headers, &resp); err != nil {
+		return AddressResult{}, err
+	}
+	result := AddressResult{Formatted: resp.Result.Address.FormattedAddress}
+	for _, missing := range resp.Result.Address.MissingComponentTypes {
+		result.Problems = append(result.Problems, "missing "+strings.ReplaceAll(missing, "_", " "))
+	}
+	for _, unconfirmed := range resp.Result.Address.UnconfirmedComponentTypes {
+		result.Problems = append(result.Problems, "could not confirm "+strings.ReplaceAll(unconfirmed, "_", " "))
+	}
+	result.Valid = resp.Result.Verdict.AddressComplete && !resp.Result.Verdict.HasUnconfirmedComponents
+	return result, nil
+}
+
+// validateAddressSmarty uses the Smarty US street address API
+func validateAddressSmarty(address string) (AddressResult, error) {
+	query := url.Values{
+		"auth-id":    {getEnv("SMARTY_AUTH_ID", "")},
+		"auth-token": {getEnv("SMARTY_AUTH_TOKEN", "")},
+		"street":     {address},
+		"candidates": {"1"},
+		"match":      {"enhanced"},
+	}
+	req, err := http.NewRequest(http.MethodGet, getEnv("SMARTY_URL", smartyStreetURL)+"?"+query.Encode(), nil)
+	if err != nil {
+		return AddressResult{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		// The request URL carries the credentials; keep it out of logs
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return AddressResult{}, fmt.Errorf("smarty: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return AddressResult{}, newStatusError("smarty", resp)
+	}
+	var candidates []struct {
+		DeliveryLine1 string `json:"delivery_line_1"`
+		DeliveryLine2 string `json:"delivery_line_2"`
+		LastLine      string `json:"last_line"`
+		Analysis      struct {
+			DPVMatchCode string `json:"dpv_match_code"`
+		} `json:"analysis"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&candidates); err != nil {
+		return AddressResult{}, err
+	}
+	if len(candidates) == 0 {
+		return AddressResult{Problems: []string{"address not found"}}, nil
+	}
+	candidate := candidates[0]
+	lines := []string{candidate.DeliveryLine1}
+	if candidate.DeliveryLine2 != "" {
+		lines = append(lines, candidate.DeliveryLine2)
+	}
+	result := AddressResult{Formatted: strings.Join(append(lines, candidate.LastLine), ", ")}
+	// Y is a confirmed delivery point; S and D need the apartment or suite
+	switch candidate.Analysis.DPVMatchCode {
+	case "Y":
+		result.Valid = true
+	case "S":
+		result.Problems = []string{"could not confirm apartment or suite"}
+	case "D":
+		result.Problems = []string{"missing apartment or suite"}
+	default:
+		result.Problems = []string{"address not found"}
+	}
+	return result, nil
+}
+
+// normalizeSpaces collapses whitespace and commas for comparing addresses
+func normalizeSpaces(s string) string {
+	return strings.Join(strings.Fields(strings.ReplaceAll(s, ",", " ")), " ")
+}
+
+// emailDomainTypos maps common misspellings to the domains callers meant
+var emailDomainTypos = map[string]string{
+	"gmial.com": "gmail.com", "gmai.com": "gmail.com", "gmail.co": "gmail.com", "gamil.com": "gmail.com", "gmal.com": "gmail.com",
+	"hotmial.com": "hotmail.com", "hotmai.com": "hotmail.com", "hotmail.co": "hotmail.com",
+	"yahooo.com": "yahoo.com", "yaho.com": "yahoo.com", "yahoo.co": "yahoo.com",
+	"outlok.com": "outlook.com", "outlook.co": "outlook.com", "iclod.com": "icloud.com", "icloud.co": "icloud.com",
+}
+
+// spokenEmail rewrites a dictated address ("jane dot doe at gmail dot com")
+// into its written form
+func spokenEmail(text string) string {
+	replacer := strings.NewReplacer(
+		" at sign ", "@", " at ", "@", " dot ", ".", " period ", ".",
+		" underscore ", "_", " dash ", "-", " hyphen ", "-", " plus ", "+",
+	)
+	text = replacer.Replace(" " + strings.ToLower(strings.TrimSpace(text)) + " ")
+	return strings.Join(strings.Fields(text), "")
+}
+
+// validateEmail checks an email address's syntax and that its domain accepts
+// mail, suggesting a correction for common domain typos
+func validateEmail(raw string) EmailResult {
+	result := EmailResult{Input: raw}
+	written := spokenEmail(raw)
+	parsed, err := mail.ParseAddress(written)
+	if err != nil || parsed.Address != written {
+		result.Problem = "that is not a valid email address"
+		return result
+	}
+	at := strings.LastIndex(written, "@")
+	local, domain := written[:at], written[at+1:]
+	if !strings.Contains(domain, ".") {
+		result.Problem = "the domain after the @ is incomplete"
+		return result
+	}
+	if fixed, ok := emailDomainTypos[domain]; ok {
+		result.Suggestion = local + "@" + fixed
+		result.Problem = "the domain looks misspelled"
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if _, err := net.DefaultResolver.LookupMX(ctx, domain); err != nil {
+		// Only a domain that does not exist is rejected; resolver trouble
+		// should not stop the call
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			if _, err := net.DefaultResolver.LookupHost(ctx, domain); err != nil {
+				result.Problem = "the domain " + domain + " does not receive email"
+				return result
+			}
+		}
+	}
+	result.Address = written
+	result.Valid = true
+	return result
+}
+
+func init() {
+	registerTool(&Tool{
+		Name:        "validate_address",
+		Description: "Check and standardize a postal address the caller gave. Read the standardized address back to the caller and ask about any problems before using it.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"address": map[string]interface{}{"type": "string", "description": "The full address as the caller said it"},
+			},
+			"required": []string{"address"},
+		},
+		Available: func(s *Session) bool { return addressProvider() != "" },
+		Handler: func(s *Session, args json.RawMessage) (interface{}, error) {
+			var params struct {
+				Address string `json:"address"`
+			}
+			if err := json.Unmarshal(args, &params); err != nil {
+				return nil, err
+			}
+			return validateAddress(params.Address, countryForNumber(s.from))
+		},
+	})
+	registerTool(&Tool{
+		Name:        "validate_email",
+		Description: "Check an email address the caller spelled out. If a correction is suggested, ask the caller whether they meant it.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"email": map[string]interface{}{"type": "string", "description": "The email address as the caller spelled it"},
+			},
+			"required": []string{"email"},
+		},
+		Available: func(s *Session) bool { return getEnvBool("EMAIL_VALIDATION", false) },
+		Handler: func(s *Session, args json.RawMessage) (interface{}, error) {
+			var params struct {
+				Email string `json:"email"`
+			}
+			if err := json.Unmarshal(args, &params); err != nil {
+				return nil, err
+			}
+			return validateEmail(params.Email), nil
+		},
+	})
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/http"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// version and commit are set at build time with
+// -ldflags "-X main.version=1.2.3 -X main.commit=abc123"; commit otherwise
+// falls back to the VCS stamp Go embeds in the binary
+var (
+	version = "dev"
+	commit  = ""
+)
+
+// processStarted is when this instance came up
+var processStarted = time.Now().UTC()
+
+// BuildInfo identifies the running binary
+type BuildInfo struct {
+	Version   string    `json:"version"`
+	Commit    string    `json:"commit,omitempty"`
+	BuiltAt   string    `json:"built_at,omitempty"`
+	Modified  bool      `json:"modified,omitempty"`
+	GoVersion string    `json:"go_version"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// Capabilities lists what this deployment is configured to do
+type Capabilities struct {
+	Backends map[string]string `json:"backends"`
+	Adapters map[string]bool   `json:"adapters"`
+	Codecs   CodecSupport      `json:"codecs"`
+	Tools    []string          `json:"tools"`
+	Flags    []string          `json:"active_flags"`
+}
+
+// CodecSupport describes the audio formats accepted on calls and uploads
+type CodecSupport struct {
+	Call         string   `json:"call"`
+	SampleRate   int      `json:"sample_rate"`
+	AssetUploads []string `json:"asset_uploads"`
+}
+
+// buildInfo reads the version stamped into the binary
+func buildInfo() BuildInfo {
+	info := BuildInfo{Version: version, Commit: commit, GoVersion: runtime.Version(), StartedAt: processStarted}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				info.BuiltAt = setting.Value
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	return info
+}
+
+// capabilities reports the configured backends and adapters; it names
+// providers but never exposes endpoints or credentials
+func capabilities() Capabilities {
+	voiceprint, _ := voiceprintProvider()
+	crmProviders := map[string]bool{}
+	tenants.RLock()
+	for _, tenant := range tenants.tenants {
+		if tenant.CRM != nil {
+			crmProviders[tenant.CRM.Provider] = true
+		}
+	}
+	tenants.RUnlock()
+	_, s3 := loadS3Config()
+	_, ffmpegErr := exec.LookPath(getEnv("FFMPEG_PATH", "ffmpeg"))
+	residency.Lock()
+	regions := len(residency.regions)
+	residency.Unlock()
+
+	realtimeBackend, speechBackend := "openai", "openai"
+	if sandbox != nil {
+		realtimeBackend, speechBackend = "mock", "mock"
+	}
+	caps := Capabilities{
+		Backends: map[string]string{
+			"realtime":           realtimeBackend,
+			"speech":             speechBackend,
+			"voiceprint":         voiceprint,
+			"address_validation": addressProvider(),
+		},
+		Adapters: map[string]bool{
+			"redis":            fleet.redis != nil,
+			"fleet_router":     fleet.router,
+			"ha":               ha != nil,
+			"s3_exports":       s3,
+			"dnc_registry":     getEnv("DNC_REGISTRY_URL", "") != "",
+			"email_validation": getEnvBool("EMAIL_VALIDATION", false),
+			"ffmpeg":           ffmpegErr == nil,
+			"regions":          regions > 0,
+			"sandbox":          sandbox != nil,
+		},
+		Codecs: CodecSupport{
+			Call:         "g711_alaw",
+			SampleRate:   bytesPerSecond,
+			AssetUploads: []string{"audio/x-alaw-basic", "audio/wav (pcm 8/16/24-bit, float32, alaw, ulaw)"},
+		},
+		Tools: []string{},
+		Flags: []string{},
+	}
+	for name := range crmProviders {
+		caps.Adapters["crm_"+name] = true
+	}
+	if ffmpegErr == nil {
+		caps.Codecs.AssetUploads = append(caps.Codecs.AssetUploads, "any format ffmpeg decodes")
+	}
+	toolsMu.RLock()
+	for name := range toolSet {
+		caps.Tools = append(caps.Tools, name)
+	}
+	toolsMu.RUnlock()
+	sort.Strings(caps.Tools)
+	for _, flag := range featureFlags.list() {
+		if flag.Enabled {
+			caps.Flags = append(caps.Flags, flag.Name)
+		}
+	}
+	return caps
+}
+
+// handleVersion serves GET /version; it is public, so it only names the
+// version, leaving the build and the configuration to /admin/version
+func handleVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"version": version})
+}
+
+// handleVersionDetails serves GET /admin/version
+func handleVersionDetails(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"build": buildInfo(), "capabilities": capabilities()})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxTranscriptionPrompt keeps the vocabulary within the transcription
+// model's prompt window
+const maxTranscriptionPrompt = 800
+
+// transcriptionPrompt lists the agent's vocabulary so the transcription model
+// recognizes domain terms, or "" without any
+func (a *Agent) transcriptionPrompt() string {
+	if len(a.Vocabulary) == 0 {
+		return ""
+	}
+	prompt := "Vocabulary:"
+	for i, term := range a.Vocabulary {
+		next := " " + term
+		if i > 0 {
+			next = "," + next
+		}
+		if len(prompt)+len(next) > maxTranscriptionPrompt {
+			break
+		}
+		prompt += next
+	}
+	return prompt + "."
+}
+
+// vocabularyInstructions tells the model how to recognize and say the
+// agent's domain terms
+func (a *Agent) vocabularyInstructions() string {
+	var b strings.Builder
+	if len(a.Vocabulary) > 0 {
+		b.WriteString("Callers may use these terms, which may be mistranscribed; interpret similar-sounding words as these and write them exactly as shown: ")
+		b.WriteString(strings.Join(a.Vocabulary, ", "))
+		b.WriteString(".")
+	}
+	if len(a.Pronunciations) > 0 {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("When you say these terms aloud, pronounce them as follows:")
+		for _, term := range sortedKeys(a.Pronunciations) {
+			b.WriteString("\n- " + term + ": say \"" + a.Pronunciations[term] + "\"")
+		}
+	}
+	return b.String()
+}
+
+// pronounce rewrites text for speech synthesis using the agent's
+// pronunciation hints; longer terms are replaced first so they win over
+// terms they contain
+func (a *Agent) pronounce(text string) string {
+	if len(a.Pronunciations) == 0 {
+		return text
+	}
+	terms := sortedKeys(a.Pronunciations)
+	sort.SliceStable(terms, func(i, j int) bool { return len(terms[i]) > len(terms[j]) })
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+	pattern, err := regexp.Compile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`)
+	if err != nil {
+		return text
+	}
+	lookup := make(map[string]string, len(terms))
+	for term, hint := range a.Pronunciations {
+		lookup[strings.ToLower(term)] = hint
+	}
+	return pattern.ReplaceAllStringFunc(text, func(match string) string {
+		return lookup[strings.ToLower(match)]
+	})
+}
+
+// sortedKeys returns a map's keys in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Webhook event names
+const (
+	EventCallCompleted = "call.completed"
+	EventCallFailed    = "call.failed"
+	EventVoicemailLeft = "voicemail.left"
+)
+
+// Webhook payload formats
+const (
+	FormatStandard = "standard"
+	FormatFlat     = "flat"
+)
+
+// WebhookSubscription is one endpoint receiving call events
+type WebhookSubscription struct {
+	// ID is a stable key for subscriptions managed through the admin API;
+	// subscriptions from WEBHOOKS_FILE without one are numbered
+	ID     string   `json:"id,omitempty"`
+	URL    string   `json:"url"`
+	Format string   `json:"format"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret,omitempty"`
+}
+
+// WebhookDispatcher delivers call events to subscribed endpoints
+type WebhookDispatcher struct {
+	sync.RWMutex
+	subscriptions []WebhookSubscription
+
+	// managed holds subscriptions declared through the admin API exactly as
+	// declared; they are saved to DATA_DIR
+	path    string
+	managed map[string]WebhookSubscription
+}
+
+// newWebhookDispatcher loads subscriptions from WEBHOOKS_FILE, the WEBHOOK_*
+// shortcut variables and those declared through the admin API
+func newWebhookDispatcher() *WebhookDispatcher {
+	d := &WebhookDispatcher{path: dataPath("webhooks.json"), managed: make(map[string]WebhookSubscription)}
+	if _, err := loadJSONFile("WEBHOOKS_FILE", &d.subscriptions); err != nil {
+		log.Println("Error loading WEBHOOKS_FILE:", err)
+	}
+	if url := getEnv("WEBHOOK_URL", ""); url != "" {
+		d.subscriptions = append(d.subscriptions, WebhookSubscription{
+			ID:     "env",
+			URL:    url,
+			Format: getEnv("WEBHOOK_FORMAT", FormatStandard),
+			Events: getEnvList("WEBHOOK_EVENTS"),
+			Secret: getEnv("WEBHOOK_SECRET", ""),
+		})
+	}
+	for i := range d.subscriptions {
+		sub := &d.subscriptions[i]
+		if sub.ID == "" {
+			sub.ID = fmt.Sprintf("file-%d", i+1)
+		}
+		*sub = sub.withDefaults()
+	}
+	var saved []WebhookSubscription
+	if err := readJSONFile(d.path, &saved); err != nil {
+		log.Println("Error loading saved webhooks:", err)
+	}
+	for _, spec := range saved {
+		if spec.ID != "" && !d.inFile(spec.ID) {
+			d.managed[spec.ID] = spec
+		}
+	}
+	return d
+}
+
+// withDefaults fills in the standard format and all events
+func (sub WebhookSubscription) withDefaults() WebhookSubscription {
+	if sub.Format != FormatFlat {
+		sub.Format = FormatStandard
+	}
+	if len(sub.Events) == 0 {
+		sub.Events = []string{"*"}
+	}
+	return sub
+}
+
+// inFile reports whether a subscription ID comes from WEBHOOKS_FILE or the
+// environment
+func (d *WebhookDispatcher) inFile(id string) bool {
+	for _, sub := range d.subscriptions {
+		if sub.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// active returns every subscription events are delivered to
+func (d *WebhookDispatcher) active() []WebhookSubscription {
+	d.RLock()
+	defer d.RUnlock()
+	list := append([]WebhookSubscription{}, d.subscriptions...)
+	for _, id := range d.managedIDsLocked() {
+		list = append(list, d.managed[id].withDefaults())
+	}
+	return list
+}
+
+// spec returns a subscription as declared
+func (d *WebhookDispatcher) spec(id string) (WebhookSubscription, bool) {
+	for _, sub := range d.specs() {
+		if sub.ID == id {
+			return sub, true
+		}
+	}
+	return WebhookSubscription{}, false
+}
+
+// specs returns every subscription as declared, file subscriptions first
+func (d *WebhookDispatcher) specs() []WebhookSubscription {
+	d.RLock()
+	defer d.RUnlock()
+	list := append([]WebhookSubscription{}, d.subscriptions...)
+	for _, id := range d.managedIDsLocked() {
+		list = append(list, d.managed[id])
+	}
+	return list
+}
+
+// plan reports what putting the spec would do
+func (d *WebhookDispatcher) plan(spec WebhookSubscription) (string, error) {
+	d.RLock()
+	defer d.RUnlock()
+	return d.planLocked(spec)
+}
+
+// planLocked is plan with the dispatcher locked
+func (d *WebhookDispatcher) planLocked(spec WebhookSubscription) (string, error) {
+	if d.inFile(spec.ID) {
+		return "", fmt.Errorf("webhook %s is defined in WEBHOOKS_FILE or WEBHOOK_URL", spec.ID)
+	}
+	current, ok := d.managed[spec.ID]
+	return changeAction(ok, current, spec), nil
+}
+
+// put creates or replaces a managed subscription
+func (d *WebhookDispatcher) put(spec WebhookSubscription) (string, error) {
+	d.Lock()
+	action, err := d.planLocked(spec)
+	if err != nil || action == ChangeUnchanged {
+		d.Unlock()
+		return action, err
+	}
+	d.managed[spec.ID] = spec
+	d.Unlock()
+	return action, d.save()
+}
+
+// remove deletes a managed subscription
+func (d *WebhookDispatcher) remove(id string) (bool, error) {
+	d.Lock()
+	_, ok := d.managed[id]
+	delete(d.managed, id)
+	d.Unlock()
+	if !ok {
+		return false, nil
+	}
+	return true, d.save()
+}
+
+// managedIDs returns the IDs of subscriptions declared through the admin API
+func (d *WebhookDispatcher) managedIDs() []string {
+	d.RLock()
+	defer d.RUnlock()
+	return d.managedIDsLocked()
+}
+
+// managedIDsLocked is managedIDs with the dispatcher locked
+func (d *WebhookDispatcher) managedIDsLocked() []string {
+	ids := make([]string, 0, len(d.managed))
+	for id := range d.managed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// save writes the managed subscriptions to DATA_DIR
+func (d *WebhookDispatcher) save() error {
+	d.RLock()
+	list := make([]WebhookSubscription, 0, len(d.managed))
+	for _, id := range d.managedIDsLocked() {
+		list = append(list, d.managed[id])
+	}
+	d.RUnlock()
+	return writeJSONFile(d.path, list)
+}
+
+// wants reports whether the subscription covers the event; "*" catches everything
+func (sub WebhookSubscription) wants(event string) bool {
+	for _, e := range sub.Events {
+		if e == "*" || e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// send delivers the event to every matching subscription in the background
+func (d *WebhookDispatcher) send(event string, data interface{}) {
+	id := newEventID()
+	now := time.Now().UTC()
+	for _, sub := range d.active() {
+		if !sub.wants(event) {
+			continue
+		}
+		payload, err := buildWebhookPayload(sub.Format, id, event, now, data)
+		if err != nil {
+			log.Printf("Error building %s webhook payload: %v\n", event, err)
+			continue
+		}
+		go deliverWebhook(sub, event, payload)
+	}
+}
+
+// deliverWebhook posts a payload, signing it when the subscription has a secret
+func deliverWebhook(sub WebhookSubscription, event string, payload map[string]interface{}) {
+	headers := map[string]string{"X-Webhook-Event": event}
+	if sub.Secret != "" {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			log.Println("Error marshaling webhook payload:", err)
+			return
+		}
+		mac := hmac.New(sha256.New, []byte(sub.Secret))
+		mac.Write(body)
+		headers["X-Webhook-Signature"] = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	if err := postJSON(sub.URL, payload, headers); err != nil {
+		log.Printf("Error delivering %s webhook: %v\n", event, err)
+	}
+}
+
+// buildWebhookPayload wraps the data in the standard envelope or flattens it
+func buildWebhookPayload(format, id, event string, at time.Time, data interface{}) (map[string]interface{}, error) {
+	payload := map[string]interface{}{
+		"id":         id,
+		"event":      event,
+		"created_at": at.Format(time.RFC3339),
+	}
+	if format != FormatFlat {
+		payload["data"] = data
+		return payload, nil
+	}
+
+	// Round-trip through JSON so the flat keys follow the JSON tags
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var nested map[string]interface{}
+	if err := json.Unmarshal(raw, &nested); err != nil {
+		return nil, err
+	}
+	flattenInto(payload, "", nested)
+	return payload, nil
+}
+
+// flattenInto copies nested values into out using underscore-joined keys;
+// lists become comma-separated strings so every field is a scalar
+func flattenInto(out map[string]interface{}, prefix string, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, inner := range v {
+			key := k
+			if prefix != "" {
+				key = prefix + "_" + k
+			}
+			flattenInto(out, key, inner)
+		}
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				parts = append(parts, s)
+				continue
+			}
+			b, _ := json.Marshal(item)
+			parts = append(parts, string(b))
+		}
+		out[prefix] = strings.Join(parts, ",")
+	default:
+		out[prefix] = v
+	}
+}
+
+// newEventID returns a random identifier for a webhook delivery
+func newEventID() string {
+	return newID("evt")
+}
+
+// newID returns a random identifier with a type prefix
+func newID(prefix string) string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%s_%d", prefix, time.Now().UnixNano())
+	}
+	return prefix + "_" + hex.EncodeToString(b)
+}
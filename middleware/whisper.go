@@ -0,0 +1,411 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Whisper modes
+const (
+	WhisperTranslate = "translate"
+	WhisperSuggest   = "suggest"
+)
+
+// Legs of a whisper conference the model can listen to, and where its
+// whispers can go
+const (
+	LegCaller = "caller"
+	LegAgent  = "agent"
+	LegBoth   = "both"
+	LegNone   = "none"
+)
+
+// whisperMixFrames is how many frames one leg may run ahead of the other
+// before it is sent unmixed
+const whisperMixFrames = 5
+
+// WhisperConfig bridges an agent's callers to a human agent in a conference.
+// The model listens without speaking, and what it would say is whispered to
+// the human agent's leg only: translations of the caller, or suggestions
+type WhisperConfig struct {
+	// Mode is translate (default) or suggest
+	Mode string `json:"mode,omitempty"`
+
+	// Language is the human agent's, e.g. "en-US"; translations are into it
+	// and whispers are read out in it
+	Language string `json:"language,omitempty"`
+
+	// AgentNumber is the number, client:name or sip: address of the human agent
+	AgentNumber string `json:"agent_number"`
+
+	// Listen is the leg the model hears: caller (default), agent or both
+	Listen string `json:"listen,omitempty"`
+}
+
+// WhisperControls are a whisper call's per-leg audio routing, adjustable
+// while the call is live
+type WhisperControls struct {
+	// Listen is caller, agent or both
+	Listen string `json:"listen"`
+	// Deliver is agent to whisper to the human agent's leg, or none to only
+	// stream whispers to co-pilots
+	Deliver string `json:"deliver"`
+	// Paused stops the model hearing either leg
+	Paused bool `json:"paused"`
+}
+
+// WhisperSummary records a whisper call's bridge in the CDR
+type WhisperSummary struct {
+	Mode         string `json:"mode"`
+	Conference   string `json:"conference"`
+	AgentCallSid string `json:"agent_call_sid,omitempty"`
+	Whispers     int    `json:"whispers"`
+	Dropped      int    `json:"dropped"`
+}
+
+// WhisperStatus is a live whisper call's bridge as the API returns it
+type WhisperStatus struct {
+	WhisperSummary
+	WhisperControls
+}
+
+// whisperBridge is the state of one whisper call
+type whisperBridge struct {
+	sync.Mutex
+	config        WhisperConfig
+	controls      WhisperControls
+	conference    string
+	conferenceSid string
+	agentCallSid  string
+	lines         []string
+	delivered     int
+	dropped       int
+
+	// token is carried by the announce URLs Twilio fetches, which read out
+	// what the caller said; without it the whispers are not served
+	token string
+
+	// frames waiting to be mixed, per track
+	inbound, outbound [][]byte
+}
+
+// newWhisperBridge prepares the bridge of a call
+func newWhisperBridge(config WhisperConfig, callSid string) *whisperBridge {
+	listen := config.Listen
+	if listen != LegAgent && listen != LegBoth {
+		listen = LegCaller
+	}
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		log.Printf("Error generating the whisper token for %s: %v\n", callSid, err)
+		token = nil
+	}
+	return &whisperBridge{
+		config:     config,
+		controls:   WhisperControls{Listen: listen, Deliver: LegAgent},
+		conference: "whisper-" + callSid,
+		token:      hex.EncodeToString(token),
+	}
+}
+
+// mode returns the bridge's whisper mode
+func (config WhisperConfig) mode() string {
+	if config.Mode == WhisperSuggest {
+		return WhisperSuggest
+	}
+	return WhisperTranslate
+}
+
+// whisperTwiML forks both directions of the caller's audio to the media
+// stream and puts the caller in the conference the human agent is dialed into
+func whisperTwiML(c *gin.Context, greeting string) string {
+	callSid := c.Request.FormValue("CallSid")
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<Response>
+    ` + greeting + `
+    <Start>
+        <Stream url="` + html.EscapeString(fleet.mediaStreamURL(c.Request.Host, c.Request.FormValue("CallSid"))) + `" track="both_tracks">` + streamParameters(c) + `
+            <Parameter name="Whisper" value="true" />
+        </Stream>
+    </Start>
+    <Dial>
+        <Conference startConferenceOnEnter="true" endConferenceOnExit="true" beep="false">` + html.EscapeString("whisper-"+callSid) + `</Conference>
+    </Dial>
+</Response>`
+}
+
+// whisperInstructions replace the agent's instructions on whisper calls; the
+// agent's own instructions are kept as background
+func whisperInstructions(config WhisperConfig, agent *Agent, locale Locale) string {
+	language := config.Language
+	if language == "" {
+		language = "the human agent's language"
+	}
+	var text string
+	if config.mode() == WhisperSuggest {
+		text = "You are listening to a phone call between a caller and a human agent. You never speak to the caller. " +
+			"After each thing the caller says, reply with one short suggestion, in " + language + ", of what the human agent could say or do next. " +
+			"Reply with nothing else."
+	} else {
+		text = "You are a silent interpreter on a phone call between a caller and a human agent. You never speak to the caller. " +
+			"Translate each thing the caller says into " + language + ", faithfully and concisely. " +
+			"If the caller already speaks " + language + ", reply with nothing. Reply with only the translation."
+	}
+	text += "\n\nBackground on the business the human agent works for:\n" + agent.instructionsFor(locale.Language)
+	if vocabulary := agent.vocabularyInstructions(); vocabulary != "" {
+		text += "\n\n" + vocabulary
+	}
+	return text
+}
+
+// startWhisper dials the human agent into the call's conference
+func (s *Session) startWhisper() {
+	w := s.whisper
+	form := url.Values{
+		"From":                {s.to},
+		"To":                  {w.config.AgentNumber},
+		"EarlyMedia":          {"false"},
+		"EndConferenceOnExit": {"false"},
+		"Beep":                {"false"},
+	}
+	var participant struct {
+		CallSid       string `json:"call_sid"`
+		ConferenceSid string `json:"conference_sid"`
+	}
+	err := twilioRequestJSON("/Conferences/"+url.PathEscape(w.conference)+"/Participants.json", form, &participant)
+	if err != nil {
+		log.Printf("Error dialing the human agent into %s: %v\n", w.conference, err)
+		return
+	}
+	w.Lock()
+	w.agentCallSid, w.conferenceSid = participant.CallSid, participant.ConferenceSid
+	w.Unlock()
+	log.Printf("Dialed human agent %s into %s\n", participant.CallSid, w.conference)
+}
+
+// forwardWhisperAudio sends the legs the model listens to, mixing them when
+// it listens to both; the caller's own leg is also recorded
+func (s *Session) forwardWhisperAudio(media map[string]interface{}, payload string) {
+	track, _ := media["track"].(string)
+	w := s.whisper
+	var frames [][]byte
+	s.stage(PathInbound, StageDSP, len(payload), func() error {
+		if track == "inbound" {
+			s.recordCallerAudio(media, payload)
+		}
+		w.Lock()
+		defer w.Unlock()
+		switch controls := w.controls; {
+		case controls.Paused:
+		case controls.Listen == LegCaller && track == "inbound", controls.Listen == LegAgent && track == "outbound":
+			if audio, err := base64.StdEncoding.DecodeString(payload); err == nil {
+				frames = append(frames, audio)
+			}
+		case controls.Listen == LegBoth:
+			frames = w.mix(track, payload)
+		}
+		return nil
+	})
+
+	for _, frame := range frames {
+		var data []byte
+		err := s.stage(PathInbound, StageEncode, len(frame), func() (err error) {
+			data, err = json.Marshal(map[string]interface{}{
+				"type":  "input_audio_buffer.append",
+				"audio": base64.StdEncoding.EncodeToString(frame),
+			})
+			return err
+		})
+		if err != nil {
+			continue
+		}
+		if err := s.stage(PathInbound, StageProvider, len(data), func() error { return s.writeOpenAI(data) }); err != nil {
+			log.Println("Error sending input_audio_buffer.append to OpenAI:", err)
+			return
+		}
+	}
+}
+
+// mix queues a frame of one leg and returns the frames ready to send: both
+// legs summed once each has a frame, or a leg alone once it runs ahead; the
+// caller holds the lock
+func (w *whisperBridge) mix(track, payload string) [][]byte {
+	audio, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil
+	}
+	if track == "outbound" {
+		w.outbound = append(w.outbound, audio)
+	} else {
+		w.inbound = append(w.inbound, audio)
+	}
+	var ready [][]byte
+	for len(w.inbound) > 0 && len(w.outbound) > 0 {
+		a, b := w.inbound[0], w.outbound[0]
+		w.inbound, w.outbound = w.inbound[1:], w.outbound[1:]
+		if len(b) > len(a) {
+			a, b = b, a
+		}
+		mixed := make([]byte, len(a))
+		for i := range a {
+			sample := int32(alawToLinear(a[i]))
+			if i < len(b) {
+				sample += int32(alawToLinear(b[i]))
+			}
+			sample = max(min(sample, 32767), -32768)
+			mixed[i] = linearToAlaw(int16(sample))
+		}
+		ready = append(ready, mixed)
+	}
+	for len(w.inbound) > whisperMixFrames {
+		ready, w.inbound = append(ready, w.inbound[0]), w.inbound[1:]
+	}
+	for len(w.outbound) > whisperMixFrames {
+		ready, w.outbound = append(ready, w.outbound[0]), w.outbound[1:]
+	}
+	return ready
+}
+
+// whisperText whispers a finished response to the human agent's leg by
+// having Twilio announce it to that participant only
+func (s *Session) whisperText(text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	w := s.whisper
+	w.Lock()
+	w.lines = append(w.lines, text)
+	n := len(w.lines) - 1
+	deliver := w.controls.Deliver == LegAgent && !w.controls.Paused
+	conferenceSid, agentCallSid := w.conferenceSid, w.agentCallSid
+	if deliver && (agentCallSid == "" || getEnv("PUBLIC_BASE_URL", "") == "") {
+		w.dropped++
+		deliver = false
+	}
+	w.Unlock()
+	if !deliver {
+		return
+	}
+	announce := strings.TrimRight(getEnv("PUBLIC_BASE_URL", ""), "/") + "/whisper/" + url.PathEscape(s.callSid) + "/" + strconv.Itoa(n) + "?token=" + w.token
+	form := url.Values{"AnnounceUrl": {announce}, "AnnounceMethod": {http.MethodGet}}
+	err := twilioRequest("/Conferences/"+conferenceSid+"/Participants/"+agentCallSid+".json", form)
+	w.Lock()
+	if err != nil {
+		w.dropped++
+	} else {
+		w.delivered++
+	}
+	w.Unlock()
+	if err != nil {
+		log.Printf("Error whispering to the human agent on %s: %v\n", s.callSid, err)
+	}
+}
+
+// summary returns the bridge for the CDR
+func (w *whisperBridge) summary() *WhisperSummary {
+	if w == nil {
+		return nil
+	}
+	w.Lock()
+	defer w.Unlock()
+	return &WhisperSummary{
+		Mode:         w.config.mode(),
+		Conference:   w.conference,
+		AgentCallSid: w.agentCallSid,
+		Whispers:     w.delivered,
+		Dropped:      w.dropped,
+	}
+}
+
+// handleWhisperAnnounce serves GET /whisper/:id/:n, the TwiML Twilio fetches
+// to read a whisper to the human agent; the URL must carry the call's token
+func handleWhisperAnnounce(c *gin.Context) {
+	c.Header("Content-Type", "text/xml")
+	s := fleet.findSession(c.Param("id"))
+	n, err := strconv.Atoi(c.Param("n"))
+	if s == nil || s.whisper == nil || err != nil {
+		c.String(http.StatusOK, `<?xml version="1.0" encoding="UTF-8"?><Response/>`)
+		return
+	}
+	if s.whisper.token == "" || subtle.ConstantTimeCompare([]byte(c.Query("token")), []byte(s.whisper.token)) != 1 {
+		c.String(http.StatusForbidden, `<?xml version="1.0" encoding="UTF-8"?><Response/>`)
+		return
+	}
+	s.whisper.Lock()
+	text, language := "", s.whisper.config.Language
+	if n >= 0 && n < len(s.whisper.lines) {
+		text = s.whisper.lines[n]
+	}
+	s.whisper.Unlock()
+	attrs := ""
+	if language != "" {
+		attrs = ` language="` + html.EscapeString(language) + `"`
+	}
+	c.String(http.StatusOK, `<?xml version="1.0" encoding="UTF-8"?><Response><Say`+attrs+`>`+html.EscapeString(text)+`</Say></Response>`)
+}
+
+// liveWhisper returns the bridge of a live whisper call, or answers 404
+func liveWhisper(c *gin.Context) *whisperBridge {
+	s := fleet.findSession(c.Param("id"))
+	if s == nil || s.whisper == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no live whisper call with that id on this instance"})
+		return nil
+	}
+	return s.whisper
+}
+
+// status returns the bridge as the API shows it
+func (w *whisperBridge) status() WhisperStatus {
+	summary := w.summary()
+	w.Lock()
+	defer w.Unlock()
+	return WhisperStatus{WhisperSummary: *summary, WhisperControls: w.controls}
+}
+
+// handleGetWhisper serves GET /calls/:id/whisper
+func handleGetWhisper(c *gin.Context) {
+	if w := liveWhisper(c); w != nil {
+		c.JSON(http.StatusOK, w.status())
+	}
+}
+
+// handlePutWhisper serves PUT /calls/:id/whisper, changing which legs the
+// model hears and where its whispers go
+func handlePutWhisper(c *gin.Context) {
+	w := liveWhisper(c)
+	if w == nil {
+		return
+	}
+	var controls WhisperControls
+	if err := c.ShouldBindJSON(&controls); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if controls.Listen != LegCaller && controls.Listen != LegAgent && controls.Listen != LegBoth {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("listen must be %s, %s or %s", LegCaller, LegAgent, LegBoth)})
+		return
+	}
+	if controls.Deliver != LegAgent && controls.Deliver != LegNone {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("deliver must be %s or %s", LegAgent, LegNone)})
+		return
+	}
+	w.Lock()
+	w.controls = controls
+	w.inbound, w.outbound = nil, nil
+	w.Unlock()
+	c.JSON(http.StatusOK, w.status())
+}